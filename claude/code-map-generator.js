@@ -4,6 +4,8 @@
  * Semantic Code Map Generator for Claude Desktop
  * Creates semantic tags and visualizations of code structure
  * Updated to use standardized DStudio utilities
+ * Files are annotated with their line coverage, uncovered line ranges and untested functions from
+ * the merged coverage model (npm run test:coverage, .cache/coverage/coverage.json)
  */
 
 const utils = require('../utils');
@@ -81,16 +83,18 @@ function getFileLanguage(filePath) {
 /**
  * Analyze a file to extract semantic information
  * @param {string} filePath - Path to the file
+ * @param {Object} coverageEntry - File entry of the coverage model, or null if the file has no coverage data
  * @returns {Promise<Object>} Analysis result
  */
-async function analyzeFile(filePath) {
+async function analyzeFile(filePath, coverageEntry = null) {
   const result = {
     path: filePath,
     language: null,
     elements: [],
     imports: [],
     dependencies: [],
-    tags: []
+    tags: [],
+    coverage: null
   };
   
   // Check if file exists
@@ -113,6 +117,11 @@ async function analyzeFile(filePath) {
   
   const content = fileResult.value;
   
+  // Coverage per file and per function
+  if (coverageEntry) {
+    result.coverage = utils.coverage.describeFile(coverageEntry, content, filePath);
+  }
+  
   // Add file type as a tag
   result.tags.push(result.language);
   
@@ -246,12 +255,28 @@ async function scanDirectory(dir, baseDir = '') {
   return files;
 }
 
+/**
+ * Summarize the coverage of a file on one line
+ * @param {Object} coverage - Result of utils.coverage.describeFile()
+ * @param {number} limit - Maximum number of ranges and functions to list
+ * @returns {Object} { uncovered, untested } as text, empty when there are none
+ */
+function describeCoverage(coverage, limit = 5) {
+  const list = (items, format) => `${items.slice(0, limit).map(format).join(', ')}${items.length > limit ? ` +${items.length - limit} more` : ''}`;
+  const untested = coverage.functions.filter(fn => !fn.tested);
+  return {
+    uncovered: coverage.uncovered.length > 0 ? list(coverage.uncovered, range => utils.coverage.formatRanges([range])) : '',
+    untested: untested.length > 0 ? list(untested, fn => `${fn.name} (L${fn.line})`) : ''
+  };
+}
+
 /**
  * Generate a semantic code map for a service
  * @param {string} serviceName - Name of the service
+ * @param {Object} coverageModel - Merged coverage model, or null if no coverage was collected
  * @returns {Promise<string>} Markdown content
  */
-async function generateCodeMap(serviceName) {
+async function generateCodeMap(serviceName, coverageModel = null) {
   const servicePath = utils.path.joinPath(IMPL_DIR, serviceName);
   
   if (!utils.path.pathExists(servicePath)) {
@@ -270,12 +295,26 @@ async function generateCodeMap(serviceName) {
   // Analyze each file
   const analyzedFiles = [];
   
+  const threshold = utils.coverage.getThreshold(serviceName);
+  const coverageTime = coverageModel ? new Date(coverageModel.generated).getTime() : 0;
+  
   for (const file of files) {
-    const analysis = await analyzeFile(file.path);
+    // Coverage paths are relative to the implementation directory
+    const key = path.relative(IMPL_DIR, file.path).split(path.sep).join('/');
+    const analysis = await analyzeFile(file.path, coverageModel?.files[key] || null);
     analysis.relativePath = file.relativePath;
+    
+    if (analysis.coverage) {
+      // Line numbers of files changed since the coverage run may have moved
+      const mtime = await utils.file.getModificationTime(file.path);
+      analysis.coverage.stale = mtime.success && mtime.value.getTime() > coverageTime;
+    }
+    
     analyzedFiles.push(analysis);
   }
   
+  const coveredFiles = analyzedFiles.filter(file => file.coverage && file.coverage.total > 0);
+  
   // Group files by language
   const filesByLanguage = {};
   const allTags = new Set();
@@ -310,6 +349,13 @@ async function generateCodeMap(serviceName) {
     lines.push(`- ${language}: ${files.length} files`);
   }
   
+  if (coveredFiles.length > 0) {
+    const covered = coveredFiles.reduce((sum, file) => sum + file.coverage.covered, 0);
+    const total = coveredFiles.reduce((sum, file) => sum + file.coverage.total, 0);
+    const percent = Math.round((covered / total) * 1000) / 10;
+    lines.push(`- coverage: ${utils.coverage.heatMarker(percent, threshold)} ${percent}% of ${total} lines in ${coveredFiles.length} files (threshold ${threshold}%, collected ${coverageModel.generated})`);
+  }
+  
   lines.push('');
   lines.push('## Tags');
   lines.push('');
@@ -362,7 +408,8 @@ async function generateCodeMap(serviceName) {
     current.__files.push({
       name: fileName,
       tags: file.tags,
-      elements: file.elements
+      elements: file.elements,
+      coverage: file.coverage
     });
   }
   
@@ -378,7 +425,16 @@ async function generateCodeMap(serviceName) {
     
     for (const file of files) {
       const tags = file.tags.map(tag => `#${tag}`).join(' ');
-      lines.push(`${prefix}📄 ${file.name} ${tags}`);
+      const coverage = file.coverage && file.coverage.total > 0
+        ? ` ${utils.coverage.heatMarker(file.coverage.percent, threshold)} ${file.coverage.percent}%${file.coverage.stale ? ' (edited since the coverage run)' : ''}`
+        : '';
+      lines.push(`${prefix}📄 ${file.name} ${tags}${coverage}`);
+      
+      if (coverage) {
+        const { uncovered, untested } = describeCoverage(file.coverage);
+        if (uncovered) lines.push(`${prefix}  - uncovered lines: ${uncovered}`);
+        if (untested) lines.push(`${prefix}  - untested: ${untested}`);
+      }
       
       // Add file elements if any
       if (file.elements && file.elements.length > 0) {
@@ -404,6 +460,30 @@ async function generateCodeMap(serviceName) {
   
   renderTree(tree);
   
+  // Add the coverage heatmap, least covered files first
+  lines.push('');
+  lines.push('## Coverage Heatmap');
+  lines.push('');
+  
+  if (coveredFiles.length === 0) {
+    lines.push('No coverage data for this service; run `npm run test:coverage`.');
+  } else {
+    lines.push('| File | Coverage | Uncovered lines | Untested functions |');
+    lines.push('|---|---|---|---|');
+    
+    const sorted = [...coveredFiles].sort((a, b) => a.coverage.percent - b.coverage.percent || b.coverage.total - a.coverage.total);
+    for (const file of sorted) {
+      const { uncovered, untested } = describeCoverage(file.coverage, 8);
+      const marker = utils.coverage.heatMarker(file.coverage.percent, threshold);
+      lines.push(`| \`${file.relativePath}\`${file.coverage.stale ? ' (edited since the coverage run)' : ''} | ${marker} ${file.coverage.percent}% (${file.coverage.covered}/${file.coverage.total}) | ${uncovered || '-'} | ${untested || '-'} |`);
+    }
+    
+    if (coveredFiles.some(file => file.coverage.stale)) {
+      lines.push('');
+      lines.push(`Files edited since the coverage run (${coverageModel.generated}) may have moved lines; rerun \`npm run test:coverage\` for current results.`);
+    }
+  }
+  
   // Add key components section
   lines.push('');
   lines.push('## Key Components');
@@ -485,8 +565,9 @@ async function generateAllCodeMaps() {
   logger.info(`Found ${services.length} services`);
   
   // Generate code maps for each service
+  const model = utils.coverage.loadModel();
   for (const service of services) {
-    const codeMap = await generateCodeMap(service);
+    const codeMap = await generateCodeMap(service, model.success ? model.value : null);
     const outputPath = utils.path.joinPath(OUTPUT_DIR, `${service}.md`);
     
     const writeResult = await utils.file.writeFile(outputPath, codeMap);
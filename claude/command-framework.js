@@ -29,13 +29,17 @@ const COMMAND_PATTERNS = {
   
   // Testing and analysis
   '@test': /^@test\s+(\S+)$/,
+  '@tests': /^@tests(?:\s+(\S+))?$/,
   '@summary': /^@summary\s+(\S+)$/,
   '@health': /^@health(?:\s+(\S+))?$/,
   
   // Specialized views
   '@view': /^@view\s+(\S+)(?:\s+(.+))?$/,
   '@diagram': /^@diagram\s+(\S+)(?:\s+(.+))?$/,
-  '@compare': /^@compare\s+(\S+)\s+(\S+)$/
+  '@compare': /^@compare\s+(\S+)\s+(\S+)$/,
+  
+  // Context snapshots
+  '@snapshot': /^@snapshot\s+(save|list|diff|restore)(?:\s+(\S+))?(?:\s+(\S+))?$/
 };
 
 /**
@@ -72,11 +76,13 @@ class CommandProcessor {
     this.commands.set('@function', this.handleFunctionCommand.bind(this));
     this.commands.set('@doc', this.handleDocCommand.bind(this));
     this.commands.set('@test', this.handleTestCommand.bind(this));
+    this.commands.set('@tests', this.handleTestsCommand.bind(this));
     this.commands.set('@summary', this.handleSummaryCommand.bind(this));
     this.commands.set('@health', this.handleHealthCommand.bind(this));
     this.commands.set('@view', this.handleViewCommand.bind(this));
     this.commands.set('@diagram', this.handleDiagramCommand.bind(this));
     this.commands.set('@compare', this.handleCompareCommand.bind(this));
+    this.commands.set('@snapshot', this.handleSnapshotCommand.bind(this));
   }
   
   /**
@@ -95,6 +101,14 @@ class CommandProcessor {
           // Found matching command, execute the handler
           const handler = this.commands.get(cmdName);
           if (handler) {
+            // Respect the allowed command list of the active session
+            if (this.navigationHub.isCommandAllowed && !this.navigationHub.isCommandAllowed(cmdName)) {
+              return {
+                type: 'error',
+                message: `Command ${cmdName} is not allowed in the ${this.navigationHub.sessionType} session`
+              };
+            }
+            
             // Record command in conversation memory
             await this.memoryManager.recordConversationEvent({
               type: 'command',
@@ -614,6 +628,36 @@ class CommandProcessor {
     }
   }
   
+  /**
+   * Handle @tests command - Show the live pass/fail status of the watched test components
+   * @param {Array<string>} args - Command arguments (optional "failed" or a component/service filter)
+   * @returns {Promise<Object>} Command result
+   */
+  async handleTestsCommand([filter]) {
+    console.log(`Handling @tests command for: ${filter || 'all'}`);
+    
+    const status = this.navigationHub.getTestStatus();
+    if (!status) {
+      return {
+        type: 'error',
+        message: 'No test status available. Start the test watcher with npm run test:watch'
+      };
+    }
+    
+    const components = Object.entries(status.components)
+      .map(([key, entry]) => ({ key, ...entry, running: status.running.includes(key) }))
+      .filter(entry => !filter || (filter === 'failed' ? entry.status !== 'passed' : entry.key.includes(filter)))
+      .sort((a, b) => a.key.localeCompare(b.key));
+    
+    return {
+      type: 'testStatus',
+      state: status.state,
+      updated: status.updated,
+      totals: status.totals,
+      components
+    };
+  }
+  
   /**
    * Handle @summary command - Generate summary
    * @param {Array<string>} args - Command arguments
@@ -872,6 +916,84 @@ class CommandProcessor {
     }
   }
   
+  /**
+   * Handle @snapshot command - Save, list, diff or restore context snapshots
+   * @param {Array<string>} args - Command arguments
+   * @returns {Promise<Object>} Command result
+   */
+  async handleSnapshotCommand([action, name, other]) {
+    console.log(`Handling @snapshot command: ${action} ${name || ''}`);
+    
+    try {
+      if (action === 'list') {
+        return {
+          type: 'snapshots',
+          snapshots: this.navigationHub.listSnapshots()
+        };
+      }
+      
+      if (!name) {
+        return {
+          type: 'error',
+          message: `Snapshot name required: @snapshot ${action} <name>`
+        };
+      }
+      
+      if (action === 'save') {
+        const snapshot = await this.navigationHub.createSnapshot(name, { note: other });
+        if (!snapshot) {
+          return {
+            type: 'error',
+            message: `Failed to save snapshot: ${name}`
+          };
+        }
+        
+        return {
+          type: 'snapshot',
+          name: snapshot.name,
+          created: snapshot.created,
+          sessionId: snapshot.sessionId,
+          memory: snapshot.memory.map(pointer => pointer.file)
+        };
+      }
+      
+      if (action === 'diff') {
+        const diff = await this.navigationHub.diffSnapshots(name, other);
+        if (!diff) {
+          return {
+            type: 'error',
+            message: `Failed to diff snapshot: ${name}`
+          };
+        }
+        
+        return {
+          type: 'snapshotDiff',
+          ...diff
+        };
+      }
+      
+      const sessionId = await this.navigationHub.restoreSnapshot(name);
+      if (!sessionId) {
+        return {
+          type: 'error',
+          message: `Failed to restore snapshot: ${name}`
+        };
+      }
+      
+      return {
+        type: 'snapshotRestored',
+        name,
+        sessionId
+      };
+    } catch (err) {
+      console.error(`Error handling @snapshot command: ${err}`);
+      return {
+        type: 'error',
+        message: `Failed to handle snapshot: ${err.message}`
+      };
+    }
+  }
+  
   /**
    * Helper method to resolve path relative to project root
    * @param {string} filePath - File path to resolve
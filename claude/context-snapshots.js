@@ -0,0 +1,252 @@
+/**
+ * DStudio Claude Desktop Context Snapshots
+ * Named snapshots of a Navigation Hub context with diff and restore support
+ */
+
+const fs = require('fs');
+const path = require('path');
+const crypto = require('crypto');
+const utils = require('../utils');
+
+// Snapshot names double as file names
+const SNAPSHOT_NAME_REGEX = /^[A-Za-z0-9._-]+$/;
+
+/**
+ * Snapshot store for Navigation Hub contexts
+ * Snapshots live in claude/memory/snapshots/<name>.json. Memory files are
+ * referenced by pointer (path + checksum) and their content is kept in a
+ * content-addressed blob store so a pointer stays restorable after the
+ * original file moves on.
+ */
+class ContextSnapshotStore {
+  /**
+   * Create a new snapshot store
+   * @param {string} memoryPath - Memory directory (defaults to claude/memory)
+   */
+  constructor(memoryPath = path.join(__dirname, 'memory')) {
+    this.memoryPath = memoryPath;
+    this.snapshotPath = path.join(memoryPath, 'snapshots');
+    this.blobPath = path.join(this.snapshotPath, 'blobs');
+  }
+  
+  /**
+   * Get the file path of a snapshot
+   * @param {string} name - Snapshot name
+   * @returns {string} Snapshot file path
+   */
+  getSnapshotFile(name) {
+    return path.join(this.snapshotPath, `${name}.json`);
+  }
+  
+  /**
+   * Create a named snapshot
+   * @param {string} name - Snapshot name
+   * @param {Object} state - Hub state to capture
+   * @param {string} state.sessionId - Session identifier
+   * @param {string} state.sessionType - Active session type
+   * @param {Object} state.context - Active context (views, history, session)
+   * @param {Object} options - Snapshot options
+   * @param {string} options.note - Free-form note describing the snapshot
+   * @param {boolean} options.overwrite - Replace an existing snapshot with the same name
+   * @returns {Object} Result object with success flag and snapshot
+   */
+  createSnapshot(name, state, options = {}) {
+    return utils.error.trySync(() => {
+      if (!SNAPSHOT_NAME_REGEX.test(name || '')) {
+        throw utils.error.ValidationError(`Invalid snapshot name: ${name} (use letters, digits, ".", "_" or "-")`);
+      }
+      
+      const snapshotFile = this.getSnapshotFile(name);
+      if (fs.existsSync(snapshotFile) && !options.overwrite) {
+        throw utils.error.ValidationError(`Snapshot already exists: ${name}`);
+      }
+      
+      const snapshot = {
+        name,
+        created: new Date().toISOString(),
+        note: options.note || null,
+        sessionId: state.sessionId,
+        sessionType: state.sessionType || null,
+        context: JSON.parse(JSON.stringify(state.context || {})),
+        memory: this.captureMemoryPointers(state.sessionId)
+      };
+      
+      utils.path.ensureDir(this.snapshotPath);
+      fs.writeFileSync(snapshotFile, JSON.stringify(snapshot, null, 2));
+      
+      return snapshot;
+    });
+  }
+  
+  /**
+   * Capture pointers to the memory files of a session
+   * @param {string} sessionId - Session identifier
+   * @returns {Array<Object>} Memory pointers
+   */
+  captureMemoryPointers(sessionId) {
+    if (!sessionId) return [];
+    
+    return this.capturePointers(file => file.includes(sessionId));
+  }
+  
+  /**
+   * Capture pointers to memory files, storing their content as blobs
+   * @param {Function} filter - Predicate on memory file names (defaults to all files)
+   * @returns {Array<Object>} Memory pointers
+   */
+  capturePointers(filter = () => true) {
+    if (!fs.existsSync(this.memoryPath)) return [];
+    
+    const pointers = [];
+    
+    for (const file of fs.readdirSync(this.memoryPath)) {
+      if (!file.endsWith('.json') || !filter(file)) continue;
+      
+      const filePath = path.join(this.memoryPath, file);
+      const content = utils.file.readFileSync(filePath);
+      if (!content.success) continue;
+      
+      const checksum = crypto.createHash('sha256').update(content.value).digest('hex');
+      const blobFile = path.join(this.blobPath, `${checksum}.json`);
+      
+      if (!fs.existsSync(blobFile)) {
+        utils.file.writeFileSync(blobFile, content.value);
+      }
+      
+      pointers.push({
+        file,
+        kind: file.startsWith('context-') ? 'context' : 'memory',
+        checksum,
+        size: Buffer.byteLength(content.value)
+      });
+    }
+    
+    return pointers;
+  }
+  
+  /**
+   * Load a snapshot
+   * @param {string} name - Snapshot name
+   * @returns {Object} Result object with success flag and snapshot
+   */
+  loadSnapshot(name) {
+    const snapshotFile = this.getSnapshotFile(name);
+    
+    if (!SNAPSHOT_NAME_REGEX.test(name || '') || !fs.existsSync(snapshotFile)) {
+      return { success: false, value: null, error: utils.error.ValidationError(`Snapshot not found: ${name}`) };
+    }
+    
+    return utils.error.trySync(() => JSON.parse(fs.readFileSync(snapshotFile, 'utf8')));
+  }
+  
+  /**
+   * List all snapshots, most recent first
+   * @returns {Array<Object>} Snapshot summaries
+   */
+  listSnapshots() {
+    if (!fs.existsSync(this.snapshotPath)) return [];
+    
+    return fs.readdirSync(this.snapshotPath)
+      .filter(file => file.endsWith('.json'))
+      .map(file => this.loadSnapshot(file.replace(/\.json$/, '')))
+      .filter(result => result.success)
+      .map(({ value }) => ({
+        name: value.name,
+        created: value.created,
+        note: value.note,
+        sessionId: value.sessionId,
+        sessionType: value.sessionType,
+        views: (value.context.views || []).length,
+        history: (value.context.history || []).length
+      }))
+      .sort((a, b) => b.created.localeCompare(a.created));
+  }
+  
+  /**
+   * Read the content a memory pointer refers to
+   * @param {Object} pointer - Memory pointer
+   * @returns {Object} Result object with success flag and file content
+   */
+  readPointer(pointer) {
+    return utils.file.readFileSync(path.join(this.blobPath, `${pointer.checksum}.json`));
+  }
+  
+  /**
+   * Diff two snapshots (or a snapshot and a live state)
+   * @param {Object} from - Older snapshot
+   * @param {Object} to - Newer snapshot
+   * @returns {Object} Differences
+   */
+  diffSnapshots(from, to) {
+    const fromContext = from.context || {};
+    const toContext = to.context || {};
+    
+    return {
+      from: from.name || from.sessionId,
+      to: to.name || to.sessionId,
+      session: {
+        changed: from.sessionType !== to.sessionType ||
+          JSON.stringify(fromContext.session?.parameters || {}) !== JSON.stringify(toContext.session?.parameters || {}),
+        from: { type: from.sessionType, parameters: fromContext.session?.parameters || {} },
+        to: { type: to.sessionType, parameters: toContext.session?.parameters || {} }
+      },
+      views: diffEvents(fromContext.views || [], toContext.views || []),
+      history: diffEvents(fromContext.history || [], toContext.history || []),
+      memory: diffPointers(from.memory || [], to.memory || [])
+    };
+  }
+}
+
+/**
+ * Diff two append-mostly event lists by their common prefix
+ * @param {Array<Object>} fromEvents - Older events
+ * @param {Array<Object>} toEvents - Newer events
+ * @returns {Object} Common prefix length plus added and removed events
+ */
+function diffEvents(fromEvents, toEvents) {
+  let common = 0;
+  
+  while (common < fromEvents.length && common < toEvents.length &&
+         JSON.stringify(fromEvents[common]) === JSON.stringify(toEvents[common])) {
+    common++;
+  }
+  
+  return {
+    common,
+    added: toEvents.slice(common),
+    removed: fromEvents.slice(common)
+  };
+}
+
+/**
+ * Diff memory pointers by kind and file
+ * @param {Array<Object>} fromPointers - Older pointers
+ * @param {Array<Object>} toPointers - Newer pointers
+ * @returns {Object} Added, removed and changed pointers
+ */
+function diffPointers(fromPointers, toPointers) {
+  // Several files share a kind, so a pointer is identified by both
+  const pointerKey = pointer => `${pointer.kind}:${pointer.file}`;
+  const fromByKey = new Map(fromPointers.map(pointer => [pointerKey(pointer), pointer]));
+  const toByKey = new Map(toPointers.map(pointer => [pointerKey(pointer), pointer]));
+  const result = { added: [], removed: [], changed: [] };
+  
+  for (const [key, pointer] of toByKey) {
+    const previous = fromByKey.get(key);
+    if (!previous) {
+      result.added.push(pointer);
+    } else if (previous.checksum !== pointer.checksum) {
+      result.changed.push({ kind: pointer.kind, file: pointer.file, from: previous.checksum, to: pointer.checksum, sizeDelta: pointer.size - previous.size });
+    }
+  }
+  
+  for (const [key, pointer] of fromByKey) {
+    if (!toByKey.has(key)) {
+      result.removed.push(pointer);
+    }
+  }
+  
+  return result;
+}
+
+module.exports = ContextSnapshotStore;
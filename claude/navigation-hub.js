@@ -5,24 +5,34 @@
 
 const fs = require('fs');
 const path = require('path');
+const EventEmitter = require('events');
 const utils = require('../utils');
+const sessionTemplates = require('./session-templates');
+const ContextSnapshotStore = require('./context-snapshots');
 const healthCheck = require('../scripts/health-check');
 
 /**
  * Navigation Hub for Claude Desktop
  * Maintains context awareness and provides navigation capabilities
  */
-class NavigationHub {
+class NavigationHub extends EventEmitter {
   /**
    * Create a new Navigation Hub instance
    */
   constructor() {
+    super();
     this.healthStatus = null;
     this.sessionType = null;
     this.projectMap = null;
     this.activeContext = {};
     this.sessionId = `session-${Date.now()}`;
-    this.heartbeatInterval = null;
+    this.agentId = process.env.AGENT_ID || 'claude-desktop';
+    this.taskId = null;
+    this.taskProgress = 0;
+    this.touchedFiles = new Set();
+    this.heartbeat = null;
+    this.watcher = null;
+    this.snapshots = new ContextSnapshotStore(path.join(__dirname, 'memory'));
   }
   
   /**
@@ -62,8 +72,14 @@ class NavigationHub {
       // Generate navigation index
       await this.generateNavigationIndex();
       
-      // Start heartbeat
-      this.startHeartbeat();
+      // Keep project map current as files change
+      this.startWatching();
+      
+      // Start heartbeat; refuse to run alongside a live agent with the same ID
+      if (!this.startHeartbeat()) {
+        this.stopWatching();
+        return false;
+      }
       
       console.log('Navigation Hub initialized successfully');
       return true;
@@ -120,9 +136,10 @@ class NavigationHub {
       const implDir = this.config.workspace.implementationDir || './generated_implementation';
       
       // Scan implementation directory
+      const excludes = this.getExcludeDirs();
       const structure = {
-        meta: this.scanDirectory(path.join(__dirname, '..')),
-        implementation: this.scanDirectory(path.join(__dirname, '..', implDir))
+        meta: this.scanDirectory(path.join(__dirname, '..'), excludes),
+        implementation: this.scanDirectory(path.join(__dirname, '..', implDir), excludes)
       };
       
       this.projectMap = structure;
@@ -194,23 +211,13 @@ class NavigationHub {
         return false;
       }
       
-      const templates = {};
-      const items = fs.readdirSync(templatesDir);
-      
-      for (const item of items) {
-        if (item.endsWith('.md')) {
-          const templatePath = path.join(templatesDir, item);
-          const content = fs.readFileSync(templatePath, 'utf8');
-          const name = item.replace('.md', '');
-          
-          templates[name] = {
-            name,
-            path: templatePath,
-            content
-          };
-        }
+      const result = sessionTemplates.loadTemplates(templatesDir);
+      if (!result.success) {
+        console.error('Failed to parse session templates:', result.error?.message);
+        return false;
       }
       
+      const templates = result.value;
       this.sessionTemplates = templates;
       console.log(`Loaded ${Object.keys(templates).length} session templates`);
       return true;
@@ -230,7 +237,9 @@ class NavigationHub {
       
       // Create a navigation index for quick access to common items
       this.navigationIndex = {
-        sessionTemplates: Object.keys(this.sessionTemplates || {}),
+        sessionTemplates: Object.values(this.sessionTemplates || {})
+          .filter(template => !template.abstract)
+          .map(template => template.name),
         services: [],
         documents: [],
         commands: [
@@ -246,7 +255,8 @@ class NavigationHub {
           '@health',
           '@view',
           '@diagram',
-          '@compare'
+          '@compare',
+          '@snapshot'
         ]
       };
       
@@ -297,9 +307,10 @@ class NavigationHub {
   /**
    * Select a session type
    * @param {string} sessionType - Type of session to select
-   * @returns {Promise<Object>} Session template
+   * @param {Object} params - Values for the template's declared parameters
+   * @returns {Promise<Object>} Resolved session context
    */
-  async selectSession(sessionType) {
+  async selectSession(sessionType, params = {}) {
     try {
       console.log(`Selecting session: ${sessionType}`);
       
@@ -308,8 +319,36 @@ class NavigationHub {
         return null;
       }
       
+      // Resolve inheritance, validate inputs and render variables
+      const result = sessionTemplates.buildSessionContext(this.sessionTemplates, sessionType, {
+        params,
+        status: this.readProjectJson('status.quick.json'),
+        specIndex: this.readProjectJson('spec.index.json'),
+        sessionId: this.sessionId
+      });
+      
+      if (!result.success) {
+        this.lastSessionErrors = result.errors;
+        console.error(`Invalid session "${sessionType}": ${result.errors.join('; ')}`);
+        return null;
+      }
+      
+      const session = result.value;
+      this.lastSessionErrors = [];
+      
+      if (session.unresolvedVariables.length > 0) {
+        console.warn(`Unresolved template variables: ${session.unresolvedVariables.join(', ')}`);
+      }
+      
       this.sessionType = sessionType;
       this.activeContext.sessionType = sessionType;
+      this.activeContext.session = {
+        name: session.name,
+        inheritance: session.inheritance,
+        parameters: session.parameters,
+        context: session.context,
+        commands: session.commands
+      };
       
       // Create a new session context
       this.activeContext.started = new Date().toISOString();
@@ -323,13 +362,47 @@ class NavigationHub {
       this.updateHeartbeat();
       
       console.log(`Session selected: ${sessionType}`);
-      return this.sessionTemplates[sessionType];
+      return session;
     } catch (err) {
       console.error(`Failed to select session: ${err}`);
       return null;
     }
   }
   
+  /**
+   * Check whether a command is allowed in the active session
+   * @param {string} command - Command name (e.g. @file)
+   * @returns {boolean} True if allowed
+   */
+  isCommandAllowed(command) {
+    const allowed = this.activeContext.session?.commands;
+    return !allowed || allowed.length === 0 || allowed.includes(command);
+  }
+  
+  /**
+   * Read a JSON file from the project root
+   * @param {string} relativePath - Path relative to the project root
+   * @returns {Object|null} Parsed JSON or null if unavailable
+   */
+  readProjectJson(relativePath) {
+    const result = utils.file.readFileSync(path.join(__dirname, '..', relativePath));
+    if (!result.success) return null;
+    
+    return utils.error.trySync(() => JSON.parse(result.value), null).value;
+  }
+  
+  /**
+   * Get the live test status kept by the test watcher (scripts/test-watch.js)
+   * @returns {Object|null} { state, updated, totals, running, components } or null if tests are not watched
+   */
+  getTestStatus() {
+    const status = utils.testReport.loadWatchStatus();
+    if (!status.success) return null;
+    
+    const { state, updated, totals, running, components } = status.value;
+    return { state, updated, totals, running, components };
+  }
+  
   /**
    * Save the current context
    * @returns {Promise<boolean>} Success status
@@ -406,85 +479,457 @@ class NavigationHub {
     }
   }
   
+  /**
+   * Capture the current context as a named snapshot
+   * @param {string} name - Snapshot name
+   * @param {Object} options - Snapshot options (note, overwrite)
+   * @returns {Promise<Object|null>} Snapshot or null on failure
+   */
+  async createSnapshot(name, options = {}) {
+    try {
+      // Flush the context file so its memory pointer matches the snapshot
+      await this.saveContext();
+      
+      const result = this.snapshots.createSnapshot(name, {
+        sessionId: this.sessionId,
+        sessionType: this.sessionType,
+        context: this.activeContext
+      }, options);
+      
+      if (!result.success) {
+        console.error(`Failed to create snapshot: ${result.error.message}`);
+        return null;
+      }
+      
+      console.log(`Snapshot created: ${name}`);
+      return result.value;
+    } catch (err) {
+      console.error(`Failed to create snapshot: ${err}`);
+      return null;
+    }
+  }
+  
+  /**
+   * List saved snapshots
+   * @returns {Array<Object>} Snapshot summaries, most recent first
+   */
+  listSnapshots() {
+    return this.snapshots.listSnapshots();
+  }
+  
+  /**
+   * Diff two snapshots, or a snapshot against the live context
+   * @param {string} fromName - Older snapshot name
+   * @param {string} toName - Newer snapshot name (defaults to the live context)
+   * @returns {Promise<Object|null>} Differences or null on failure
+   */
+  async diffSnapshots(fromName, toName = null) {
+    try {
+      const from = this.snapshots.loadSnapshot(fromName);
+      if (!from.success) {
+        console.error(from.error.message);
+        return null;
+      }
+      
+      let to;
+      if (toName) {
+        const result = this.snapshots.loadSnapshot(toName);
+        if (!result.success) {
+          console.error(result.error.message);
+          return null;
+        }
+        to = result.value;
+      } else {
+        await this.saveContext();
+        to = {
+          name: 'current',
+          sessionId: this.sessionId,
+          sessionType: this.sessionType,
+          context: this.activeContext,
+          memory: this.snapshots.captureMemoryPointers(this.sessionId)
+        };
+      }
+      
+      return this.snapshots.diffSnapshots(from.value, to);
+    } catch (err) {
+      console.error(`Failed to diff snapshots: ${err}`);
+      return null;
+    }
+  }
+  
+  /**
+   * Restore a snapshot into a new session
+   * The current session is left untouched on disk; the hub switches to a fresh
+   * session ID seeded with the snapshot's context and memory.
+   * @param {string} name - Snapshot name
+   * @returns {Promise<string|null>} New session ID or null on failure
+   */
+  async restoreSnapshot(name) {
+    try {
+      const result = this.snapshots.loadSnapshot(name);
+      if (!result.success) {
+        console.error(result.error.message);
+        return null;
+      }
+      
+      const snapshot = result.value;
+      const previousSessionId = this.sessionId;
+      
+      // Flush the session we are leaving before switching
+      await this.saveContext();
+      
+      this.sessionId = `session-${Date.now()}`;
+      this.sessionType = snapshot.sessionType;
+      this.activeContext = JSON.parse(JSON.stringify(snapshot.context));
+      this.activeContext.restoredFrom = {
+        snapshot: snapshot.name,
+        snapshotSessionId: snapshot.sessionId,
+        previousSessionId,
+        restored: new Date().toISOString()
+      };
+      
+      // Re-create memory files (other than the context itself) under the new session ID
+      for (const pointer of snapshot.memory || []) {
+        if (pointer.kind === 'context') continue;
+        
+        const content = this.snapshots.readPointer(pointer);
+        if (!content.success) {
+          console.warn(`Memory blob missing for ${pointer.file}`);
+          continue;
+        }
+        
+        const restoredFile = pointer.file.replace(snapshot.sessionId, this.sessionId);
+        fs.writeFileSync(path.join(__dirname, 'memory', restoredFile), content.value);
+      }
+      
+      await this.addHistoryEvent('snapshotRestored', {
+        snapshot: snapshot.name,
+        previousSessionId
+      });
+      
+      this.updateHeartbeat();
+      
+      console.log(`Snapshot ${name} restored into ${this.sessionId}`);
+      return this.sessionId;
+    } catch (err) {
+      console.error(`Failed to restore snapshot: ${err}`);
+      return null;
+    }
+  }
+  
+  /**
+   * Get the directories excluded from project scans
+   * @returns {Array<string>} Excluded directory names
+   */
+  getExcludeDirs() {
+    return this.config?.workspace?.excludeDirs || ['node_modules', '.git', 'dist', 'build'];
+  }
+  
+  /**
+   * Start watching the project for changes
+   * @returns {boolean} Success status
+   */
+  startWatching() {
+    const watchConfig = this.config?.navigation?.watch || {};
+    
+    if (watchConfig.enabled === false) {
+      console.log('Project watching disabled by configuration');
+      return false;
+    }
+    
+    this.stopWatching();
+    
+    try {
+      const excludes = this.getExcludeDirs();
+      
+      this.watcher = new utils.watch.DirectoryWatcher(path.join(__dirname, '..'), {
+        debounceMs: watchConfig.debounceMs,
+        rescanIntervalSeconds: watchConfig.rescanIntervalSeconds,
+        isExcluded: relativePath => relativePath.split(/[\\/]/).some(segment => excludes.includes(segment))
+      });
+      
+      this.watcher.on('batch', changes => this.applyProjectChanges(changes));
+      this.watcher.on('mode', mode => console.log(`Project watcher running in ${mode} mode`));
+      this.watcher.on('error', err => console.error('Project watcher error:', err.message));
+      this.watcher.start();
+      
+      return true;
+    } catch (err) {
+      console.error('Failed to start project watcher:', err);
+      this.watcher = null;
+      return false;
+    }
+  }
+  
+  /**
+   * Stop watching the project
+   */
+  stopWatching() {
+    if (this.watcher) {
+      this.watcher.stop();
+      this.watcher.removeAllListeners();
+      this.watcher = null;
+    }
+  }
+  
+  /**
+   * Apply a batch of filesystem changes to the project map and navigation index
+   * @param {Array<Object>} changes - Changes emitted by the project watcher
+   */
+  applyProjectChanges(changes) {
+    if (!this.projectMap) return;
+    
+    const projectRoot = path.join(__dirname, '..');
+    const implDir = path.resolve(projectRoot, this.config?.workspace?.implementationDir || './generated_implementation');
+    const heartbeatFile = this.config?.recovery?.heartbeatFile || '.agent-lock';
+    
+    for (const change of changes) {
+      this.applyTreeChange(this.projectMap.meta, projectRoot, change);
+      
+      if (utils.path.isWithinDirectory(change.path, implDir) && change.path !== implDir) {
+        this.applyTreeChange(this.projectMap.implementation, implDir, change);
+      }
+      
+      this.updateNavigationIndex(change, implDir);
+      
+      // Report edited files on the next heartbeat (ignoring the heartbeat files themselves)
+      if (!change.isDirectory && !path.basename(change.relativePath).startsWith(heartbeatFile)) {
+        this.touchedFiles.add(change.relativePath);
+      }
+    }
+    
+    this.emit('projectChange', changes);
+  }
+  
+  /**
+   * Apply a single change to a scanned directory tree
+   * @param {Object} tree - Tree produced by scanDirectory
+   * @param {string} rootDir - Directory the tree was scanned from
+   * @param {Object} change - Change emitted by the project watcher
+   */
+  applyTreeChange(tree, rootDir, change) {
+    const segments = path.relative(rootDir, change.path).split(path.sep);
+    const name = segments.pop();
+    let node = tree;
+    let nodePath = rootDir;
+    
+    // Walk (or create) the parent directories
+    for (const segment of segments) {
+      nodePath = path.join(nodePath, segment);
+      let child = node.directories.find(dir => dir.name === segment);
+      
+      if (!child) {
+        if (change.type === 'remove') return;
+        child = { name: segment, path: nodePath, files: [], directories: [] };
+        node.directories.push(child);
+      }
+      
+      node = child;
+    }
+    
+    if (change.type === 'remove') {
+      node.directories = node.directories.filter(dir => dir.name !== name);
+      node.files = node.files.filter(file => file.name !== name);
+      return;
+    }
+    
+    if (change.isDirectory) {
+      if (!node.directories.some(dir => dir.name === name)) {
+        node.directories.push({ name, path: change.path, files: [], directories: [] });
+      }
+      return;
+    }
+    
+    const file = node.files.find(entry => entry.name === name);
+    if (file) {
+      file.size = change.size;
+      file.modified = change.modified;
+    } else {
+      node.files.push({ name, path: change.path, size: change.size, modified: change.modified });
+    }
+  }
+  
+  /**
+   * Update the navigation index for a single change
+   * @param {Object} change - Change emitted by the project watcher
+   * @param {string} implDir - Absolute implementation directory
+   */
+  updateNavigationIndex(change, implDir) {
+    if (!this.navigationIndex) return;
+    
+    // Services are the top-level directories of the implementation
+    if (change.isDirectory && path.dirname(change.path) === implDir) {
+      const name = path.basename(change.path);
+      const services = this.navigationIndex.services.filter(service => service !== name);
+      
+      if (change.type !== 'remove') {
+        services.push(name);
+      }
+      
+      this.navigationIndex.services = services;
+      return;
+    }
+    
+    // Documents are markdown files below docs/
+    const docsDir = path.join(__dirname, '..', 'docs');
+    if (!change.isDirectory && change.path.endsWith('.md') && utils.path.isWithinDirectory(change.path, docsDir)) {
+      const documents = this.navigationIndex.documents.filter(doc => doc.path !== change.path);
+      
+      if (change.type !== 'remove') {
+        documents.push({
+          name: path.basename(change.path),
+          path: change.path,
+          directory: path.basename(path.dirname(change.path))
+        });
+      }
+      
+      this.navigationIndex.documents = documents;
+    }
+  }
+  
   /**
    * Start the heartbeat process
+   * @returns {boolean} True if the heartbeat lease was acquired
    */
   startHeartbeat() {
     console.log('Starting heartbeat...');
     
-    // Clear any existing interval
-    if (this.heartbeatInterval) {
-      clearInterval(this.heartbeatInterval);
+    // Release any lease held by a previous start
+    this.stopHeartbeat();
+    
+    this.heartbeat = new utils.heartbeat.HeartbeatLease(this.agentId, {
+      agent: 'Claude Desktop',
+      sessionId: this.sessionId,
+      taskId: this.taskId,
+      intervalSeconds: this.config?.recovery?.heartbeatIntervalSeconds || 30
+    });
+    
+    // Acquire the lease and renew it on every interval
+    const result = this.heartbeat.start(() => this.getHeartbeatUpdates());
+    if (!result.success) {
+      console.error(`Failed to acquire heartbeat lease: ${result.error.message}`);
+      this.heartbeat = null;
+      return false;
+    }
+    
+    if (this.heartbeat.previousOwner?.handoff) {
+      const handoff = this.heartbeat.previousOwner.handoff;
+      console.log(`Taking over from session ${this.heartbeat.previousOwner.sessionId}: ${handoff.note || handoff.finalStatus}`);
+      
+      if (handoff.resume) {
+        this.resumeSession(handoff);
+      }
+    }
+    
+    console.log(`Heartbeat started for ${this.agentId} with interval: ${this.heartbeat.intervalSeconds} seconds`);
+    return true;
+  }
+  
+  /**
+   * Continue a session handed off for resumption (see scripts/recovery.js)
+   * @param {Object} handoff - Handoff from the previous lease
+   * @returns {boolean} True if the saved context was restored
+   */
+  resumeSession(handoff) {
+    this.sessionId = handoff.sessionId;
+    this.taskId = handoff.taskId;
+    this.taskProgress = handoff.progress || 0;
+    
+    const contextPath = path.join(__dirname, 'memory', `context-${handoff.sessionId}.json`);
+    const context = utils.error.trySync(() => JSON.parse(fs.readFileSync(contextPath, 'utf8')));
+    
+    if (context.success) {
+      this.activeContext = context.value;
+      this.sessionType = context.value.sessionType || null;
     }
     
-    // Get heartbeat interval from config (default to 30 seconds)
-    const intervalSeconds = this.config?.recovery?.heartbeatIntervalSeconds || 30;
+    this.activeContext.resumedFrom = {
+      sessionId: handoff.sessionId,
+      recovery: handoff.recovery || null,
+      resumed: new Date().toISOString()
+    };
     
-    // Update heartbeat immediately
     this.updateHeartbeat();
+    console.log(`Resumed session ${this.sessionId} (task ${this.taskId || 'unknown'})${context.success ? '' : ' without saved context'}`);
+    return context.success;
+  }
+  
+  /**
+   * Collect the fields reported on each heartbeat renewal
+   * @returns {Object} Heartbeat updates
+   */
+  getHeartbeatUpdates() {
+    const touchedFiles = Array.from(this.touchedFiles);
+    this.touchedFiles.clear();
     
-    // Set up interval for future updates
-    this.heartbeatInterval = setInterval(() => {
-      this.updateHeartbeat();
-    }, intervalSeconds * 1000);
+    return {
+      sessionId: this.sessionId,
+      taskId: this.taskId || null,
+      progress: this.taskProgress,
+      touchedFiles
+    };
+  }
+  
+  /**
+   * Set the task the agent is working on
+   * @param {string} taskId - Task identifier (e.g. REQ-15)
+   * @param {number} progress - Progress percentage
+   * @returns {boolean} False if another live agent owns the task
+   */
+  setCurrentTask(taskId, progress = 0) {
+    if (this.heartbeat) {
+      const result = this.heartbeat.setTask(taskId);
+      if (!result.success) {
+        console.error(result.error.message);
+        return false;
+      }
+    }
     
-    console.log(`Heartbeat started with interval: ${intervalSeconds} seconds`);
+    this.taskId = taskId;
+    this.taskProgress = progress;
+    this.updateHeartbeat();
+    return true;
   }
   
   /**
-   * Update the heartbeat file
+   * Renew the heartbeat lease immediately
    */
   updateHeartbeat() {
-    try {
-      const heartbeatFile = this.config?.recovery?.heartbeatFile || '.agent-lock';
-      const heartbeatPath = path.join(__dirname, '..', heartbeatFile);
-      
-      const heartbeat = {
-        agent: "Claude Desktop",
-        sessionId: this.sessionId,
-        timestamp: new Date().toISOString(),
-        status: "active",
-        currentTask: this.sessionType || "initialization"
-      };
-      
-      fs.writeFileSync(heartbeatPath, JSON.stringify(heartbeat, null, 2));
-      console.log(`Heartbeat updated: ${heartbeat.timestamp}`);
-    } catch (err) {
-      console.error('Failed to update heartbeat:', err);
+    if (!this.heartbeat) return;
+    
+    const result = this.heartbeat.renew(this.getHeartbeatUpdates());
+    if (result.success) {
+      console.log(`Heartbeat updated: ${result.value.timestamp}`);
+    } else {
+      console.error('Failed to update heartbeat:', result.error.message);
     }
   }
   
   /**
-   * Stop the heartbeat process
+   * Stop the heartbeat process and hand off the lease
+   * @param {Object} handoff - Handoff details (to, note, status)
    */
-  stopHeartbeat() {
+  stopHeartbeat(handoff = {}) {
+    if (!this.heartbeat) return;
+    
     console.log('Stopping heartbeat...');
     
-    if (this.heartbeatInterval) {
-      clearInterval(this.heartbeatInterval);
-      this.heartbeatInterval = null;
-      
-      // Set final heartbeat status to completed
-      try {
-        const heartbeatFile = this.config?.recovery?.heartbeatFile || '.agent-lock';
-        const heartbeatPath = path.join(__dirname, '..', heartbeatFile);
-        
-        const heartbeat = {
-          agent: "Claude Desktop",
-          sessionId: this.sessionId,
-          timestamp: new Date().toISOString(),
-          status: "completed",
-          currentTask: this.sessionType || "unknown"
-        };
-        
-        fs.writeFileSync(heartbeatPath, JSON.stringify(heartbeat, null, 2));
-        console.log('Final heartbeat written with completed status');
-      } catch (err) {
-        console.error('Failed to write final heartbeat:', err);
-      }
-      
-      console.log('Heartbeat stopped');
+    // Flush pending updates, then release with an explicit handoff
+    this.heartbeat.renew(this.getHeartbeatUpdates());
+    const result = this.heartbeat.release({
+      status: 'completed',
+      note: `Session ${this.sessionId} (${this.sessionType || 'no session'}) shut down`,
+      ...handoff
+    });
+    
+    if (result.success) {
+      console.log('Final heartbeat written with handoff');
+    } else {
+      console.error('Failed to write final heartbeat:', result.error.message);
     }
+    
+    this.heartbeat = null;
+    console.log('Heartbeat stopped');
   }
   
   /**
@@ -493,6 +938,9 @@ class NavigationHub {
   async shutdown() {
     console.log('Shutting down Navigation Hub...');
     
+    // Stop watching the project
+    this.stopWatching();
+    
     // Stop heartbeat
     this.stopHeartbeat();
     
@@ -6,14 +6,14 @@
  * Updated to use the standardized DStudio utilities
  */
 
+const path = require('path');
 const utils = require('../utils');
 const logger = utils.logger.createScopedLogger('ProjectMapGenerator');
-const util = require('util');
-const exec = util.promisify(require('child_process').exec);
 
 // Configuration
 const OUTPUT_FILE = utils.path.resolveProjectPath('claude', 'project-map.md');
 const IMPL_DIR = utils.config.getImplementationDir();
+const TEST_REPORTS = ['test-affected', 'test-summary'];
 
 /**
  * Get the age of a directory or file in days
@@ -31,6 +31,88 @@ async function getAge(filePath) {
   return 0;
 }
 
+/**
+ * Get the latest test results of a service from the test reports
+ * test-summary suites name their service; test-affected paths are relative to the implementation.
+ * @param {string} dir - Service directory
+ * @returns {Object|null} Totals of the service's tests, or null if no report covers it
+ */
+function getServiceTestTotals(dir) {
+  const relative = path.relative(IMPL_DIR, dir);
+  if (relative.startsWith('..') || path.isAbsolute(relative)) return null;
+  
+  const within = file => Boolean(file) && (relative === '' || file === relative || file.startsWith(`${relative}/`));
+  let latest = null;
+  
+  for (const name of TEST_REPORTS) {
+    const report = utils.testReport.loadReport(name);
+    if (!report.success || (latest && latest.generated >= report.value.generated)) continue;
+    
+    const suites = report.value.suites
+      .map(suite => {
+        if (suite.service !== undefined) return suite.service === relative ? suite : null;
+        if (within(suite.path)) return suite;
+        const tests = suite.tests.filter(test => within(test.file));
+        return tests.length > 0 ? { ...suite, tests } : null;
+      })
+      .filter(Boolean);
+    
+    if (suites.length > 0) latest = { generated: report.value.generated, totals: utils.testReport.summarize(suites) };
+  }
+  
+  return latest && latest.totals;
+}
+
+/**
+ * Get the line coverage of a service from the merged coverage model
+ * @param {Object} coverage - Summary from utils.coverage.summarizeModel(), or null
+ * @param {string} name - Service name
+ * @returns {Object|null} { percent, threshold, passed } or null if the service has no coverage data
+ */
+function getServiceCoverage(coverage, name) {
+  if (!coverage) return null;
+  if (coverage.services[name]) return coverage.services[name];
+  
+  // Coverage collected for the implementation as a whole: use the files under the service
+  const files = coverage.files.filter(file => file.file.startsWith(`${name}/`));
+  if (files.length === 0) return null;
+  
+  const covered = files.reduce((sum, file) => sum + file.covered, 0);
+  const total = files.reduce((sum, file) => sum + file.total, 0);
+  const percent = Math.round((covered / total) * 1000) / 10;
+  const threshold = utils.coverage.getThreshold(name);
+  return { percent, threshold, passed: percent >= threshold };
+}
+
+/**
+ * List the least covered files of a service with their uncovered lines and untested functions
+ * @param {Object} model - Merged coverage model
+ * @param {Object} coverage - Summary from utils.coverage.summarizeModel()
+ * @param {string} name - Service name
+ * @returns {Promise<Array<string>>} Markdown list items, least covered first
+ */
+async function getCoverageHeatmap(model, coverage, name) {
+  const limit = utils.config.get('development.testing.coverage.leastCoveredFiles', 10);
+  const threshold = utils.coverage.getThreshold(name);
+  const files = coverage.files
+    .filter(file => (file.service === name || file.file.startsWith(`${name}/`)) && file.percent < 100)
+    .slice(0, limit);
+  const items = [];
+  
+  for (const file of files) {
+    const source = await utils.file.readFile(path.join(IMPL_DIR, file.file));
+    const details = utils.coverage.describeFile(model.files[file.file], source.success ? source.value : null, file.file);
+    const untested = details.functions.filter(fn => !fn.tested).map(fn => `${fn.name} (L${fn.line})`);
+    const parts = [
+      details.uncovered.length > 0 && `uncovered ${utils.coverage.formatRanges(details.uncovered.slice(0, 8))}${details.uncovered.length > 8 ? ' ...' : ''}`,
+      untested.length > 0 && `untested ${untested.slice(0, 5).join(', ')}${untested.length > 5 ? ` +${untested.length - 5} more` : ''}`
+    ].filter(Boolean);
+    items.push(`- ${utils.coverage.heatMarker(file.percent, threshold)} ${file.percent}% \`${file.file}\` (${file.covered}/${file.total} lines)${parts.length ? `: ${parts.join('; ')}` : ''}`);
+  }
+  
+  return items;
+}
+
 /**
  * Check health of a component
  * @param {string} dir - Directory to check
@@ -80,37 +162,19 @@ async function checkHealth(dir) {
       result.issues.push('Python virtual environment not found');
     }
     
-    // Check for failing tests (basic check)
-    await utils.error.tryAsync(async () => {
-      if (files.includes('package.json')) {
-        // Check for test coverage
-        const packageJsonPath = utils.path.joinPath(dir, 'package.json');
-        const packageJsonResult = await utils.file.readFile(packageJsonPath);
-        
-        if (packageJsonResult.success) {
-          const packageJson = JSON.parse(packageJsonResult.value);
-          if (packageJson.scripts && packageJson.scripts.test) {
-            try {
-              await exec('npm test -- --silent', { cwd: dir, timeout: 5000 });
-              result.tests = '100%'; // Simplified - would need a coverage report for accurate number
-            } catch (err) {
-              result.health = '⚠️';
-              result.tests = '?';
-              result.issues.push('Tests failing');
-            }
-          }
-        }
-      } else if (files.includes('go.mod')) {
-        try {
-          await exec('go test ./... -cover', { cwd: dir, timeout: 5000 });
-          result.tests = '100%'; // Simplified
-        } catch (err) {
-          result.health = '⚠️';
-          result.tests = '?';
-          result.issues.push('Go tests failing');
-        }
+    // Check for failing tests in the latest test report
+    const totals = getServiceTestTotals(dir);
+    if (totals) {
+      const failing = totals.failed + totals.errors;
+      result.tests = `${totals.passed}/${totals.tests}`;
+      
+      if (failing > totals.quarantined) {
+        result.health = '⚠️';
+        result.issues.push(`${failing - totals.quarantined} test(s) failing`);
+      } else if (totals.quarantined > 0) {
+        result.issues.push(`${totals.quarantined} quarantined flaky test(s) failing`);
       }
-    }, null);
+    }
     
     return result;
   } catch (err) {
@@ -153,6 +217,8 @@ async function generateProjectMap() {
     lines.push(`2. IMPL: No services found`);
   } else {
     const services = servicesResult.value;
+    const model = utils.coverage.loadModel();
+    const coverage = model.success ? utils.coverage.summarizeModel(model.value) : null;
     lines.push('');
     lines.push(`## Implementation Services (${services.length})`);
     lines.push('');
@@ -162,8 +228,15 @@ async function generateProjectMap() {
       const health = await checkHealth(service.path);
       const age = await getAge(service.path);
       const language = utils.project.detectServiceLanguage(service.path);
+      const serviceCoverage = getServiceCoverage(coverage, service.name);
       
-      lines.push(`${counter}. IMPL/${service.name}: health=${health.health} tests=${health.tests} age=${age}d lang=${language}`);
+      if (serviceCoverage && !serviceCoverage.passed) {
+        health.health = '⚠️';
+        health.issues.push(`Coverage ${serviceCoverage.percent}% below ${serviceCoverage.threshold}%`);
+      }
+      
+      const coverageText = serviceCoverage ? `${serviceCoverage.percent}%` : 'N/A';
+      lines.push(`${counter}. IMPL/${service.name}: health=${health.health} tests=${health.tests} coverage=${coverageText} age=${age}d lang=${language}`);
       
       if (health.issues.length > 0) {
         lines.push(`   └── Issues: ${health.issues.join(', ')}`);
@@ -171,6 +244,25 @@ async function generateProjectMap() {
       
       counter++;
     }
+    
+    // Coverage heatmap: the least covered files of each service
+    if (coverage) {
+      lines.push('');
+      lines.push('## Coverage Heatmap');
+      
+      for (const service of services) {
+        const items = await getCoverageHeatmap(model.value, coverage, service.name);
+        if (items.length === 0) continue;
+        
+        lines.push('');
+        lines.push(`### ${service.name}`);
+        lines.push('');
+        lines.push(...items);
+      }
+      
+      lines.push('');
+      lines.push(`Coverage collected ${model.value.generated}; per-file details in claude/code-maps/.`);
+    }
   }
   
   lines.push('');
@@ -181,6 +273,9 @@ async function generateProjectMap() {
   lines.push('- ⚠️: Warning');
   lines.push('- ✗: Critical issues');
   lines.push('- ?: Unknown status');
+  lines.push('- tests: passed/total in the latest test report (.cache/test-reports/)');
+  lines.push('- coverage: line coverage from npm run test:coverage (.cache/coverage/)');
+  lines.push('- 🟩/🟨/🟥: coverage at or above the threshold, above half of it, below half of it');
   
   return lines.join('\n');
 }
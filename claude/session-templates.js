@@ -0,0 +1,472 @@
+/**
+ * DStudio Claude Desktop Session Templates
+ * Loads session templates with front-matter, resolves inheritance and renders session context
+ */
+
+const fs = require('fs');
+const path = require('path');
+const utils = require('../utils');
+
+// Front-matter is delimited by --- lines at the very top of the file
+const FRONT_MATTER_REGEX = /^---\r?\n([\s\S]*?)\r?\n---\r?\n?/;
+const VARIABLE_REGEX = /\{\{\s*([A-Za-z0-9_.-]+)\s*\}\}/g;
+const PARAMETER_TYPES = ['string', 'number', 'boolean'];
+
+/**
+ * Parse a YAML front-matter block
+ * Supports the subset used by session templates: nested maps, block and inline
+ * lists, quoted strings, numbers, booleans and comments.
+ * @param {string} text - YAML text
+ * @returns {Object} Parsed value
+ */
+function parseYaml(text) {
+  const lines = text.split(/\r?\n/)
+    .map(raw => ({ indent: raw.search(/\S/), content: stripComment(raw).trim() }))
+    .filter(line => line.indent >= 0 && line.content);
+  let index = 0;
+  
+  const isListItem = content => content === '-' || content.startsWith('- ');
+  
+  function parseBlock(indent) {
+    return isListItem(lines[index].content) ? parseList(indent) : parseMap(indent);
+  }
+  
+  function parseNested(indent) {
+    if (index >= lines.length) return null;
+    
+    const next = lines[index];
+    if (next.indent > indent || (next.indent === indent && isListItem(next.content))) {
+      return parseBlock(next.indent);
+    }
+    
+    return null;
+  }
+  
+  function parseMap(indent) {
+    const map = {};
+    
+    while (index < lines.length && lines[index].indent === indent && !isListItem(lines[index].content)) {
+      const pair = splitKeyValue(lines[index].content);
+      index++;
+      
+      if (!pair) continue;
+      map[pair.key] = pair.value === '' ? parseNested(indent) : parseScalar(pair.value);
+    }
+    
+    return map;
+  }
+  
+  function parseList(indent) {
+    const list = [];
+    
+    while (index < lines.length && lines[index].indent === indent && isListItem(lines[index].content)) {
+      const line = lines[index];
+      const itemText = line.content.replace(/^-\s*/, '');
+      
+      if (itemText === '') {
+        index++;
+        list.push(index < lines.length && lines[index].indent > indent ? parseBlock(lines[index].indent) : null);
+      } else if (splitKeyValue(itemText)) {
+        // "- key: value" starts a map whose keys align with the first key
+        const itemIndent = line.indent + line.content.indexOf(itemText);
+        lines[index] = { indent: itemIndent, content: itemText };
+        list.push(parseMap(itemIndent));
+      } else {
+        list.push(parseScalar(itemText));
+        index++;
+      }
+    }
+    
+    return list;
+  }
+  
+  return lines.length > 0 ? parseBlock(lines[0].indent) : {};
+}
+
+/**
+ * Remove a trailing comment from a YAML line, ignoring # inside quotes
+ * @param {string} line - YAML line
+ * @returns {string} Line without comment
+ */
+function stripComment(line) {
+  let quote = null;
+  
+  for (let i = 0; i < line.length; i++) {
+    const char = line[i];
+    
+    if (quote) {
+      if (char === quote) quote = null;
+    } else if (char === '"' || char === "'") {
+      quote = char;
+    } else if (char === '#' && (i === 0 || /\s/.test(line[i - 1]))) {
+      return line.slice(0, i);
+    }
+  }
+  
+  return line;
+}
+
+/**
+ * Split a "key: value" line
+ * @param {string} content - Line content
+ * @returns {Object|null} Key and raw value, or null if the line is not a pair
+ */
+function splitKeyValue(content) {
+  const match = content.match(/^("[^"]*"|'[^']*'|[A-Za-z0-9_@.-]+)\s*:(?:\s+(.*)|$)/);
+  if (!match) return null;
+  
+  return {
+    key: match[1].replace(/^["']|["']$/g, ''),
+    value: (match[2] || '').trim()
+  };
+}
+
+/**
+ * Parse a YAML scalar or inline list
+ * @param {string} value - Raw value
+ * @returns {any} Parsed value
+ */
+function parseScalar(value) {
+  if (/^".*"$/.test(value) || /^'.*'$/.test(value)) {
+    return value.slice(1, -1);
+  }
+  
+  if (value.startsWith('[') && value.endsWith(']')) {
+    const inner = value.slice(1, -1).trim();
+    if (!inner) return [];
+    return (inner.match(/("[^"]*"|'[^']*'|[^,]+)/g) || []).map(item => parseScalar(item.trim()));
+  }
+  
+  if (value === 'true') return true;
+  if (value === 'false') return false;
+  if (value === 'null' || value === '~') return null;
+  if (/^-?\d+(\.\d+)?$/.test(value)) return parseFloat(value);
+  
+  return value;
+}
+
+/**
+ * Split a template file into front-matter attributes and Markdown body
+ * @param {string} content - Template file content
+ * @returns {Object} Attributes and body
+ */
+function parseFrontMatter(content) {
+  const match = content.match(FRONT_MATTER_REGEX);
+  
+  if (!match) {
+    return { attributes: {}, body: content };
+  }
+  
+  return {
+    attributes: parseYaml(match[1]) || {},
+    body: content.slice(match[0].length)
+  };
+}
+
+/**
+ * Load all session templates from a directory
+ * @param {string} templatesDir - Directory containing *.md templates
+ * @returns {Object} Result object with success flag and templates keyed by name
+ */
+function loadTemplates(templatesDir) {
+  return utils.error.trySync(() => {
+    const templates = {};
+    
+    for (const item of fs.readdirSync(templatesDir)) {
+      if (!item.endsWith('.md')) continue;
+      
+      const templatePath = path.join(templatesDir, item);
+      const content = fs.readFileSync(templatePath, 'utf8');
+      const { attributes, body } = parseFrontMatter(content);
+      const name = attributes.name || item.replace('.md', '');
+      
+      templates[name] = {
+        name,
+        path: templatePath,
+        content,
+        body,
+        attributes,
+        description: attributes.description || null,
+        parent: attributes.extends || null,
+        abstract: attributes.abstract === true,
+        parameters: attributes.parameters || {},
+        context: attributes.context || {},
+        commands: attributes.commands || null
+      };
+    }
+    
+    return templates;
+  }, {});
+}
+
+/**
+ * Resolve a template against its ancestors
+ * Parameters are merged by name (child wins), context lists are concatenated
+ * parent-first, commands are inherited unless the child declares its own, and
+ * the parent body is appended after the child body.
+ * @param {Object} templates - Templates keyed by name
+ * @param {string} name - Template to resolve
+ * @param {Array<string>} chain - Names already visited (cycle detection)
+ * @returns {Object} Resolved template
+ */
+function resolveTemplate(templates, name, chain = []) {
+  const template = templates[name];
+  
+  if (!template) {
+    throw utils.error.ValidationError(`Session template not found: ${name}${chain.length ? ` (parent of ${chain[chain.length - 1]})` : ''}`);
+  }
+  
+  if (chain.includes(name)) {
+    throw utils.error.ValidationError(`Circular session template inheritance: ${[...chain, name].join(' -> ')}`);
+  }
+  
+  if (!template.parent) {
+    return { ...template, inheritance: [name] };
+  }
+  
+  const parent = resolveTemplate(templates, template.parent, [...chain, name]);
+  const context = {};
+  
+  for (const key of new Set([...Object.keys(parent.context), ...Object.keys(template.context)])) {
+    context[key] = [...new Set([...(parent.context[key] || []), ...(template.context[key] || [])])];
+  }
+  
+  return {
+    ...template,
+    body: [template.body.trim(), parent.body.trim()].filter(Boolean).join('\n\n') + '\n',
+    parameters: { ...parent.parameters, ...template.parameters },
+    context,
+    commands: template.commands || parent.commands,
+    inheritance: [...parent.inheritance, name]
+  };
+}
+
+/**
+ * Validate session inputs against parameter definitions
+ * @param {Object} definitions - Parameter definitions from front-matter
+ * @param {Object} params - Supplied parameter values
+ * @returns {Object} Result with success flag, coerced values and errors
+ */
+function validateParameters(definitions = {}, params = {}) {
+  const values = {};
+  const errors = [];
+  
+  for (const [name, rawDefinition] of Object.entries(definitions)) {
+    // Shorthand: "name: string"
+    const definition = typeof rawDefinition === 'string' ? { type: rawDefinition } : (rawDefinition || {});
+    const type = definition.type || 'string';
+    let value = params[name];
+    
+    if (value === undefined || value === null || value === '') {
+      if (definition.default !== undefined) {
+        values[name] = definition.default;
+      } else if (definition.required) {
+        errors.push(`Missing required parameter: ${name}`);
+      }
+      continue;
+    }
+    
+    if (!PARAMETER_TYPES.includes(type)) {
+      errors.push(`Unknown type "${type}" for parameter: ${name}`);
+      continue;
+    }
+    
+    if (type === 'number') {
+      value = Number(value);
+      if (Number.isNaN(value)) {
+        errors.push(`Parameter ${name} must be a number`);
+        continue;
+      }
+    } else if (type === 'boolean' && typeof value !== 'boolean') {
+      if (value !== 'true' && value !== 'false') {
+        errors.push(`Parameter ${name} must be true or false`);
+        continue;
+      }
+      value = value === 'true';
+    } else if (type === 'string') {
+      value = String(value);
+    }
+    
+    if (Array.isArray(definition.enum) && !definition.enum.includes(value)) {
+      errors.push(`Parameter ${name} must be one of: ${definition.enum.join(', ')}`);
+      continue;
+    }
+    
+    values[name] = value;
+  }
+  
+  for (const name of Object.keys(params)) {
+    if (!(name in definitions)) {
+      errors.push(`Unknown parameter: ${name}`);
+    }
+  }
+  
+  return { success: errors.length === 0, value: values, errors };
+}
+
+/**
+ * Look up a dotted path in an object
+ * @param {Object} source - Object to search
+ * @param {string} dottedPath - Path such as status.health.total_files
+ * @returns {any} Value or undefined
+ */
+function lookup(source, dottedPath) {
+  return dottedPath.split('.').reduce((current, part) =>
+    (current !== undefined && current !== null && typeof current === 'object') ? current[part] : undefined, source);
+}
+
+/**
+ * Render {{variable}} placeholders
+ * @param {string} text - Template text
+ * @param {Object} variables - Variables available to the template
+ * @returns {Object} Rendered text and names of unresolved variables
+ */
+function renderTemplate(text, variables) {
+  const unresolved = new Set();
+  
+  const rendered = text.replace(VARIABLE_REGEX, (match, name) => {
+    const value = lookup(variables, name);
+    
+    if (value === undefined || value === null) {
+      unresolved.add(name);
+      return match;
+    }
+    
+    return typeof value === 'object' ? JSON.stringify(value) : String(value);
+  });
+  
+  return { text: rendered, unresolved: Array.from(unresolved) };
+}
+
+/**
+ * Resolve spec references against the spec index
+ * A reference matches requirement/task IDs or section titles and paths.
+ * @param {string} ref - Spec reference
+ * @param {Object} specIndex - Parsed spec.index.json
+ * @returns {Array<Object>} Matching spec entries
+ */
+function resolveSpecReference(ref, specIndex) {
+  if (!specIndex) return [];
+  
+  const needle = ref.toLowerCase();
+  const matches = [];
+  
+  for (const requirement of specIndex.requirements || []) {
+    if ((requirement.id || '').toLowerCase() === needle || (requirement.text || '').toLowerCase().includes(`**${needle}**`)) {
+      matches.push({ kind: 'requirement', id: requirement.id, text: requirement.text, section: requirement.section, completed: requirement.completed });
+    }
+  }
+  
+  for (const [taskId, task] of Object.entries(specIndex.tasks || {})) {
+    if (taskId.toLowerCase() === needle) {
+      matches.push({ kind: 'task', id: taskId, title: task.title, requirements: (task.requirements || []).length });
+    }
+  }
+  
+  const visitSections = (sections) => {
+    for (const section of sections || []) {
+      const title = (section.title || '').toLowerCase();
+      const sectionPath = (section.path || '').toLowerCase();
+      if (title === needle || sectionPath === needle || title.startsWith(`${needle} `)) {
+        matches.push({ kind: 'section', title: section.title, path: section.path, line: section.line });
+      }
+      visitSections(section.subsections);
+    }
+  };
+  
+  visitSections(specIndex.sections);
+  
+  return matches;
+}
+
+/**
+ * Build the resolved context for a session
+ * @param {Object} templates - Templates keyed by name
+ * @param {string} name - Template name
+ * @param {Object} options - Session inputs
+ * @param {Object} options.params - Parameter values
+ * @param {Object} options.status - Parsed status.quick.json
+ * @param {Object} options.specIndex - Parsed spec.index.json
+ * @param {string} options.sessionId - Session identifier
+ * @returns {Object} Result with success flag, session context and errors
+ */
+function buildSessionContext(templates, name, options = {}) {
+  const { params = {}, status = null, specIndex = null, sessionId = null } = options;
+  
+  const resolved = utils.error.trySync(() => resolveTemplate(templates, name));
+  if (!resolved.success) {
+    return { success: false, value: null, errors: [resolved.error.message] };
+  }
+  
+  const template = resolved.value;
+  if (template.abstract) {
+    return { success: false, value: null, errors: [`Session template is abstract and cannot be selected: ${name}`] };
+  }
+  
+  const validation = validateParameters(template.parameters, params);
+  if (!validation.success) {
+    return { success: false, value: null, errors: validation.errors };
+  }
+  
+  const variables = {
+    ...validation.value,
+    params: validation.value,
+    status: status || {},
+    spec: specIndex ? { checksum: specIndex.checksum, stats: specIndex.stats } : {},
+    session: { id: sessionId, type: name }
+  };
+  
+  const unresolved = new Set();
+  const render = (text) => {
+    const result = renderTemplate(String(text), variables);
+    result.unresolved.forEach(variable => unresolved.add(variable));
+    return result.text;
+  };
+  
+  const projectRoot = utils.path.PROJECT_ROOT;
+  const files = (template.context.files || []).map(render).map(file => ({
+    path: file,
+    exists: utils.path.pathExists(path.resolve(projectRoot, file))
+  }));
+  
+  const protocols = (template.context.protocols || []).map(render).map(protocol => {
+    const protocolPath = path.join('docs', 'protocol', protocol.endsWith('.md') ? protocol : `${protocol}.md`);
+    return {
+      name: protocol,
+      path: protocolPath,
+      exists: utils.path.pathExists(path.resolve(projectRoot, protocolPath))
+    };
+  });
+  
+  const spec = (template.context.spec || []).map(render).map(ref => ({
+    ref,
+    matches: resolveSpecReference(ref, specIndex)
+  }));
+  
+  return {
+    success: true,
+    errors: [],
+    value: {
+      name,
+      description: template.description,
+      inheritance: template.inheritance,
+      path: template.path,
+      parameters: validation.value,
+      content: render(template.body),
+      context: { files, spec, protocols },
+      commands: template.commands || [],
+      unresolvedVariables: Array.from(unresolved)
+    }
+  };
+}
+
+module.exports = {
+  parseYaml,
+  parseFrontMatter,
+  loadTemplates,
+  resolveTemplate,
+  validateParameters,
+  renderTemplate,
+  resolveSpecReference,
+  buildSessionContext
+};
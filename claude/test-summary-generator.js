@@ -3,17 +3,67 @@
 /**
  * Structured Test Summary Generator for Claude Desktop
  * Creates concise, scannable test result summaries
+ * Also writes every test as a normalized report to .cache/test-reports/test-summary.json and .xml,
+ * and records the run in the test history (claude/test-summaries/trends.md)
  */
 
 const fs = require('fs');
+const os = require('os');
 const path = require('path');
-const { execSync } = require('child_process');
+const { execSync, spawnSync } = require('child_process');
+const utils = require('../utils');
+const flakyTests = require('../scripts/flaky-tests');
+const testTrends = require('../scripts/test-trends');
 
 // Configuration
 const ROOT_DIR = path.join(__dirname, '..');
 const IMPL_DIR = path.join(ROOT_DIR, 'generated_implementation');
 const OUTPUT_DIR = path.join(__dirname, 'test-summaries');
 
+/**
+ * Get the timeout of a service's test run
+ * @returns {number} Timeout in seconds (development.testing.summary.timeoutSeconds)
+ */
+function getTimeoutSeconds() {
+  return utils.config.get('development.testing.summary.timeoutSeconds', 600);
+}
+
+/**
+ * Fill the summary of a JavaScript service from Jest JSON results
+ * @param {Object} result - Test results, updated in place
+ * @param {Object} testResults - Parsed `jest --json` output
+ * @param {string} servicePath - Path to the service
+ */
+function applyJestResults(result, testResults, servicePath) {
+  result.success = testResults.success;
+  result.summary.pass = testResults.numPassedTests;
+  result.summary.fail = testResults.numFailedTests;
+  result.summary.skip = testResults.numPendingTests;
+  result.suites = utils.testReport.fromJestJson(testResults, servicePath);
+  
+  // Get coverage if available
+  if (testResults.coverageMap) {
+    const covSummary = testResults.coverageMap.getCoverageSummary();
+    result.summary.coverage = `${covSummary.lines.pct}%`;
+  }
+  
+  // Get failures
+  for (const testResult of testResults.testResults) {
+    for (const assertionResult of testResult.assertionResults) {
+      if (assertionResult.status === 'failed') {
+        const name = assertionResult.fullName || assertionResult.title;
+        const file = path.relative(servicePath, testResult.testFilePath);
+        result.summary.failures.push({
+          name,
+          file,
+          message: assertionResult.failureMessages[0]?.split('\n')[0] || 'Unknown error',
+          test: flakyTests.testSelector('js', { name: file }, { name, file })
+        });
+      }
+    }
+  }
+}
+
 /**
  * Run tests for a JavaScript service
  * @param {string} servicePath - Path to the service
@@ -55,41 +105,17 @@ function runJsTests(servicePath) {
         // Run Jest with JSON output
         const output = execSync('npx jest --json', {
           cwd: servicePath,
-          timeout: 30000,
+          timeout: getTimeoutSeconds() * 1000,
           encoding: 'utf8'
         });
         
         // Parse JSON output
-        const testResults = JSON.parse(output);
-        
-        result.success = testResults.success;
-        result.summary.pass = testResults.numPassedTests;
-        result.summary.fail = testResults.numFailedTests;
-        result.summary.skip = testResults.numPendingTests;
-        
-        // Get coverage if available
-        if (testResults.coverageMap) {
-          const covSummary = testResults.coverageMap.getCoverageSummary();
-          result.summary.coverage = `${covSummary.lines.pct}%`;
-        }
-        
-        // Get failures
-        for (const testResult of testResults.testResults) {
-          for (const assertionResult of testResult.assertionResults) {
-            if (assertionResult.status === 'failed') {
-              result.summary.failures.push({
-                name: assertionResult.fullName || assertionResult.title,
-                file: path.relative(servicePath, testResult.testFilePath),
-                message: assertionResult.failureMessages[0]?.split('\n')[0] || 'Unknown error'
-              });
-            }
-          }
-        }
+        applyJestResults(result, JSON.parse(output), servicePath);
       } else {
         // Fallback to npm test
         const output = execSync('npm test', {
           cwd: servicePath,
-          timeout: 30000,
+          timeout: getTimeoutSeconds() * 1000,
           encoding: 'utf8'
         });
         
@@ -111,6 +137,14 @@ function runJsTests(servicePath) {
       result.success = false;
       result.output = error.stdout?.toString() || error.message;
       
+      // Jest exits non-zero on failing tests but still prints its JSON results
+      const jestResults = utils.error.trySync(() => JSON.parse(result.output), null).value;
+      if (jestResults?.testResults) {
+        applyJestResults(result, jestResults, servicePath);
+        result.output = '';
+        return result;
+      }
+      
       // Basic parsing of error output
       const passMatch = result.output.match(/(\d+)\s+passing/i);
       const failMatch = result.output.match(/(\d+)\s+failing/i);
@@ -172,12 +206,12 @@ function runPythonTests(servicePath) {
     }
     
     // Run tests with pytest
+    const tempXmlPath = path.join(servicePath, 'test-results.xml');
     try {
       // Run pytest with JUnit XML output for better parsing
-      const tempXmlPath = path.join(servicePath, 'test-results.xml');
       execSync(`python -m pytest -v --junitxml=${tempXmlPath}`, {
         cwd: servicePath,
-        timeout: 30000
+        timeout: getTimeoutSeconds() * 1000
       });
       
       // Parse XML output if available
@@ -199,9 +233,6 @@ function runPythonTests(servicePath) {
           result.summary.skip = skipped;
           result.success = failures === 0;
         }
-        
-        // Clean up temp file
-        fs.unlinkSync(tempXmlPath);
       }
     } catch (error) {
       result.success = false;
@@ -234,11 +265,19 @@ function runPythonTests(servicePath) {
       }
     }
     
+    // The JUnit XML is written whether or not tests fail
+    if (fs.existsSync(tempXmlPath)) {
+      result.suites = utils.testReport.fromJUnitXml(fs.readFileSync(tempXmlPath, 'utf8'), { rootDir: servicePath, python: true });
+      
+      // Clean up temp file
+      fs.unlinkSync(tempXmlPath);
+    }
+    
     // Try to get coverage if pytest-cov is available
     try {
       const coverageOutput = execSync('python -m pytest --cov=.', {
         cwd: servicePath,
-        timeout: 30000,
+        timeout: getTimeoutSeconds() * 1000,
         encoding: 'utf8'
       });
       
@@ -256,8 +295,26 @@ function runPythonTests(servicePath) {
   return result;
 }
 
+/**
+ * Build report suites from `go test -json` output
+ * @param {string} output - Output with one JSON event per line
+ * @param {string} servicePath - Path to the service
+ * @param {string} stderr - stderr of go test, with compiler errors of older Go versions
+ * @returns {Array<Object>} Suites
+ */
+function goSuites(output, servicePath, stderr = null) {
+  const events = output.split('\n')
+    .filter(line => line.startsWith('{'))
+    .map(line => utils.error.trySync(() => JSON.parse(line), null).value)
+    .filter(Boolean);
+  const goMod = fs.readFileSync(path.join(servicePath, 'go.mod'), 'utf8');
+  const modulePath = (goMod.match(/^module\s+(\S+)/m) || [])[1] || null;
+  return utils.testReport.fromGoTestEvents(events, { modulePath, rootDir: path.resolve(servicePath), buildOutput: stderr });
+}
+
 /**
  * Run tests for a Go service
+ * Tests and subtests are counted separately, per package; coverage is weighted by statements.
  * @param {string} servicePath - Path to the service
  * @returns {Object} Test results
  */
@@ -274,104 +331,311 @@ function runGoTests(servicePath) {
     }
   };
   
-  try {
-    // Check if go.mod exists
-    if (!fs.existsSync(path.join(servicePath, 'go.mod'))) {
-      result.output = 'No go.mod found';
-      return result;
+  // Check if go.mod exists
+  if (!fs.existsSync(path.join(servicePath, 'go.mod'))) {
+    result.output = 'No go.mod found';
+    return result;
+  }
+  
+  const timeoutSeconds = getTimeoutSeconds();
+  const profile = path.join(os.tmpdir(), `test-summary-${process.pid}-${Date.now()}.coverprofile`);
+  const args = ['test', './...', '-json', `-timeout=${timeoutSeconds}s`, `-coverprofile=${profile}`];
+  if (utils.config.get('development.testing.go.race', false)) args.push('-race');
+  
+  // go test stops at -timeout itself and names the hanging tests; the kill is the last resort
+  const started = Date.now();
+  const run = spawnSync('go', args, { cwd: servicePath, encoding: 'utf8', timeout: (timeoutSeconds + 60) * 1000, maxBuffer: 256 * 1024 * 1024 });
+  if (run.error && !run.stdout) {
+    result.output = `Error running tests: ${run.error.message}`;
+    return result;
+  }
+  
+  result.suites = goSuites(run.stdout, servicePath, run.stderr);
+  result.summary.subtests = { pass: 0, fail: 0, skip: 0 };
+  result.summary.durationSeconds = Math.round((Date.now() - started) / 100) / 10;
+  
+  const coverage = utils.error.trySync(() => utils.coverage.goStatementCoverage(fs.readFileSync(profile, 'utf8')), null).value;
+  utils.error.trySync(() => fs.unlinkSync(profile));
+  if (coverage && coverage.statements > 0) {
+    result.summary.coverage = `${coverage.percent}%`;
+  }
+  
+  const isFailed = test => test.status === 'failed' || test.status === 'error';
+  result.summary.packages = result.suites.map(suite => {
+    const tests = suite.tests.filter(test => !test.kind || test.kind !== 'build');
+    for (const test of tests.filter(entry => entry.name !== suite.name)) {
+      const counts = test.parent ? result.summary.subtests : result.summary;
+      counts[{ passed: 'pass', skipped: 'skip' }[test.status] || 'fail']++;
     }
     
-    // Run tests with coverage
-    try {
-      // Use -json for better parsing
-      const output = execSync('go test ./... -json -cover', {
-        cwd: servicePath,
-        timeout: 30000,
-        encoding: 'utf8'
-      });
-      
-      // Parse JSON output (one JSON object per line)
-      const lines = output.split('\n').filter(line => line.trim());
-      
-      for (const line of lines) {
-        try {
-          const testResult = JSON.parse(line);
-          
-          if (testResult.Action === 'pass') {
-            result.summary.pass++;
-          } else if (testResult.Action === 'fail') {
-            result.summary.fail++;
-            
-            result.summary.failures.push({
-              name: testResult.Test,
-              file: testResult.Package,
-              message: testResult.Output?.[0] || 'Test failed'
-            });
-          } else if (testResult.Action === 'skip') {
-            result.summary.skip++;
-          }
-          
-          // Extract coverage if available
-          if (testResult.Action === 'output' && testResult.Output?.includes('coverage:')) {
-            const coverageMatch = testResult.Output.match(/coverage:\s+(\d+\.\d+)%/);
-            if (coverageMatch) {
-              result.summary.coverage = `${coverageMatch[1]}%`;
-            }
-          }
-        } catch (err) {
-          // Skip lines that aren't valid JSON
-        }
-      }
-      
-      result.success = result.summary.fail === 0;
-    } catch (error) {
-      result.success = false;
-      result.output = error.stdout?.toString() || error.message;
+    for (const test of suite.tests.filter(isFailed)) {
+      if (test.kind === 'subtest') continue;
       
-      // Try to parse error output
-      const lines = result.output.split('\n');
-      let inFailureBlock = false;
-      let currentTest = null;
-      
-      for (const line of lines) {
-        // Look for test failures
-        if (line.includes('--- FAIL:')) {
-          inFailureBlock = true;
-          currentTest = line.split('--- FAIL:')[1].trim();
-          continue;
-        }
-        
-        if (inFailureBlock && line.includes('FAIL')) {
-          const parts = line.split('\t');
-          if (parts.length >= 2) {
-            result.summary.failures.push({
-              name: currentTest,
-              file: parts[0].trim(),
-              message: parts.length > 2 ? parts[1].trim() : 'Test failed'
-            });
-          }
-          inFailureBlock = false;
-          currentTest = null;
+      if (test.kind === 'build') {
+        // One failure per compiler diagnostic
+        for (const diagnostic of test.diagnostics || [{ file: suite.path || suite.name, message: test.message }]) {
+          result.summary.failures.push({
+            name: suite.path || suite.name,
+            file: diagnostic.line ? `${diagnostic.file}:${diagnostic.line}${diagnostic.column ? `:${diagnostic.column}` : ''}` : diagnostic.file,
+            message: diagnostic.message,
+            kind: 'build',
+            test: null
+          });
         }
+        continue;
       }
       
-      // Count total tests
-      const passMatches = result.output.match(/--- PASS: /g);
-      const failMatches = result.output.match(/--- FAIL: /g);
-      const skipMatches = result.output.match(/--- SKIP: /g);
+      const isPackage = test.name === suite.name;
+      result.summary.failures.push({
+        name: isPackage ? suite.path || suite.name : test.name,
+        file: test.file ? `${test.file}${test.line ? `:${test.line}` : ''}` : suite.path || suite.name,
+        message: (test.message || 'Test failed').split('\n')[0],
+        kind: test.kind,
+        test: isPackage ? null : test.name
+      });
+    }
+    
+    const pkgCoverage = coverage && coverage.packages[suite.name];
+    return {
+      name: suite.path || suite.name,
+      status: suite.buildFailed ? 'build failed' : suite.tests.some(isFailed) ? 'FAIL' : tests.length === 0 ? 'no tests' : 'ok',
+      tests: tests.filter(test => test.name !== suite.name && !test.parent).length,
+      durationSeconds: suite.durationSeconds,
+      coverage: pkgCoverage && pkgCoverage.statements > 0 ? `${pkgCoverage.percent}%` : null
+    };
+  });
+  result.summary.races = result.summary.failures.filter(failure => failure.kind === 'race').length;
+  
+  result.success = run.status === 0;
+  if (!result.success) {
+    // The output of the failed packages, as `go test` prints it without -json
+    const failedPackages = new Set(result.suites.filter(suite => suite.tests.some(isFailed)).map(suite => suite.name));
+    const text = run.stdout.split('\n')
+      .map(line => utils.error.trySync(() => JSON.parse(line), null).value)
+      .filter(event => event && event.Output && (event.Action === 'build-output' || (event.Action === 'output' && failedPackages.has(event.Package))))
+      .map(event => event.Output)
+      .join('');
+    result.output = [run.error ? `Killed after ${timeoutSeconds + 60}s: ${run.error.message}` : '', (run.stderr || '').trim(), text.trim()].filter(Boolean).join('\n');
+  }
+  
+  return result;
+}
+
+/**
+ * Fill the summary counts and failures of a service from its report suites
+ * @param {Object} result - Test results, updated in place
+ * @param {string} serviceType - Service type, for the rerun selector of each failure
+ * @returns {Object} The test results
+ */
+function applySuites(result, serviceType) {
+  for (const suite of result.suites) {
+    for (const test of suite.tests) {
+      result.summary[{ passed: 'pass', skipped: 'skip' }[test.status] || 'fail']++;
+      if (test.status !== 'failed' && test.status !== 'error') continue;
       
-      result.summary.pass = passMatches ? passMatches.length : 0;
-      result.summary.fail = failMatches ? failMatches.length : 0;
-      result.summary.skip = skipMatches ? skipMatches.length : 0;
+      result.summary.failures.push({
+        name: serviceType === 'rust' ? test.name : `${suite.name}.${test.name}`,
+        file: test.file ? `${test.file}${test.line ? `:${test.line}` : ''}` : suite.name,
+        message: (test.message || 'Test failed').split('\n')[0],
+        test: flakyTests.testSelector(serviceType, suite, test)
+      });
+    }
+  }
+  return result;
+}
+
+/**
+ * Find the compiler errors in Rust or Java build output
+ * @param {string} output - Build output (cargo, Maven, Gradle)
+ * @param {string} servicePath - Path to the service, absolute paths are made relative to it
+ * @returns {Array<Object>} Summary failures of kind build, one per diagnostic
+ */
+function findBuildErrors(output, servicePath) {
+  const patterns = [
+    /^error(?:\[\w+\])?: (?<message>.+)\n\s*--> (?<file>[^\n:]+):(?<line>\d+):(?<column>\d+)/gm,       // rustc
+    /^\[ERROR\] (?<file>\S+\.(?:java|kt)):\[(?<line>\d+),(?<column>\d+)\] (?<message>.+)$/gm,          // Maven
+    /^(?<file>\S+\.java):(?<line>\d+): error: (?<message>.+)$/gm,                                      // javac (Gradle)
+    /^e: (?:file:\/\/)?(?<file>\S+\.kt):(?<line>\d+):(?<column>\d+) (?<message>.+)$/gm                  // kotlinc (Gradle)
+  ];
+  const failures = new Map();
+  
+  for (const pattern of patterns) {
+    for (const { groups } of String(output).matchAll(pattern)) {
+      const file = path.isAbsolute(groups.file) ? path.relative(servicePath, groups.file) : groups.file;
+      const location = `${file}:${groups.line}${groups.column ? `:${groups.column}` : ''}`;
       
-      // Extract coverage if available
-      const coverageMatch = result.output.match(/coverage:\s+(\d+\.\d+)%/);
-      if (coverageMatch) {
-        result.summary.coverage = `${coverageMatch[1]}%`;
+      // Maven repeats the compiler errors in its build summary
+      if (!failures.has(`${location} ${groups.message}`)) {
+        failures.set(`${location} ${groups.message}`, { name: file, file: location, message: groups.message.trim(), kind: 'build', test: null });
       }
     }
-  } catch (err) {
-    result.output = `Error running tests: ${err.message}`;
+  }
+  
+  return [...failures.values()];
+}
+
+/**
+ * Run a service's test command within the summary timeout
+ * @param {string} servicePath - Path to the service
+ * @param {string} command - Command
+ * @param {Array<string>} args - Arguments
+ * @returns {Object} spawnSync result
+ */
+function spawnTests(servicePath, command, args) {
+  return spawnSync(command, args, { cwd: servicePath, encoding: 'utf8', timeout: getTimeoutSeconds() * 1000, maxBuffer: 256 * 1024 * 1024 });
+}
+
+/**
+ * Run tests for a Rust service
+ * Uses libtest JSON on nightly toolchains and the text output otherwise; coverage needs cargo-llvm-cov.
+ * @param {string} servicePath - Path to the service
+ * @returns {Object} Test results
+ */
+function runRustTests(servicePath) {
+  const result = {
+    success: false,
+    output: '',
+    summary: {
+      pass: 0,
+      fail: 0,
+      skip: 0,
+      coverage: 'N/A',
+      failures: []
+    }
+  };
+  
+  if (!fs.existsSync(path.join(servicePath, 'Cargo.toml'))) {
+    result.output = 'No Cargo.toml found';
+    return result;
+  }
+  
+  // rustup picks the toolchain per directory (rust-toolchain.toml)
+  const nightly = /nightly/.test(spawnSync('rustc', ['--version'], { cwd: servicePath, encoding: 'utf8' }).stdout || '');
+  const llvmCov = spawnSync('cargo', ['llvm-cov', '--version'], { cwd: servicePath, encoding: 'utf8' }).status === 0;
+  const lcov = path.join(os.tmpdir(), `test-summary-${process.pid}-${Date.now()}.lcov`);
+  
+  const args = llvmCov ? ['llvm-cov', '--lcov', '--output-path', lcov, '--no-fail-fast'] : ['test', '--no-fail-fast'];
+  if (nightly) args.push('--', '-Z', 'unstable-options', '--format', 'json', '--report-time');
+  
+  const started = Date.now();
+  const run = spawnTests(servicePath, 'cargo', args);
+  if (run.error && !run.stdout) {
+    result.output = `Error running tests: ${run.error.message}`;
+    return result;
+  }
+  
+  result.suites = nightly ? utils.testReport.fromLibtestJson(run.stdout, run.stderr) : utils.testReport.fromCargoOutput(run.stdout, run.stderr);
+  result.summary.durationSeconds = Math.round((Date.now() - started) / 100) / 10;
+  applySuites(result, 'rust');
+  
+  const lcovText = utils.error.trySync(() => fs.readFileSync(lcov, 'utf8'), null).value;
+  utils.error.trySync(() => fs.unlinkSync(lcov));
+  if (lcovText) {
+    const counts = Object.values(utils.coverage.fromLcov(lcovText, servicePath)).map(utils.coverage.countLines);
+    const total = counts.reduce((sum, count) => sum + count.total, 0);
+    if (total > 0) result.summary.coverage = `${Math.round((counts.reduce((sum, count) => sum + count.covered, 0) / total) * 1000) / 10}%`;
+  }
+  
+  result.success = run.status === 0;
+  if (!result.success) {
+    if (result.summary.failures.length === 0) result.summary.failures.push(...findBuildErrors(run.stderr, servicePath));
+    
+    // Compiler errors and the panics of the failed tests; cargo's progress lines are left out
+    const errors = (run.stderr || '').split('\n').filter(line => !/^\s*(Compiling|Running|Doc-tests|Finished|Blocking|Downloading|Downloaded|Updating|Locking)\b/.test(line));
+    const failures = nightly
+      ? result.suites.flatMap(suite => suite.tests).filter(test => test.status === 'failed').map(test => `---- ${test.name} ----\n${test.message}`)
+      : [run.stdout.slice(Math.max(run.stdout.indexOf('\nfailures:\n'), 0)).trim()];
+    result.output = [run.error ? `Killed after ${getTimeoutSeconds()}s: ${run.error.message}` : '', errors.join('\n').trim(), ...failures].filter(Boolean).join('\n');
+  }
+  
+  return result;
+}
+
+/**
+ * Find the files a build tool wrote during a test run
+ * @param {string} dir - Directory to search, with the output of every module
+ * @param {RegExp} pattern - Pattern for the path relative to dir
+ * @param {number} since - Start of the run (ms); older files are from earlier runs
+ * @param {number} depth - Depth of dir below the service
+ * @returns {Array<string>} Absolute paths
+ */
+function findFreshFiles(dir, pattern, since, depth = 0) {
+  const files = [];
+  
+  for (const entry of utils.error.trySync(() => fs.readdirSync(dir, { withFileTypes: true }), []).value) {
+    const file = path.join(dir, entry.name);
+    if (entry.isDirectory()) {
+      if (depth < 8 && !['node_modules', '.git', '.gradle', 'src'].includes(entry.name)) files.push(...findFreshFiles(file, pattern, since, depth + 1));
+    } else if (pattern.test(file.split(path.sep).join('/')) && fs.statSync(file).mtimeMs >= since) {
+      files.push(file);
+    }
+  }
+  
+  return files;
+}
+
+/**
+ * Run tests for a Java service (Maven or Gradle)
+ * Tests are read from the Surefire or Gradle JUnit XML reports of the run, line coverage from
+ * JaCoCo XML when the build writes it.
+ * @param {string} servicePath - Path to the service
+ * @param {string} serviceType - java-maven or java-gradle
+ * @returns {Object} Test results
+ */
+function runJavaTests(servicePath, serviceType) {
+  const result = {
+    success: false,
+    output: '',
+    summary: {
+      pass: 0,
+      fail: 0,
+      skip: 0,
+      coverage: 'N/A',
+      failures: []
+    }
+  };
+  
+  const maven = serviceType === 'java-maven';
+  const wrapper = maven ? 'mvnw' : 'gradlew';
+  const command = fs.existsSync(path.join(servicePath, wrapper)) ? `./${wrapper}` : maven ? 'mvn' : 'gradle';
+  const buildFile = utils.error.trySync(() => fs.readFileSync(path.join(servicePath, 'build.gradle'), 'utf8'), '').value;
+  // Keep testing the other modules after a failure, so every failed test is reported
+  const args = maven ? ['-B', 'test', '-fae'] : ['test', '--continue', ...(buildFile.includes('jacoco') ? ['jacocoTestReport'] : [])];
+  
+  // Report files can be a second older than the run on filesystems with coarse timestamps
+  const started = Date.now() - 1000;
+  const run = spawnTests(servicePath, command, args);
+  if (run.error && !run.stdout) {
+    result.output = `Error running tests: ${run.error.message}`;
+    return result;
+  }
+  
+  const reports = findFreshFiles(servicePath, maven ? /\/target\/surefire-reports\/TEST-[^/]+\.xml$/ : /\/build\/test-results\/[^/]+\/TEST-[^/]+\.xml$/, started);
+  result.suites = reports.flatMap(file => utils.testReport.fromJUnitXml(fs.readFileSync(file, 'utf8'), { rootDir: servicePath }));
+  result.summary.durationSeconds = Math.round((Date.now() - started - 1000) / 100) / 10;
+  applySuites(result, serviceType);
+  
+  // The report-level counters of each JaCoCo report follow its last package
+  let covered = 0;
+  let missed = 0;
+  for (const file of findFreshFiles(servicePath, /\/(jacoco|jacocoTestReport)\.xml$/, started)) {
+    const xml = fs.readFileSync(file, 'utf8');
+    const counter = /<counter type="LINE" missed="(\d+)" covered="(\d+)"\/>/.exec(xml.slice(xml.lastIndexOf('</package>')));
+    if (counter) {
+      missed += Number(counter[1]);
+      covered += Number(counter[2]);
+    }
+  }
+  if (covered + missed > 0) result.summary.coverage = `${Math.round((covered / (covered + missed)) * 1000) / 10}%`;
+  
+  result.success = run.status === 0;
+  if (!result.success) {
+    const output = `${run.stdout}\n${run.stderr || ''}`;
+    if (result.summary.failures.length === 0) result.summary.failures.push(...findBuildErrors(output, servicePath));
+    
+    // Maven and Gradle print their errors among a lot of progress output
+    const errors = output.split('\n').filter(line => /^\[ERROR\]|FAILED|error:|^e: |^> /.test(line));
+    result.output = [run.error ? `Killed after ${getTimeoutSeconds()}s: ${run.error.message}` : '', errors.length > 0 ? errors.join('\n') : output.trim().split('\n').slice(-20).join('\n')].filter(Boolean).join('\n');
   }
   
   return result;
@@ -380,7 +644,7 @@ function runGoTests(servicePath) {
 /**
  * Determine the type of a service
  * @param {string} servicePath - Path to the service
- * @returns {string} Service type (js, python, go, etc.)
+ * @returns {string} Service type (js, python, go, rust, java-maven, java-gradle or unknown)
  */
 function getServiceType(servicePath) {
   if (fs.existsSync(path.join(servicePath, 'package.json'))) {
@@ -392,14 +656,112 @@ function getServiceType(servicePath) {
     return 'go';
   } else if (fs.existsSync(path.join(servicePath, 'Cargo.toml'))) {
     return 'rust';
-  } else if (fs.existsSync(path.join(servicePath, 'pom.xml')) ||
-             fs.existsSync(path.join(servicePath, 'build.gradle'))) {
-    return 'java';
+  } else if (fs.existsSync(path.join(servicePath, 'pom.xml'))) {
+    return 'java-maven';
+  } else if (fs.existsSync(path.join(servicePath, 'build.gradle')) ||
+             fs.existsSync(path.join(servicePath, 'build.gradle.kts'))) {
+    return 'java-gradle';
   } else {
     return 'unknown';
   }
 }
 
+/**
+ * Get the run_impl_tests selector for a failure
+ * @param {string} serviceType - Service type (js, python, go, rust, java-maven, java-gradle)
+ * @param {Object} failure - Failure from the summary
+ * @returns {string|null} Test selector, or null if the failure cannot be rerun alone
+ */
+function getTestSelector(serviceType, failure) {
+  switch (serviceType) {
+    case 'go':
+      // A data race is a bug even when a rerun happens to pass
+      return failure.test && failure.kind !== 'race' ? failure.test.split('/')[0] : null;
+    case 'js':
+      // Jest failures are rerun by name; other runners only name the file
+      return failure.test || (failure.file && failure.file !== 'Unknown' ? failure.file : null);
+    case 'python': {
+      const nodeId = (failure.name || '').match(/(\S+::[^\s\[]+)/);
+      return nodeId ? nodeId[1] : null;
+    }
+    case 'rust':
+    case 'java-maven':
+    case 'java-gradle':
+      return failure.test || null;
+    default:
+      return null;
+  }
+}
+
+/**
+ * Rerun failed tests in isolation and stop flaky or quarantined ones from failing the service
+ * The failures stay in the summary, marked as flaky or quarantined.
+ * @param {string} serviceName - Name of the service
+ * @param {Object} testResults - Test results, updated in place
+ * @returns {Object} Test results
+ */
+function retryFailedTests(serviceName, testResults) {
+  const servicePath = path.join(IMPL_DIR, serviceName);
+  const serviceType = getServiceType(servicePath);
+  
+  const failures = testResults.summary.failures;
+  const selectors = failures.map(failure => getTestSelector(serviceType, failure));
+  
+  if (testResults.success || failures.length === 0 || selectors.includes(null)) {
+    return testResults;
+  }
+  
+  console.log(`Rerunning ${new Set(selectors).size} failed test(s) in isolation for: ${serviceName}`);
+  const retry = flakyTests.retryFailures({ language: serviceType, tests: [...new Set(selectors)], implDir: servicePath });
+  const byTest = new Map(retry.tests.map(result => [result.test, result]));
+  
+  failures.forEach((failure, i) => {
+    const result = byTest.get(selectors[i]);
+    failure.flaky = result.classification === 'flaky';
+    failure.quarantined = result.quarantined;
+  });
+  
+  testResults.summary.quarantined = retry.tests.filter(result => result.quarantined).length;
+  testResults.success = retry.gating.length === 0;
+  testResults.retry = retry;
+  return testResults;
+}
+
+/**
+ * Get the report suites of a service
+ * Runners without per-test results are reported from the summary failures, or as one test.
+ * @param {string} serviceName - Name of the service
+ * @param {Object} testResults - Test results
+ * @returns {Array<Object>} Suites tagged with the service, flaky and quarantined tests marked
+ */
+function getReportSuites(serviceName, testResults) {
+  const serviceType = getServiceType(path.join(IMPL_DIR, serviceName));
+  let suites = (testResults.suites || []).filter(suite => suite.tests.length > 0);
+  
+  if (suites.length === 0) {
+    const tests = testResults.summary.failures.map(failure => utils.testReport.createTest({
+      name: failure.name || failure.file,
+      status: 'failed',
+      message: failure.message,
+      file: failure.file !== 'Unknown' ? failure.file : null,
+      flaky: failure.flaky || undefined,
+      quarantined: failure.quarantined || undefined
+    }));
+    if (tests.length === 0) {
+      tests.push(utils.testReport.createTest({
+        name: serviceName,
+        status: testResults.success ? 'passed' : 'error',
+        message: testResults.success ? null : testResults.output.split('\n').slice(0, 20).join('\n')
+      }));
+    }
+    suites = [{ name: serviceName, tests }];
+  } else {
+    flakyTests.annotateReport({ suites }, serviceType, testResults.retry);
+  }
+  
+  return suites.map(suite => ({ ...suite, service: serviceName }));
+}
+
 /**
  * Run tests for a service
  * @param {string} serviceName - Name of the service
@@ -438,31 +800,10 @@ function runTests(serviceName) {
     case 'go':
       return runGoTests(servicePath);
     case 'rust':
-      // Basic placeholder, would need Rust-specific testing implementation
-      return {
-        success: false,
-        output: 'Rust testing not yet implemented',
-        summary: {
-          pass: 0,
-          fail: 0,
-          skip: 0,
-          coverage: 'N/A',
-          failures: []
-        }
-      };
-    case 'java':
-      // Basic placeholder, would need Java-specific testing implementation
-      return {
-        success: false,
-        output: 'Java testing not yet implemented',
-        summary: {
-          pass: 0,
-          fail: 0,
-          skip: 0,
-          coverage: 'N/A',
-          failures: []
-        }
-      };
+      return runRustTests(servicePath);
+    case 'java-maven':
+    case 'java-gradle':
+      return runJavaTests(servicePath, serviceType);
     default:
       return {
         success: false,
@@ -500,9 +841,39 @@ function generateTestSummary(serviceName, testResults) {
   lines.push(`TYPE: ${serviceType}`);
   lines.push(`STATUS: ${testResults.success ? 'PASS' : 'FAIL'}`);
   lines.push(`PASS: ${testResults.summary.pass} FAIL: ${testResults.summary.fail} SKIP: ${testResults.summary.skip}`);
+  if (testResults.summary.subtests) {
+    const { subtests } = testResults.summary;
+    lines.push(`SUBTESTS: PASS: ${subtests.pass} FAIL: ${subtests.fail} SKIP: ${subtests.skip}`);
+  }
+  if (testResults.summary.packages) {
+    const count = status => testResults.summary.packages.filter(pkg => pkg.status === status).length;
+    lines.push(`PACKAGES: ${count('ok')} ok, ${count('FAIL')} failed, ${count('build failed')} build failed, ${count('no tests')} without tests`);
+  }
+  if (testResults.summary.races) {
+    lines.push(`RACES: ${testResults.summary.races}`);
+  }
+  if (testResults.summary.durationSeconds !== undefined) {
+    lines.push(`DURATION: ${testResults.summary.durationSeconds}s`);
+  }
+  if (testResults.summary.quarantined) {
+    lines.push(`QUARANTINED: ${testResults.summary.quarantined} (flaky, not gating)`);
+  }
   lines.push(`COVERAGE: ${testResults.summary.coverage}`);
   lines.push('');
   
+  // Add per-package results
+  if (testResults.summary.packages && testResults.summary.packages.length > 0) {
+    lines.push('## PACKAGES');
+    lines.push('');
+    
+    for (const pkg of testResults.summary.packages) {
+      const details = [`${pkg.tests} test(s)`, pkg.durationSeconds !== null && `${pkg.durationSeconds}s`, pkg.coverage && `coverage ${pkg.coverage}`].filter(Boolean);
+      lines.push(`${pkg.status} ${pkg.name} (${details.join(', ')})`);
+    }
+    
+    lines.push('');
+  }
+  
   // Add failure details if any
   if (testResults.summary.failures.length > 0) {
     lines.push('## FAILURES');
@@ -510,7 +881,8 @@ function generateTestSummary(serviceName, testResults) {
     
     for (let i = 0; i < testResults.summary.failures.length; i++) {
       const failure = testResults.summary.failures[i];
-      lines.push(`${i + 1}. ${failure.name} - ${failure.file} - ${failure.message}`);
+      const tags = [failure.kind && failure.kind !== 'assertion' && failure.kind, failure.flaky && 'flaky', failure.quarantined && 'quarantined'].filter(Boolean);
+      lines.push(`${i + 1}. ${failure.name} - ${failure.file} - ${failure.message}${tags.length ? ` [${tags.join(', ')}]` : ''}`);
     }
     
     lines.push('');
@@ -552,9 +924,11 @@ function generateAllTestSummaries() {
   
   // Generate test summaries for each service
   const summaries = [];
+  const suites = [];
+  const started = Date.now();
   
   for (const service of services) {
-    const testResults = runTests(service);
+    const testResults = retryFailedTests(service, runTests(service));
     const summary = generateTestSummary(service, testResults);
     
     fs.writeFileSync(path.join(OUTPUT_DIR, `${service}.md`), summary);
@@ -565,6 +939,20 @@ function generateAllTestSummaries() {
       success: testResults.success,
       results: testResults.summary
     });
+    suites.push(...getReportSuites(service, testResults));
+  }
+  
+  const report = utils.testReport.createReport({ source: 'test-summary', suites });
+  const written = utils.testReport.writeReport(report);
+  if (written.success) {
+    console.log(`Test report written to: ${written.value['test-summary.json']}`);
+  } else {
+    console.error(`Error writing test report: ${written.error.message}`);
+  }
+  
+  const recorded = testTrends.recordReport(report, { durationSeconds: Math.round((Date.now() - started) / 100) / 10 });
+  if (!recorded.success) {
+    console.error(`Error recording the test history: ${recorded.error.message}`);
   }
   
   // Generate an index file
@@ -580,6 +968,10 @@ function generateAllTestSummaries() {
     indexLines.push(`- ${status} [${summary.service}](./${summary.service}.md) - Pass: ${summary.results.pass}, Fail: ${summary.results.fail}, Coverage: ${summary.results.coverage}`);
   }
   
+  if (recorded.success) {
+    indexLines.push('', 'Newly failing tests, duration regressions and pass rates over time: [trends](./trends.md)');
+  }
+  
   fs.writeFileSync(path.join(OUTPUT_DIR, 'index.md'), indexLines.join('\n'));
   console.log(`Index written to: ${path.join(OUTPUT_DIR, 'index.md')}`);
 }
@@ -0,0 +1,589 @@
+#!/usr/bin/env node
+
+/**
+ * DStudio Affected Test Graph
+ * Selects the tests affected by a change from the reverse-dependency graph of the implementation
+ *
+ * Usage:
+ *   node scripts/affected-graph.js [--since ref] [--language lang] [--service name] [--out file] [--files a,b] [--json]
+ *
+ * Graphs per language (run from the implementation directory):
+ *   go     `go list -deps -json ./...` package imports; test imports count for the package's tests
+ *   js     require/import statements between files, including workspace packages
+ *   python import statements between modules; conftest.py applies to the tests below it
+ *   rust   Cargo workspace members and their path dependencies (`cargo metadata`)
+ *
+ * Every transitively affected test package is written to .cache/affected-components.txt (--out), one
+ * per line, each followed by a `#` comment with the import chain that makes it affected. With
+ * --service the graph is built for that service directory and paths are relative to it.
+ * Changed files outside the graph select the tests in their nearest directory. Exits with 3 when no
+ * graph can be built, so callers can fall back to path patterns, and with 4 when changed files have no
+ * tests near them, so callers run the full suite.
+ */
+
+const fs = require('fs');
+const path = require('path');
+const { execFileSync } = require('child_process');
+const utils = require('../utils');
+const { detectLanguage } = require('./bisect-tests');
+const logger = utils.logger.createScopedLogger('AffectedGraph');
+
+// Files at the implementation root that affect every test of the language
+const GLOBAL_FILES = {
+  go: [/^go\.(mod|sum|work)$/],
+  js: [/^package(-lock)?\.json$/, /^(yarn\.lock|pnpm-lock\.yaml|tsconfig\.json|\.babelrc)$/, /^(jest|babel|vitest)\.config\.[cm]?[jt]s$/],
+  python: [/^requirements.*\.txt$/, /^(pyproject\.toml|setup\.py|setup\.cfg|pytest\.ini|tox\.ini)$/],
+  rust: [/^Cargo\.(toml|lock)$/]
+};
+
+// Test files by language; Go test files are also listed per package by `go list`
+const TEST_FILES = {
+  go: /_test\.go$/,
+  js: /\.(test|spec)\.[cm]?[jt]sx?$|(^|\/)__tests__\//,
+  python: /(^|\/)(test_[^/]*|[^/]*_test)\.py$/,
+  java: /(^|\/)src\/test\/.*\.java$|Tests?\.java$/,
+  kotlin: /(^|\/)src\/test\/.*\.kt$|Tests?\.kt$/,
+  rust: /(^|\/)tests\/.*\.rs$/
+};
+
+const JS_EXTENSIONS = ['.js', '.mjs', '.cjs', '.jsx', '.ts', '.tsx', '.json'];
+const SKIP_DIRS = new Set(['node_modules', '.git', 'target', 'vendor', '__pycache__', '.venv', 'venv', 'dist', 'build', 'coverage']);
+
+/**
+ * Check whether a file is a test file of any language
+ * @param {string} rel - Relative file path
+ * @returns {boolean} True for Go, JS, Python, Java, Kotlin and Rust test files
+ */
+function isTestFile(rel) {
+  return Object.values(TEST_FILES).some(pattern => pattern.test(rel));
+}
+
+/**
+ * Graph of implementation units (files, packages or crates)
+ * Nodes: { id, files, isTest, component, imports: Set, testImports: Set }
+ */
+class DependencyGraph {
+  /**
+   * Create an empty graph
+   * @param {string} language - Language the graph was built for
+   */
+  constructor(language) {
+    this.language = language;
+    this.nodes = new Map();
+    this.locate = () => [];
+  }
+  
+  /**
+   * Add a node
+   * @param {Object} node - Node fields
+   * @returns {Object} Added node
+   */
+  add(node) {
+    const full = { files: [], isTest: false, component: null, imports: new Set(), testImports: new Set(), ...node };
+    this.nodes.set(full.id, full);
+    return full;
+  }
+  
+  /**
+   * Build the reverse edges: for each node, the nodes that import it
+   * @returns {Map<string, Set<string>>} Importers by node ID
+   */
+  reverse() {
+    const importers = new Map();
+    
+    for (const node of this.nodes.values()) {
+      for (const dep of node.imports) {
+        if (!importers.has(dep)) importers.set(dep, new Set());
+        importers.get(dep).add(node.id);
+      }
+    }
+    
+    return importers;
+  }
+  
+  /**
+   * Collect a node and everything it depends on, including the node's own test imports
+   * @param {string} id - Node ID
+   * @returns {Set<string>} Node IDs, the node itself included
+   */
+  dependencies(id) {
+    const start = this.nodes.get(id);
+    const seen = new Set([id]);
+    const queue = start ? [...start.imports, ...start.testImports] : [];
+    
+    while (queue.length > 0) {
+      const dep = queue.shift();
+      if (seen.has(dep) || !this.nodes.has(dep)) continue;
+      
+      seen.add(dep);
+      queue.push(...this.nodes.get(dep).imports);
+    }
+    
+    return seen;
+  }
+}
+
+/**
+ * Walk the implementation directory for files matching a predicate
+ * @param {string} rootDir - Directory to walk
+ * @param {Function} predicate - Called with the relative path
+ * @returns {Array<string>} Relative paths with forward slashes
+ */
+function listFiles(rootDir, predicate) {
+  const files = [];
+  const walk = (dir) => {
+    for (const entry of utils.error.trySync(() => fs.readdirSync(dir, { withFileTypes: true }), []).value) {
+      if (entry.isDirectory()) {
+        if (!SKIP_DIRS.has(entry.name) && !entry.name.startsWith('.')) walk(path.join(dir, entry.name));
+      } else {
+        const rel = path.relative(rootDir, path.join(dir, entry.name)).split(path.sep).join('/');
+        if (predicate(rel)) files.push(rel);
+      }
+    }
+  };
+  
+  walk(rootDir);
+  return files.sort();
+}
+
+/**
+ * Find the node owning a file by the longest matching directory
+ * @param {Array<Object>} nodes - Nodes with a `dir` field ('' for the root)
+ * @param {string} file - Relative file path
+ * @returns {Array<Object>} The owning node, if any
+ */
+function nodeByDirectory(nodes, file) {
+  const owner = nodes
+    .filter(node => node.dir === '' || file === node.dir || file.startsWith(`${node.dir}/`))
+    .sort((a, b) => b.dir.length - a.dir.length)[0];
+  return owner ? [owner] : [];
+}
+
+/**
+ * Build the Go package graph with `go list -deps -json`
+ * @param {string} implDir - Implementation directory
+ * @returns {DependencyGraph} Graph of main-module packages
+ */
+function buildGoGraph(implDir) {
+  const output = execFileSync('go', ['list', '-deps', '-json', './...'], { cwd: implDir, encoding: 'utf8', maxBuffer: 256 * 1024 * 1024, stdio: ['ignore', 'pipe', 'pipe'] });
+  const packages = output.split(/\n}\n/).filter(chunk => chunk.trim()).map(chunk => JSON.parse(`${chunk.trimEnd().replace(/}$/, '')}\n}`));
+  const graph = new DependencyGraph('go');
+  
+  for (const pkg of packages) {
+    if (pkg.Standard || !pkg.Module || !pkg.Module.Main) continue;
+    
+    const dir = path.relative(implDir, pkg.Dir).split(path.sep).join('/');
+    const hasTests = (pkg.TestGoFiles || []).length + (pkg.XTestGoFiles || []).length > 0;
+    graph.add({
+      id: pkg.ImportPath,
+      dir,
+      files: [...(pkg.GoFiles || []), ...(pkg.CgoFiles || []), ...(pkg.TestGoFiles || []), ...(pkg.XTestGoFiles || [])].map(file => dir ? `${dir}/${file}` : file),
+      isTest: hasTests,
+      component: hasTests ? (dir || '.') : null,
+      imports: new Set(pkg.Imports || []),
+      testImports: new Set([...(pkg.TestImports || []), ...(pkg.XTestImports || [])])
+    });
+  }
+  
+  // Non-Go files (testdata, embedded assets) belong to the package of their directory
+  const nodes = [...graph.nodes.values()];
+  graph.locate = file => nodeByDirectory(nodes, file);
+  return graph;
+}
+
+/**
+ * Resolve a JS import to a file of the graph
+ * @param {string} fromFile - Importing file (relative)
+ * @param {string} specifier - Import specifier
+ * @param {Set<string>} files - Known files
+ * @param {Map<string, Object>} workspaces - Workspace packages by name { dir, main }
+ * @returns {string|null} Imported file
+ */
+function resolveJsImport(fromFile, specifier, files, workspaces) {
+  let base;
+  if (specifier.startsWith('.')) {
+    base = path.posix.normalize(path.posix.join(path.posix.dirname(fromFile), specifier));
+  } else {
+    const parts = specifier.split('/');
+    const name = specifier.startsWith('@') ? parts.slice(0, 2).join('/') : parts[0];
+    const workspace = workspaces.get(name);
+    if (!workspace) return null;
+    
+    const subpath = specifier.slice(name.length + 1);
+    base = path.posix.join(workspace.dir, subpath || workspace.main || 'index');
+  }
+  
+  const candidates = [base, ...JS_EXTENSIONS.map(ext => `${base}${ext}`), ...JS_EXTENSIONS.map(ext => `${base}/index${ext}`)];
+  return candidates.map(candidate => candidate.replace(/^\.\//, '')).find(candidate => files.has(candidate)) || null;
+}
+
+/**
+ * Build the JS file import graph
+ * @param {string} implDir - Implementation directory
+ * @returns {DependencyGraph} Graph of source files
+ */
+function buildJsGraph(implDir) {
+  const graph = new DependencyGraph('js');
+  const fileList = listFiles(implDir, rel => JS_EXTENSIONS.includes(path.extname(rel)) || path.basename(rel) === 'package.json');
+  const files = new Set(fileList.filter(rel => path.basename(rel) !== 'package.json'));
+  
+  // Packages inside the implementation directory can import each other by name
+  const workspaces = new Map();
+  for (const manifest of fileList.filter(rel => path.basename(rel) === 'package.json' && rel !== 'package.json')) {
+    const pkg = utils.error.trySync(() => JSON.parse(fs.readFileSync(path.join(implDir, manifest), 'utf8')), {}).value;
+    if (pkg.name) workspaces.set(pkg.name, { dir: path.posix.dirname(manifest), main: pkg.main ? pkg.main.replace(/^\.\//, '') : null });
+  }
+  
+  const importPattern = /(?:require|import)\s*\(\s*['"]([^'"]+)['"]\s*\)|(?:import|export)\s[^'"]*?from\s*['"]([^'"]+)['"]|import\s+['"]([^'"]+)['"]/g;
+  const isTest = rel => TEST_FILES.js.test(rel);
+  
+  for (const rel of files) {
+    const node = graph.add({ id: rel, files: [rel], isTest: isTest(rel), component: isTest(rel) ? rel : null });
+    if (rel.endsWith('.json')) continue;
+    
+    const source = utils.error.trySync(() => fs.readFileSync(path.join(implDir, rel), 'utf8'), '').value;
+    for (const match of source.matchAll(importPattern)) {
+      const target = resolveJsImport(rel, match[1] || match[2] || match[3], files, workspaces);
+      if (target && target !== rel) node.imports.add(target);
+    }
+  }
+  
+  graph.locate = file => graph.nodes.has(file) ? [graph.nodes.get(file)] : [];
+  return graph;
+}
+
+/**
+ * Build the Python module import graph
+ * Modules resolve against the implementation directory, src/ and the importing file's directory.
+ * @param {string} implDir - Implementation directory
+ * @returns {DependencyGraph} Graph of modules
+ */
+function buildPythonGraph(implDir) {
+  const graph = new DependencyGraph('python');
+  const files = listFiles(implDir, rel => rel.endsWith('.py'));
+  const fileSet = new Set(files);
+  const isTest = rel => TEST_FILES.python.test(rel);
+  
+  const moduleFile = (root, moduleName) => {
+    const base = path.posix.join(root, ...moduleName.split('.'));
+    return [`${base}.py`, `${base}/__init__.py`].map(candidate => candidate.replace(/^\.\//, '')).find(candidate => fileSet.has(candidate)) || null;
+  };
+  
+  for (const rel of files) {
+    const node = graph.add({ id: rel, files: [rel], isTest: isTest(rel), component: isTest(rel) ? rel : null });
+    const source = utils.error.trySync(() => fs.readFileSync(path.join(implDir, rel), 'utf8'), '').value;
+    const dir = path.posix.dirname(rel);
+    const roots = ['.', 'src', dir];
+    
+    const addModule = (moduleName, relativeRoot) => {
+      const searchRoots = relativeRoot !== undefined ? [relativeRoot] : roots;
+      for (const root of searchRoots) {
+        const target = moduleFile(root, moduleName);
+        if (target && target !== rel) {
+          node.imports.add(target);
+          return true;
+        }
+      }
+      return false;
+    };
+    
+    for (const match of source.matchAll(/^\s*import\s+([\w., ]+)/gm)) {
+      for (const name of match[1].split(',').map(part => part.trim().split(/\s+/)[0]).filter(Boolean)) {
+        addModule(name);
+      }
+    }
+    
+    for (const match of source.matchAll(/^\s*from\s+(\.*)([\w.]*)\s+import\s+\(?([\w, *\n]+)\)?/gm)) {
+      const [, dots, moduleName, names] = match;
+      let root;
+      if (dots) {
+        root = dir;
+        for (let i = 1; i < dots.length; i++) root = path.posix.dirname(root);
+      }
+      
+      // `from pkg import module` imports a submodule when one exists, the package otherwise
+      const imported = names.split(',').map(part => part.trim().split(/\s+/)[0]).filter(name => name && name !== '*');
+      const submodules = imported.filter(name => addModule(moduleName ? `${moduleName}.${name}` : name, root));
+      if (moduleName && submodules.length < imported.length) addModule(moduleName, root);
+    }
+  }
+  
+  // conftest.py fixtures apply to every test at or below its directory
+  for (const conftest of files.filter(rel => path.posix.basename(rel) === 'conftest.py')) {
+    const dir = path.posix.dirname(conftest);
+    for (const node of graph.nodes.values()) {
+      if (node.isTest && (dir === '.' || node.id.startsWith(`${dir}/`))) node.imports.add(conftest);
+    }
+  }
+  
+  graph.locate = file => graph.nodes.has(file) ? [graph.nodes.get(file)] : [];
+  return graph;
+}
+
+/**
+ * Build the Rust crate graph from Cargo workspace metadata
+ * @param {string} implDir - Implementation directory
+ * @returns {DependencyGraph} Graph of workspace packages
+ */
+function buildRustGraph(implDir) {
+  const output = execFileSync('cargo', ['metadata', '--format-version', '1', '--no-deps', '--offline'], { cwd: implDir, encoding: 'utf8', maxBuffer: 256 * 1024 * 1024, stdio: ['ignore', 'pipe', 'pipe'] });
+  const metadata = JSON.parse(output);
+  const members = new Set(metadata.workspace_members);
+  const graph = new DependencyGraph('rust');
+  const names = new Set(metadata.packages.filter(pkg => members.has(pkg.id)).map(pkg => pkg.name));
+  
+  for (const pkg of metadata.packages) {
+    if (!members.has(pkg.id)) continue;
+    
+    const deps = pkg.dependencies.filter(dep => dep.path && names.has(dep.name));
+    graph.add({
+      id: pkg.name,
+      dir: path.relative(implDir, path.dirname(pkg.manifest_path)).split(path.sep).join('/'),
+      isTest: true,
+      component: pkg.name,
+      imports: new Set(deps.filter(dep => dep.kind !== 'dev').map(dep => dep.name)),
+      testImports: new Set(deps.filter(dep => dep.kind === 'dev').map(dep => dep.name))
+    });
+  }
+  
+  const nodes = [...graph.nodes.values()];
+  graph.locate = file => nodeByDirectory(nodes, file);
+  return graph;
+}
+
+/**
+ * Build the dependency graph for a language
+ * @param {string} language - go, js, python or rust (test-affected.sh names)
+ * @param {string} implDir - Implementation directory
+ * @returns {Object} Result object with success flag and graph
+ */
+function buildGraph(language, implDir = utils.config.getImplementationDir()) {
+  const builders = { go: buildGoGraph, js: buildJsGraph, python: buildPythonGraph, rust: buildRustGraph };
+  
+  if (!builders[language]) {
+    return { success: false, value: null, error: utils.error.ValidationError(`No dependency graph for language: ${language || '(none)'}`) };
+  }
+  
+  return utils.error.trySync(() => builders[language](implDir));
+}
+
+/**
+ * Find the graph nodes a changed file belongs to
+ * Data files (fixtures, snapshots, JSON read from disk) are not imported, so they belong to no node
+ * and are matched by directory with testsNear() instead.
+ * @param {DependencyGraph} graph - Graph from buildGraph()
+ * @param {string} file - File relative to the implementation directory
+ * @param {Map<string, Set<string>>} importers - Reverse edges from graph.reverse()
+ * @returns {Array<Object>} Owning nodes, empty for files outside the graph
+ */
+function locateChanged(graph, file, importers) {
+  return graph.locate(file).filter(node => node.isTest || !file.endsWith('.json') || importers.has(node.id));
+}
+
+/**
+ * Find the test nodes in the nearest directory above a file that has tests, stopping below the root
+ * @param {DependencyGraph} graph - Graph from buildGraph()
+ * @param {string} file - File relative to the implementation directory
+ * @returns {Object|null} { dir, nodes } or null when no directory below the root has tests
+ */
+function testsNear(graph, file) {
+  const tests = [...graph.nodes.values()].filter(node => node.isTest);
+  
+  for (let dir = path.posix.dirname(file); dir !== '.'; dir = path.posix.dirname(dir)) {
+    const inside = rel => rel === dir || rel.startsWith(`${dir}/`);
+    const nodes = tests.filter(node => (node.dir !== undefined && inside(node.dir)) || node.files.some(inside));
+    if (nodes.length > 0) return { dir, nodes };
+  }
+  
+  return null;
+}
+
+/**
+ * Find the test components affected by changed files
+ * @param {DependencyGraph} graph - Graph from buildGraph()
+ * @param {Array<string>} changedFiles - Changed files relative to the implementation directory
+ * @returns {Object} { components: [{ component, reason, chain, changed }], global, unmapped }
+ */
+function findAffected(graph, changedFiles) {
+  const global = changedFiles.filter(file => (GLOBAL_FILES[graph.language] || []).some(pattern => pattern.test(file)));
+  const importers = graph.reverse();
+  const changedBy = new Map();
+  const outside = [];
+  
+  for (const file of changedFiles) {
+    if (global.includes(file)) continue;
+    
+    const owners = locateChanged(graph, file, importers);
+    if (owners.length === 0) outside.push(file);
+    for (const node of owners) {
+      changedBy.set(node.id, [...(changedBy.get(node.id) || []), file]);
+    }
+  }
+  
+  // Walk importers from every changed node, remembering how each node was reached
+  const via = new Map([...changedBy.keys()].map(id => [id, null]));
+  const queue = [...changedBy.keys()];
+  while (queue.length > 0) {
+    const id = queue.shift();
+    for (const importer of importers.get(id) || []) {
+      if (!via.has(importer)) {
+        via.set(importer, id);
+        queue.push(importer);
+      }
+    }
+  }
+  
+  const chainFrom = (id) => {
+    const chain = [id];
+    while (via.get(chain[chain.length - 1])) chain.push(via.get(chain[chain.length - 1]));
+    return chain;
+  };
+  
+  const components = [];
+  for (const node of [...graph.nodes.values()].filter(candidate => candidate.isTest)) {
+    let chain = null;
+    let reason;
+    
+    if (global.length > 0) {
+      chain = [node.id];
+      reason = `${global.join(', ')} changed (affects every test)`;
+    } else if (via.has(node.id)) {
+      chain = chainFrom(node.id);
+    } else {
+      const testDep = [...node.testImports].find(dep => via.has(dep));
+      if (testDep) chain = [`${node.id} (tests)`, ...chainFrom(testDep)];
+    }
+    if (!chain) continue;
+    
+    const changed = global.length > 0 ? global : changedBy.get(chain[chain.length - 1]);
+    if (!reason) {
+      reason = chain.length === 1
+        ? `changed: ${changed.join(', ')}`
+        : `${chain.join(' -> ')} (changed: ${changed.join(', ')})`;
+    }
+    
+    components.push({ component: node.component, reason, chain, changed });
+  }
+  
+  // Files outside the graph select the tests in their nearest directory that has any; files with no
+  // tests above them below the root are left unmapped, which callers treat as a full-suite run
+  const unmapped = [];
+  for (const file of global.length > 0 ? [] : outside) {
+    const tests = testsNear(graph, file);
+    if (!tests) unmapped.push(file);
+    for (const node of tests ? tests.nodes : []) {
+      components.push({ component: node.component, reason: `${file} is not in the graph; tests under ${tests.dir}/`, chain: [node.id], changed: [file] });
+    }
+  }
+  
+  // One line per component even when several nodes (e.g. test files) map to it
+  const unique = [...new Map(components.map(entry => [entry.component, entry])).values()]
+    .sort((a, b) => a.component.localeCompare(b.component));
+  
+  return { components: unique, global, unmapped };
+}
+
+/**
+ * Write the affected components with their reasons
+ * @param {string} outFile - Output file
+ * @param {Object} result - Result of findAffected() with language and since
+ */
+function writeComponents(outFile, result) {
+  const lines = [
+    `# Affected test components (${result.language} dependency graph${result.since ? `, since ${result.since.slice(0, 8)}` : ''})`,
+    `# ${result.changedFiles.length} changed file(s)${result.unmapped.length ? `; not in the graph: ${result.unmapped.join(', ')}` : ''}`
+  ];
+  
+  for (const entry of result.components) {
+    lines.push(entry.component);
+    lines.push(`#   ${entry.reason}`);
+  }
+  
+  utils.path.ensureDir(path.dirname(outFile));
+  fs.writeFileSync(outFile, `${lines.join('\n')}\n`);
+}
+
+/**
+ * Get the files changed since a commit, relative to the implementation (or service) directory
+ * @param {string} since - Commit to compare with HEAD
+ * @param {string} implDir - Directory the paths are relative to
+ * @returns {Array<string>} Changed files, including deleted ones
+ */
+function getChangedFiles(since, implDir = utils.config.getImplementationDir()) {
+  const implPrefix = utils.path.getRelativeToProjectRoot(implDir).split(path.sep).join('/');
+  const output = execFileSync('git', ['diff', '--name-only', `${since}..HEAD`, '--', implPrefix], {
+    cwd: utils.path.resolveProjectPath(),
+    encoding: 'utf8',
+    stdio: ['ignore', 'pipe', 'pipe']
+  });
+  
+  return output.split('\n').filter(Boolean).map(file => file.slice(implPrefix.length + 1));
+}
+
+/**
+ * Get the value following a command line flag
+ * @param {string} flag - Flag name
+ * @returns {string|undefined} Flag value
+ */
+function getArg(flag) {
+  const index = process.argv.indexOf(flag);
+  return index !== -1 ? process.argv[index + 1] : undefined;
+}
+
+/**
+ * Main function
+ */
+function main() {
+  const implDir = utils.project.getServiceDir(getArg('--service') || null);
+  const language = getArg('--language') || detectLanguage(implDir);
+  const since = getArg('--since') || 'HEAD~1';
+  
+  const graph = buildGraph(language, implDir);
+  if (!graph.success) {
+    logger.warn(`Dependency graph unavailable: ${graph.error.message}`);
+    process.exitCode = 3;
+    return;
+  }
+  
+  const changedFiles = getArg('--files') ? getArg('--files').split(',').filter(Boolean) : getChangedFiles(since, implDir);
+  const result = {
+    language,
+    since: getArg('--files') ? null : utils.error.trySync(() => execFileSync('git', ['rev-parse', since], { cwd: utils.path.resolveProjectPath(), encoding: 'utf8' }).trim(), since).value,
+    changedFiles,
+    ...findAffected(graph.value, changedFiles)
+  };
+  
+  writeComponents(utils.path.resolveProjectPath(getArg('--out') || path.join('.cache', 'affected-components.txt')), result);
+  if (result.unmapped.length > 0) process.exitCode = 4;
+  
+  if (process.argv.includes('--json')) {
+    console.log(JSON.stringify(result, null, 2));
+    return;
+  }
+  
+  logger.info(`${result.components.length} affected test component(s) from ${changedFiles.length} changed file(s) (${graph.value.nodes.size} ${language} graph nodes)`);
+  for (const entry of result.components) {
+    logger.info(`  ${entry.component}: ${entry.reason}`);
+  }
+}
+
+if (require.main === module) {
+  try {
+    main();
+  } catch (err) {
+    utils.error.createErrorHandler('affected-graph')(err);
+  }
+}
+
+module.exports = {
+  GLOBAL_FILES,
+  SKIP_DIRS,
+  isTestFile,
+  DependencyGraph,
+  listFiles,
+  buildGraph,
+  locateChanged,
+  testsNear,
+  findAffected,
+  getChangedFiles
+};
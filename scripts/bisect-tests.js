@@ -0,0 +1,434 @@
+#!/usr/bin/env node
+
+/**
+ * DStudio Test Bisect
+ * Finds the commit that broke implementation tests with `git bisect run`
+ *
+ * Usage:
+ *   node scripts/bisect-tests.js run --good <ref> [--bad <ref>] [--service <name>] [--test <name>]... [--from-log <file>]
+ *                                    [--all-tests] [--rollback [--impl-only] [--dry-run]] [--json]
+ *   node scripts/bisect-tests.js show [latest|<id>] [--json]
+ *
+ * Tests default to the failures in the last test-affected.sh run (.cache/last-test-run.log);
+ * --test selects them explicitly and --all-tests runs the whole suite. Each bisect step restores
+ * dependencies for the detected language (scripts/impl-deps.sh, copied so older commits use the
+ * same logic) and runs only those tests. Commits without the implementation directory or a test
+ * setup are skipped. With --service the tests run in that service directory and default to the
+ * failures of its last test-affected.sh run. With --rollback the first bad commit is handed to rollback.sh.
+ */
+
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const { execFileSync, spawnSync } = require('child_process');
+const utils = require('../utils');
+const logger = utils.logger.createScopedLogger('Bisect');
+
+// Failed tests as each runner prints them, in the form run_impl_tests accepts. Jest only names
+// the failed files, which is what a bisect step reruns; flaky-tests.js tracks JavaScript tests
+// by name from the Jest results in the report.
+const FAILURE_PATTERNS = {
+  js: [/^\s*FAIL\s+(\S+)/gm],
+  go: [/^\s*--- FAIL: ([^\s/]+)/gm],
+  python: [/^FAILED (\S+?)(?: - .*)?$/gm],
+  rust: [/^test (\S+) \.\.\. FAILED$/gm],
+  'java-maven': [/^\[ERROR\]\s+([\w.$]+)\.(\w+):\d+/gm],
+  'java-gradle': [/^(\S+) > (\w+)(?:\(\))? FAILED$/gm]
+};
+
+/**
+ * Run a git command in the project root
+ * @param {Array<string>} args - git arguments
+ * @returns {string} Stdout without trailing newlines
+ */
+function git(args) {
+  return execFileSync('git', args, {
+    cwd: utils.path.resolveProjectPath(),
+    encoding: 'utf8',
+    stdio: ['ignore', 'pipe', 'pipe']
+  }).trimEnd();
+}
+
+/**
+ * Get the bisect report directory
+ * @returns {string} Absolute path
+ */
+function getBisectDir() {
+  return utils.path.resolveProjectPath(utils.config.get('bisect.dir', '.cache/bisect'));
+}
+
+/**
+ * Detect the test language of the implementation directory, in the order impl-deps.sh uses
+ * @param {string} implDir - Implementation directory
+ * @returns {string|null} Language name as used by test-affected.sh
+ */
+function detectLanguage(implDir) {
+  const markers = [
+    ['js', ['package.json']],
+    ['go', ['go.mod']],
+    ['python', ['requirements.txt', 'pyproject.toml']],
+    ['rust', ['Cargo.toml']],
+    ['java-maven', ['pom.xml']],
+    ['java-gradle', ['build.gradle']]
+  ];
+  
+  const match = markers.find(([, files]) => files.some(file => utils.path.pathExists(path.join(implDir, file))));
+  return match ? match[0] : null;
+}
+
+/**
+ * Extract the failed tests from test output
+ * @param {string} output - Test runner output
+ * @param {string} language - Language from detectLanguage()
+ * @returns {Array<string>} Test selectors for run_impl_tests
+ */
+function parseFailingTests(output, language) {
+  const tests = new Set();
+  
+  // Lines streamed by test-scheduler.js carry a "[component] " prefix
+  output = output.replace(/^\[[^\]\n]+\] /gm, '');
+  
+  for (const pattern of FAILURE_PATTERNS[language] || []) {
+    for (const match of output.matchAll(pattern)) {
+      if (language === 'java-maven') {
+        tests.add(`${match[1].split('.').pop()}#${match[2]}`);
+      } else if (language === 'java-gradle') {
+        tests.add(`${match[1]}.${match[2]}`);
+      } else {
+        tests.add(match[1]);
+      }
+    }
+  }
+  
+  return [...tests];
+}
+
+/**
+ * Write the script `git bisect run` executes at each step
+ * Exit codes follow git bisect: 0 good, 1 bad, 125 skip.
+ * @param {Object} options - Script options
+ * @param {string} options.workDir - Directory for the script and its copy of impl-deps.sh
+ * @param {string} options.implDir - Implementation (or service) directory relative to the project root
+ * @param {Array<string>} options.tests - Tests to run (all tests if empty)
+ * @param {string} options.logFile - File collecting the output of every step
+ * @returns {string} Script path
+ */
+function writeStepScript({ workDir, implDir, tests, logFile }) {
+  const rootDir = utils.path.resolveProjectPath();
+  const quote = value => `'${String(value).replace(/'/g, `'\\''`)}'`;
+  
+  fs.copyFileSync(path.join(__dirname, 'impl-deps.sh'), path.join(workDir, 'impl-deps.sh'));
+  
+  const script = [
+    '#!/usr/bin/env bash',
+    '# Generated by scripts/bisect-tests.js for git bisect run',
+    '',
+    `source ${quote(path.join(workDir, 'impl-deps.sh'))}`,
+    `IMPL_DIR=${quote(path.join(rootDir, implDir))}`,
+    `LOG=${quote(logFile)}`,
+    '',
+    'echo "=== $(git rev-parse --short HEAD) $(git log -1 --format=%s) ===" >> "$LOG"',
+    '',
+    '# Nothing to test at this commit',
+    '[ -d "$IMPL_DIR" ] || exit 125',
+    '',
+    'restore_impl_dependencies "$IMPL_DIR" >> "$LOG" 2>&1',
+    `run_impl_tests "$IMPL_DIR"${tests.map(test => ` ${quote(test)}`).join('')} >> "$LOG" 2>&1`,
+    '',
+    'case $? in',
+    '  0) exit 0 ;;',
+    '  2) exit 125 ;;',
+    '  *) exit 1 ;;',
+    'esac',
+    ''
+  ].join('\n');
+  
+  const scriptFile = path.join(workDir, 'bisect-step.sh');
+  fs.writeFileSync(scriptFile, script, { mode: 0o755 });
+  return scriptFile;
+}
+
+/**
+ * Describe a commit: who made it, for which task, and what it changed
+ * @param {string} sha - Commit SHA
+ * @returns {Object} Commit { sha, subject, author, date, agent, taskId, requirements, stat, files }
+ */
+function describeCommit(sha) {
+  const [subject, author, date] = git(['show', '-s', '--format=%s%x1f%an%x1f%aI', sha]).split('\x1f');
+  const message = git(['show', '-s', '--format=%B', sha]);
+  const trailer = name => {
+    const match = message.match(new RegExp(`^${name}:\\s*(.+)$`, 'im'));
+    return match ? match[1].trim() : null;
+  };
+  const requirements = [...new Set(message.match(/\bREQ-[A-Za-z0-9.]*[A-Za-z0-9]/g) || [])];
+  const tag = subject.match(/^\[([^\]]+)\]/);
+  
+  const files = git(['diff-tree', '--root', '--no-commit-id', '-r', '--name-status', sha])
+    .split('\n')
+    .filter(Boolean)
+    .map(line => {
+      const [status, ...names] = line.split('\t');
+      return { status: status[0], file: names[names.length - 1] };
+    });
+  const shortstat = git(['show', '--shortstat', '--format=', sha]);
+  const count = pattern => Number((shortstat.match(pattern) || [])[1] || 0);
+  
+  return {
+    sha,
+    subject,
+    author,
+    date,
+    agent: trailer('Agent') || (tag ? tag[1] : null) || author,
+    taskId: trailer('Task') || requirements[0] || null,
+    requirements,
+    stat: { files: files.length, insertions: count(/(\d+) insertion/), deletions: count(/(\d+) deletion/) },
+    files
+  };
+}
+
+/**
+ * Run a bisect between a good and a bad commit
+ * The repository is always returned to where it was, even when the bisect fails.
+ * @param {Object} options - Bisect options
+ * @param {string} options.good - Last known good commit
+ * @param {string} options.bad - First known bad commit (default HEAD)
+ * @param {string} options.service - Service whose tests to run, or null for the implementation root
+ * @param {Array<string>} options.tests - Tests to run; undefined uses the failures of the last run
+ * @param {string} options.fromLog - Test output to take failures from
+ * @returns {Object} Result object with success flag and the bisect report
+ */
+function runBisect(options = {}) {
+  return utils.error.trySync(() => {
+    if (!options.good) throw utils.error.ValidationError('--good <ref> is required');
+    if (utils.path.pathExists(path.join(git(['rev-parse', '--absolute-git-dir']), 'BISECT_LOG'))) {
+      throw utils.error.ValidationError('A git bisect is already in progress (finish it with: git bisect reset)');
+    }
+    if (git(['status', '--porcelain', '--untracked-files=no'])) {
+      throw utils.error.ValidationError('Working tree has uncommitted changes. Commit or stash them before bisecting.');
+    }
+    
+    const good = git(['rev-parse', '--verify', `${options.good}^{commit}`]);
+    const bad = git(['rev-parse', '--verify', `${options.bad || 'HEAD'}^{commit}`]);
+    if (!utils.error.trySync(() => git(['merge-base', '--is-ancestor', good, bad])).success) {
+      throw utils.error.ValidationError(`${options.good} is not an ancestor of ${options.bad || 'HEAD'}`);
+    }
+    
+    const service = options.service || null;
+    const implDir = utils.path.getRelativeToProjectRoot(utils.project.getServiceDir(service));
+    const language = detectLanguage(utils.project.getServiceDir(service));
+    
+    let tests = options.tests;
+    if (!tests) {
+      const logFile = options.fromLog || utils.path.resolveProjectPath('.cache', service ? `last-test-run-${service}.log` : 'last-test-run.log');
+      const output = utils.file.readFileSync(logFile);
+      tests = output.success ? parseFailingTests(output.value, language) : [];
+      if (tests.length === 0) {
+        logger.warn(`No failed tests found in ${utils.path.getRelativeToProjectRoot(logFile)}; bisecting with the whole suite`);
+      }
+    }
+    
+    const id = new Date().toISOString().replace(/[-:T]/g, '').slice(0, 14);
+    const bisectDir = getBisectDir();
+    const logFile = path.join(bisectDir, `${id}.log`);
+    const workDir = fs.mkdtempSync(path.join(os.tmpdir(), 'dstudio-bisect-'));
+    utils.path.ensureDir(bisectDir);
+    
+    const script = writeStepScript({ workDir, implDir, tests, logFile });
+    logger.info(`Bisecting ${good.slice(0, 8)}..${bad.slice(0, 8)} (${service ? `service ${service}, ` : ''}${language || 'unknown language'}, ${tests.length ? tests.join(', ') : 'all tests'})`);
+    logger.info(`Step output: ${utils.path.getRelativeToProjectRoot(logFile)}`);
+    
+    const startRef = utils.error.trySync(() => git(['symbolic-ref', '--short', 'HEAD'])).value || git(['rev-parse', 'HEAD']);
+    let output = '';
+    
+    try {
+      // Without a failure at the bad commit there is nothing to look for
+      git(['checkout', '-q', '--detach', bad]);
+      const check = spawnSync('bash', [script], { cwd: utils.path.resolveProjectPath() });
+      if (check.status === 0) {
+        throw utils.error.ValidationError(`Tests pass at ${bad.slice(0, 8)}; nothing to bisect`);
+      }
+      if (check.status === 125) {
+        throw utils.error.ValidationError(`Tests cannot run at ${bad.slice(0, 8)} (no ${service ? `${service} service` : 'implementation'} directory or test setup)`);
+      }
+      
+      git(['bisect', 'start', bad, good, '--']);
+      
+      const result = spawnSync('git', ['bisect', 'run', script], {
+        cwd: utils.path.resolveProjectPath(),
+        encoding: 'utf8'
+      });
+      output = `${result.stdout || ''}${result.stderr || ''}`;
+      
+      for (const line of output.split('\n').filter(line => line.startsWith('Bisecting:'))) {
+        logger.info(line);
+      }
+    } finally {
+      utils.error.trySync(() => git(['bisect', 'reset', startRef]));
+      utils.error.trySync(() => git(['checkout', '-q', startRef]));
+      fs.rmSync(workDir, { recursive: true, force: true });
+    }
+    
+    const firstBad = output.match(/^([0-9a-f]{40}) is the first bad commit/m);
+    const candidates = output.includes('only \'skip\'ped commits left')
+      ? [...output.matchAll(/^([0-9a-f]{40})$/gm)].map(match => match[1])
+      : [];
+    
+    const report = {
+      id,
+      timestamp: new Date().toISOString(),
+      good,
+      bad,
+      service,
+      language,
+      tests,
+      steps: (output.match(/^running /gm) || []).length,
+      log: utils.path.getRelativeToProjectRoot(logFile),
+      firstBad: firstBad ? describeCommit(firstBad[1]) : null,
+      candidates,
+      error: firstBad ? null : candidates.length ? 'only_skipped_commits' : 'no_result'
+    };
+    
+    fs.writeFileSync(path.join(bisectDir, `${id}.json`), JSON.stringify(report, null, 2));
+    
+    if (report.firstBad) {
+      const issuesLog = utils.path.resolveProjectPath(utils.config.get('watchdog.issuesLog', 'issues.log'));
+      fs.appendFileSync(issuesLog, `[${report.timestamp}] [WARN] Test regression introduced by ${report.firstBad.sha.slice(0, 7)} (agent ${report.firstBad.agent}, task ${report.firstBad.taskId || 'none'}): ${report.firstBad.subject}\n`);
+    }
+    
+    return report;
+  });
+}
+
+/**
+ * Load a bisect report by ID (or 'latest')
+ * @param {string} id - Report ID
+ * @returns {Object} Result object with success flag and report
+ */
+function loadReport(id) {
+  const dir = getBisectDir();
+  const ids = utils.error.trySync(() => fs.readdirSync(dir), []).value
+    .filter(file => file.endsWith('.json'))
+    .map(file => file.replace(/\.json$/, ''))
+    .sort();
+  const match = id === 'latest' ? ids[ids.length - 1] : ids.find(candidate => candidate === id);
+  
+  if (!match) {
+    return { success: false, value: null, error: utils.error.ValidationError(`Bisect report not found: ${id || '(none)'}`) };
+  }
+  
+  return utils.error.trySync(() => JSON.parse(fs.readFileSync(path.join(dir, `${match}.json`), 'utf8')));
+}
+
+/**
+ * Print a bisect report
+ * @param {Object} report - Report from runBisect()
+ */
+function printReport(report) {
+  if (process.argv.includes('--json')) {
+    console.log(JSON.stringify(report, null, 2));
+    return;
+  }
+  
+  if (!report.firstBad) {
+    logger.warn(report.candidates.length
+      ? `Only skipped commits left; the first bad commit is one of: ${report.candidates.map(sha => sha.slice(0, 7)).join(', ')}`
+      : `Bisect did not find a first bad commit (see ${report.log})`);
+    return;
+  }
+  
+  const commit = report.firstBad;
+  logger.info(`First bad commit: ${commit.sha.slice(0, 7)} ${commit.subject}`);
+  logger.info(`  Agent:  ${commit.agent}${commit.agent !== commit.author ? ` (author ${commit.author})` : ''}`);
+  logger.info(`  Task:   ${commit.taskId || 'none'}${commit.requirements.length > 1 ? ` (refs ${commit.requirements.join(', ')})` : ''}`);
+  logger.info(`  Date:   ${commit.date}`);
+  logger.info(`  Diff:   ${commit.stat.files} file(s), +${commit.stat.insertions} -${commit.stat.deletions}`);
+  for (const file of commit.files.slice(0, 20)) {
+    logger.info(`    ${file.status} ${file.file}`);
+  }
+  if (commit.files.length > 20) {
+    logger.info(`    ... ${commit.files.length - 20} more`);
+  }
+  logger.info(`  Tests:  ${report.tests.length ? report.tests.join(', ') : 'all'}${report.service ? ` in ${report.service}` : ''} (${report.steps} step(s), log ${report.log})`);
+}
+
+/**
+ * Get the value following a command line flag
+ * @param {string} flag - Flag name
+ * @returns {string|undefined} Flag value
+ */
+function getArg(flag) {
+  const index = process.argv.indexOf(flag);
+  return index !== -1 ? process.argv[index + 1] : undefined;
+}
+
+/**
+ * Get every value of a repeatable flag
+ * @param {string} flag - Flag name
+ * @returns {Array<string>} Flag values
+ */
+function getArgs(flag) {
+  return process.argv.flatMap((arg, i) => arg === flag && process.argv[i + 1] ? [process.argv[i + 1]] : []);
+}
+
+/**
+ * Main function
+ */
+function main() {
+  const [command, target] = process.argv.slice(2);
+  
+  switch (command) {
+    case 'run': {
+      const tests = process.argv.includes('--all-tests') ? [] : getArgs('--test');
+      const result = runBisect({
+        good: getArg('--good'),
+        bad: getArg('--bad'),
+        service: getArg('--service') || null,
+        tests: tests.length || process.argv.includes('--all-tests') ? tests : undefined,
+        fromLog: getArg('--from-log') ? path.resolve(getArg('--from-log')) : undefined
+      });
+      if (!result.success) throw result.error;
+      
+      printReport(result.value);
+      if (!result.value.firstBad) {
+        process.exitCode = 1;
+        return;
+      }
+      
+      if (process.argv.includes('--rollback')) {
+        const args = [path.join(__dirname, 'rollback.sh'), result.value.firstBad.sha, `test regression found by bisect ${result.value.id}`];
+        if (process.argv.includes('--impl-only')) args.push('--impl-only');
+        if (process.argv.includes('--dry-run')) args.push('--dry-run');
+        
+        const rollback = spawnSync('bash', args, { cwd: utils.path.resolveProjectPath(), stdio: 'inherit' });
+        process.exitCode = rollback.status || 0;
+      }
+      break;
+    }
+    
+    case 'show': {
+      const result = loadReport(target && !target.startsWith('--') ? target : 'latest');
+      if (!result.success) throw result.error;
+      printReport(result.value);
+      break;
+    }
+    
+    default:
+      throw utils.error.ValidationError(`Unknown command: ${command || '(none)'} (expected run or show)`);
+  }
+}
+
+if (require.main === module) {
+  try {
+    main();
+  } catch (err) {
+    utils.error.createErrorHandler('bisect-tests')(err);
+  }
+}
+
+module.exports = {
+  detectLanguage,
+  parseFailingTests,
+  describeCommit,
+  runBisect,
+  loadReport
+};
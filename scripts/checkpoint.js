@@ -0,0 +1,443 @@
+#!/usr/bin/env node
+
+/**
+ * DStudio Iteration Checkpoints
+ * Records and restores the implementation directory and meta status at iteration boundaries
+ *
+ * Usage:
+ *   node scripts/checkpoint.js create [--label name] [--note text]   Record a checkpoint (alias: tag)
+ *   node scripts/checkpoint.js list                                  List checkpoints, most recent first
+ *   node scripts/checkpoint.js show <id|latest>                      Show a checkpoint and what changed since
+ *   node scripts/checkpoint.js restore <id|latest> [--no-backup] [--skip-deps] [--skip-tests]
+ *                                                                    Restore implementation and meta status
+ *
+ * A checkpoint commits the whole working tree (without touching HEAD, the index or files), tags the
+ * commit as checkpoint/<id>, and records the spec.index.json checksum, status.quick.json and
+ * pointers to the Navigation Hub memory files.
+ */
+
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const { execFileSync, spawnSync } = require('child_process');
+const utils = require('../utils');
+const ContextSnapshotStore = require('../claude/context-snapshots');
+const logger = utils.logger.createScopedLogger('Checkpoint');
+
+// Checkpoint labels become part of the ID and the tag name
+const LABEL_REGEX = /^[A-Za-z0-9._-]+$/;
+
+/**
+ * Run a git command in the project root
+ * @param {Array<string>} args - git arguments
+ * @param {Object} env - Extra environment variables
+ * @returns {string} Stdout without trailing newlines
+ */
+function git(args, env = {}) {
+  return execFileSync('git', args, {
+    cwd: utils.path.resolveProjectPath(),
+    encoding: 'utf8',
+    env: { ...process.env, ...env },
+    stdio: ['ignore', 'pipe', 'pipe']
+  }).trimEnd();
+}
+
+/**
+ * Write the whole working tree as a git tree object without touching HEAD, the index or files
+ * Caches, installed dependencies and heartbeat files are left out.
+ * @returns {string} Tree SHA
+ */
+function writeWorkingTree() {
+  const tmpIndex = path.join(os.tmpdir(), `dstudio-checkpoint-${process.pid}-${Date.now()}.index`);
+  const env = { GIT_INDEX_FILE: tmpIndex };
+  const heartbeatFile = utils.config.get('recovery.heartbeatFile', '.agent-lock');
+  
+  try {
+    git(['read-tree', 'HEAD'], env);
+    git(['add', '-A', '--', '.', ':(exclude).cache', ':(exclude)**/node_modules', `:(exclude,glob)${heartbeatFile}*`], env);
+    return git(['write-tree'], env);
+  } finally {
+    utils.error.trySync(() => fs.unlinkSync(tmpIndex));
+  }
+}
+
+/**
+ * Commit the whole working tree without touching HEAD, the index or files
+ * @param {string} message - Commit message
+ * @returns {string} Commit SHA
+ */
+function commitWorkingTree(message) {
+  return git(['commit-tree', writeWorkingTree(), '-p', 'HEAD', '-m', message]);
+}
+
+/**
+ * Get the checkpoint directory
+ * @returns {string} Absolute path
+ */
+function getCheckpointDir() {
+  return utils.path.resolveProjectPath(utils.config.get('checkpoints.dir', '.cache/checkpoints'));
+}
+
+/**
+ * Get the implementation directory relative to the project root
+ * @returns {string} Relative path
+ */
+function getImplementationPath() {
+  return utils.path.getRelativeToProjectRoot(utils.config.getImplementationDir());
+}
+
+/**
+ * Get the memory snapshot store used for memory pointers
+ * @returns {ContextSnapshotStore} Store over claude/memory
+ */
+function getMemoryStore() {
+  return new ContextSnapshotStore(utils.path.resolveProjectPath('claude', 'memory'));
+}
+
+/**
+ * Checksum a project file
+ * @param {string} relativePath - Path relative to the project root
+ * @returns {string|null} SHA-256 checksum, or null if the file is missing
+ */
+function checksumFile(relativePath) {
+  return utils.file.calculateChecksumSync(utils.path.resolveProjectPath(relativePath)).value;
+}
+
+/**
+ * Load all checkpoints, most recent first
+ * @returns {Array<Object>} Checkpoint records
+ */
+function listCheckpoints() {
+  const dir = getCheckpointDir();
+  
+  return utils.error.trySync(() => fs.readdirSync(dir), []).value
+    .filter(file => file.endsWith('.json'))
+    .map(file => utils.error.trySync(() => JSON.parse(fs.readFileSync(path.join(dir, file), 'utf8'))).value)
+    .filter(Boolean)
+    .sort((a, b) => b.created.localeCompare(a.created));
+}
+
+/**
+ * Load a checkpoint by ID (or 'latest')
+ * @param {string} id - Checkpoint ID
+ * @returns {Object} Result object with success flag and checkpoint
+ */
+function loadCheckpoint(id) {
+  const checkpoint = id === 'latest'
+    ? listCheckpoints()[0]
+    : listCheckpoints().find(record => record.id === id);
+  
+  if (!checkpoint) {
+    return { success: false, value: null, error: utils.error.ValidationError(`Checkpoint not found: ${id || '(none)'}`) };
+  }
+  
+  return { success: true, value: checkpoint, error: null };
+}
+
+/**
+ * Save a checkpoint record
+ * @param {Object} checkpoint - Checkpoint record
+ */
+function saveCheckpoint(checkpoint) {
+  utils.path.ensureDir(getCheckpointDir());
+  utils.file.writeFileSync(path.join(getCheckpointDir(), `${checkpoint.id}.json`), JSON.stringify(checkpoint, null, 2));
+}
+
+/**
+ * Create a checkpoint of the current iteration
+ * @param {Object} options - Checkpoint options
+ * @param {string} options.label - Short label appended to the ID
+ * @param {string} options.note - Free-form note
+ * @returns {Object} Result object with success flag and checkpoint
+ */
+function createCheckpoint(options = {}) {
+  return utils.error.trySync(() => {
+    if (options.label && !LABEL_REGEX.test(options.label)) {
+      throw utils.error.ValidationError(`Invalid label: ${options.label} (use letters, digits, ".", "_" or "-")`);
+    }
+    
+    const created = new Date();
+    const id = `${created.toISOString().replace(/[-:T]/g, '').slice(0, 14)}${options.label ? `-${options.label}` : ''}`;
+    if (loadCheckpoint(id).success) {
+      throw utils.error.ValidationError(`Checkpoint already exists: ${id}`);
+    }
+    
+    const agents = utils.heartbeat.listHeartbeats()
+      .filter(entry => entry.data && entry.leaseActive && entry.ownerAlive)
+      .map(({ data }) => ({ agentId: data.agentId, sessionId: data.sessionId, taskId: data.taskId || null, progress: data.progress ?? null }));
+    
+    const head = git(['rev-parse', 'HEAD']);
+    const dirty = git(['status', '--porcelain']) !== '';
+    const commit = dirty ? commitWorkingTree(`Checkpoint ${id}${options.note ? `: ${options.note}` : ''}`) : head;
+    const tag = `${utils.config.get('checkpoints.tagPrefix', 'checkpoint')}/${id}`;
+    git(['tag', tag, commit]);
+    
+    const quickStatus = utils.file.readFileSync(utils.path.resolveProjectPath('status.quick.json'));
+    
+    const checkpoint = {
+      id,
+      label: options.label || null,
+      note: options.note || null,
+      created: created.toISOString(),
+      agents,
+      git: {
+        ref: `refs/tags/${tag}`,
+        commit,
+        head,
+        branch: utils.error.trySync(() => git(['rev-parse', '--abbrev-ref', 'HEAD']), null).value,
+        dirty
+      },
+      implementationDir: getImplementationPath(),
+      spec: { file: 'spec.index.json', checksum: checksumFile('spec.index.json') },
+      status: {
+        file: 'status.quick.json',
+        content: quickStatus.success ? utils.error.trySync(() => JSON.parse(quickStatus.value), null).value : null
+      },
+      memory: getMemoryStore().capturePointers(),
+      restores: []
+    };
+    
+    saveCheckpoint(checkpoint);
+    return checkpoint;
+  });
+}
+
+/**
+ * Compare the working tree with a checkpoint
+ * @param {Object} checkpoint - Checkpoint record
+ * @returns {Object} Changed implementation files, spec change flag and changed memory files
+ */
+function compareWithCheckpoint(checkpoint) {
+  const implDir = checkpoint.implementationDir;
+  const changed = git(['diff-tree', '-r', '--name-status', checkpoint.git.commit, writeWorkingTree(), '--', implDir])
+    .split('\n').filter(Boolean);
+  const current = new Map(getMemoryStore().capturePointers().map(pointer => [pointer.file, pointer.checksum]));
+  
+  return {
+    implementation: changed,
+    specChanged: checksumFile(checkpoint.spec.file) !== checkpoint.spec.checksum,
+    memory: checkpoint.memory.filter(pointer => current.get(pointer.file) !== pointer.checksum).map(pointer => pointer.file)
+  };
+}
+
+/**
+ * Restore the implementation directory and meta status of a checkpoint
+ * @param {string} id - Checkpoint ID (or 'latest')
+ * @param {Object} options - Restore options
+ * @param {boolean} options.backup - Checkpoint the current state first (default true)
+ * @param {boolean} options.restoreDependencies - Run the dependency restore step (default true)
+ * @param {boolean} options.runTests - Run the implementation tests (default true)
+ * @returns {Object} Result object with success flag and restore summary
+ */
+function restoreCheckpoint(id, options = {}) {
+  return utils.error.trySync(() => {
+    const loaded = loadCheckpoint(id);
+    if (!loaded.success) throw loaded.error;
+    const checkpoint = loaded.value;
+    const implDir = checkpoint.implementationDir;
+    
+    // Keep the state being replaced so a restore can itself be undone
+    let backup = null;
+    if (options.backup !== false) {
+      const created = createCheckpoint({ label: 'before-restore', note: `State before restoring ${checkpoint.id}` });
+      if (!created.success) throw created.error;
+      backup = created.value.id;
+      logger.info(`Current state saved as checkpoint ${backup}`);
+    }
+    
+    // Implementation: tracked files from the checkpoint commit, untracked leftovers removed
+    const keep = new Set(git(['ls-tree', '-r', '--name-only', checkpoint.git.commit, '--', implDir]).split('\n').filter(Boolean));
+    const tracked = git(['ls-files', '--', implDir]).split('\n').filter(Boolean);
+    const untracked = git(['ls-files', '--others', '--exclude-standard', '--', implDir]).split('\n').filter(Boolean);
+    
+    for (const file of [...tracked, ...untracked].filter(file => !keep.has(file))) {
+      utils.error.trySync(() => fs.unlinkSync(utils.path.resolveProjectPath(file)));
+    }
+    if (keep.size > 0) {
+      git(['restore', '--source', checkpoint.git.commit, '--worktree', '--', implDir]);
+    }
+    
+    // Meta status: status.quick.json, status files from the commit, and memory files
+    if (checkpoint.status.content) {
+      utils.file.writeFileSync(utils.path.resolveProjectPath(checkpoint.status.file), JSON.stringify(checkpoint.status.content, null, 2));
+    }
+    
+    const statusPaths = utils.config.get('checkpoints.statusPaths', ['project-status.md', 'status']);
+    const committedStatus = statusPaths.filter(statusPath =>
+      git(['ls-tree', '--name-only', checkpoint.git.commit, '--', statusPath]) !== '');
+    if (committedStatus.length > 0) {
+      git(['restore', '--source', checkpoint.git.commit, '--worktree', '--', ...committedStatus]);
+    }
+    
+    const store = getMemoryStore();
+    const memoryRestored = [];
+    for (const pointer of checkpoint.memory) {
+      const content = store.readPointer(pointer);
+      if (content.success) {
+        utils.file.writeFileSync(path.join(store.memoryPath, pointer.file), content.value);
+        memoryRestored.push(pointer.file);
+      } else {
+        logger.warn(`Memory blob missing for ${pointer.file} (${pointer.checksum.slice(0, 12)})`);
+      }
+    }
+    
+    if (checksumFile(checkpoint.spec.file) !== checkpoint.spec.checksum) {
+      logger.warn(`${checkpoint.spec.file} changed since checkpoint ${checkpoint.id}; requirements may not match the restored code`);
+    }
+    
+    // Dependency restore and tests shared with rollback.sh
+    const depsScript = path.join(__dirname, 'impl-deps.sh');
+    const implPath = utils.config.getImplementationDir();
+    
+    if (options.restoreDependencies !== false) {
+      spawnSync('bash', [depsScript, 'restore', implPath], { cwd: utils.path.resolveProjectPath(), stdio: 'inherit' });
+    }
+    
+    // null when tests were skipped or the implementation has no test setup
+    let testsPassed = null;
+    if (options.runTests !== false) {
+      const status = spawnSync('bash', [depsScript, 'test', implPath], { cwd: utils.path.resolveProjectPath(), stdio: 'inherit' }).status;
+      testsPassed = status === 2 ? null : status === 0;
+    }
+    
+    const restore = {
+      restored: new Date().toISOString(),
+      backup,
+      files: keep.size,
+      statusPaths: committedStatus,
+      memory: memoryRestored,
+      testsPassed
+    };
+    
+    checkpoint.restores = [...(checkpoint.restores || []), restore];
+    saveCheckpoint(checkpoint);
+    
+    return { checkpoint, ...restore };
+  });
+}
+
+/**
+ * Print checkpoints
+ */
+function printList() {
+  const checkpoints = listCheckpoints();
+  
+  if (checkpoints.length === 0) {
+    logger.info('No checkpoints yet (create one with: node scripts/checkpoint.js create)');
+    return;
+  }
+  
+  for (const checkpoint of checkpoints) {
+    const agents = checkpoint.agents.map(agent => `${agent.agentId}${agent.taskId ? `@${agent.taskId}` : ''}`).join(', ');
+    logger.info(`${checkpoint.id.padEnd(32)} ${checkpoint.git.commit.slice(0, 8)}${checkpoint.git.dirty ? ' (dirty)' : '        '} ${agents || '-'}${checkpoint.note ? `  ${checkpoint.note}` : ''}`);
+  }
+}
+
+/**
+ * Print a checkpoint and what changed since
+ * @param {string} id - Checkpoint ID (or 'latest')
+ */
+function printCheckpoint(id) {
+  const loaded = loadCheckpoint(id);
+  if (!loaded.success) throw loaded.error;
+  
+  const checkpoint = loaded.value;
+  const health = checkpoint.status.content?.health || {};
+  const changes = compareWithCheckpoint(checkpoint);
+  
+  logger.info(`Checkpoint ${checkpoint.id}${checkpoint.note ? ` - ${checkpoint.note}` : ''}`);
+  logger.info(`  Created:      ${checkpoint.created}`);
+  logger.info(`  Git:          ${checkpoint.git.ref} -> ${checkpoint.git.commit} (HEAD ${checkpoint.git.head.slice(0, 8)} on ${checkpoint.git.branch}${checkpoint.git.dirty ? ', with uncommitted changes' : ''})`);
+  logger.info(`  Spec index:   ${checkpoint.spec.checksum ? checkpoint.spec.checksum.slice(0, 12) : 'missing'}${changes.specChanged ? ' (changed since)' : ''}`);
+  logger.info(`  Requirements: ${health.requirements_completed ?? '?'}/${health.requirements_total ?? '?'} (${health.requirements_progress_percent ?? '?'}%)`);
+  logger.info(`  Memory:       ${checkpoint.memory.length} file(s)${changes.memory.length ? `, ${changes.memory.length} changed since` : ''}`);
+  
+  for (const agent of checkpoint.agents) {
+    logger.info(`  Agent:        ${agent.agentId} session ${agent.sessionId}${agent.taskId ? `, ${agent.taskId} at ${agent.progress ?? 0}%` : ''}`);
+  }
+  
+  logger.info(`  Implementation changes since: ${changes.implementation.length}`);
+  for (const line of changes.implementation.slice(0, 20)) {
+    logger.info(`    ${line.replace('\t', ' ')}`);
+  }
+  
+  for (const restore of checkpoint.restores || []) {
+    logger.info(`  Restored ${restore.restored}${restore.backup ? ` (previous state: ${restore.backup})` : ''}, tests ${restore.testsPassed === null ? 'not run' : restore.testsPassed ? 'passed' : 'failed'}`);
+  }
+}
+
+/**
+ * Get the value following a command line flag
+ * @param {string} flag - Flag name
+ * @returns {string|undefined} Flag value
+ */
+function getArg(flag) {
+  const index = process.argv.indexOf(flag);
+  return index !== -1 ? process.argv[index + 1] : undefined;
+}
+
+/**
+ * Main function
+ */
+function main() {
+  const [command, target] = process.argv.slice(2);
+  
+  switch (command) {
+    case 'create':
+    case 'tag': {
+      const result = createCheckpoint({ label: getArg('--label'), note: getArg('--note') });
+      if (!result.success) throw result.error;
+      logger.info(`Checkpoint ${result.value.id} created (${result.value.git.ref})`);
+      break;
+    }
+    
+    case 'list':
+      printList();
+      break;
+    
+    case 'show':
+      printCheckpoint(target || 'latest');
+      break;
+    
+    case 'restore': {
+      if (!target) {
+        throw utils.error.ValidationError('restore requires a checkpoint ID (or "latest")');
+      }
+      
+      const result = restoreCheckpoint(target, {
+        backup: !process.argv.includes('--no-backup'),
+        restoreDependencies: !process.argv.includes('--skip-deps'),
+        runTests: !process.argv.includes('--skip-tests')
+      });
+      if (!result.success) throw result.error;
+      
+      const { checkpoint, files, memory, testsPassed } = result.value;
+      logger.info(`Restored checkpoint ${checkpoint.id}: ${files} implementation file(s), ${memory.length} memory file(s)`);
+      if (testsPassed === false) {
+        logger.warn('Tests failed after restore');
+        process.exitCode = 1;
+      }
+      break;
+    }
+    
+    default:
+      throw utils.error.ValidationError(`Unknown command: ${command || '(none)'} (expected create, list, show or restore)`);
+  }
+}
+
+if (require.main === module) {
+  try {
+    main();
+  } catch (err) {
+    utils.error.createErrorHandler('checkpoint')(err);
+  }
+}
+
+module.exports = {
+  commitWorkingTree,
+  createCheckpoint,
+  listCheckpoints,
+  loadCheckpoint,
+  compareWithCheckpoint,
+  restoreCheckpoint
+};
@@ -0,0 +1,367 @@
+#!/usr/bin/env node
+
+/**
+ * DStudio Coverage Gate
+ * Collects line coverage per language and enforces development.testing.coverageThresholdPercent
+ *
+ * Usage:
+ *   node scripts/coverage.js collect [--service <name>]
+ *   node scripts/coverage.js check [--collect] [--top <n>] [--json]
+ *   node scripts/coverage.js show [--json]
+ *   node scripts/coverage.js changed [--since <ref>] [--json]
+ *
+ * `collect` runs the tests of the implementation (or of each service when the implementation
+ * root is not a project itself) with the language's coverage tool: a Go coverprofile, lcov from
+ * Jest/Istanbul or c8, coverage.py XML, and cargo-llvm-cov lcov when it is installed. The results
+ * are merged into one per-file model in .cache/coverage/coverage.json.
+ *
+ * `check` compares each service with its threshold (development.testing.coverage.serviceThresholds,
+ * falling back to coverageThresholdPercent), lists the least-covered files of the services below
+ * it and exits 1 if any service is below its threshold.
+ *
+ * `changed` lists the functions changed since --since (default HEAD~1, including uncommitted and
+ * untracked files, but not test files or files of languages without a collector) with the coverage
+ * of their lines, and exits 1 if any of them is untested. Functions in files edited after the
+ * coverage run are reported as unknown.
+ * Per-file coverage, uncovered line ranges and untested functions are also in the code maps.
+ */
+
+const fs = require('fs');
+const path = require('path');
+const { spawnSync, execFileSync } = require('child_process');
+const utils = require('../utils');
+const { detectLanguage } = require('./bisect-tests');
+const { isTestFile } = require('./affected-graph');
+const logger = utils.logger.createScopedLogger('Coverage');
+
+// Source files collectRoot() has a coverage tool for
+const COLLECTED_EXTENSIONS = new Set(['.go', '.js', '.mjs', '.cjs', '.jsx', '.ts', '.tsx', '.py', '.rs']);
+
+/**
+ * Get the directories coverage is collected in
+ * @param {string} implDir - Implementation directory
+ * @returns {Array<Object>} { service, dir, prefix, language }
+ */
+function getCoverageRoots(implDir) {
+  const language = detectLanguage(implDir);
+  if (language) return [{ service: null, dir: implDir, prefix: '', language }];
+  
+  const services = utils.project.getServices();
+  return (services.success ? services.value : [])
+    .map(service => ({ service: service.name, dir: service.path, prefix: service.name, language: detectLanguage(service.path) }))
+    .filter(root => root.language);
+}
+
+/**
+ * Run a coverage command in a root
+ * @param {Object} root - Coverage root
+ * @param {string} command - Command
+ * @param {Array<string>} args - Arguments
+ * @returns {boolean} True if the command exited 0
+ */
+function run(root, command, args) {
+  const timeout = utils.config.get('development.testing.scheduler.timeoutSeconds', 900) * 1000;
+  logger.debug(`${root.service || '.'}: ${command} ${args.join(' ')}`);
+  const result = spawnSync(command, args, { cwd: root.dir, encoding: 'utf8', timeout, stdio: ['ignore', 'pipe', 'pipe'] });
+  if (result.error) logger.warn(`${command} could not run: ${result.error.message}`);
+  return result.status === 0;
+}
+
+/**
+ * Read a raw coverage file
+ * @param {string} file - File path
+ * @param {number} since - Time (ms) the run started; older files are left over from an earlier run
+ * @returns {string|null} Contents, or null if the tool wrote nothing
+ */
+function readOutput(file, since = null) {
+  const stat = utils.error.trySync(() => fs.statSync(file), null).value;
+  // File system timestamps can trail the clock by a few milliseconds
+  if (!stat || (since !== null && stat.mtimeMs < since - 1000)) return null;
+  return utils.error.trySync(() => fs.readFileSync(file, 'utf8'), null).value;
+}
+
+/**
+ * Collect the coverage of one root with its language's tool
+ * @param {Object} root - Coverage root from getCoverageRoots()
+ * @param {string} outDir - Directory for raw tool output
+ * @returns {Object|null} Files by path relative to the root, or null if no coverage was collected
+ */
+function collectRoot(root, outDir) {
+  const base = path.join(outDir, root.service || 'implementation');
+  const started = Date.now();
+  
+  // A tool that crashes or fails to build writes nothing; never fall back to the last run's output
+  fs.rmSync(base, { recursive: true, force: true });
+  utils.path.ensureDir(base);
+  
+  switch (root.language) {
+    case 'go': {
+      const profile = path.join(base, 'coverage.out');
+      const passed = run(root, 'go', ['test', './...', '-covermode=count', '-coverpkg=./...', `-coverprofile=${profile}`]);
+      const text = readOutput(profile, started);
+      if (text && !passed) logger.warn(`${root.service || 'implementation'}: tests failed; coverage is from the tests that ran`);
+      const goMod = readOutput(path.join(root.dir, 'go.mod')) || '';
+      return text ? utils.coverage.fromGoCoverprofile(text, { modulePath: (/^module\s+(\S+)/m.exec(goMod) || [])[1] }) : null;
+    }
+    
+    case 'js': {
+      const lcov = path.join(base, 'lcov.info');
+      const packageJson = readOutput(path.join(root.dir, 'package.json')) || '';
+      if (packageJson.includes('"jest":')) {
+        run(root, 'npx', ['jest', '--coverage', '--coverageReporters=lcov', `--coverageDirectory=${base}`]);
+      } else if (utils.path.pathExists(path.join(root.dir, 'node_modules', '.bin', 'c8'))) {
+        run(root, 'npx', ['c8', '--reporter=lcovonly', `--report-dir=${base}`, 'npm', 'test']);
+      } else if (utils.path.pathExists(path.join(root.dir, 'coverage', 'lcov.info'))) {
+        // Istanbul/nyc output of the project's own coverage run, used only if `npm test` wrote it now
+        run(root, 'npm', ['test']);
+        const projectLcov = readOutput(path.join(root.dir, 'coverage', 'lcov.info'), started);
+        if (projectLcov) fs.writeFileSync(lcov, projectLcov);
+      }
+      const text = readOutput(lcov, started);
+      return text ? utils.coverage.fromLcov(text, root.dir) : null;
+    }
+    
+    case 'python': {
+      const xml = path.join(base, 'coverage.xml');
+      const dataFile = path.join(base, '.coverage');
+      // Measure the project's modules only, not the tests (as Go and Jest do) or installed packages
+      run(root, 'python', ['-m', 'coverage', 'run', `--data-file=${dataFile}`, '--source=.', '--omit=*/test_*.py,*/*_test.py,*/tests/*,*/conftest.py', '-m', 'pytest']);
+      run(root, 'python', ['-m', 'coverage', 'xml', `--data-file=${dataFile}`, '-o', xml]);
+      const text = readOutput(xml, started);
+      return text ? utils.coverage.fromCobertura(text, root.dir) : null;
+    }
+    
+    case 'rust': {
+      const lcov = path.join(base, 'lcov.info');
+      if (!run(root, 'cargo', ['llvm-cov', '--version'])) {
+        logger.warn(`${root.service || 'implementation'}: cargo-llvm-cov is not installed; skipping Rust coverage`);
+        return null;
+      }
+      run(root, 'cargo', ['llvm-cov', '--lcov', '--output-path', lcov]);
+      const text = readOutput(lcov, started);
+      return text ? utils.coverage.fromLcov(text, root.dir) : null;
+    }
+    
+    default:
+      logger.warn(`${root.service || 'implementation'}: no coverage collector for ${root.language}`);
+      return null;
+  }
+}
+
+/**
+ * Collect coverage and save the merged model
+ * @param {Object} options - { service } to recollect one service and keep the others
+ * @returns {Object} Coverage model
+ */
+function collect({ service = null } = {}) {
+  const implDir = utils.config.getImplementationDir();
+  const roots = getCoverageRoots(implDir).filter(root => !service || root.service === service);
+  if (service && roots.length === 0) throw utils.error.ValidationError(`Unknown service: ${service}`);
+  
+  const commit = utils.error.trySync(() => execFileSync('git', ['rev-parse', 'HEAD'], {
+    cwd: utils.path.resolveProjectPath(),
+    encoding: 'utf8',
+    stdio: ['ignore', 'pipe', 'ignore']
+  }).trim(), null).value;
+  const model = utils.coverage.createModel({ commit });
+  
+  if (service) {
+    const previous = utils.coverage.loadModel();
+    for (const [file, entry] of Object.entries(previous.success ? previous.value.files : {})) {
+      if (entry.service !== service) model.files[file] = entry;
+    }
+  }
+  
+  const outDir = utils.coverage.getCoverageDir();
+  for (const root of roots) {
+    logger.info(`Collecting ${root.language} coverage for ${root.service || 'the implementation'}...`);
+    const files = collectRoot(root, outDir);
+    if (files) utils.coverage.addFiles(model, files, root);
+  }
+  
+  const saved = utils.coverage.saveModel(model);
+  if (!saved.success) throw utils.error.ExecutionError(`Could not save coverage: ${saved.error.message}`);
+  logger.info(`Coverage of ${Object.keys(model.files).length} file(s) written to ${path.relative(process.cwd(), saved.value)}`);
+  return model;
+}
+
+/**
+ * Get the lines of implementation files changed since a commit
+ * @param {string} since - Commit to compare the working tree with
+ * @returns {Map<string, Set<number>|null>} Changed lines by implementation-relative path; null for new untracked files
+ */
+function getChangedLines(since) {
+  const rootDir = utils.path.resolveProjectPath();
+  const implDir = utils.config.getImplementationDir();
+  const git = args => execFileSync('git', args, { cwd: rootDir, encoding: 'utf8', stdio: ['ignore', 'pipe', 'pipe'], maxBuffer: 64 * 1024 * 1024 });
+  const toKey = file => path.relative(implDir, path.join(rootDir, file)).split(path.sep).join('/');
+  const changed = new Map();
+  let current = null;
+  
+  for (const line of git(['diff', '-U0', '--no-color', '--no-renames', since, '--', path.relative(rootDir, implDir) || '.']).split('\n')) {
+    const file = /^\+\+\+ (?:b\/(.+)|\/dev\/null)$/.exec(line);
+    if (file) {
+      current = file[1] ? toKey(file[1]) : null;
+      if (current) changed.set(current, changed.get(current) || new Set());
+      continue;
+    }
+    
+    const hunk = /^@@ -\S+ \+(\d+)(?:,(\d+))? @@/.exec(line);
+    if (hunk && current) {
+      const start = Number(hunk[1]);
+      const count = hunk[2] === undefined ? 1 : Number(hunk[2]);
+      // A pure deletion touches the function around the line it follows
+      for (let number = Math.max(start, 1); number <= Math.max(start + count - 1, start); number++) changed.get(current).add(number);
+    }
+  }
+  
+  for (const file of git(['ls-files', '--others', '--exclude-standard', '--', path.relative(rootDir, implDir) || '.']).split('\n').filter(Boolean)) {
+    changed.set(toKey(file), null);
+  }
+  
+  return changed;
+}
+
+/**
+ * Find the changed functions and how well they are covered
+ * @param {Object} model - Coverage model
+ * @param {string} since - Commit to compare the working tree with
+ * @returns {Array<Object>} { file, name, line, endLine, covered, total, percent, tested, uncovered, stale } per changed function;
+ *   tested is null for functions in files edited after the coverage run
+ */
+function findChangedFunctions(model, since) {
+  const implDir = utils.config.getImplementationDir();
+  const collected = new Date(model.generated).getTime();
+  const functions = [];
+  
+  for (const [file, lines] of getChangedLines(since)) {
+    // Coverage tools leave test files out, and Java or Kotlin files are never measured, so their
+    // functions would always look untested
+    if (isTestFile(file) || !COLLECTED_EXTENSIONS.has(path.extname(file))) continue;
+    
+    const entry = model.files[file];
+    const source = utils.error.trySync(() => fs.readFileSync(path.join(implDir, file), 'utf8'), null).value;
+    if (source === null) continue;
+    
+    const stale = fs.statSync(path.join(implDir, file)).mtimeMs > collected;
+    const coverage = entry ? utils.coverage.functionCoverage(entry, source, file) : [];
+    const covered = new Map(coverage.map(fn => [fn.line, fn]));
+    
+    for (const fn of utils.coverage.findFunctions(source, file)) {
+      if (lines && ![...lines].some(number => number >= fn.line && number <= fn.endLine)) continue;
+      
+      // Functions without coverage data (new files, files no test loads) are untested; coverage of
+      // an edited file describes other lines, so its functions are unknown
+      const result = stale ? { ...fn, covered: 0, total: 0, percent: null, tested: null } : covered.get(fn.line) || { ...fn, covered: 0, total: 0, percent: null, tested: false };
+      const uncovered = entry ? utils.coverage.uncoveredRanges({ lines: Object.fromEntries(Object.entries(entry.lines).filter(([number]) => number >= fn.line && number <= fn.endLine)) }) : [];
+      functions.push({ file, ...result, uncovered, stale });
+    }
+  }
+  
+  return functions;
+}
+
+/**
+ * Get the value following a command line flag
+ * @param {string} flag - Flag name
+ * @returns {string|undefined} Flag value
+ */
+function getArg(flag) {
+  const index = process.argv.indexOf(flag);
+  return index !== -1 ? process.argv[index + 1] : undefined;
+}
+
+/**
+ * Main function
+ */
+function main() {
+  const command = process.argv[2];
+  const json = process.argv.includes('--json');
+  
+  switch (command) {
+    case 'collect':
+      collect({ service: getArg('--service') || null });
+      break;
+    
+    case 'check':
+    case 'show': {
+      const model = command === 'check' && process.argv.includes('--collect') ? { success: true, value: collect() } : utils.coverage.loadModel();
+      if (!model.success) throw utils.error.ValidationError('No coverage collected yet; run node scripts/coverage.js collect');
+      
+      const summary = utils.coverage.summarizeModel(model.value);
+      if (json) {
+        console.log(JSON.stringify({ generated: model.value.generated, commit: model.value.commit, ...summary }, null, 2));
+      } else if (summary.files.length === 0) {
+        logger.warn('No coverage data; the implementation has no tests with coverage yet');
+      } else {
+        const top = parseInt(getArg('--top') || utils.config.get('development.testing.coverage.leastCoveredFiles', 10), 10);
+        logger.info(`Total: ${summary.totals.percent}% of ${summary.totals.total} lines in ${summary.totals.files} file(s)`);
+        
+        for (const [name, service] of Object.entries(summary.services)) {
+          const label = name === '.' ? 'implementation' : name;
+          logger[service.passed ? 'info' : 'error'](`${label}: ${service.percent}% (threshold ${service.threshold}%)${service.passed ? '' : ' - below threshold'}`);
+          
+          if (command === 'show' || !service.passed) {
+            for (const file of summary.files.filter(entry => (entry.service || '.') === name).slice(0, top)) {
+              logger[service.passed ? 'info' : 'error'](`  ${`${file.percent}%`.padStart(6)}  ${file.file} (${file.covered}/${file.total} lines)`);
+            }
+          }
+        }
+      }
+      
+      if (command === 'check' && !summary.passed) process.exitCode = 1;
+      break;
+    }
+    
+    case 'changed': {
+      const model = utils.coverage.loadModel();
+      if (!model.success) throw utils.error.ValidationError('No coverage collected yet; run node scripts/coverage.js collect');
+      
+      const since = getArg('--since') || utils.error.trySync(() => execFileSync('git', ['rev-parse', 'HEAD~1'], {
+        cwd: utils.path.resolveProjectPath(),
+        encoding: 'utf8',
+        stdio: ['ignore', 'pipe', 'ignore']
+      }).trim(), 'HEAD').value;
+      const functions = findChangedFunctions(model.value, since);
+      const untested = functions.filter(fn => fn.tested === false);
+      const unknown = functions.filter(fn => fn.tested === null);
+      
+      if (json) {
+        console.log(JSON.stringify({ since, generated: model.value.generated, functions }, null, 2));
+      } else if (functions.length === 0) {
+        logger.info(`No functions changed since ${since.slice(0, 12)}`);
+      } else {
+        for (const fn of functions) {
+          if (fn.tested === null) {
+            logger.warn(`${fn.file}:${fn.line} ${fn.name}: unknown (edited since the coverage run)`);
+            continue;
+          }
+          const state = !fn.tested ? 'untested' : `${fn.percent}% covered${fn.uncovered.length ? `, uncovered ${utils.coverage.formatRanges(fn.uncovered)}` : ''}`;
+          logger[fn.tested ? 'info' : 'error'](`${fn.file}:${fn.line} ${fn.name}: ${state}`);
+        }
+        if (unknown.length > 0) logger.warn('Some files changed after coverage was collected; rerun node scripts/coverage.js collect for current results');
+        logger[untested.length ? 'error' : 'info'](`${untested.length} of ${functions.length} changed function(s) untested${unknown.length ? `, ${unknown.length} unknown` : ''}`);
+      }
+      
+      if (untested.length > 0) process.exitCode = 1;
+      break;
+    }
+    
+    default:
+      throw utils.error.ValidationError(`Unknown command: ${command || '(none)'} (expected collect, check, show or changed)`);
+  }
+}
+
+if (require.main === module) {
+  try {
+    main();
+  } catch (err) {
+    utils.error.createErrorHandler('coverage')(err);
+  }
+}
+
+module.exports = {
+  getCoverageRoots,
+  collect,
+  findChangedFunctions
+};
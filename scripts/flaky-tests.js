@@ -0,0 +1,368 @@
+#!/usr/bin/env node
+
+/**
+ * DStudio Flaky Test Quarantine
+ * Reruns failed tests in isolation and quarantines tests that pass on retry
+ *
+ * Usage:
+ *   node scripts/flaky-tests.js retry [--language <lang>] [--service <name>] [--log <file>] [--retries <n>] [--report <name>] [--json]
+ *   node scripts/flaky-tests.js list [--all] [--json]
+ *   node scripts/flaky-tests.js release <test> [--language <lang>]
+ *
+ * `retry` reads the failed tests from a test log (default .cache/last-test-run.log), reruns each
+ * one alone up to --retries times (development.testing.flaky.retries) and exits 0 only when every
+ * failed test and unit in the report (--report) was flaky or already quarantined; a failure without
+ * a test name (a build error, timeout or crash) always fails. Quarantined tests still run and are
+ * still reported, they just no longer fail the gate. `release` takes a fixed test out of quarantine.
+ *
+ * The log of a Jest run only names the failed files, so JavaScript failures are read from the
+ * Jest results in the report instead: each test is "<file>::<full name>" and reruns with `-t`.
+ *
+ * Every observed outcome is tracked per test name in .cache/flaky-tests.json, with first-seen,
+ * last-seen, run and flip counts; the flip rate is the share of consecutive outcomes that changed.
+ * The outcome is also written into the test-affected report (--report) in .cache/test-reports/,
+ * where failed tests are marked flaky and/or quarantined. --service reruns tests in that service.
+ */
+
+const fs = require('fs');
+const path = require('path');
+const { spawnSync } = require('child_process');
+const utils = require('../utils');
+const { detectLanguage, parseFailingTests } = require('./bisect-tests');
+const logger = utils.logger.createScopedLogger('FlakyTests');
+
+// Separates the file from the full test name in JavaScript selectors
+const JS_NAME_SEPARATOR = '::';
+
+/**
+ * Get the quarantine file
+ * @returns {string} Absolute path
+ */
+function getQuarantineFile() {
+  return utils.path.resolveProjectPath(utils.config.get('development.testing.flaky.quarantineFile', '.cache/flaky-tests.json'));
+}
+
+/**
+ * Load the tracked tests
+ * @returns {Object} Entries by "<language>:<test>"
+ */
+function loadQuarantine() {
+  return utils.error.trySync(() => JSON.parse(fs.readFileSync(getQuarantineFile(), 'utf8')).tests || {}, {}).value;
+}
+
+/**
+ * Save the tracked tests
+ * @param {Object} tests - Entries by "<language>:<test>"
+ */
+function saveQuarantine(tests) {
+  const file = getQuarantineFile();
+  utils.path.ensureDir(path.dirname(file));
+  fs.writeFileSync(`${file}.tmp`, JSON.stringify({ version: 1, tests }, null, 2));
+  fs.renameSync(`${file}.tmp`, file);
+}
+
+/**
+ * Check whether a test is quarantined
+ * @param {string} language - Language as used by test-affected.sh
+ * @param {string} test - Test name
+ * @param {Object} tests - Tracked tests (loaded if omitted)
+ * @returns {boolean} True if failures of the test do not gate
+ */
+function isQuarantined(language, test, tests = loadQuarantine()) {
+  return Boolean(tests[`${language}:${test}`]?.quarantined);
+}
+
+/**
+ * Record one outcome of a test
+ * @param {Object} tests - Tracked tests, updated in place
+ * @param {string} language - Language as used by test-affected.sh
+ * @param {string} test - Test name
+ * @param {string} outcome - "pass" or "fail"
+ * @returns {Object} The updated entry
+ */
+function observe(tests, language, test, outcome) {
+  const now = new Date().toISOString();
+  const entry = tests[`${language}:${test}`] || (tests[`${language}:${test}`] = {
+    language,
+    test,
+    firstSeen: now,
+    runs: 0,
+    failures: 0,
+    flips: 0,
+    quarantined: false
+  });
+  
+  if (entry.lastOutcome && entry.lastOutcome !== outcome) entry.flips++;
+  entry.runs++;
+  if (outcome === 'fail') entry.failures++;
+  entry.lastOutcome = outcome;
+  entry.lastSeen = now;
+  entry.flipRate = entry.runs > 1 ? Math.round((entry.flips / (entry.runs - 1)) * 100) / 100 : 0;
+  return entry;
+}
+
+/**
+ * Run one test alone through impl-deps.sh
+ * @param {string} implDir - Directory to run the test in
+ * @param {string} test - Test selector (see run_impl_tests)
+ * @param {string} language - Language as used by test-affected.sh
+ * @returns {boolean} True if the test passed
+ */
+function runIsolated(implDir, test, language) {
+  // "<file>::<full name>" runs the file with Jest's name filter, matching the whole name
+  const separator = language === 'js' ? test.indexOf(JS_NAME_SEPARATOR) : -1;
+  const args = separator === -1 ? [test] : [
+    test.slice(0, separator),
+    '-t',
+    `^${test.slice(separator + JS_NAME_SEPARATOR.length).replace(/[.*+?^${}()|[\]\\]/g, '\\$&')}$`
+  ];
+  
+  const result = spawnSync('bash', [path.join(__dirname, 'impl-deps.sh'), 'test', implDir, ...args], {
+    cwd: utils.path.resolveProjectPath(),
+    encoding: 'utf8',
+    timeout: utils.config.get('development.testing.flaky.timeoutSeconds', 300) * 1000
+  });
+  return result.status === 0;
+}
+
+/**
+ * Rerun failed tests and classify them as flaky or failed
+ * A test that passes on any retry is flaky and gets quarantined.
+ * @param {Object} options - Retry options
+ * @param {string} options.language - Language as used by test-affected.sh
+ * @param {Array<string>} options.tests - Failed test selectors
+ * @param {string} options.implDir - Directory to rerun the tests in
+ * @param {number} options.retries - Maximum reruns per test
+ * @returns {Object} { tests: [{ test, classification, quarantined, attempts, flipRate }], gating: [test] }
+ */
+function retryFailures({ language, tests, implDir = utils.config.getImplementationDir(), retries = utils.config.get('development.testing.flaky.retries', 2) }) {
+  const tracked = loadQuarantine();
+  const results = [];
+  
+  for (const test of tests) {
+    const attempts = ['fail'];
+    observe(tracked, language, test, 'fail');
+    
+    while (attempts.length <= retries && !attempts.includes('pass')) {
+      const outcome = runIsolated(implDir, test, language) ? 'pass' : 'fail';
+      attempts.push(outcome);
+      observe(tracked, language, test, outcome);
+    }
+    
+    const entry = tracked[`${language}:${test}`];
+    const classification = attempts.includes('pass') ? 'flaky' : 'failed';
+    if (classification === 'flaky' && !entry.quarantined) {
+      entry.quarantined = true;
+      entry.quarantinedAt = entry.lastSeen;
+    }
+    
+    results.push({ test, classification, quarantined: entry.quarantined, attempts, flipRate: entry.flipRate });
+  }
+  
+  saveQuarantine(tracked);
+  return { tests: results, gating: results.filter(result => !result.quarantined).map(result => result.test) };
+}
+
+/**
+ * Get the selector a report test is retried and quarantined under
+ * Matches the names parseFailingTests() reads from the test output, except for JavaScript, where a
+ * test is "<file>::<full name>" and a file that failed to run is its path.
+ * @param {string} language - Language as used by test-affected.sh
+ * @param {Object} suite - Report suite
+ * @param {Object} test - Report test
+ * @returns {string} Test selector
+ */
+function testSelector(language, suite, test) {
+  switch (language) {
+    case 'go':
+      return test.name.split('/')[0];
+    case 'js': {
+      const file = test.file || suite.name;
+      return test.name === file ? file : `${file}${JS_NAME_SEPARATOR}${test.name}`;
+    }
+    case 'java-maven':
+      return `${suite.name.split('.').pop()}#${test.name}`;
+    case 'java-gradle':
+      return `${suite.name}.${test.name}`;
+    default:
+      return test.name;
+  }
+}
+
+/**
+ * Get the selectors of the failed tests of a report
+ * @param {Object} report - Report
+ * @param {string} language - Language as used by test-affected.sh
+ * @returns {Array<string>} Unique test selectors
+ */
+function failedSelectors(report, language) {
+  const selectors = report.suites.flatMap(suite => suite.tests
+    .filter(test => test.status === 'failed' || test.status === 'error')
+    .map(test => testSelector(language, suite, test)));
+  return [...new Set(selectors)];
+}
+
+/**
+ * Get the failures of an annotated report that still gate
+ * @param {Object} report - Report from annotateReport()
+ * @returns {Array<string>} Failed tests that are neither flaky nor quarantined, as "<suite> > <test>"
+ */
+function unexcusedFailures(report) {
+  const names = report.suites.flatMap(suite => suite.tests
+    .filter(test => (test.status === 'failed' || test.status === 'error') && !test.quarantined)
+    .map(test => (test.name === suite.name ? test.name : `${suite.name} > ${test.name}`)));
+  return [...new Set(names)];
+}
+
+/**
+ * Mark the failed tests of a report as flaky and/or quarantined
+ * @param {Object} report - Report, updated in place
+ * @param {string} language - Language as used by test-affected.sh
+ * @param {Object} retryResult - Result of retryFailures(), or null to apply the quarantine only
+ * @returns {Object} The report with updated totals
+ */
+function annotateReport(report, language, retryResult = null) {
+  const tracked = loadQuarantine();
+  const classified = new Map((retryResult?.tests || []).map(entry => [entry.test, entry]));
+  
+  for (const suite of report.suites) {
+    for (const test of suite.tests) {
+      if (test.status !== 'failed' && test.status !== 'error') continue;
+      
+      const selector = testSelector(language, suite, test);
+      const entry = classified.get(selector);
+      if (entry?.classification === 'flaky') test.flaky = true;
+      if (entry?.quarantined || isQuarantined(language, selector, tracked)) test.quarantined = true;
+    }
+  }
+  
+  return utils.testReport.finalizeReport(report);
+}
+
+/**
+ * Get the value following a command line flag
+ * @param {string} flag - Flag name
+ * @returns {string|undefined} Flag value
+ */
+function getArg(flag) {
+  const index = process.argv.indexOf(flag);
+  return index !== -1 ? process.argv[index + 1] : undefined;
+}
+
+/**
+ * Main function
+ */
+function main() {
+  const [command, target] = process.argv.slice(2);
+  const implDir = utils.project.getServiceDir(getArg('--service') || null);
+  const language = getArg('--language') || detectLanguage(implDir);
+  
+  switch (command) {
+    case 'retry': {
+      const logFile = path.resolve(getArg('--log') || utils.path.resolveProjectPath('.cache', 'last-test-run.log'));
+      const output = utils.error.trySync(() => fs.readFileSync(logFile, 'utf8'), '').value;
+      const report = utils.testReport.loadReport(getArg('--report') || 'test-affected');
+      const current = report.success && report.value.language === language ? report.value : null;
+      
+      // Jest results name every failed test; a plain `npm test` unit is only known by its log
+      const jestFailures = language === 'js' && current && current.suites.some(suite => suite.tests.some(test => test.file)) ? failedSelectors(current, language) : [];
+      const tests = jestFailures.length > 0 ? jestFailures : parseFailingTests(output, language);
+      
+      // Without named failures (build errors, crashes) there is nothing to retry and nothing to excuse
+      if (tests.length === 0) {
+        logger.warn(`No failed ${language} tests found in ${path.relative(process.cwd(), logFile)}; treating the run as failed`);
+        process.exitCode = 1;
+        return;
+      }
+      
+      const retries = getArg('--retries') !== undefined ? parseInt(getArg('--retries'), 10) : undefined;
+      const result = retryFailures({ language, tests, implDir, retries });
+      
+      if (process.argv.includes('--json')) {
+        console.log(JSON.stringify(result, null, 2));
+      } else {
+        for (const entry of result.tests) {
+          const note = entry.quarantined ? ' (quarantined, not gating)' : '';
+          logger.info(`${entry.test}: ${entry.classification} [${entry.attempts.join(' ')}] flip rate ${entry.flipRate}${note}`);
+        }
+      }
+      
+      const annotated = current && annotateReport(current, language, result);
+      if (annotated) {
+        const written = utils.testReport.writeReport(annotated);
+        if (!written.success) logger.warn(`Could not update the test report: ${written.error.message}`);
+      }
+      
+      // Failures the log does not name (build errors, timeouts, suites that did not run, crashes)
+      // are in the report but were never retried, so they still fail the run
+      const unexcused = annotated ? unexcusedFailures(annotated) : [];
+      if (result.gating.length > 0) {
+        logger.error(`${result.gating.length} test(s) failed on every retry: ${result.gating.join(', ')}`);
+        process.exitCode = 1;
+      } else if (!annotated) {
+        logger.error(`No ${language} test report for this run; cannot confirm that only flaky tests failed`);
+        process.exitCode = 1;
+      } else if (unexcused.length > 0) {
+        logger.error(`${unexcused.length} failure(s) are neither flaky nor quarantined: ${unexcused.join(', ')}`);
+        process.exitCode = 1;
+      } else {
+        logger.warn(`All ${result.tests.length} failed test(s) are flaky or quarantined`);
+      }
+      break;
+    }
+    
+    case 'list': {
+      const entries = Object.values(loadQuarantine())
+        .filter(entry => process.argv.includes('--all') || entry.quarantined)
+        .sort((a, b) => b.flipRate - a.flipRate || a.test.localeCompare(b.test));
+      
+      if (process.argv.includes('--json')) {
+        console.log(JSON.stringify(entries, null, 2));
+      } else if (entries.length === 0) {
+        logger.info('No quarantined tests');
+      } else {
+        for (const entry of entries) {
+          const state = entry.quarantined ? 'quarantined' : 'tracked';
+          logger.info(`${entry.language.padEnd(8)} ${entry.test.padEnd(50)} ${state.padEnd(11)} flip rate ${entry.flipRate} (${entry.failures}/${entry.runs} failed, first ${entry.firstSeen}, last ${entry.lastSeen})`);
+        }
+      }
+      break;
+    }
+    
+    case 'release': {
+      if (!target || target.startsWith('--')) throw utils.error.ValidationError('release requires a test name');
+      
+      const tests = loadQuarantine();
+      const entry = tests[`${language}:${target}`];
+      if (!entry || !entry.quarantined) throw utils.error.ValidationError(`${target} is not quarantined for ${language}`);
+      
+      entry.quarantined = false;
+      entry.releasedAt = new Date().toISOString();
+      saveQuarantine(tests);
+      logger.info(`Released ${target} from quarantine`);
+      break;
+    }
+    
+    default:
+      throw utils.error.ValidationError(`Unknown command: ${command || '(none)'} (expected retry, list or release)`);
+  }
+}
+
+if (require.main === module) {
+  try {
+    main();
+  } catch (err) {
+    utils.error.createErrorHandler('flaky-tests')(err);
+  }
+}
+
+module.exports = {
+  loadQuarantine,
+  isQuarantined,
+  observe,
+  retryFailures,
+  testSelector,
+  failedSelectors,
+  unexcusedFailures,
+  annotateReport
+};
@@ -2,14 +2,24 @@
 
 /**
  * File Map Generator
+ *
+ * Usage:
+ *   node scripts/gen-file-map.js [--sign]                       Write .cache/file-map.json (and a signed meta manifest)
+ *   node scripts/gen-file-map.js verify [--manifest f] [--json] Check meta files against the signed manifest
+ *
+ * The manifest covers integrity.protectedPaths and is signed with the HMAC key from
+ * DSTUDIO_INTEGRITY_KEY or integrity.keyFile (outside the repository).
+ * verify exits 0 when all files match, 1 on any difference, 2 if the manifest cannot be verified.
  */
 
 const fs = require('fs');
 const path = require('path');
 const crypto = require('crypto');
 const minimatch = require('minimatch');
+const utils = require('../utils');
 
 const OUT = '.cache/file-map.json';
+const MANIFEST = utils.config.get('integrity.manifestFile', 'meta-manifest.json');
 const IGNORE_DIRS = ['.git','node_modules','.cache','dist','build','coverage','vendor','target'];
 const IGNORE_FILES = ['.DS_Store','*.pyc','*.pyo','*.swp','*.swo','*.lock','*.log'];
 const MAX_SIZE = 50*1024*1024;
@@ -48,11 +58,65 @@ async function walk(dir, base='', map={}) {
   return map;
 }
 
+// Protected meta files from a file map, keyed by forward-slash paths
+function metaFiles(map){
+  const files={};
+  for(const [rel,entry] of Object.entries(map)){
+    const file=utils.integrity.normalizePath(rel);
+    if(utils.integrity.getLayer(file)!=='meta'||!utils.integrity.isProtectedPath(file)) continue;
+    if(utils.integrity.isIgnoredPath(file)) continue;
+    files[file]={sha256:entry.sha256,size:entry.size};
+  }
+  return files;
+}
+
+function signManifest(map){
+  const key=utils.integrity.getSigningKey({create:true});
+  if(!key.success) throw key.error;
+  const manifest=utils.integrity.signDocument({version:1,generated:new Date().toISOString(),scope:'meta',files:metaFiles(map)},key.value);
+  fs.writeFileSync(MANIFEST,JSON.stringify(manifest,null,2)+'\n');
+  console.log('Signed manifest',MANIFEST,'with',Object.keys(manifest.files).length,'meta files (key',key.value.keyId+')');
+}
+
+async function verify(manifestFile,json){
+  const fail=msg=>{console.error('Manifest verification failed:',msg);return 2;};
+  if(!fs.existsSync(manifestFile)) return fail(`${manifestFile} not found (generate it with --sign)`);
+  const manifest=utils.error.trySync(()=>JSON.parse(fs.readFileSync(manifestFile,'utf8')));
+  if(!manifest.success) return fail(manifest.error.message);
+  const key=utils.integrity.getSigningKey();
+  if(!key.success) return fail(key.error.message);
+  const verified=utils.integrity.verifyDocument(manifest.value,key.value);
+  if(!verified.success) return fail(verified.error.message);
+
+  const diff=utils.integrity.diffFiles(manifest.value.files,metaFiles(await walk(process.cwd())));
+  const changed=diff.added.length+diff.removed.length+diff.modified.length;
+  if(json){
+    console.log(JSON.stringify({manifest:manifestFile,generated:manifest.value.generated,...diff},null,2));
+  }else{
+    for(const f of diff.modified) console.log('MODIFIED',f);
+    for(const f of diff.removed) console.log('MISSING ',f);
+    for(const f of diff.added) console.log('ADDED   ',f);
+    console.log(changed?`${changed} meta file(s) differ from ${manifestFile} (signed ${manifest.value.generated})`:`All ${Object.keys(manifest.value.files).length} meta files match ${manifestFile}`);
+  }
+  return changed?1:0;
+}
+
 async function main(){
+  const args=process.argv.slice(2);
+  if(args[0]==='verify'){
+    const i=args.indexOf('--manifest');
+    process.exitCode=await verify(i!==-1?args[i+1]:MANIFEST,args.includes('--json'));
+    return;
+  }
   const map = await walk(process.cwd());
   await fs.promises.mkdir('.cache',{recursive:true});
   fs.writeFileSync(OUT,JSON.stringify(map,null,2));
   console.log('Generated file map with',Object.keys(map).length,'entries');
+  if(args.includes('--sign')) signManifest(map);
+}
+
+if(require.main===module){
+  main().catch(e=>{console.error(e);process.exit(1);});
 }
 
-main().catch(e=>{console.error(e);process.exit(1);});
+module.exports = { walk, hashFile, metaFiles };
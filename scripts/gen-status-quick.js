@@ -18,6 +18,7 @@ const SPEC_INDEX_PATH = 'spec.index.json';
 const LAYOUT_PATH = 'project-layout.json';
 const ISSUES_LOG_PATH = 'issues.log';
 const IMPLEMENTATION_DIR = 'generated_implementation';
+const TEST_REPORT_PATH = '.cache/test-reports/latest.json';
 
 function readJsonSafe(filePath, defaultValue = null) {
   try {
@@ -49,7 +50,7 @@ function countRecentIssues(logPath, hours = 24) {
     const threshold = Date.now() - hours * 60 * 60 * 1000;
 
     for (const line of lines) {
-      const timestampMatch = line.match(/^\[(\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}Z?)\]/);
+      const timestampMatch = line.match(/^\[(\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:\.\d+)?Z?)\]/);
       if (timestampMatch) {
         try {
           const lineDate = new Date(timestampMatch[1].replace(' ', 'T') + (timestampMatch[1].endsWith('Z') ? '' : 'Z')).getTime();
@@ -211,6 +212,7 @@ function generateQuickStatus() {
   const specIndex = readJsonSafe(SPEC_INDEX_PATH, { stats: {} });
   const layoutData = readJsonSafe(LAYOUT_PATH, { stats: {} });
   const recentIssues = countRecentIssues(ISSUES_LOG_PATH);
+  const testReport = readJsonSafe(TEST_REPORT_PATH);
 
   // Check if implementation directory exists
   const implementationDirExists = fs.existsSync(IMPLEMENTATION_DIR);
@@ -276,6 +278,13 @@ function generateQuickStatus() {
       recent_issues_warning: recentIssues.warnings
     },
     latest_metrics: latestMetrics,
+    tests: testReport ? {
+      report: TEST_REPORT_PATH,
+      source: testReport.source,
+      generated: testReport.generated,
+      commit: testReport.commit || null,
+      totals: testReport.totals
+    } : null,
     environment: {
       hostname: os.hostname(),
       platform: os.platform(),
@@ -291,7 +300,8 @@ function generateQuickStatus() {
 - Next Task: ${quickStatus.agentState.next_task?.id || quickStatus.agentState.next_task?.title || 'None'}
 - Blockers: ${quickStatus.agentState.blockers_count}
 - Req Progress: ${quickStatus.health.requirements_progress_percent}% (${quickStatus.health.requirements_completed}/${quickStatus.health.requirements_total})
-- Implementation Files: ${quickStatus.implementation.fileCount}`);
+- Implementation Files: ${quickStatus.implementation.fileCount}
+- Tests: ${quickStatus.tests ? `${quickStatus.tests.totals.passed}/${quickStatus.tests.totals.tests} passed (${quickStatus.tests.source})` : 'No test report'}`);
   } catch (writeErr) {
     console.error(`Error writing quick status file ${QUICK_STATUS_PATH}:`, writeErr.message);
     process.exit(1);
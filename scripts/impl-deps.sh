@@ -0,0 +1,133 @@
+#!/usr/bin/env bash
+
+# Dependency restore and test steps for the implementation directory
+# Shared by rollback.sh, checkpoint.js and bisect-tests.js. Source it to get the functions, or run it directly:
+#   bash scripts/impl-deps.sh <restore|test|all> [implementation-dir] [test...]
+# When run as a script, the exit code is that of run_impl_tests (0 after a plain restore).
+
+if ! declare -f print_status >/dev/null; then
+  function print_status() {
+    local color=$1
+    local message=$2
+    
+    case "$color" in
+      "red")    echo -e "\033[0;31m$message\033[0m" ;;
+      "green")  echo -e "\033[0;32m$message\033[0m" ;;
+      "yellow") echo -e "\033[0;33m$message\033[0m" ;;
+      "blue")   echo -e "\033[0;34m$message\033[0m" ;;
+      *)        echo "$message" ;;
+    esac
+  }
+fi
+
+# Restore dependencies based on the detected language (failures are reported, not fatal)
+function restore_impl_dependencies() {
+  local impl_dir=$1
+  
+  if [ ! -d "$impl_dir" ]; then
+    print_status "yellow" "Implementation directory not found or empty. Skipping dependency restore."
+    return 0
+  fi
+  
+  (
+    cd "$impl_dir" || exit 0
+    
+    # Detect project type and restore dependencies
+    if [ -f "package.json" ]; then
+      print_status "blue" "JavaScript/Node.js project detected."
+      npm ci || print_status "yellow" "npm ci failed, but continuing."
+    fi
+    
+    if [ -f "go.mod" ]; then
+      print_status "blue" "Go project detected."
+      go mod download || print_status "yellow" "go mod download failed, but continuing."
+    fi
+    
+    if [ -f "requirements.txt" ]; then
+      print_status "blue" "Python project detected."
+      pip install -r requirements.txt || print_status "yellow" "pip install failed, but continuing."
+    elif [ -f "pyproject.toml" ]; then
+      print_status "blue" "Python project with pyproject.toml detected."
+      pip install -e . || print_status "yellow" "pip install failed, but continuing."
+    fi
+    
+    if [ -f "Cargo.toml" ]; then
+      print_status "blue" "Rust project detected."
+      cargo fetch || print_status "yellow" "cargo fetch failed, but continuing."
+    fi
+    
+    if [ -f "pom.xml" ]; then
+      print_status "blue" "Java (Maven) project detected."
+      mvn dependency:resolve || print_status "yellow" "mvn dependency:resolve failed, but continuing."
+    elif [ -f "build.gradle" ]; then
+      print_status "blue" "Java (Gradle) project detected."
+      ./gradlew dependencies || print_status "yellow" "gradlew dependencies failed, but continuing."
+    fi
+  )
+}
+
+# Run the test suite for the detected language
+# Extra arguments select tests in the language's own form: jest paths, Go test names,
+# pytest node IDs, cargo test filters, Maven Class#method or Gradle Class.method.
+# Returns 0 if tests passed, 1 if they failed and 2 if no supported test setup was found
+function run_impl_tests() {
+  local impl_dir=$1
+  shift
+  local tests=("$@")
+  
+  if [ ! -d "$impl_dir" ]; then
+    return 1
+  fi
+  
+  (
+    cd "$impl_dir" || exit 1
+    
+    # Try each testing approach, but don't fail if tests don't exist
+    if [ -f "package.json" ]; then
+      npm test ${tests[0]:+--} "${tests[@]}" || { print_status "yellow" "JavaScript tests failed or not found."; exit 1; }
+    elif [ -f "go.mod" ]; then
+      go test ./... ${tests[0]:+-run "^($(IFS='|'; echo "${tests[*]}"))\$"} || { print_status "yellow" "Go tests failed or not found."; exit 1; }
+    elif [ -f "requirements.txt" ] || [ -f "pyproject.toml" ]; then
+      python -m pytest "${tests[@]}" || { print_status "yellow" "Python tests failed or not found."; exit 1; }
+    elif [ -f "Cargo.toml" ]; then
+      cargo test ${tests[0]:+--} "${tests[@]}" || { print_status "yellow" "Rust tests failed or not found."; exit 1; }
+    elif [ -f "pom.xml" ]; then
+      mvn test ${tests[0]:+-Dtest="$(IFS=,; echo "${tests[*]}")" -DfailIfNoTests=false -Dsurefire.failIfNoSpecifiedTests=false} || { print_status "yellow" "Maven tests failed or not found."; exit 1; }
+    elif [ -f "build.gradle" ]; then
+      local gradle_args=()
+      for test in "${tests[@]}"; do
+        gradle_args+=(--tests "$test")
+      done
+      ./gradlew test "${gradle_args[@]}" || { print_status "yellow" "Gradle tests failed or not found."; exit 1; }
+    else
+      print_status "yellow" "No supported test setup found."
+      exit 2
+    fi
+  )
+}
+
+# Run directly: bash scripts/impl-deps.sh <restore|test|all> [implementation-dir]
+if [ "${BASH_SOURCE[0]}" = "$0" ]; then
+  STEP=${1:-all}
+  IMPL_DIR=${2:-generated_implementation}
+  shift 2 2>/dev/null || shift $#
+  
+  case "$STEP" in
+    restore)
+      restore_impl_dependencies "$IMPL_DIR"
+      ;;
+    test)
+      print_status "blue" "Running tests..."
+      run_impl_tests "$IMPL_DIR" "$@"
+      ;;
+    all)
+      restore_impl_dependencies "$IMPL_DIR"
+      print_status "blue" "Running tests..."
+      run_impl_tests "$IMPL_DIR" "$@"
+      ;;
+    *)
+      print_status "red" "Usage: $0 <restore|test|all> [implementation-dir] [test...]"
+      exit 1
+      ;;
+  esac
+fi
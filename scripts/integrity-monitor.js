@@ -0,0 +1,351 @@
+#!/usr/bin/env node
+
+/**
+ * DStudio Integrity Monitor
+ * Keeps signed baselines for the meta and implementation layers and reports changes against them
+ *
+ * Usage:
+ *   node scripts/integrity-monitor.js baseline [--layer meta|implementation]   Record and sign baselines
+ *   node scripts/integrity-monitor.js check [--json]                           Compare the tree with the baselines
+ *   node scripts/integrity-monitor.js watch                                    Report changes continuously
+ *
+ * Changes to protected meta paths (integrity.protectedPaths) while an agent holds a live heartbeat
+ * lease are alerts; each change is attributed to the agent whose heartbeat was active.
+ * The implementation baseline follows accepted changes; the meta baseline only changes through `baseline`.
+ */
+
+const fs = require('fs');
+const path = require('path');
+const EventEmitter = require('events');
+const utils = require('../utils');
+const logger = utils.logger.createScopedLogger('Integrity');
+
+/**
+ * Get the monitor file locations
+ * @returns {Object} Absolute paths for the events log and issues log
+ */
+function getPaths() {
+  return {
+    eventsFile: utils.path.resolveProjectPath(utils.config.get('integrity.eventsFile', '.cache/integrity/events.jsonl')),
+    issuesLog: utils.path.resolveProjectPath(utils.config.get('watchdog.issuesLog', 'issues.log'))
+  };
+}
+
+/**
+ * Load the signing key, exiting the command on failure
+ * @param {boolean} create - Create a key file if none exists
+ * @returns {Object} Signing key
+ */
+function requireSigningKey(create = false) {
+  const signingKey = utils.integrity.getSigningKey({ create });
+  if (!signingKey.success) throw signingKey.error;
+  return signingKey.value;
+}
+
+/**
+ * Integrity monitor comparing file changes with signed layer baselines
+ *
+ * Events:
+ * - `change` ({ timestamp, level, layer, type, file, protected, sha256, agent, message }) for every recorded change
+ */
+class IntegrityMonitor extends EventEmitter {
+  /**
+   * Create a new integrity monitor
+   * @param {Object} options - Monitor options
+   * @param {Object} options.signingKey - Key from utils.integrity.getSigningKey()
+   * @param {Object} options.paths - File locations (defaults to getPaths())
+   */
+  constructor(options = {}) {
+    super();
+    this.signingKey = options.signingKey;
+    this.paths = options.paths || getPaths();
+    this.rootDir = utils.path.resolveProjectPath();
+    this.baselines = {};
+    this.reported = new Map();
+    this.watcher = null;
+  }
+  
+  /**
+   * Load and verify both baselines
+   * @returns {Object} Result object; fails if a baseline is missing or its signature is invalid
+   */
+  loadBaselines() {
+    for (const layer of utils.integrity.LAYERS) {
+      const baseline = utils.integrity.loadBaseline(layer, this.signingKey);
+      if (!baseline.success) return baseline;
+      this.baselines[layer] = baseline.value;
+    }
+    
+    return { success: true, value: this.baselines, error: null };
+  }
+  
+  /**
+   * Compare the whole tree with the baselines
+   * @returns {Array<Object>} Changes { layer, type, file, sha256 }
+   */
+  scan() {
+    const changes = [];
+    
+    for (const layer of utils.integrity.LAYERS) {
+      const current = utils.integrity.scanLayer(layer, this.rootDir);
+      const diff = utils.integrity.diffFiles(this.baselines[layer].files, current);
+      
+      for (const type of ['added', 'removed', 'modified']) {
+        for (const file of diff[type]) {
+          changes.push({ layer, type, file, sha256: current[file] ? current[file].sha256 : null });
+        }
+      }
+    }
+    
+    return changes;
+  }
+  
+  /**
+   * Start watching the project and report changes as they happen
+   * Drift that happened while the monitor was not running is reported first.
+   */
+  start() {
+    this.handleChanges(this.scan());
+    
+    this.watcher = new utils.watch.DirectoryWatcher(this.rootDir, {
+      debounceMs: utils.config.get('integrity.debounceMs', utils.config.get('navigation.watch.debounceMs', 250)),
+      rescanIntervalSeconds: utils.config.get('navigation.watch.rescanIntervalSeconds', 30),
+      isExcluded: utils.integrity.isIgnoredPath
+    });
+    
+    this.watcher.on('batch', batch => this.handleBatch(batch));
+    this.watcher.on('mode', mode => logger.info(`Watching ${this.rootDir} (${mode === 'watch' ? 'native events' : 'polling'})`));
+    this.watcher.on('error', err => logger.warn(`Watcher error, falling back to polling: ${err.message}`));
+    this.watcher.start();
+  }
+  
+  /**
+   * Stop watching
+   */
+  stop() {
+    if (this.watcher) {
+      this.watcher.stop();
+      this.watcher = null;
+    }
+  }
+  
+  /**
+   * Resolve a batch of watcher events against the baselines
+   * Only content changes count; a touched file with the baseline hash is not a change.
+   * @param {Array<Object>} batch - Watcher changes
+   */
+  handleBatch(batch) {
+    const changes = [];
+    
+    for (const change of batch) {
+      if (change.isDirectory) continue;
+      
+      const file = utils.integrity.normalizePath(change.relativePath);
+      const layer = utils.integrity.getLayer(file);
+      const recorded = this.baselines[layer].files[file];
+      const checksum = change.type === 'remove' ? null : utils.file.calculateChecksumSync(change.path);
+      const sha256 = checksum && checksum.success ? checksum.value : null;
+      
+      if (!sha256 && recorded) {
+        changes.push({ layer, type: 'removed', file, sha256: null });
+      } else if (sha256 && !recorded) {
+        changes.push({ layer, type: 'added', file, sha256 });
+      } else if (sha256 && recorded && sha256 !== recorded.sha256) {
+        changes.push({ layer, type: 'modified', file, sha256 });
+      } else {
+        // Back to the baseline state, so a later change is reported again
+        this.reported.delete(file);
+      }
+    }
+    
+    this.handleChanges(changes);
+  }
+  
+  /**
+   * Record changes and roll the implementation baseline forward
+   * @param {Array<Object>} changes - Changes { layer, type, file, sha256 }
+   * @returns {Array<Object>} Recorded events
+   */
+  handleChanges(changes) {
+    const events = [];
+    let implementationChanged = false;
+    
+    for (const change of changes) {
+      // Meta changes stay pending until re-baselined; report each state once
+      const state = `${change.type}:${change.sha256}`;
+      if (this.reported.get(change.file) === state) continue;
+      
+      events.push(this.record(change));
+      
+      if (change.layer === 'implementation' && utils.config.get('integrity.acceptImplementationChanges', true)) {
+        const files = this.baselines.implementation.files;
+        if (change.type === 'removed') {
+          delete files[change.file];
+        } else {
+          files[change.file] = { sha256: change.sha256, size: utils.error.trySync(() => fs.statSync(path.join(this.rootDir, change.file)).size, 0).value };
+        }
+        implementationChanged = true;
+      } else {
+        this.reported.set(change.file, state);
+      }
+    }
+    
+    if (implementationChanged) {
+      const saved = utils.integrity.saveBaseline('implementation', this.signingKey, {
+        files: this.baselines.implementation.files,
+        createdBy: 'integrity-monitor'
+      });
+      if (saved.success) {
+        this.baselines.implementation = saved.value;
+      } else {
+        logger.error(`Could not update the implementation baseline: ${saved.error.message}`);
+      }
+    }
+    
+    return events;
+  }
+  
+  /**
+   * Record a change in the events log and mirror warnings to issues.log
+   * @param {Object} change - Change { layer, type, file, sha256 }
+   * @returns {Object} Recorded event
+   */
+  record(change) {
+    const agent = utils.integrity.attributeChange(change.file, this.rootDir);
+    const isProtected = change.layer === 'meta' && utils.integrity.isProtectedPath(change.file);
+    const inSession = agent.candidates.length > 0;
+    
+    const level = isProtected ? (inSession ? 'alert' : 'warn') : 'info';
+    const by = agent.agentId
+      ? ` by ${agent.agentId} (session ${agent.sessionId || 'unknown'}, task ${agent.taskId || 'none'}, ${agent.basis})`
+      : inSession ? ` during session of ${agent.candidates.join(', ')} (ambiguous)` : '';
+    
+    const entry = {
+      timestamp: new Date().toISOString(),
+      level,
+      layer: change.layer,
+      type: change.type,
+      file: change.file,
+      protected: isProtected,
+      sha256: change.sha256,
+      agent,
+      message: `${isProtected ? 'Protected meta file' : `${change.layer === 'meta' ? 'Meta' : 'Implementation'} file`} ${change.type}: ${change.file}${by}`
+    };
+    
+    utils.path.ensureDir(path.dirname(this.paths.eventsFile));
+    fs.appendFileSync(this.paths.eventsFile, JSON.stringify(entry) + '\n');
+    
+    if (level !== 'info') {
+      fs.appendFileSync(this.paths.issuesLog, `[${entry.timestamp}] [${level.toUpperCase()}] ${entry.message}\n`);
+    }
+    
+    const log = { info: logger.info, warn: logger.warn }[level] || logger.error;
+    log(entry.message);
+    
+    this.emit('change', entry);
+    return entry;
+  }
+}
+
+/**
+ * Record and sign baselines
+ * @param {string} layer - Layer to record, or all layers if omitted
+ */
+function createBaselines(layer) {
+  const signingKey = requireSigningKey(true);
+  const layers = layer ? [layer] : utils.integrity.LAYERS;
+  
+  for (const name of layers) {
+    const result = utils.integrity.saveBaseline(name, signingKey);
+    if (!result.success) throw result.error;
+    logger.info(`${name} baseline: ${Object.keys(result.value.files).length} files signed with key ${signingKey.keyId} (${utils.path.getRelativeToProjectRoot(utils.integrity.getBaselinePath(name))})`);
+  }
+}
+
+/**
+ * Compare the tree with the baselines once
+ * Exit codes: 0 no changes, 1 changes to protected meta paths, 2 missing or tampered baseline.
+ */
+function checkOnce() {
+  const monitor = new IntegrityMonitor({ signingKey: requireSigningKey() });
+  const loaded = monitor.loadBaselines();
+  
+  if (!loaded.success) {
+    logger.error(loaded.error.message);
+    process.exitCode = 2;
+    return;
+  }
+  
+  const changes = monitor.scan().map(change => ({
+    ...change,
+    protected: change.layer === 'meta' && utils.integrity.isProtectedPath(change.file),
+    agent: utils.integrity.attributeChange(change.file)
+  }));
+  
+  if (process.argv.includes('--json')) {
+    console.log(JSON.stringify({ changes }, null, 2));
+  } else if (changes.length === 0) {
+    logger.info('No changes since the signed baselines');
+  } else {
+    for (const change of changes) {
+      const log = change.protected ? logger.warn : logger.info;
+      log(`[${change.layer}] ${change.type.padEnd(8)} ${change.file}${change.agent.agentId ? ` (${change.agent.agentId}, ${change.agent.basis})` : ''}`);
+    }
+  }
+  
+  if (changes.some(change => change.protected)) process.exitCode = 1;
+}
+
+/**
+ * Watch the project until interrupted
+ */
+function watch() {
+  const monitor = new IntegrityMonitor({ signingKey: requireSigningKey() });
+  const loaded = monitor.loadBaselines();
+  if (!loaded.success) throw loaded.error;
+  
+  monitor.start();
+  
+  const shutdown = () => {
+    monitor.stop();
+    process.exit(0);
+  };
+  process.on('SIGINT', shutdown);
+  process.on('SIGTERM', shutdown);
+}
+
+/**
+ * Main function
+ */
+function main() {
+  const command = process.argv[2];
+  const layerIndex = process.argv.indexOf('--layer');
+  const layer = layerIndex !== -1 ? process.argv[layerIndex + 1] : undefined;
+  
+  switch (command) {
+    case 'baseline':
+      createBaselines(layer);
+      break;
+    case 'check':
+      checkOnce();
+      break;
+    case 'watch':
+      watch();
+      break;
+    default:
+      throw utils.error.ValidationError(`Unknown command: ${command || '(none)'} (expected baseline, check or watch)`);
+  }
+}
+
+if (require.main === module) {
+  try {
+    main();
+  } catch (err) {
+    utils.error.createErrorHandler('integrity-monitor')(err);
+  }
+}
+
+module.exports = {
+  IntegrityMonitor,
+  getPaths
+};
@@ -0,0 +1,462 @@
+#!/usr/bin/env node
+
+/**
+ * DStudio Metrics Exporter
+ * Exposes watchdog and project health as Prometheus/OpenMetrics gauges and counters
+ *
+ * Usage:
+ *   node scripts/metrics-exporter.js serve [--port n] [--host h]   Serve /metrics over HTTP (local only by default)
+ *   node scripts/metrics-exporter.js write [--textfile path]        Write a textfile-collector file
+ *   node scripts/metrics-exporter.js print [--openmetrics]          Print the metrics to stdout
+ *   node scripts/metrics-exporter.js record-test --exit-code n [--language l] [--scope s] [--duration sec] [--log file]
+ *                                                                   Record the result of a test run
+ *
+ * Metrics are collected on every scrape from heartbeat files, the stale-locks directory,
+ * issues.log, status.quick.json, the implementation directory, the last test run and .cache.
+ */
+
+const fs = require('fs');
+const http = require('http');
+const path = require('path');
+const utils = require('../utils');
+const { getPaths: getWatchdogPaths, readRunningPid, LEVELS } = require('./watchdog');
+const logger = utils.logger.createScopedLogger('Metrics');
+
+const PROMETHEUS_CONTENT_TYPE = 'text/plain; version=0.0.4; charset=utf-8';
+const OPENMETRICS_CONTENT_TYPE = 'application/openmetrics-text; version=1.0.0; charset=utf-8';
+
+// Matches "[2025-04-26T15:30:00Z] [WARN] message", with or without milliseconds
+const ISSUE_LINE_PATTERN = /^\[(\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:\.\d+)?Z?)\]\s*(?:\[([A-Z]+)\])?/;
+
+// Coverage summaries printed by the supported test runners
+const COVERAGE_PATTERNS = [
+  /^All files\s*\|\s*([\d.]+)/m,                 // jest / istanbul (statements)
+  /^TOTAL\s+.*?(\d+(?:\.\d+)?)%\s*$/m,           // pytest-cov
+  /([\d.]+)% coverage,/,                         // cargo tarpaulin
+  /Total.*?(\d+(?:\.\d+)?)%/                     // jacoco text summaries
+];
+
+/**
+ * Get the exporter file locations
+ * @returns {Object} Absolute paths for the textfile, last test run and quick status
+ */
+function getPaths() {
+  return {
+    textfile: utils.path.resolveProjectPath(utils.config.get('metrics.textfile', '.cache/metrics/dstudio.prom')),
+    lastTestRun: utils.path.resolveProjectPath(utils.config.get('metrics.lastTestRunFile', '.cache/last-test-run.json')),
+    quickStatus: utils.path.resolveProjectPath('status.quick.json')
+  };
+}
+
+/**
+ * Read a JSON file
+ * @param {string} filePath - File to read
+ * @returns {Object|null} Parsed content, or null if missing or invalid
+ */
+function readJson(filePath) {
+  return utils.error.trySync(() => JSON.parse(fs.readFileSync(filePath, 'utf8')), null).value;
+}
+
+/**
+ * Create a metric family
+ * @param {string} name - Metric name without the dstudio_ prefix (counters without _total)
+ * @param {string} type - gauge or counter
+ * @param {string} help - Help text
+ * @returns {Object} Family with a chainable add(value, labels) helper that skips non-numeric values
+ */
+function family(name, type, help) {
+  const metric = { name: `dstudio_${name}`, type, help, samples: [] };
+  metric.add = (value, labels = {}) => {
+    if (value !== null && value !== undefined && Number.isFinite(Number(value))) {
+      metric.samples.push({ labels, value: Number(value) });
+    }
+    return metric;
+  };
+  return metric;
+}
+
+/**
+ * Collect heartbeat and lease metrics
+ * @returns {Array<Object>} Metric families
+ */
+function collectHeartbeats() {
+  const age = family('agent_heartbeat_age_seconds', 'gauge', 'Seconds since the agent last renewed its heartbeat');
+  const leaseActive = family('agent_lease_active', 'gauge', 'Whether the agent holds an unexpired lease (1) or not (0)');
+  const ownerAlive = family('agent_owner_alive', 'gauge', 'Whether the process owning the heartbeat is running');
+  const progress = family('agent_task_progress_percent', 'gauge', 'Progress of the agent\'s current task');
+  const now = Date.now();
+  
+  for (const entry of utils.heartbeat.listHeartbeats()) {
+    const data = entry.data || {};
+    const labels = { agent_id: data.agentId || entry.file, status: data.status || 'unknown' };
+    const timestamp = Date.parse(data.timestamp || '') || (entry.modified ? entry.modified.getTime() : NaN);
+    
+    age.add(Number.isFinite(timestamp) ? Math.max(0, (now - timestamp) / 1000) : null, labels);
+    leaseActive.add(entry.leaseActive ? 1 : 0, { agent_id: labels.agent_id });
+    ownerAlive.add(entry.ownerAlive ? 1 : 0, { agent_id: labels.agent_id });
+    
+    if (data.taskId || data.currentTask) {
+      progress.add(data.progress || 0, { agent_id: labels.agent_id, task: data.taskId || data.currentTask });
+    }
+  }
+  
+  const staleLocks = family('stale_locks', 'gauge', 'Stale lock backups in the stale-locks directory');
+  const backups = utils.error.trySync(() => fs.readdirSync(utils.config.getStaleLocksDir()), []).value;
+  staleLocks.add(backups.filter(file => file.endsWith('.stale')).length, { state: 'pending' });
+  staleLocks.add(backups.filter(file => file.endsWith('.recovered')).length, { state: 'recovered' });
+  
+  return [age, leaseActive, ownerAlive, progress, staleLocks];
+}
+
+/**
+ * Collect issues.log counters
+ * Counters count every line in the log, so a rotated log shows up as a counter reset.
+ * @returns {Array<Object>} Metric families
+ */
+function collectIssues() {
+  const total = family('issues', 'counter', 'Entries in issues.log by level');
+  const recent = family('issues_recent', 'gauge', 'Entries in issues.log by level within the recent window');
+  const windowSeconds = utils.config.get('metrics.issuesWindowSeconds', 3600);
+  const threshold = Date.now() - windowSeconds * 1000;
+  const counts = {};
+  const recentCounts = {};
+  
+  const content = utils.file.readFileSync(getWatchdogPaths().issuesLog);
+  for (const line of content.success ? content.value.split('\n') : []) {
+    const match = line.match(ISSUE_LINE_PATTERN);
+    if (!match) continue;
+    
+    const level = (match[2] || 'info').toLowerCase();
+    counts[level] = (counts[level] || 0) + 1;
+    
+    const time = Date.parse(match[1].replace(' ', 'T') + (match[1].endsWith('Z') ? '' : 'Z'));
+    if (time >= threshold) {
+      recentCounts[level] = (recentCounts[level] || 0) + 1;
+    }
+  }
+  
+  // Always expose the watchdog levels so rates start from zero
+  for (const level of new Set([...LEVELS.slice(1), ...Object.keys(counts)])) {
+    total.add(counts[level] || 0, { level });
+    recent.add(recentCounts[level] || 0, { level, window: `${windowSeconds}s` });
+  }
+  
+  return [total, recent];
+}
+
+/**
+ * Collect requirement progress from status.quick.json
+ * @returns {Array<Object>} Metric families
+ */
+function collectProjectStatus() {
+  const status = readJson(getPaths().quickStatus);
+  if (!status) return [];
+  
+  const health = status.health || {};
+  const agentState = status.agentState || {};
+  const generated = Date.parse(status.generated || '');
+  
+  return [
+    family('requirements_total', 'gauge', 'Requirements listed in the project status').add(health.requirements_total),
+    family('requirements_completed', 'gauge', 'Completed requirements').add(health.requirements_completed),
+    family('requirements_progress_percent', 'gauge', 'Requirement completion').add(health.requirements_progress_percent),
+    family('pending_tasks', 'gauge', 'Pending agent tasks').add(agentState.pending_tasks_count),
+    family('blockers', 'gauge', 'Open blockers reported by agents').add(agentState.blockers_count),
+    family('status_generated_timestamp_seconds', 'gauge', 'When status.quick.json was generated')
+      .add(Number.isFinite(generated) ? generated / 1000 : null)
+  ];
+}
+
+/**
+ * Count files in the implementation directory, skipping excluded directories
+ * @returns {number|null} File count, or null if the directory does not exist
+ */
+function countImplementationFiles() {
+  const implDir = utils.config.getImplementationDir();
+  if (!utils.path.isDirectory(implDir)) return null;
+  
+  const count = dirPath => utils.error.trySync(() => fs.readdirSync(dirPath, { withFileTypes: true }), []).value
+    .reduce((total, entry) => {
+      if (entry.isDirectory()) {
+        return utils.config.isExcludedDir(entry.name) ? total : total + count(path.join(dirPath, entry.name));
+      }
+      return entry.isFile() ? total + 1 : total;
+    }, 0);
+  
+  return count(implDir);
+}
+
+/**
+ * Collect implementation, test and cache metrics
+ * @returns {Array<Object>} Metric families
+ */
+function collectWorkspace() {
+  const families = [
+    family('implementation_files', 'gauge', 'Files in the implementation directory').add(countImplementationFiles()),
+    family('cache_size_bytes', 'gauge', 'Size of the .cache directory').add(utils.cache.getCacheSize())
+  ];
+  
+  const lastRun = readJson(getPaths().lastTestRun);
+  if (lastRun) {
+    const labels = { language: lastRun.language || 'unknown', scope: lastRun.scope || 'unknown' };
+    const finished = Date.parse(lastRun.timestamp || '');
+    
+    families.push(
+      family('last_test_run_success', 'gauge', 'Whether the last test run passed (1) or failed (0)').add(lastRun.success ? 1 : 0, labels),
+      family('last_test_run_timestamp_seconds', 'gauge', 'When the last test run finished')
+        .add(Number.isFinite(finished) ? finished / 1000 : null, labels),
+      family('last_test_run_duration_seconds', 'gauge', 'Duration of the last test run').add(lastRun.durationSeconds, labels),
+      family('test_coverage_percent', 'gauge', 'Coverage reported by the last test run').add(lastRun.coveragePercent, labels)
+    );
+  }
+  
+  return families;
+}
+
+/**
+ * Collect watchdog daemon and check metrics
+ * @returns {Array<Object>} Metric families
+ */
+function collectWatchdog() {
+  const paths = getWatchdogPaths();
+  const state = readJson(paths.stateFile) || {};
+  const checkLevel = family('watchdog_check_level', 'gauge', 'Worst level of the last check run (0 ok, 1 info, 2 warn, 3 alert, 4 error)');
+  const checkRun = family('watchdog_check_last_run_timestamp_seconds', 'gauge', 'When the check last ran');
+  
+  for (const [name, checkState] of Object.entries(state.checks || {})) {
+    checkLevel.add(['ok', ...LEVELS].indexOf(checkState.lastLevel), { check: name });
+    checkRun.add(checkState.lastRun ? Date.parse(checkState.lastRun) / 1000 : null, { check: name });
+  }
+  
+  return [
+    family('watchdog_up', 'gauge', 'Whether the watchdog daemon is running').add(readRunningPid(paths.pidFile) ? 1 : 0),
+    checkLevel,
+    checkRun
+  ];
+}
+
+/**
+ * Collect all metrics
+ * A failing collector is logged and skipped so one bad file never breaks a scrape.
+ * @returns {Array<Object>} Metric families
+ */
+function collectMetrics() {
+  const collectors = [collectHeartbeats, collectIssues, collectProjectStatus, collectWorkspace, collectWatchdog];
+  const families = [];
+  
+  for (const collector of collectors) {
+    const result = utils.error.trySync(collector, []);
+    if (!result.success) {
+      logger.warn(`${collector.name} failed: ${result.error.message}`);
+    }
+    families.push(...result.value);
+  }
+  
+  return families;
+}
+
+/**
+ * Escape a label value for the exposition format
+ * @param {string} value - Label value
+ * @returns {string} Escaped value
+ */
+function escapeLabel(value) {
+  return String(value).replace(/\\/g, '\\\\').replace(/\n/g, '\\n').replace(/"/g, '\\"');
+}
+
+/**
+ * Render metric families in the Prometheus text or OpenMetrics format
+ * @param {Array<Object>} families - Metric families
+ * @param {Object} options - Format options
+ * @param {boolean} options.openMetrics - Use OpenMetrics (counter families without _total, trailing # EOF)
+ * @returns {string} Exposition text
+ */
+function formatMetrics(families, options = {}) {
+  const lines = [];
+  
+  for (const metric of families) {
+    const sampleName = metric.type === 'counter' ? `${metric.name}_total` : metric.name;
+    const familyName = options.openMetrics ? metric.name : sampleName;
+    
+    lines.push(`# HELP ${familyName} ${metric.help}`);
+    lines.push(`# TYPE ${familyName} ${metric.type}`);
+    
+    for (const sample of metric.samples) {
+      const labels = Object.entries(sample.labels)
+        .map(([key, value]) => `${key}="${escapeLabel(value)}"`)
+        .join(',');
+      lines.push(`${sampleName}${labels ? `{${labels}}` : ''} ${sample.value}`);
+    }
+  }
+  
+  if (options.openMetrics) lines.push('# EOF');
+  return lines.join('\n') + '\n';
+}
+
+/**
+ * Write the metrics to a textfile-collector file (atomically, so a scrape never sees a partial file)
+ * @param {string} textfile - Target file (defaults to metrics.textfile)
+ * @returns {Object} Result object with the written path
+ */
+function writeTextfile(textfile = getPaths().textfile) {
+  return utils.error.trySync(() => {
+    utils.path.ensureDir(path.dirname(textfile));
+    const tmpFile = `${textfile}.${process.pid}.tmp`;
+    fs.writeFileSync(tmpFile, formatMetrics(collectMetrics()));
+    fs.renameSync(tmpFile, textfile);
+    return textfile;
+  });
+}
+
+/**
+ * Serve /metrics over HTTP
+ * @param {Object} options - Server options
+ * @param {number} options.port - Port to listen on
+ * @param {string} options.host - Interface to bind (127.0.0.1 by default)
+ * @returns {http.Server} Listening server
+ */
+function serve(options = {}) {
+  const port = options.port || utils.config.get('metrics.port', 9464);
+  const host = options.host || utils.config.get('metrics.host', '127.0.0.1');
+  
+  const server = http.createServer((req, res) => {
+    const { pathname } = new URL(req.url, `http://${req.headers.host || host}`);
+    
+    if (req.method !== 'GET' || pathname !== '/metrics') {
+      res.writeHead(pathname === '/metrics' ? 405 : 404, { 'Content-Type': 'text/plain' });
+      res.end(pathname === '/metrics' ? 'Method not allowed\n' : 'Metrics are served at /metrics\n');
+      return;
+    }
+    
+    const openMetrics = (req.headers.accept || '').includes('application/openmetrics-text');
+    res.writeHead(200, { 'Content-Type': openMetrics ? OPENMETRICS_CONTENT_TYPE : PROMETHEUS_CONTENT_TYPE });
+    res.end(formatMetrics(collectMetrics(), { openMetrics }));
+  });
+  
+  server.listen(port, host, () => {
+    logger.info(`Serving metrics at http://${host}:${server.address().port}/metrics`);
+  });
+  
+  return server;
+}
+
+/**
+ * Extract a coverage percentage from test runner output
+ * Go prints one line per package, which is averaged.
+ * @param {string} output - Test output
+ * @returns {number|null} Coverage percentage
+ */
+function parseCoverage(output) {
+  const goCoverage = [...output.matchAll(/coverage:\s+([\d.]+)% of statements/g)].map(match => parseFloat(match[1]));
+  if (goCoverage.length > 0) {
+    return Math.round(goCoverage.reduce((sum, value) => sum + value, 0) / goCoverage.length * 10) / 10;
+  }
+  
+  for (const pattern of COVERAGE_PATTERNS) {
+    const match = output.match(pattern);
+    if (match) return parseFloat(match[1]);
+  }
+  
+  return null;
+}
+
+/**
+ * Record the result of a test run for the last_test_run metrics
+ * @param {Object} run - Test run
+ * @param {number} run.exitCode - Exit code of the test command
+ * @param {string} run.language - Implementation language
+ * @param {string} run.scope - all, affected or none
+ * @param {number} run.durationSeconds - Duration of the run
+ * @param {string} run.logFile - Captured test output to read coverage from
+ * @returns {Object} Result object with the recorded run
+ */
+function recordTestRun(run) {
+  return utils.error.trySync(() => {
+    const output = run.logFile ? utils.file.readFileSync(run.logFile) : null;
+    const record = {
+      timestamp: new Date().toISOString(),
+      language: run.language || null,
+      scope: run.scope || null,
+      exitCode: run.exitCode,
+      success: run.exitCode === 0,
+      durationSeconds: Number.isFinite(run.durationSeconds) ? run.durationSeconds : null,
+      coveragePercent: output && output.success ? parseCoverage(output.value) : null
+    };
+    
+    const { lastTestRun } = getPaths();
+    utils.path.ensureDir(path.dirname(lastTestRun));
+    fs.writeFileSync(lastTestRun, JSON.stringify(record, null, 2));
+    return record;
+  });
+}
+
+/**
+ * Get the value following a command line flag
+ * @param {string} flag - Flag name
+ * @returns {string|undefined} Flag value
+ */
+function getArg(flag) {
+  const index = process.argv.indexOf(flag);
+  return index !== -1 ? process.argv[index + 1] : undefined;
+}
+
+/**
+ * Main function
+ */
+function main() {
+  const command = process.argv[2] || 'print';
+  
+  switch (command) {
+    case 'serve':
+      serve({ port: parseInt(getArg('--port'), 10) || undefined, host: getArg('--host') });
+      break;
+    
+    case 'write': {
+      const result = writeTextfile(getArg('--textfile') ? path.resolve(getArg('--textfile')) : undefined);
+      if (!result.success) throw result.error;
+      logger.info(`Metrics written to ${utils.path.getRelativeToProjectRoot(result.value)}`);
+      break;
+    }
+    
+    case 'print':
+      process.stdout.write(formatMetrics(collectMetrics(), { openMetrics: process.argv.includes('--openmetrics') }));
+      break;
+    
+    case 'record-test': {
+      const exitCode = parseInt(getArg('--exit-code'), 10);
+      if (!Number.isInteger(exitCode)) {
+        throw utils.error.ValidationError('record-test requires --exit-code');
+      }
+      
+      const result = recordTestRun({
+        exitCode,
+        language: getArg('--language'),
+        scope: getArg('--scope'),
+        durationSeconds: parseFloat(getArg('--duration')),
+        logFile: getArg('--log')
+      });
+      if (!result.success) throw result.error;
+      break;
+    }
+    
+    default:
+      throw utils.error.ValidationError(`Unknown command: ${command} (expected serve, write, print or record-test)`);
+  }
+}
+
+if (require.main === module) {
+  try {
+    main();
+  } catch (err) {
+    utils.error.createErrorHandler('metrics-exporter')(err);
+  }
+}
+
+module.exports = {
+  collectMetrics,
+  formatMetrics,
+  writeTextfile,
+  serve,
+  recordTestRun,
+  parseCoverage
+};
@@ -0,0 +1,630 @@
+#!/usr/bin/env node
+
+/**
+ * DStudio Stale-Agent Recovery
+ * Applies configurable recovery policies to stale agents and resumes sessions from lock backups
+ *
+ * Usage:
+ *   node scripts/recovery.js list                              List stale lock backups and their recovery records
+ *   node scripts/recovery.js handle <stale-lock> [--severity s] Apply the recovery policy to a backup
+ *   node scripts/recovery.js recover <stale-lock|latest> [--apply-stash]
+ *                                                              Resume the agent session from a backup
+ *
+ * The watchdog applies policies automatically (see attach()).
+ */
+
+const fs = require('fs');
+const path = require('path');
+const { execFileSync, spawn } = require('child_process');
+const utils = require('../utils');
+const { commitWorkingTree } = require('./checkpoint');
+const logger = utils.logger.createScopedLogger('Recovery');
+
+// Watchdog events that indicate a stale agent, and the order actions always run in
+const RECOVERABLE_EVENTS = ['heartbeat-ageing', 'stale-heartbeat', 'owner-process-gone'];
+const ACTION_ORDER = ['checkpoint-branch', 'stash-implementation', 'health-check', 'affected-tests', 'report', 'mark-blocked'];
+const SEVERITIES = ['warn', 'alert', 'critical'];
+
+// Defaults used when .agent-config.json has no recovery.policies
+const DEFAULT_POLICIES = {
+  warn: [],
+  alert: ['checkpoint-branch', 'report', 'mark-blocked'],
+  critical: ['checkpoint-branch', 'stash-implementation', 'health-check', 'affected-tests', 'report', 'mark-blocked']
+};
+
+// Marker used to find the blocker line a recovery added to a status file
+const BLOCKER_MARKER = 'recovery:';
+
+/**
+ * Run a git command in the project root
+ * @param {Array<string>} args - git arguments
+ * @param {Object} env - Extra environment variables
+ * @returns {string} Stdout without trailing newlines (leading porcelain columns are kept)
+ */
+function git(args, env = {}) {
+  return execFileSync('git', args, {
+    cwd: utils.path.resolveProjectPath(),
+    encoding: 'utf8',
+    env: { ...process.env, ...env },
+    stdio: ['ignore', 'pipe', 'pipe']
+  }).trimEnd();
+}
+
+/**
+ * Get the directory holding recovery records and reports
+ * @returns {string} Absolute path
+ */
+function getRecoveryDir() {
+  return utils.path.resolveProjectPath(utils.config.get('recovery.reportsDir', '.cache/recovery'));
+}
+
+/**
+ * List uncommitted changes in the implementation directory
+ * @returns {Array<string>} Changed paths
+ */
+function getImplementationChanges() {
+  const implDir = utils.path.getRelativeToProjectRoot(utils.config.getImplementationDir());
+  const status = utils.error.trySync(() => git(['status', '--porcelain', '--', implDir]), '');
+  
+  return (status.value || '').split('\n').filter(Boolean).map(line => line.slice(3));
+}
+
+/**
+ * Determine the recovery severity of a watchdog event
+ * A stale agent that left uncommitted implementation changes escalates to critical.
+ * @param {string} level - Watchdog event level
+ * @returns {string} warn, alert or critical
+ */
+function getSeverity(level) {
+  if (level === 'alert' || level === 'error') {
+    return getImplementationChanges().length > 0 ? 'critical' : 'alert';
+  }
+  
+  return 'warn';
+}
+
+/**
+ * Get the configured actions for a severity
+ * @param {string} severity - warn, alert or critical
+ * @returns {Array<string>} Actions in execution order
+ */
+function getPolicy(severity) {
+  const policies = utils.config.get('recovery.policies', DEFAULT_POLICIES);
+  const actions = policies[severity] || [];
+  
+  const unknown = actions.filter(action => !ACTION_ORDER.includes(action));
+  if (unknown.length > 0) {
+    logger.warn(`Ignoring unknown recovery actions for ${severity}: ${unknown.join(', ')}`);
+  }
+  
+  return ACTION_ORDER.filter(action => actions.includes(action));
+}
+
+/**
+ * Commit the whole working tree to a recovery branch without touching HEAD, the index or files
+ * @param {Object} heartbeat - Heartbeat of the stale agent
+ * @param {string} recordId - Recovery record identifier
+ * @returns {Object} Action result
+ */
+function checkpointBranch(heartbeat, recordId) {
+  const prefix = utils.config.get('recovery.branchPrefix', 'recovery');
+  const branch = `${prefix}/${recordId}`;
+  const commit = commitWorkingTree(
+    `Recovery checkpoint for ${heartbeat.agent || heartbeat.agentId} (session ${heartbeat.sessionId}, task ${heartbeat.taskId || heartbeat.currentTask || 'unknown'})`);
+  git(['branch', branch, commit]);
+  
+  return { success: true, branch, commit };
+}
+
+/**
+ * Stash uncommitted implementation changes (including untracked files)
+ * @param {Object} heartbeat - Heartbeat of the stale agent
+ * @returns {Object} Action result
+ */
+function stashImplementation(heartbeat) {
+  const changes = getImplementationChanges();
+  if (changes.length === 0) {
+    return { success: true, stashed: false, files: [] };
+  }
+  
+  const implDir = utils.path.getRelativeToProjectRoot(utils.config.getImplementationDir());
+  const message = `recovery: ${heartbeat.agentId || heartbeat.agent} ${heartbeat.sessionId}`;
+  
+  git(['stash', 'push', '--include-untracked', '-m', message, '--', implDir]);
+  const commit = git(['rev-parse', 'stash@{0}']);
+  
+  return { success: true, stashed: true, commit, message, files: changes };
+}
+
+/**
+ * Run a command and capture its outcome
+ * Runs asynchronously, so the watchdog keeps running its checks while health checks and tests run.
+ * @param {string} command - Executable
+ * @param {Array<string>} args - Arguments
+ * @returns {Promise<Object>} Action result with exit code and output tail
+ */
+function runCommand(command, args) {
+  const timeoutSeconds = utils.config.get('recovery.commandTimeoutSeconds', 600);
+  
+  return new Promise(resolve => {
+    const chunks = [];
+    let timedOut = false;
+    
+    // Own process group, so a timeout also stops what the command started (e.g. test binaries)
+    const child = spawn(command, args, { cwd: utils.path.resolveProjectPath(), detached: true, stdio: ['ignore', 'pipe', 'pipe'] });
+    child.stdout.on('data', chunk => chunks.push(chunk));
+    child.stderr.on('data', chunk => chunks.push(chunk));
+    
+    const timer = setTimeout(() => {
+      timedOut = true;
+      utils.error.trySync(() => process.kill(-child.pid, 'SIGTERM'));
+      setTimeout(() => utils.error.trySync(() => process.kill(-child.pid, 'SIGKILL')), 5000).unref();
+    }, timeoutSeconds * 1000);
+    
+    const finish = (exitCode, error) => {
+      clearTimeout(timer);
+      const output = `${Buffer.concat(chunks).toString('utf8')}${error ? error.message : ''}`.trim().split('\n');
+      resolve({
+        success: exitCode === 0 && !timedOut,
+        exitCode,
+        timedOut,
+        output: output.slice(-20).join('\n')
+      });
+    };
+    
+    child.on('error', error => finish(null, error));
+    child.on('close', exitCode => finish(exitCode, null));
+  });
+}
+
+/**
+ * Add a blocker for the stale agent's task to its status file
+ * @param {Object} record - Recovery record
+ * @returns {Object} Action result
+ */
+function markBlocked(record) {
+  const { agentId, taskId } = record.heartbeat;
+  const statusFile = utils.path.resolveProjectPath('status', `status-${agentId}.md`);
+  const existing = utils.file.readFileSync(statusFile);
+  
+  let content = existing.success ? existing.value : `## Agent: ${agentId}\n\n## 🚀 Current Iteration / Task\n- **ID:** ${taskId || 'unknown'}\n\n## 🚧 Blockers\n- None\n`;
+  const blocker = `- **${taskId || 'unknown'}**: Blocked - agent stopped heartbeating (session ${record.heartbeat.sessionId}, ${record.severity}); resume with \`node scripts/recovery.js recover ${path.basename(record.backupFile || '')}\` <!-- ${BLOCKER_MARKER}${record.id} -->`;
+  
+  if (/^## .*Blockers[ \t]*$/m.test(content)) {
+    content = content.replace(/^(## .*Blockers[ \t]*\n)(- None[ \t]*\n)?/m, `$1${blocker}\n`);
+  } else {
+    content = `${content.trimEnd()}\n\n## 🚧 Blockers\n${blocker}\n`;
+  }
+  
+  const result = utils.project.createAgentStatus(agentId, content);
+  return { success: result.success, statusFile: utils.path.getRelativeToProjectRoot(statusFile) };
+}
+
+/**
+ * Remove the blocker a recovery added to a status file
+ * @param {Object} record - Recovery record
+ * @returns {boolean} True if a blocker was removed
+ */
+function unmarkBlocked(record) {
+  const agentId = record.heartbeat.agentId;
+  const statusFile = utils.path.resolveProjectPath('status', `status-${agentId}.md`);
+  const existing = utils.file.readFileSync(statusFile);
+  if (!existing.success) return false;
+  
+  const marker = `<!-- ${BLOCKER_MARKER}${record.id} -->`;
+  if (!existing.value.includes(marker)) return false;
+  
+  let content = existing.value.split('\n').filter(line => !line.includes(marker)).join('\n');
+  
+  // Restore the placeholder when the section is left empty
+  content = content.replace(/^(## .*Blockers[ \t]*\n)(?!- )/m, '$1- None\n');
+  
+  return utils.project.createAgentStatus(agentId, content).success;
+}
+
+/**
+ * Write the Markdown recovery report
+ * @param {Object} record - Recovery record
+ * @returns {Object} Action result
+ */
+function writeReport(record) {
+  const reportFile = path.join(getRecoveryDir(), `${record.id}.md`);
+  const heartbeat = record.heartbeat;
+  const lines = [
+    `# Recovery Report: ${heartbeat.agent || heartbeat.agentId}`,
+    '',
+    `- **Detected:** ${record.created}`,
+    `- **Event:** ${record.event} (${record.severity})`,
+    `- **Session:** ${heartbeat.sessionId}`,
+    `- **Task:** ${heartbeat.taskId || heartbeat.currentTask || 'unknown'} (${heartbeat.progress ?? 0}%)`,
+    `- **Last heartbeat:** ${heartbeat.timestamp}`,
+    `- **Process:** ${heartbeat.pid || 'unknown'}@${heartbeat.hostname || 'unknown'}`,
+    `- **Lock backup:** ${record.backupFile ? utils.path.getRelativeToProjectRoot(record.backupFile) : 'none'}`,
+    '',
+    '## Touched Files',
+    ...((heartbeat.touchedFiles || []).length > 0 ? heartbeat.touchedFiles.map(file => `- ${file}`) : ['- None recorded']),
+    '',
+    '## Uncommitted Implementation Changes',
+    ...(record.implementationChanges.length > 0 ? record.implementationChanges.map(file => `- ${file}`) : ['- None']),
+    '',
+    '## Actions'
+  ];
+  
+  for (const [action, result] of Object.entries(record.actions)) {
+    if (action === 'report') continue;
+    
+    lines.push(`### ${action}: ${result.success ? 'ok' : 'failed'}`);
+    if (result.branch) lines.push(`- Branch: \`${result.branch}\` (${result.commit})`);
+    if (result.stashed) lines.push(`- Stash: \`${result.commit}\` - restore with \`git stash apply ${result.commit}\``);
+    if (result.exitCode !== undefined) lines.push(`- Exit code: ${result.exitCode}${result.timedOut ? ' (timed out)' : ''}`);
+    if (result.statusFile) lines.push(`- Status file: ${result.statusFile}`);
+    if (result.error) lines.push(`- Error: ${result.error}`);
+    if (result.output) lines.push('', '```', result.output, '```');
+    lines.push('');
+  }
+  
+  lines.push('## Resume', '', '```bash', `node scripts/recovery.js recover ${record.backupFile ? path.basename(record.backupFile) : record.id}`, '```', '');
+  
+  utils.file.writeFileSync(reportFile, lines.join('\n'));
+  return { success: true, reportFile: utils.path.getRelativeToProjectRoot(reportFile) };
+}
+
+/**
+ * Load all recovery records
+ * @returns {Array<Object>} Records, most recent first
+ */
+function listRecords() {
+  const dir = getRecoveryDir();
+  const files = utils.error.trySync(() => fs.readdirSync(dir), []).value;
+  
+  return files
+    .filter(file => file.endsWith('.json'))
+    .map(file => utils.error.trySync(() => JSON.parse(fs.readFileSync(path.join(dir, file), 'utf8'))).value)
+    .filter(Boolean)
+    .sort((a, b) => b.created.localeCompare(a.created));
+}
+
+/**
+ * Save a recovery record
+ * @param {Object} record - Recovery record
+ */
+function saveRecord(record) {
+  utils.path.ensureDir(getRecoveryDir());
+  utils.file.writeFileSync(path.join(getRecoveryDir(), `${record.id}.json`), JSON.stringify(record, null, 2));
+}
+
+/**
+ * Apply the recovery policy for a stale agent
+ * @param {Object} heartbeat - Heartbeat of the stale agent
+ * @param {Object} options - Recovery options
+ * @param {string} options.event - Watchdog event name
+ * @param {string} options.severity - warn, alert or critical
+ * @param {string} options.backupFile - Stale lock backup
+ * @returns {Promise<Object>} Result object with success flag and recovery record
+ */
+async function applyPolicy(heartbeat, options = {}) {
+  const severity = options.severity || 'alert';
+  const actions = getPolicy(severity);
+  const leaseKey = heartbeat.leaseId || heartbeat.sessionId;
+  
+  // Only recover a lease once per severity (escalation to a higher severity runs again)
+  const previous = listRecords().find(record => (record.heartbeat.leaseId || record.heartbeat.sessionId) === leaseKey);
+  if (previous && SEVERITIES.indexOf(previous.severity) >= SEVERITIES.indexOf(severity)) {
+    return { success: true, value: previous, error: null };
+  }
+  
+  if (actions.length === 0) {
+    return { success: true, value: null, error: null };
+  }
+  
+  const agentId = heartbeat.agentId || utils.heartbeat.normalizeAgentId(heartbeat.agent || 'agent');
+  const ts = new Date().toISOString().replace(/[-:T]/g, '').slice(0, 14);
+  const record = {
+    id: `${agentId}-${ts}`,
+    created: new Date().toISOString(),
+    event: options.event || 'manual',
+    severity,
+    backupFile: options.backupFile || null,
+    heartbeat: { ...heartbeat, agentId },
+    implementationChanges: getImplementationChanges(),
+    actions: {},
+    resumed: null
+  };
+  
+  logger.warn(`Recovering ${agentId} (session ${heartbeat.sessionId}, ${severity}): ${actions.join(', ')}`);
+  
+  for (const action of actions) {
+    const result = await utils.error.tryAsync(async () => {
+      switch (action) {
+        case 'checkpoint-branch':
+          return checkpointBranch(record.heartbeat, record.id);
+        case 'stash-implementation':
+          return stashImplementation(record.heartbeat);
+        case 'health-check':
+          return runCommand(process.execPath, [path.join(__dirname, 'health-check.js')]);
+        case 'affected-tests':
+          return runCommand('bash', [path.join(__dirname, 'test-affected.sh')]);
+        case 'report':
+          return writeReport(record);
+        case 'mark-blocked':
+          return markBlocked(record);
+      }
+    });
+    
+    record.actions[action] = result.success ? result.value : { success: false, error: result.error.message };
+    const outcome = record.actions[action];
+    const reason = outcome.error || (outcome.exitCode !== undefined ? `exit code ${outcome.exitCode}` : 'unknown error');
+    logger.info(`  ${action}: ${outcome.success ? 'ok' : `failed (${reason})`}`);
+  }
+  
+  saveRecord(record);
+  return { success: true, value: record, error: null };
+}
+
+/**
+ * Find the stale agent a watchdog event is about
+ * @param {Object} event - Watchdog event
+ * @returns {Object|null} { heartbeat, options } for applyPolicy(), or null if there is nothing to recover
+ */
+function resolveEvent(event) {
+  if (!RECOVERABLE_EVENTS.includes(event.event) || !event.data) return null;
+  
+  const rootDir = utils.path.resolveProjectPath();
+  let backupFile = event.data.backupFile || null;
+  let heartbeat;
+  
+  if (backupFile) {
+    heartbeat = utils.heartbeat.readHeartbeat(backupFile).value;
+  } else {
+    const lockPath = path.join(rootDir, event.data.file);
+    heartbeat = utils.heartbeat.readHeartbeat(lockPath).value;
+    
+    // A dead owner will never renew; archive its lock now so it can be resumed
+    if (heartbeat && event.event === 'owner-process-gone') {
+      const archived = utils.heartbeat.archiveHeartbeat(lockPath);
+      if (archived.success) backupFile = archived.value.backupFile;
+    }
+  }
+  
+  if (!heartbeat) return null;
+  
+  return { heartbeat, options: { event: event.event, severity: getSeverity(event.level), backupFile } };
+}
+
+/**
+ * Handle a watchdog event
+ * @param {Object} event - Watchdog event
+ * @returns {Promise<Object|null>} Recovery record, or null if nothing was done
+ */
+async function handleEvent(event) {
+  const target = resolveEvent(event);
+  if (!target) return null;
+  
+  const result = await applyPolicy(target.heartbeat, target.options);
+  return result.value;
+}
+
+/**
+ * Apply recovery policies to watchdog events
+ * The stale agent is resolved when the event arrives; its recovery is queued behind earlier ones, so
+ * the listener returns at once and recoveries never run concurrently.
+ * @param {EventEmitter} watchdog - Watchdog instance
+ * @returns {Object} { idle } where idle() resolves once the queued recoveries are done
+ */
+function attach(watchdog) {
+  let queue = Promise.resolve();
+  
+  watchdog.on('event', event => {
+    const target = utils.error.trySync(() => resolveEvent(event));
+    if (target.success && !target.value) return;
+    
+    queue = queue
+      .then(() => {
+        if (!target.success) throw target.error;
+        return applyPolicy(target.value.heartbeat, target.value.options);
+      })
+      .catch(err => logger.error(`Recovery for ${event.event} failed: ${err.message}`));
+  });
+  
+  return { idle: () => queue };
+}
+
+/**
+ * Resolve a stale lock argument to a backup file
+ * @param {string} target - Backup path, backup file name or "latest"
+ * @returns {string|null} Absolute backup path
+ */
+function resolveBackup(target) {
+  const staleLocksDir = utils.config.getStaleLocksDir();
+  
+  if (!target || target === 'latest') {
+    const backups = utils.error.trySync(() => fs.readdirSync(staleLocksDir), []).value
+      .filter(file => file.endsWith('.stale'))
+      .map(file => path.join(staleLocksDir, file))
+      .sort((a, b) => fs.statSync(b).mtimeMs - fs.statSync(a).mtimeMs);
+    return backups[0] || null;
+  }
+  
+  for (const candidate of [path.resolve(target), path.join(staleLocksDir, target)]) {
+    if (fs.existsSync(candidate)) return candidate;
+  }
+  
+  return null;
+}
+
+/**
+ * Resume an agent session from a stale lock backup
+ * The session is handed to the agent through a released lease with resume set, so the
+ * next process that starts a heartbeat for that agent continues the same session and task.
+ * @param {string} target - Backup path, backup file name or "latest"
+ * @param {Object} options - Resume options
+ * @param {boolean} options.applyStash - Re-apply stashed implementation changes
+ * @returns {Object} Result object with success flag and resume details
+ */
+function recover(target, options = {}) {
+  const backupFile = resolveBackup(target);
+  if (!backupFile) {
+    return { success: false, value: null, error: utils.error.ValidationError(`Stale lock backup not found: ${target || 'latest'}`) };
+  }
+  
+  const heartbeat = utils.heartbeat.readHeartbeat(backupFile);
+  if (!heartbeat.success) {
+    return { success: false, value: null, error: utils.error.ValidationError(`Unreadable lock backup: ${backupFile}`) };
+  }
+  
+  const data = heartbeat.value;
+  const agentId = data.agentId || utils.heartbeat.normalizeAgentId(data.agent || 'agent');
+  const record = listRecords().find(entry => entry.backupFile === backupFile) || null;
+  
+  // Acquiring refuses if another live agent already holds this agent's lease or the task
+  const lease = new utils.heartbeat.HeartbeatLease(agentId, {
+    agent: data.agent || agentId,
+    sessionId: data.sessionId,
+    taskId: data.taskId || null
+  });
+  
+  const acquired = lease.acquire();
+  if (!acquired.success) return acquired;
+  
+  lease.setProgress(data.progress || 0);
+  lease.touch(data.touchedFiles || []);
+  
+  let stashApplied = false;
+  const stash = record && record.actions['stash-implementation'];
+  if (options.applyStash && stash && stash.stashed) {
+    git(['stash', 'apply', stash.commit]);
+    stashApplied = true;
+  }
+  
+  const released = lease.release({
+    to: agentId,
+    status: 'recovered',
+    note: `Resumed from ${path.basename(backupFile)}`,
+    resume: true,
+    recovery: record ? {
+      id: record.id,
+      checkpointBranch: record.actions['checkpoint-branch']?.branch || null,
+      stash: stash && stash.stashed ? stash.commit : null,
+      stashApplied
+    } : null
+  });
+  if (!released.success) return released;
+  
+  if (record) {
+    unmarkBlocked(record);
+    record.resumed = { at: new Date().toISOString(), stashApplied };
+    saveRecord(record);
+  }
+  
+  // Keep the backup for reference but stop listing it as pending
+  const recoveredFile = backupFile.replace(/\.stale$/, '.recovered');
+  fs.renameSync(backupFile, recoveredFile);
+  
+  return {
+    success: true,
+    value: {
+      agentId,
+      sessionId: data.sessionId,
+      taskId: data.taskId || data.currentTask || null,
+      heartbeatFile: lease.heartbeatPath,
+      backupFile: recoveredFile,
+      record
+    },
+    error: null
+  };
+}
+
+/**
+ * Print stale lock backups and their recovery state
+ */
+function listBackups() {
+  const staleLocksDir = utils.config.getStaleLocksDir();
+  const records = listRecords();
+  const backups = utils.error.trySync(() => fs.readdirSync(staleLocksDir), []).value
+    .filter(file => file.endsWith('.stale'))
+    .sort();
+  
+  if (backups.length === 0) {
+    logger.info('No stale lock backups pending recovery');
+    return;
+  }
+  
+  for (const file of backups) {
+    const backupFile = path.join(staleLocksDir, file);
+    const data = utils.heartbeat.readHeartbeat(backupFile).value || {};
+    const record = records.find(entry => entry.backupFile === backupFile);
+    
+    logger.info(`${file}`);
+    logger.info(`  agent ${data.agent || 'unknown'}, session ${data.sessionId || 'unknown'}, task ${data.taskId || data.currentTask || 'unknown'}, last beat ${data.timestamp || 'unknown'}`);
+    logger.info(record
+      ? `  recovery ${record.id} (${record.severity}): ${Object.keys(record.actions).join(', ')}`
+      : '  no recovery actions recorded');
+  }
+}
+
+/**
+ * Main function
+ */
+async function main() {
+  const [command, target] = process.argv.slice(2);
+  
+  switch (command) {
+    case 'list':
+      listBackups();
+      break;
+    
+    case 'handle': {
+      const backupFile = resolveBackup(target);
+      if (!backupFile) {
+        throw utils.error.ValidationError(`Stale lock backup not found: ${target || 'latest'}`);
+      }
+      
+      const severityIndex = process.argv.indexOf('--severity');
+      const severity = severityIndex !== -1 ? process.argv[severityIndex + 1] : getSeverity('alert');
+      if (!SEVERITIES.includes(severity)) {
+        throw utils.error.ValidationError(`Unknown severity: ${severity} (expected ${SEVERITIES.join(', ')})`);
+      }
+      
+      const heartbeat = utils.heartbeat.readHeartbeat(backupFile);
+      if (!heartbeat.success) throw heartbeat.error;
+      
+      const result = await applyPolicy(heartbeat.value, { event: 'manual', severity, backupFile });
+      if (result.value) {
+        logger.info(`Recovery record: ${utils.path.getRelativeToProjectRoot(path.join(getRecoveryDir(), `${result.value.id}.json`))}`);
+      } else {
+        logger.info(`No recovery actions configured for severity ${severity}`);
+      }
+      break;
+    }
+    
+    case 'recover': {
+      const result = recover(target, { applyStash: process.argv.includes('--apply-stash') });
+      if (!result.success) throw result.error;
+      
+      const { agentId, sessionId, taskId, heartbeatFile, record } = result.value;
+      logger.info(`Session ${sessionId} (task ${taskId || 'unknown'}) handed back to ${agentId}`);
+      logger.info(`The next heartbeat for ${agentId} resumes it (${utils.path.getRelativeToProjectRoot(heartbeatFile)})`);
+      
+      const branch = record && record.actions['checkpoint-branch']?.branch;
+      if (branch) logger.info(`Checkpoint branch: ${branch}`);
+      break;
+    }
+    
+    default:
+      throw utils.error.ValidationError(`Unknown command: ${command || '(none)'} (expected list, handle or recover)`);
+  }
+}
+
+if (require.main === module) {
+  main().catch(err => utils.error.createErrorHandler('recovery')(err));
+}
+
+module.exports = {
+  attach,
+  handleEvent,
+  applyPolicy,
+  recover,
+  getSeverity,
+  getPolicy,
+  listRecords
+};
@@ -0,0 +1,354 @@
+#!/usr/bin/env node
+
+/**
+ * DStudio Rollback Planner
+ * Resolves the commits a rollback covers and reports what reverting them would change
+ *
+ * Usage:
+ *   node scripts/rollback-plan.js commits [<sha|A..B>] [--agent id] [--since ref]
+ *       Print the commits to revert, oldest first (one SHA per line)
+ *   node scripts/rollback-plan.js report <sha...> [--impl-only] [--json]
+ *       Print the affected files, services and requirements
+ *
+ * Used by rollback.sh for range and per-agent rollbacks and for --dry-run. A commit belongs to an
+ * agent when its author name or email matches the agent ID, its subject starts with [<agent>],
+ * or it has an `Agent: <agent>` trailer. Merge commits are never selected.
+ */
+
+const fs = require('fs');
+const path = require('path');
+const { execFileSync } = require('child_process');
+const utils = require('../utils');
+const logger = utils.logger.createScopedLogger('RollbackPlan');
+
+// Requirement IDs as written in docs/spec.md and in commit messages ("Refs: REQ-4")
+const REQUIREMENT_ID_REGEX = /\bREQ-[A-Za-z0-9.]*[A-Za-z0-9]/g;
+
+/**
+ * Run a git command in the project root
+ * @param {Array<string>} args - git arguments
+ * @returns {string} Stdout without trailing newlines
+ */
+function git(args) {
+  return execFileSync('git', args, {
+    cwd: utils.path.resolveProjectPath(),
+    encoding: 'utf8',
+    maxBuffer: 64 * 1024 * 1024,
+    stdio: ['ignore', 'pipe', 'pipe']
+  }).trimEnd();
+}
+
+/**
+ * Get the implementation directory relative to the project root
+ * @returns {string} Relative path with forward slashes
+ */
+function getImplementationPrefix() {
+  return utils.path.getRelativeToProjectRoot(utils.config.getImplementationDir()).split(path.sep).join('/');
+}
+
+/**
+ * Check whether a commit belongs to an agent
+ * @param {Object} commit - Commit { author, email, message }
+ * @param {string} agentId - Normalized agent ID
+ * @returns {boolean} True if the commit was made by or for the agent
+ */
+function isAgentCommit(commit, agentId) {
+  const normalize = utils.heartbeat.normalizeAgentId;
+  const emailUser = commit.email.split('@')[0];
+  
+  if (normalize(commit.author) === agentId || normalize(commit.email) === agentId || normalize(emailUser) === agentId) {
+    return true;
+  }
+  
+  const subject = commit.message.split('\n')[0];
+  const tagMatch = subject.match(/^\[([^\]]+)\]/);
+  if (tagMatch && normalize(tagMatch[1]) === agentId) return true;
+  
+  return commit.message.split('\n').some(line => {
+    const trailer = line.match(/^Agent:\s*(\S+)\s*$/i);
+    return trailer && normalize(trailer[1]) === agentId;
+  });
+}
+
+/**
+ * Resolve the commits a rollback covers
+ * @param {Object} options - Selection
+ * @param {string} options.target - Single commit or A..B range
+ * @param {string} options.agent - Only commits by this agent
+ * @param {string} options.since - With an agent and no target, only commits after this ref
+ * @returns {Object} Result object with commit SHAs, oldest first
+ */
+function resolveCommits({ target, agent, since } = {}) {
+  return utils.error.trySync(() => {
+    if (!target && !agent) {
+      throw utils.error.ValidationError('A commit, a range or --agent is required');
+    }
+    
+    let revisions;
+    if (target && target.includes('..')) {
+      revisions = [target];
+    } else if (target) {
+      // A single commit, even when it is a merge, so git revert can report it
+      const sha = git(['rev-parse', '--verify', `${target}^{commit}`]);
+      if (!agent) return [sha];
+      revisions = [`${sha}^!`];
+    } else {
+      revisions = [since ? `${since}..HEAD` : 'HEAD'];
+    }
+    
+    const log = git(['log', '--reverse', '--no-merges', '--format=%H%x1f%an%x1f%ae%x1f%B%x1e', ...revisions, '--']);
+    const commits = log.split('\x1e')
+      .map(entry => entry.replace(/^\n/, ''))
+      .filter(Boolean)
+      .map(entry => {
+        const [sha, author, email, message] = entry.split('\x1f');
+        return { sha, author, email, message: message || '' };
+      });
+    
+    const agentId = agent ? utils.heartbeat.normalizeAgentId(agent) : null;
+    return commits
+      .filter(commit => !agentId || isAgentCommit(commit, agentId))
+      .map(commit => commit.sha);
+  }, []);
+}
+
+/**
+ * Load the requirements from spec.index.json, or from docs/spec.md when no index was generated
+ * @returns {Array<Object>} Requirements { id, text, completed, fromInclude }
+ */
+function loadRequirements() {
+  // The index keeps bold IDs ("**REQ-1**: text") in the requirement text
+  const splitId = (id, text) => {
+    const match = text.match(/^\*{0,2}(REQ-[A-Za-z0-9.-]+?)\*{0,2}:\s+(.+)$/);
+    return match ? { id: match[1], text: match[2].trim() } : { id, text };
+  };
+  
+  const indexPath = utils.path.resolveProjectPath('spec.index.json');
+  const index = utils.error.trySync(() => JSON.parse(fs.readFileSync(indexPath, 'utf8')), null).value;
+  
+  if (index && Array.isArray(index.requirements)) {
+    return index.requirements
+      .map(requirement => ({ ...requirement, ...splitId(requirement.id, requirement.text || '') }))
+      .filter(requirement => requirement.id);
+  }
+  
+  const spec = utils.file.readFileSync(utils.path.resolveProjectPath('docs/spec.md'));
+  if (!spec.success) return [];
+  
+  return spec.value.split('\n')
+    .map(line => line.match(/^[*-]\s+\[([ x])\]\s+(.+)$/))
+    .filter(Boolean)
+    .map(match => ({ ...splitId(null, match[2]), completed: match[1] === 'x', fromInclude: null }))
+    .filter(requirement => requirement.id);
+}
+
+/**
+ * Build the impact report for reverting a set of commits
+ * @param {Array<string>} shas - Commits to revert, oldest first
+ * @param {Object} options - Report options
+ * @param {boolean} options.implOnly - Only revert changes inside the implementation directory
+ * @returns {Object} Report { scope, implementationDir, commits, files, skipped, services, requirements }
+ */
+function buildReport(shas, { implOnly = false } = {}) {
+  const implPrefix = getImplementationPrefix();
+  const inImplementation = file => file === implPrefix || file.startsWith(`${implPrefix}/`);
+  
+  const commits = [];
+  const changes = new Map();
+  
+  for (const sha of shas) {
+    const [subject, author, date] = git(['show', '-s', '--format=%s%x1f%an%x1f%aI', sha]).split('\x1f');
+    const message = git(['show', '-s', '--format=%B', sha]);
+    const files = git(['diff-tree', '--root', '--no-commit-id', '--no-renames', '-r', '--name-status', sha])
+      .split('\n')
+      .filter(Boolean)
+      .map(line => {
+        const [status, file] = line.split('\t');
+        return { status: status[0], file };
+      });
+    
+    commits.push({
+      sha,
+      subject,
+      author,
+      date,
+      files: files.length,
+      requirements: [...new Set(message.match(REQUIREMENT_ID_REGEX) || [])]
+    });
+    
+    for (const { status, file } of files) {
+      const change = changes.get(file) || { file, first: status, last: status, commits: [] };
+      change.last = status;
+      change.commits.push(sha.slice(0, 7));
+      changes.set(file, change);
+    }
+  }
+  
+  // What the revert does to each file: undo an addition, bring back a deletion, or restore content
+  const files = [];
+  const skipped = [];
+  for (const change of [...changes.values()].sort((a, b) => a.file.localeCompare(b.file))) {
+    const effect = change.first === 'A' ? 'delete' : change.last === 'D' ? 'restore' : 'modify';
+    const entry = { file: change.file, effect, layer: inImplementation(change.file) ? 'implementation' : 'meta', commits: change.commits };
+    
+    if (implOnly && entry.layer !== 'implementation') {
+      skipped.push(entry);
+    } else {
+      files.push(entry);
+    }
+  }
+  
+  // Services are the top-level directories of the implementation directory
+  const detected = new Set((utils.project.getServices().value || []).map(service => service.name));
+  const services = {};
+  for (const entry of files.filter(file => file.layer === 'implementation')) {
+    const name = entry.file.slice(implPrefix.length + 1).split('/')[0];
+    if (!name || !entry.file.slice(implPrefix.length + 1).includes('/')) continue;
+    
+    services[name] = services[name] || { name, detected: detected.has(name), files: 0 };
+    services[name].files++;
+  }
+  
+  // Requirements referenced by the commits, plus those from the specs of affected services
+  const known = loadRequirements();
+  const requirements = new Map();
+  for (const commit of commits) {
+    for (const id of commit.requirements) {
+      const requirement = requirements.get(id) || { id, source: 'commit', commits: [] };
+      requirement.commits.push(commit.sha.slice(0, 7));
+      requirements.set(id, requirement);
+    }
+  }
+  for (const requirement of known) {
+    const include = requirement.fromInclude ? path.basename(requirement.fromInclude).replace(/\.md$/, '').replace(/-spec$/, '') : null;
+    if (include && services[include] && !requirements.has(requirement.id)) {
+      requirements.set(requirement.id, { id: requirement.id, source: `service spec (${include})`, commits: [] });
+    }
+  }
+  for (const requirement of requirements.values()) {
+    const spec = known.find(candidate => candidate.id === requirement.id);
+    requirement.text = spec ? spec.text : null;
+    requirement.completed = spec ? spec.completed : null;
+  }
+  
+  return {
+    scope: implOnly ? 'implementation' : 'all',
+    implementationDir: implPrefix,
+    commits,
+    files,
+    skipped,
+    services: Object.values(services).sort((a, b) => a.name.localeCompare(b.name)),
+    requirements: [...requirements.values()].sort((a, b) => a.id.localeCompare(b.id, undefined, { numeric: true }))
+  };
+}
+
+/**
+ * Print a report for people
+ * @param {Object} report - Report from buildReport()
+ */
+function printReport(report) {
+  console.log(`Rollback impact (${report.scope === 'implementation' ? `${report.implementationDir}/ only` : 'whole repository'})`);
+  
+  console.log(`\nCommits (${report.commits.length}, reverted newest first):`);
+  for (const commit of report.commits) {
+    console.log(`  ${commit.sha.slice(0, 7)} ${commit.subject} (${commit.author}, ${commit.files} files)`);
+  }
+  
+  console.log(`\nFiles (${report.files.length}):`);
+  for (const entry of report.files) {
+    console.log(`  ${entry.effect.padEnd(8)} ${entry.file}${entry.layer === 'meta' ? '  [meta]' : ''}`);
+  }
+  
+  if (report.skipped.length > 0) {
+    console.log(`\nSkipped meta-layer files (${report.skipped.length}, left as they are):`);
+    for (const entry of report.skipped) {
+      console.log(`  ${entry.file}`);
+    }
+  }
+  
+  console.log(`\nServices (${report.services.length}):`);
+  for (const service of report.services) {
+    console.log(`  ${service.name} (${service.files} files${service.detected ? '' : ', not a detected service'})`);
+  }
+  
+  console.log(`\nRequirements (${report.requirements.length}):`);
+  for (const requirement of report.requirements) {
+    const state = requirement.completed === null ? 'not in spec' : requirement.completed ? 'completed' : 'open';
+    console.log(`  ${requirement.id} [${state}] ${requirement.text || ''} (from ${requirement.source === 'commit' ? requirement.commits.join(', ') : requirement.source})`);
+  }
+  
+  const metaFiles = report.files.filter(entry => entry.layer === 'meta');
+  if (metaFiles.length > 0) {
+    console.log(`\nWarning: ${metaFiles.length} meta-layer files would be reverted; use --impl-only to leave them alone`);
+  }
+}
+
+/**
+ * Get the value following a flag
+ * @param {string} flag - Flag name
+ * @returns {string|undefined} Value
+ */
+function getArg(flag) {
+  const index = process.argv.indexOf(flag);
+  return index !== -1 ? process.argv[index + 1] : undefined;
+}
+
+/**
+ * Get the positional arguments after the command
+ * @returns {Array<string>} Arguments that are neither flags nor flag values
+ */
+function getPositionals() {
+  const valueFlags = ['--agent', '--since'];
+  return process.argv.slice(3).filter((arg, i, args) => !arg.startsWith('--') && !valueFlags.includes(args[i - 1]));
+}
+
+/**
+ * Main function
+ */
+function main() {
+  const command = process.argv[2];
+  
+  switch (command) {
+    case 'commits': {
+      const result = resolveCommits({ target: getPositionals()[0], agent: getArg('--agent'), since: getArg('--since') });
+      if (!result.success) throw result.error;
+      
+      if (result.value.length === 0) {
+        logger.error('No commits match the selection');
+        process.exitCode = 1;
+        return;
+      }
+      console.log(result.value.join('\n'));
+      break;
+    }
+    case 'report': {
+      const shas = getPositionals();
+      if (shas.length === 0) throw utils.error.ValidationError('No commits given');
+      
+      const report = buildReport(shas, { implOnly: process.argv.includes('--impl-only') });
+      if (process.argv.includes('--json')) {
+        console.log(JSON.stringify(report, null, 2));
+      } else {
+        printReport(report);
+      }
+      break;
+    }
+    default:
+      throw utils.error.ValidationError(`Unknown command: ${command || '(none)'} (expected commits or report)`);
+  }
+}
+
+if (require.main === module) {
+  try {
+    main();
+  } catch (err) {
+    utils.error.createErrorHandler('rollback-plan')(err);
+  }
+}
+
+module.exports = {
+  resolveCommits,
+  isAgentCommit,
+  buildReport,
+  loadRequirements
+};
@@ -0,0 +1,531 @@
+#!/usr/bin/env node
+
+/**
+ * DStudio Rollback Registry
+ * Reads and updates the rollback records in .cache/rollbacks written by rollback.sh
+ *
+ * Usage:
+ *   node scripts/rollback-registry.js list [--status s] [--json]        List rollbacks, most recent first
+ *   node scripts/rollback-registry.js show <id|latest> [--json]          Show a rollback, its plan and branch state
+ *   node scripts/rollback-registry.js resume <id|latest> [--into branch] [--push] [--keep-branch]
+ *                                                                        Merge a prepared rollback branch
+ *   node scripts/rollback-registry.js abandon <id|latest> [--reason text] [--remote]
+ *                                                                        Drop a rollback and delete its branch
+ *   node scripts/rollback-registry.js stats [--json]                     Summarize all rollbacks
+ *   node scripts/rollback-registry.js record <id> field=value field:=json ...
+ *                                                                        Create or update a record (used by rollback.sh)
+ *
+ * Also available as `scripts/rollback.sh <list|show|resume|abandon|stats>`.
+ * Record statuses: initiated, prepared (branch ready for review), completed (merged),
+ * failed and abandoned. Every status change is kept in the record's history.
+ */
+
+const fs = require('fs');
+const path = require('path');
+const { execFileSync, spawnSync } = require('child_process');
+const utils = require('../utils');
+const logger = utils.logger.createScopedLogger('Rollback');
+
+const STATUSES = ['initiated', 'prepared', 'completed', 'failed', 'abandoned'];
+
+/**
+ * Run a git command in the project root
+ * @param {Array<string>} args - git arguments
+ * @returns {string} Stdout without trailing newlines
+ */
+function git(args) {
+  return execFileSync('git', args, {
+    cwd: utils.path.resolveProjectPath(),
+    encoding: 'utf8',
+    stdio: ['ignore', 'pipe', 'pipe']
+  }).trimEnd();
+}
+
+/**
+ * Check whether a git command succeeds
+ * @param {Array<string>} args - git arguments
+ * @returns {boolean} True if git exited with 0
+ */
+function gitSucceeds(args) {
+  return utils.error.trySync(() => git(args)).success;
+}
+
+/**
+ * Get the rollback record directory
+ * @returns {string} Absolute path
+ */
+function getRollbackDir() {
+  return utils.path.resolveProjectPath('.cache', 'rollbacks');
+}
+
+/**
+ * Load all rollback records, most recent first
+ * Impact reports (<id>.plan.json) are not records.
+ * @returns {Array<Object>} Rollback records
+ */
+function listRollbacks() {
+  const dir = getRollbackDir();
+  
+  return utils.error.trySync(() => fs.readdirSync(dir), []).value
+    .filter(file => file.endsWith('.json') && !file.endsWith('.plan.json'))
+    .map(file => utils.error.trySync(() => JSON.parse(fs.readFileSync(path.join(dir, file), 'utf8'))).value)
+    .filter(record => record && record.id)
+    .sort((a, b) => (b.time || '').localeCompare(a.time || '') || b.id.localeCompare(a.id));
+}
+
+/**
+ * Load a rollback record by ID (or 'latest')
+ * @param {string} id - Rollback ID
+ * @returns {Object} Result object with success flag and record
+ */
+function loadRollback(id) {
+  const record = id === 'latest'
+    ? listRollbacks()[0]
+    : listRollbacks().find(candidate => candidate.id === id);
+  
+  if (!record) {
+    return { success: false, value: null, error: utils.error.ValidationError(`Rollback not found: ${id || '(none)'}`) };
+  }
+  
+  return { success: true, value: record, error: null };
+}
+
+/**
+ * Load the impact report rollback.sh stored next to a record
+ * @param {string} id - Rollback ID
+ * @returns {Object|null} Report from rollback-plan.js, or null if there is none
+ */
+function loadPlan(id) {
+  return utils.error.trySync(() => JSON.parse(fs.readFileSync(path.join(getRollbackDir(), `${id}.plan.json`), 'utf8')), null).value;
+}
+
+/**
+ * Create or update a rollback record
+ * Status changes are appended to the record's history.
+ * @param {string} id - Rollback ID
+ * @param {Object} fields - Fields to set
+ * @returns {Object} Result object with success flag and the saved record
+ */
+function updateRollback(id, fields) {
+  return utils.error.trySync(() => {
+    if (!id || !/^[A-Za-z0-9._-]+$/.test(id)) {
+      throw utils.error.ValidationError(`Invalid rollback ID: ${id || '(none)'}`);
+    }
+    if (fields.status && !STATUSES.includes(fields.status)) {
+      throw utils.error.ValidationError(`Unknown rollback status: ${fields.status} (expected ${STATUSES.join(', ')})`);
+    }
+    
+    const file = path.join(getRollbackDir(), `${id}.json`);
+    const now = new Date().toISOString();
+    const existing = utils.error.trySync(() => JSON.parse(fs.readFileSync(file, 'utf8')), null).value;
+    const record = { id, time: now, history: [], ...existing, ...fields, updated: now };
+    
+    if (fields.status && (!existing || existing.status !== fields.status)) {
+      record.history = [...(existing?.history || []), { status: fields.status, time: now, ...(fields.error ? { error: fields.error } : {}) }];
+    }
+    
+    // Write to a temporary file first so readers never see a half-written record
+    utils.path.ensureDir(getRollbackDir());
+    const tmpFile = `${file}.${process.pid}.tmp`;
+    fs.writeFileSync(tmpFile, JSON.stringify(record, null, 2));
+    fs.renameSync(tmpFile, file);
+    
+    return record;
+  });
+}
+
+/**
+ * Parse field assignments from the command line
+ * `field=value` sets a string; `field:=value` sets parsed JSON (booleans, null, numbers, arrays).
+ * @param {Array<string>} assignments - Assignments
+ * @returns {Object} Fields
+ */
+function parseFields(assignments) {
+  const fields = {};
+  
+  for (const assignment of assignments) {
+    const match = assignment.match(/^([A-Za-z_][A-Za-z0-9_]*)(:?=)([\s\S]*)$/);
+    if (!match) throw utils.error.ValidationError(`Invalid field assignment: ${assignment}`);
+    
+    const [, name, operator, value] = match;
+    if (operator === '=') {
+      fields[name] = value;
+    } else {
+      const parsed = utils.error.trySync(() => JSON.parse(value));
+      if (!parsed.success) throw utils.error.ValidationError(`Invalid JSON for ${name}: ${value}`);
+      fields[name] = parsed.value;
+    }
+  }
+  
+  return fields;
+}
+
+/**
+ * Check whether a local branch exists
+ * @param {string} branch - Branch name
+ * @returns {boolean} True if the branch exists
+ */
+function branchExists(branch) {
+  return Boolean(branch) && gitSucceeds(['show-ref', '--verify', '--quiet', `refs/heads/${branch}`]);
+}
+
+/**
+ * Describe the state of a rollback branch
+ * @param {Object} record - Rollback record
+ * @returns {Object} Branch state { branch, exists, merged, ahead }
+ */
+function getBranchState(record) {
+  const defaultBranch = utils.config.getDefaultBranch();
+  const exists = branchExists(record.branch);
+  
+  return {
+    branch: record.branch || null,
+    exists,
+    merged: exists && branchExists(defaultBranch) ? gitSucceeds(['merge-base', '--is-ancestor', record.branch, defaultBranch]) : null,
+    ahead: exists && branchExists(defaultBranch) ? Number(git(['rev-list', '--count', `${defaultBranch}..${record.branch}`])) : null
+  };
+}
+
+/**
+ * Run a meta-layer script after a rollback, reporting failures without stopping
+ * @param {string} script - Script path relative to the project root
+ * @param {string} failure - Message logged when the script fails
+ */
+function runMetaScript(script, failure) {
+  if (!utils.path.pathExists(utils.path.resolveProjectPath(script))) return;
+  
+  const result = spawnSync(process.execPath, [script], { cwd: utils.path.resolveProjectPath(), stdio: 'inherit' });
+  if (result.status !== 0) logger.warn(failure);
+}
+
+/**
+ * Merge a prepared rollback branch and mark the rollback completed
+ * @param {string} id - Rollback ID (or 'latest')
+ * @param {Object} options - Resume options
+ * @param {string} options.into - Branch to merge into (default: development.defaultBranch)
+ * @param {boolean} options.push - Push the target branch to origin afterwards
+ * @param {boolean} options.keepBranch - Keep the rollback branch after merging
+ * @returns {Object} Result object with success flag and the updated record
+ */
+function resumeRollback(id, options = {}) {
+  const loaded = loadRollback(id);
+  if (!loaded.success) return loaded;
+  
+  const record = loaded.value;
+  const into = options.into || utils.config.getDefaultBranch();
+  
+  return utils.error.trySync(() => {
+    if (record.status !== 'prepared') {
+      throw utils.error.ValidationError(`Rollback ${record.id} is ${record.status}; only prepared rollbacks can be resumed`);
+    }
+    if (!branchExists(record.branch)) {
+      throw utils.error.ValidationError(`Rollback branch ${record.branch || '(none)'} no longer exists; abandon the rollback instead`);
+    }
+    if (git(['status', '--porcelain', '--untracked-files=no'])) {
+      throw utils.error.ValidationError('Working tree has uncommitted changes. Commit or stash them before resuming a rollback.');
+    }
+    
+    const startBranch = git(['rev-parse', '--abbrev-ref', 'HEAD']);
+    git(['checkout', '-q', into]);
+    
+    try {
+      git(['merge', '--no-ff', '--no-edit', record.branch]);
+    } catch (err) {
+      utils.error.trySync(() => git(['merge', '--abort']));
+      git(['checkout', '-q', startBranch]);
+      updateRollback(record.id, { error: 'merge_conflicts' });
+      throw utils.error.ExecutionError(`Merging ${record.branch} into ${into} failed with conflicts; resolve them on the rollback branch and resume again`);
+    }
+    
+    const merge = git(['rev-parse', 'HEAD']);
+    logger.info(`Merged ${record.branch} into ${into} (${merge.slice(0, 8)})`);
+    
+    let pushed = null;
+    if (options.push) {
+      pushed = gitSucceeds(['push', 'origin', into]);
+      if (pushed) {
+        logger.info(`Pushed ${into} to origin`);
+      } else {
+        logger.error(`Failed to push ${into}; the merge is only local`);
+      }
+    }
+    
+    if (!options.keepBranch) {
+      git(['branch', '-d', record.branch]);
+    }
+    if (startBranch !== into) {
+      git(['checkout', '-q', startBranch]);
+    }
+    
+    const updated = updateRollback(record.id, {
+      status: 'completed',
+      mergedInto: into,
+      mergeCommit: merge,
+      mergePushed: pushed,
+      error: pushed === false ? 'push_failed' : null
+    });
+    if (!updated.success) throw updated.error;
+    
+    // Refresh the meta layer now that the implementation changed
+    logger.info('Updating project status...');
+    runMetaScript('scripts/gen-status-quick.js', 'Failed to update status.');
+    logger.info('Running health check...');
+    runMetaScript('scripts/health-check.js', 'Health check found issues. Please review.');
+    
+    return updated.value;
+  });
+}
+
+/**
+ * Abandon a rollback and delete its branch
+ * @param {string} id - Rollback ID (or 'latest')
+ * @param {Object} options - Abandon options
+ * @param {string} options.reason - Why the rollback was dropped
+ * @param {boolean} options.remote - Also delete the branch on origin if it was pushed
+ * @returns {Object} Result object with success flag and the updated record
+ */
+function abandonRollback(id, options = {}) {
+  const loaded = loadRollback(id);
+  if (!loaded.success) return loaded;
+  
+  const record = loaded.value;
+  
+  return utils.error.trySync(() => {
+    if (record.status === 'completed' || record.status === 'abandoned') {
+      throw utils.error.ValidationError(`Rollback ${record.id} is already ${record.status}`);
+    }
+    
+    if (branchExists(record.branch)) {
+      if (git(['rev-parse', '--abbrev-ref', 'HEAD']) === record.branch) {
+        throw utils.error.ValidationError(`Rollback branch ${record.branch} is checked out; switch branches first`);
+      }
+      git(['branch', '-D', record.branch]);
+      logger.info(`Deleted branch ${record.branch}`);
+    }
+    
+    if (record.pushed && options.remote) {
+      if (gitSucceeds(['push', 'origin', '--delete', record.branch])) {
+        logger.info(`Deleted ${record.branch} on origin`);
+      } else {
+        logger.warn(`Could not delete ${record.branch} on origin`);
+      }
+    } else if (record.pushed) {
+      logger.warn(`${record.branch} is still on origin (delete it with --remote)`);
+    }
+    
+    const updated = updateRollback(record.id, { status: 'abandoned', abandonReason: options.reason || null });
+    if (!updated.success) throw updated.error;
+    return updated.value;
+  });
+}
+
+/**
+ * Summarize all rollback records
+ * @returns {Object} Statistics
+ */
+function getStats() {
+  const records = listRollbacks();
+  const count = (values) => values.reduce((counts, value) => {
+    counts[value] = (counts[value] || 0) + 1;
+    return counts;
+  }, {});
+  const weekAgo = Date.now() - 7 * 24 * 60 * 60 * 1000;
+  const commitCounts = records.map(record => Array.isArray(record.commits) ? record.commits.length : 1);
+  
+  return {
+    total: records.length,
+    lastWeek: records.filter(record => Date.parse(record.time) >= weekAgo).length,
+    byStatus: count(records.map(record => record.status || 'unknown')),
+    byScope: count(records.map(record => record.scope || 'all')),
+    byAgent: count(records.filter(record => record.agent).map(record => record.agent)),
+    errors: count(records.filter(record => record.error).map(record => record.error)),
+    tests: {
+      passed: records.filter(record => record.tests_passed === true).length,
+      failed: records.filter(record => record.tests_passed === false).length,
+      notRun: records.filter(record => record.tests_passed === null || record.tests_passed === undefined).length
+    },
+    averageCommits: records.length ? Math.round(commitCounts.reduce((sum, n) => sum + n, 0) / records.length * 10) / 10 : 0,
+    open: records.filter(record => record.status === 'prepared').map(record => record.id)
+  };
+}
+
+/**
+ * Describe a test result
+ * @param {boolean|null|undefined} passed - tests_passed field
+ * @returns {string} Description
+ */
+function describeTests(passed) {
+  return passed === true ? 'passed' : passed === false ? 'failed' : 'not run';
+}
+
+/**
+ * Print rollbacks
+ * @param {string} status - Only list rollbacks with this status
+ */
+function printList(status) {
+  const records = listRollbacks().filter(record => !status || record.status === status);
+  
+  if (records.length === 0) {
+    logger.info(status ? `No ${status} rollbacks` : 'No rollbacks recorded');
+    return;
+  }
+  
+  for (const record of records) {
+    const commits = Array.isArray(record.commits) ? record.commits.length : 1;
+    logger.info(`${record.id.padEnd(28)} ${(record.status || 'unknown').padEnd(10)} ${String(commits).padStart(3)} commit(s) ${(record.scope || 'all').padEnd(14)} ${record.reason || ''}`);
+  }
+}
+
+/**
+ * Print a rollback with its plan and branch state
+ * @param {string} id - Rollback ID (or 'latest')
+ */
+function printRollback(id) {
+  const loaded = loadRollback(id);
+  if (!loaded.success) throw loaded.error;
+  
+  const record = loaded.value;
+  const plan = loadPlan(record.id);
+  const branch = getBranchState(record);
+  
+  if (process.argv.includes('--json')) {
+    console.log(JSON.stringify({ record, plan, branch }, null, 2));
+    return;
+  }
+  
+  logger.info(`Rollback ${record.id} - ${record.reason || 'no reason given'}`);
+  logger.info(`  Status:   ${record.status}${record.error ? ` (${record.error})` : ''}`);
+  logger.info(`  Started:  ${record.time}${record.agent ? `, commits by ${record.agent}` : ''}`);
+  logger.info(`  Scope:    ${record.scope === 'implementation' ? 'implementation directory only' : 'whole repository'}`);
+  logger.info(`  Tests:    ${describeTests(record.tests_passed)}`);
+  if (record.branch) {
+    logger.info(`  Branch:   ${record.branch} (${branch.exists ? `${branch.ahead ?? '?'} commit(s) ahead of ${utils.config.getDefaultBranch()}${branch.merged ? ', merged' : ''}` : 'deleted'}${record.pushed ? ', pushed' : ''})`);
+  }
+  if (record.mergeCommit) {
+    logger.info(`  Merged:   ${record.mergeCommit.slice(0, 8)} into ${record.mergedInto}`);
+  }
+  
+  const commits = Array.isArray(record.commits) ? record.commits : [record.sha];
+  logger.info(`  Commits:  ${commits.map(sha => sha.slice(0, 7)).join(', ')}`);
+  
+  if (plan) {
+    logger.info(`  Files:    ${plan.files.length}${plan.skipped.length ? ` (${plan.skipped.length} meta-layer file(s) left alone)` : ''}`);
+    logger.info(`  Services: ${plan.services.map(service => service.name).join(', ') || '-'}`);
+    logger.info(`  Requirements: ${plan.requirements.map(requirement => requirement.id).join(', ') || '-'}`);
+  }
+  
+  for (const entry of record.history || []) {
+    logger.info(`  ${entry.time} ${entry.status}${entry.error ? ` (${entry.error})` : ''}`);
+  }
+}
+
+/**
+ * Print rollback statistics
+ */
+function printStats() {
+  const stats = getStats();
+  
+  if (process.argv.includes('--json')) {
+    console.log(JSON.stringify(stats, null, 2));
+    return;
+  }
+  
+  const format = counts => Object.entries(counts).map(([key, value]) => `${key} ${value}`).join(', ') || '-';
+  
+  logger.info(`Rollbacks: ${stats.total} (${stats.lastWeek} in the last 7 days, ${stats.averageCommits} commit(s) on average)`);
+  logger.info(`  By status: ${format(stats.byStatus)}`);
+  logger.info(`  By scope:  ${format(stats.byScope)}`);
+  logger.info(`  By agent:  ${format(stats.byAgent)}`);
+  logger.info(`  Tests:     passed ${stats.tests.passed}, failed ${stats.tests.failed}, not run ${stats.tests.notRun}`);
+  logger.info(`  Errors:    ${format(stats.errors)}`);
+  if (stats.open.length > 0) {
+    logger.info(`  Waiting for review: ${stats.open.join(', ')}`);
+  }
+}
+
+/**
+ * Get the value following a command line flag
+ * @param {string} flag - Flag name
+ * @returns {string|undefined} Flag value
+ */
+function getArg(flag) {
+  const index = process.argv.indexOf(flag);
+  return index !== -1 ? process.argv[index + 1] : undefined;
+}
+
+/**
+ * Main function
+ */
+function main() {
+  const [command, target] = process.argv.slice(2);
+  
+  switch (command) {
+    case 'list':
+      if (process.argv.includes('--json')) {
+        console.log(JSON.stringify(listRollbacks().filter(record => !getArg('--status') || record.status === getArg('--status')), null, 2));
+      } else {
+        printList(getArg('--status'));
+      }
+      break;
+    
+    case 'show':
+      printRollback(target || 'latest');
+      break;
+    
+    case 'resume': {
+      if (!target) throw utils.error.ValidationError('resume requires a rollback ID (or "latest")');
+      
+      const result = resumeRollback(target, {
+        into: getArg('--into'),
+        push: process.argv.includes('--push'),
+        keepBranch: process.argv.includes('--keep-branch')
+      });
+      if (!result.success) throw result.error;
+      
+      logger.info(`Rollback ${result.value.id} completed`);
+      if (result.value.mergePushed === false) process.exitCode = 1;
+      break;
+    }
+    
+    case 'abandon': {
+      if (!target) throw utils.error.ValidationError('abandon requires a rollback ID (or "latest")');
+      
+      const result = abandonRollback(target, { reason: getArg('--reason'), remote: process.argv.includes('--remote') });
+      if (!result.success) throw result.error;
+      
+      logger.info(`Rollback ${result.value.id} abandoned`);
+      break;
+    }
+    
+    case 'stats':
+      printStats();
+      break;
+    
+    case 'record': {
+      const result = updateRollback(target, parseFields(process.argv.slice(4)));
+      if (!result.success) throw result.error;
+      break;
+    }
+    
+    default:
+      throw utils.error.ValidationError(`Unknown command: ${command || '(none)'} (expected list, show, resume, abandon, stats or record)`);
+  }
+}
+
+if (require.main === module) {
+  try {
+    main();
+  } catch (err) {
+    utils.error.createErrorHandler('rollback-registry')(err);
+  }
+}
+
+module.exports = {
+  STATUSES,
+  listRollbacks,
+  loadRollback,
+  updateRollback,
+  resumeRollback,
+  abandonRollback,
+  getStats
+};
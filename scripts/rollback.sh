@@ -1,7 +1,22 @@
 #!/usr/bin/env bash
 
 # Enhanced rollback script with better error handling and multi-language support
-# Properly handles meta/implementation separation by using config-utils.js
+# Properly handles meta/implementation separation by using the shared config utilities
+#
+# Usage:
+#   scripts/rollback.sh <sha|A..B> [reason] [options]
+#   scripts/rollback.sh --agent <id> [--since <ref>] [reason] [options]
+#   scripts/rollback.sh <list|show|resume|abandon|stats> ...   (see scripts/rollback-registry.js)
+#
+# Options:
+#   --agent <id>    Only revert commits made by this agent (within the range, if one is given)
+#   --since <ref>   With --agent and no range, only consider commits after this ref
+#   --impl-only     Only revert changes inside the implementation directory; meta files are left alone
+#   --dry-run       Print the affected commits, files, services and requirements and exit
+#   --push          Push the rollback branch to origin for review
+#
+# The rollback is committed on a new rollback-<id> branch; the current branch and the default
+# branch are never modified. Merge the branch (or open a PR from it) once it has been reviewed.
 
 set -e
 
@@ -23,27 +38,18 @@ function print_status() {
 ROOT_DIR=$(git rev-parse --show-toplevel)
 cd "$ROOT_DIR"
 
-# Get implementation directory from config-utils.js
+# Registry commands over the recorded rollbacks
+case "$1" in
+  list|show|resume|abandon|stats)
+    exec node scripts/rollback-registry.js "$@"
+    ;;
+esac
+
+# Get implementation directory from the config utilities
 function get_impl_dir() {
-  if [ -f "scripts/config-utils.js" ]; then
-    IMPL_DIR=$(node -e "try { const utils = require('./scripts/config-utils'); console.log(utils.getImplementationDir()); } catch (e) { console.error(e); process.exit(1); }")
-    if [ $? -ne 0 ]; then
-      print_status "yellow" "Failed to get implementation directory from config-utils.js"
-      # Fall back to direct JSON parsing
-      if [ -f ".agent-config.json" ]; then
-        # Try to extract implementation directory using grep and cut (more compatible)
-        IMPL_DIR=$(grep -o '"implementationDir": *"[^"]*"' .agent-config.json | cut -d'"' -f4)
-        
-        # If that fails, try with jq if available
-        if [ -z "$IMPL_DIR" ] && command -v jq >/dev/null 2>&1; then
-          IMPL_DIR=$(jq -r '.workspace.implementationDir' .agent-config.json)
-        fi
-        
-        # Clean up the path
-        IMPL_DIR=${IMPL_DIR//.\//}
-      fi
-    fi
-  elif [ -f ".agent-config.json" ]; then
+  IMPL_DIR=$(node -e "const path = require('path'); const utils = require('./utils'); console.log(path.relative(process.cwd(), utils.config.getImplementationDir()));" 2>/dev/null) || IMPL_DIR=""
+  
+  if [ -z "$IMPL_DIR" ] && [ -f ".agent-config.json" ]; then
     # Try to extract implementation directory using grep and cut (more compatible)
     IMPL_DIR=$(grep -o '"implementationDir": *"[^"]*"' .agent-config.json | cut -d'"' -f4)
     
@@ -63,48 +69,115 @@ function get_impl_dir() {
 IMPL_DIR=$(get_impl_dir)
 print_status "blue" "Implementation directory: $IMPL_DIR"
 
-# Check arguments
-if [ $# -lt 1 ]; then
-  print_status "red" "Usage: $0 <sha> [reason]"
+# Parse arguments
+TARGET=""
+REASON=""
+AGENT=""
+SINCE=""
+IMPL_ONLY=false
+DRY_RUN=false
+PUSH=false
+
+while [ $# -gt 0 ]; do
+  case "$1" in
+    --agent)     AGENT=$2; shift ;;
+    --since)     SINCE=$2; shift ;;
+    --impl-only) IMPL_ONLY=true ;;
+    --dry-run)   DRY_RUN=true ;;
+    --push)      PUSH=true ;;
+    --no-push)   ;; # Kept for compatibility; not pushing is the default
+    --*)
+      print_status "red" "Unknown option: $1"
+      exit 1
+      ;;
+    *)
+      # With --agent the range is optional, so a lone argument that is not a revision is the reason
+      if [ -z "$TARGET" ] && [ -z "$REASON" ] && { [ -z "$AGENT" ] || [[ "$1" == *..* ]] || git rev-parse --verify --quiet "$1^{commit}" >/dev/null; }; then
+        TARGET=$1
+      else
+        REASON=$1
+      fi
+      ;;
+  esac
+  shift
+done
+
+if [ -z "$TARGET" ] && [ -z "$AGENT" ]; then
+  print_status "red" "Usage: $0 <sha|A..B> [reason] [--agent id] [--since ref] [--impl-only] [--dry-run] [--push]"
   exit 1
 fi
 
-SHA=$1
-REASON=${2:-"automatic rollback"}
-ID=$(date +%Y%m%d%H%M%S)-${SHA:0:7}
+REASON=${REASON:-"automatic rollback"}
+SCOPE=$([ "$IMPL_ONLY" = true ] && echo "implementation" || echo "all")
+
+# Resolve the commits to revert, oldest first
+PLAN_ARGS=()
+[ -n "$TARGET" ] && PLAN_ARGS+=("$TARGET")
+[ -n "$AGENT" ] && PLAN_ARGS+=(--agent "$AGENT")
+[ -n "$SINCE" ] && PLAN_ARGS+=(--since "$SINCE")
+
+if ! COMMITS=$(node scripts/rollback-plan.js commits "${PLAN_ARGS[@]}"); then
+  print_status "red" "Could not resolve the commits to roll back."
+  exit 1
+fi
+
+# shellcheck disable=SC2206
+COMMIT_LIST=($COMMITS)
+FIRST_SHA=${COMMIT_LIST[0]}
+LAST_SHA=${COMMIT_LIST[${#COMMIT_LIST[@]}-1]}
+SHA=${TARGET:-$LAST_SHA}
+if [ ${#COMMIT_LIST[@]} -eq 1 ]; then
+  RANGE_DESC=${FIRST_SHA:0:7}
+elif [ -n "$AGENT" ]; then
+  RANGE_DESC="${#COMMIT_LIST[@]} commits by $AGENT, ${FIRST_SHA:0:7} to ${LAST_SHA:0:7}"
+else
+  RANGE_DESC="${FIRST_SHA:0:7}^..${LAST_SHA:0:7}, ${#COMMIT_LIST[@]} commits"
+fi
+
+REPORT_ARGS=("${COMMIT_LIST[@]}")
+[ "$IMPL_ONLY" = true ] && REPORT_ARGS+=(--impl-only)
+
+if [ "$DRY_RUN" = true ]; then
+  print_status "blue" "Dry run: nothing will be changed"
+  node scripts/rollback-plan.js report "${REPORT_ARGS[@]}"
+  exit 0
+fi
+
+# Reverting on top of local changes would mix them into the rollback commit
+if [ -n "$(git status --porcelain --untracked-files=no)" ]; then
+  print_status "red" "Working tree has uncommitted changes. Commit or stash them before rolling back."
+  exit 1
+fi
+
+ID=$(date +%Y%m%d%H%M%S)-${LAST_SHA:0:7}
 LOG="issues.log"
+START_BRANCH=$(git rev-parse --abbrev-ref HEAD)
 
 # Create cache directory if it doesn't exist
 mkdir -p .cache/rollbacks
 
+# Keep the impact report next to the rollback record
+node scripts/rollback-plan.js report "${REPORT_ARGS[@]}" --json > .cache/rollbacks/$ID.plan.json
+
+# Create or update the rollback record (field=string, field:=json)
+function write_record() {
+  node scripts/rollback-registry.js record "$ID" "$@"
+}
+
+COMMITS_JSON=$(printf '"%s",' "${COMMIT_LIST[@]}")
+
 # Log rollback
-cat > .cache/rollbacks/$ID.json <<EOF
-{"id":"$ID","sha":"$SHA","time":"$(date -u +%Y-%m-%dT%H:%M:%SZ)","reason":"$REASON","status":"initiated"}
-EOF
+write_record sha="$SHA" commits:="[${COMMITS_JSON%,}]" agent="$AGENT" scope="$SCOPE" reason="$REASON" status=initiated
 
 # Add to issues log
-echo "[$(date -u +%Y-%m-%dT%H:%M:%SZ)] ROLLBACK: $REASON (sha: $SHA)" >> $LOG
-
-print_status "yellow" "Starting rollback of commit $SHA - $REASON"
+echo "[$(date -u +%Y-%m-%dT%H:%M:%SZ)] ROLLBACK: $REASON (commits: $RANGE_DESC, scope: $SCOPE)" >> $LOG
 
-# Get default branch from config or fall back to 'main'
-DEFAULT_BRANCH=$(node -e "try { const utils = require('./scripts/config-utils'); console.log(utils.getDefaultBranch()); } catch (e) { console.log('main'); }")
+print_status "yellow" "Starting rollback of $RANGE_DESC - $REASON"
 
-# Create temp branch for rollback to avoid direct manipulation of main branch
+# Create a branch for the rollback to avoid direct manipulation of the current or default branch
 TEMP_BRANCH="rollback-$ID"
-git checkout -b $TEMP_BRANCH
 
-# Check for a --no-push flag
-NO_PUSH=false
-for arg in "$@"; do
-  if [ "$arg" = "--no-push" ]; then
-    NO_PUSH=true
-    print_status "blue" "Running in no-push mode (will create branch but not push)"
-    break
-  fi
-done
-
-# Check if the temporary branch already exists
+# Check if the branch already exists
 if git show-ref --verify --quiet refs/heads/$TEMP_BRANCH; then
   # Branch exists, generate a unique name with agent ID if available
   if [ -f ".agent-lock" ] && [ -r ".agent-lock" ]; then
@@ -124,143 +197,101 @@ fi
 
 git checkout -b $TEMP_BRANCH
 
-# Try to revert the commit
-if ! git revert --no-commit "$SHA"; then
-  print_status "red" "Failed to revert commit. Checking for conflicts..."
+# Leave the rollback branch and record the failure
+function abort_rollback() {
+  local error=$1
   
-  if git status | grep -q "You are in the middle of a reverting"; then
-    print_status "yellow" "Conflicts detected. Aborting revert and returning to $DEFAULT_BRANCH branch."
-    git revert --abort
-    git checkout "$DEFAULT_BRANCH"
-    git branch -D $TEMP_BRANCH
-    
-    # Update status
-    cat > .cache/rollbacks/$ID.json <<EOF
-{"id":"$ID","sha":"$SHA","time":"$(date -u +%Y-%m-%dT%H:%M:%SZ)","reason":"$REASON","status":"failed","error":"merge_conflicts"}
-EOF
-    
-    exit 1
-  fi
-fi
-
-print_status "green" "Commit reverted. Restoring dependencies..."
-
-# Move to implementation directory and restore dependencies based on language
-if [ -d "$IMPL_DIR" ]; then
-  cd "$IMPL_DIR"
+  git reset --hard -q HEAD
+  git checkout "$START_BRANCH"
+  git branch -D $TEMP_BRANCH
   
-  # Detect project type and restore dependencies
-  if [ -f "package.json" ]; then
-    print_status "blue" "JavaScript/Node.js project detected."
-    npm ci || print_status "yellow" "npm ci failed, but continuing rollback."
-  fi
-  
-  if [ -f "go.mod" ]; then
-    print_status "blue" "Go project detected."
-    go mod download || print_status "yellow" "go mod download failed, but continuing rollback."
-  fi
+  write_record status=failed error="$error"
   
-  if [ -f "requirements.txt" ]; then
-    print_status "blue" "Python project detected."
-    pip install -r requirements.txt || print_status "yellow" "pip install failed, but continuing rollback."
-  elif [ -f "pyproject.toml" ]; then
-    print_status "blue" "Python project with pyproject.toml detected."
-    pip install -e . || print_status "yellow" "pip install failed, but continuing rollback."
-  fi
+  exit 1
+}
+
+# Revert newest first so later changes come off before the ones they build on
+REVERSED=()
+for ((i=${#COMMIT_LIST[@]}-1; i>=0; i--)); do
+  REVERSED+=("${COMMIT_LIST[$i]}")
+done
+
+if [ "$IMPL_ONLY" = true ]; then
+  # Apply each commit's implementation diff in reverse; meta-layer changes are never touched
+  for commit in "${REVERSED[@]}"; do
+    PARENT=$(git rev-parse --verify --quiet "$commit^" || git hash-object -t tree /dev/null)
+    if ! git diff --binary "$PARENT" "$commit" -- "$IMPL_DIR" | git apply -R --index --allow-empty; then
+      print_status "yellow" "Conflicts detected in ${commit:0:7}. Aborting and returning to $START_BRANCH."
+      abort_rollback "merge_conflicts"
+    fi
+  done
   
-  if [ -f "Cargo.toml" ]; then
-    print_status "blue" "Rust project detected."
-    cargo fetch || print_status "yellow" "cargo fetch failed, but continuing rollback."
+  if git diff --cached --quiet; then
+    print_status "yellow" "The selected commits do not change $IMPL_DIR. Nothing to roll back."
+    abort_rollback "no_implementation_changes"
   fi
+elif ! git revert --no-commit "${REVERSED[@]}"; then
+  print_status "red" "Failed to revert commits. Checking for conflicts..."
   
-  if [ -f "pom.xml" ]; then
-    print_status "blue" "Java (Maven) project detected."
-    mvn dependency:resolve || print_status "yellow" "mvn dependency:resolve failed, but continuing rollback."
-  elif [ -f "build.gradle" ]; then
-    print_status "blue" "Java (Gradle) project detected."
-    ./gradlew dependencies || print_status "yellow" "gradlew dependencies failed, but continuing rollback."
+  if git rev-parse --quiet --verify REVERT_HEAD >/dev/null; then
+    print_status "yellow" "Conflicts detected. Aborting revert and returning to $START_BRANCH."
+    git revert --abort || true
   fi
   
-  cd "$ROOT_DIR"
-else
-  print_status "yellow" "Implementation directory not found or empty. Skipping dependency restore."
+  abort_rollback "merge_conflicts"
 fi
 
-# Try to run basic tests
+print_status "green" "Commits reverted. Restoring dependencies..."
+
+# Restore dependencies and run tests (shared with checkpoint.js)
+source "$ROOT_DIR/scripts/impl-deps.sh"
+restore_impl_dependencies "$IMPL_DIR"
+
 print_status "blue" "Running tests..."
+# tests_passed is null when there is no test setup to run
 TEST_SUCCESS=false
+TEST_STATUS=0
+run_impl_tests "$IMPL_DIR" || TEST_STATUS=$?
+[ $TEST_STATUS -eq 0 ] && TEST_SUCCESS=true
+[ $TEST_STATUS -eq 2 ] && TEST_SUCCESS=null
 
-if [ -d "$IMPL_DIR" ]; then
-  cd "$IMPL_DIR"
-  
-  # Try each testing approach, but don't fail if tests don't exist
-  if [ -f "package.json" ]; then
-    npm test && TEST_SUCCESS=true || print_status "yellow" "JavaScript tests failed or not found."
-  elif [ -f "go.mod" ]; then
-    go test ./... && TEST_SUCCESS=true || print_status "yellow" "Go tests failed or not found."
-  elif [ -f "requirements.txt" ] || [ -f "pyproject.toml" ]; then
-    python -m pytest && TEST_SUCCESS=true || print_status "yellow" "Python tests failed or not found."
-  elif [ -f "Cargo.toml" ]; then
-    cargo test && TEST_SUCCESS=true || print_status "yellow" "Rust tests failed or not found."
-  elif [ -f "pom.xml" ]; then
-    mvn test && TEST_SUCCESS=true || print_status "yellow" "Maven tests failed or not found."
-  elif [ -f "build.gradle" ]; then
-    ./gradlew test && TEST_SUCCESS=true || print_status "yellow" "Gradle tests failed or not found."
-  fi
-  
-  cd "$ROOT_DIR"
-fi
+# Commit the rollback on its branch
+MESSAGE_BODY=""
+for commit in "${REVERSED[@]}"; do
+  MESSAGE_BODY+="This reverts commit $commit."$'\n'
+done
+[ "$IMPL_ONLY" = true ] && MESSAGE_BODY+=$'\n'"Scope: $IMPL_DIR only"
 
-# Complete the revert and push
-git commit -m "revert: $REASON (reverts $SHA)"
+if ! git commit -q -m "revert: $REASON (reverts $RANGE_DESC)" -m "$MESSAGE_BODY"; then
+  print_status "red" "Failed to commit the rollback. Returning to $START_BRANCH."
+  abort_rollback "commit_failed"
+fi
 
-print_status "yellow" "Finalizing rollback..."
+# Go back to where we started; the rollback waits on its branch for review
+git checkout -q "$START_BRANCH"
 
-# Handle the push based on the --no-push flag
-if [ "$NO_PUSH" = true ]; then
-  print_status "green" "Rollback prepared in branch $TEMP_BRANCH (no-push mode)"
+PUSHED=false
+if [ "$PUSH" = true ]; then
+  print_status "yellow" "Pushing $TEMP_BRANCH..."
   
-  # Update status but mark as prepared rather than completed
-  cat > .cache/rollbacks/$ID.json <<EOF
-{"id":"$ID","sha":"$SHA","time":"$(date -u +%Y-%m-%dT%H:%M:%SZ)","reason":"$REASON","status":"prepared","tests_passed":$TEST_SUCCESS,"branch":"$TEMP_BRANCH"}
-EOF
-  
-  print_status "blue" "To complete the rollback, run: git checkout $DEFAULT_BRANCH && git merge $TEMP_BRANCH && git push"
-  print_status "blue" "Or use GitHub UI to create a PR from branch: $TEMP_BRANCH"
-else
-  print_status "yellow" "Pushing changes..."
-  
-  if git push --force-with-lease origin $TEMP_BRANCH:$DEFAULT_BRANCH; then
-    print_status "green" "Rollback complete: $ID"
+  if git push -u origin $TEMP_BRANCH; then
+    PUSHED=true
+  else
+    print_status "red" "Failed to push rollback. Changes are still in branch $TEMP_BRANCH."
     
-    # Update status
-    cat > .cache/rollbacks/$ID.json <<EOF
-{"id":"$ID","sha":"$SHA","time":"$(date -u +%Y-%m-%dT%H:%M:%SZ)","reason":"$REASON","status":"completed","tests_passed":$TEST_SUCCESS}
-EOF
+    # The branch is still ready for review, so the rollback stays prepared
+    write_record status=prepared error=push_failed tests_passed:=$TEST_SUCCESS branch="$TEMP_BRANCH" pushed:=false
     
-    # Clean up
-    git checkout $DEFAULT_BRANCH
-    git pull origin $DEFAULT_BRANCH
-    git branch -D $TEMP_BRANCH
-  
-  # Update meta layer status
-  print_status "blue" "Updating project status..."
-  if [ -f "scripts/gen-status-quick.js" ]; then
-    node scripts/gen-status-quick.js || print_status "yellow" "Failed to update status."
-  fi
-  
-  # Run health check
-  print_status "blue" "Running health check..."
-  if [ -f "scripts/health-check.js" ]; then
-    node scripts/health-check.js || print_status "yellow" "Health check found issues. Please review."
+    exit 1
   fi
-else
-  print_status "red" "Failed to push rollback. Changes are still in branch $TEMP_BRANCH."
-  
-  # Update status
-  cat > .cache/rollbacks/$ID.json <<EOF
-{"id":"$ID","sha":"$SHA","time":"$(date -u +%Y-%m-%dT%H:%M:%SZ)","reason":"$REASON","status":"failed","error":"push_failed","branch":"$TEMP_BRANCH"}
-EOF
-  
-  exit 1
+fi
+
+# Mark as prepared; the rollback is complete once the branch is merged
+write_record status=prepared tests_passed:=$TEST_SUCCESS branch="$TEMP_BRANCH" pushed:=$PUSHED
+
+print_status "green" "Rollback prepared in branch $TEMP_BRANCH ($RANGE_DESC, tests passed: $TEST_SUCCESS)"
+print_status "blue" "Review it with: git diff $START_BRANCH...$TEMP_BRANCH"
+print_status "blue" "To complete the rollback, merge it: scripts/rollback.sh resume $ID (or drop it: scripts/rollback.sh abandon $ID)"
+if [ "$PUSHED" = true ]; then
+  print_status "blue" "Or open a PR from branch: $TEMP_BRANCH"
 fi
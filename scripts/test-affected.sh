@@ -1,6 +1,8 @@
 #!/usr/bin/env bash
 
 # Test Affected components with proper meta/implementation separation
+# Polyglot implementations (no project at the implementation root) are tested per service, each
+# from its own directory with its own toolchain; the results are aggregated.
 
 set -e
 
@@ -27,39 +29,34 @@ OUT="$CACHE/affected-components.txt"
 MAX=50
 ALL=false
 META=false
+FORCE=false
+RETRIES=""
+SHARD=""
+SERVICE=""
+SCHED_ARGS=()
+PASS_ARGS=()
 
 while [[ $# -gt 0 ]]; do
   case $1 in
     --since) SINCE="$2"; shift 2;;
-    --verbose) VERBOSE=true; shift;;
+    --verbose) VERBOSE=true; PASS_ARGS+=("$1"); shift;;
     --language) LANG="$2"; shift 2;;
-    --all) ALL=true; shift;;
+    --service) SERVICE="$2"; shift 2;;
+    --all) ALL=true; PASS_ARGS+=("$1"); shift;;
     --meta) META=true; shift;;
+    --force) FORCE=true; PASS_ARGS+=("$1"); shift;;
+    --retries) RETRIES="$2"; PASS_ARGS+=("$1" "$2"); shift 2;;
+    --workers|--timeout) SCHED_ARGS+=("$1" "$2"); PASS_ARGS+=("$1" "$2"); shift 2;;
+    --shard) SHARD="$2"; SCHED_ARGS+=("$1" "$2"); PASS_ARGS+=("$1" "$2"); shift 2;;
     *) print_status "red" "Unknown option: $1"; exit 1;;
   esac
 done
 
-# Get implementation directory from config
+# Get implementation directory from the config utilities
 function get_impl_dir() {
-  if [ -f "scripts/config-utils.js" ]; then
-    IMPL_DIR=$(node -e "try { const utils = require('./scripts/config-utils'); console.log(utils.getImplementationDir()); } catch (e) { console.error(e); process.exit(1); }")
-    if [ $? -ne 0 ]; then
-      print_status "yellow" "Failed to get implementation directory from config-utils.js"
-      # Fall back to direct JSON parsing
-      if [ -f ".agent-config.json" ]; then
-        # Try to extract implementation directory using grep and cut (more compatible)
-        IMPL_DIR=$(grep -o '"implementationDir": *"[^"]*"' .agent-config.json | cut -d'"' -f4)
-        
-        # If that fails, try with jq if available
-        if [ -z "$IMPL_DIR" ] && command -v jq >/dev/null 2>&1; then
-          IMPL_DIR=$(jq -r '.workspace.implementationDir' .agent-config.json)
-        fi
-        
-        # Clean up the path
-        IMPL_DIR=${IMPL_DIR//.\//}
-      fi
-    fi
-  elif [ -f ".agent-config.json" ]; then
+  IMPL_DIR=$(node -e "const path = require('path'); const utils = require('./utils'); console.log(path.relative(process.cwd(), utils.config.getImplementationDir()));" 2>/dev/null) || IMPL_DIR=""
+  
+  if [ -z "$IMPL_DIR" ] && [ -f ".agent-config.json" ]; then
     # Try to extract implementation directory using grep and cut (more compatible)
     IMPL_DIR=$(grep -o '"implementationDir": *"[^"]*"' .agent-config.json | cut -d'"' -f4)
     
@@ -109,84 +106,227 @@ if [ ! -d "$IMPL_DIR" ]; then
   exit 1
 fi
 
-cd "$IMPL_DIR"
+ROOT_DIR=$(pwd)
+TEST_LOG="$ROOT_DIR/$CACHE/last-test-run.log"
+REPORT="test-affected"
+SVC_ARGS=()
 
-# Auto-detect language if not provided
-if [ -z "$LANG" ]; then
+# A service run works in the service directory, with its own components file, log and report
+if [ -n "$SERVICE" ]; then
+  if [ ! -d "$IMPL_DIR/$SERVICE" ]; then
+    print_status "red" "Service directory not found: $IMPL_DIR/$SERVICE"
+    exit 1
+  fi
+  
+  OUT="$CACHE/affected-components-$SERVICE.txt"
+  TEST_LOG="$ROOT_DIR/$CACHE/last-test-run-$SERVICE.log"
+  REPORT="test-affected-$SERVICE"
+  SVC_ARGS=(--service "$SERVICE")
+  rm -f "$TEST_LOG"
+  cd "$IMPL_DIR/$SERVICE"
+else
+  cd "$IMPL_DIR"
+fi
+
+# Create cache directory
+mkdir -p "$ROOT_DIR/$CACHE"
+
+# Detect the language of the current directory from its project files
+function detect_language() {
   if [ -f "package.json" ]; then 
-    LANG="js";
+    echo "js"
   elif [ -f "go.mod" ]; then 
-    LANG="go";
+    echo "go"
   elif [ -f "requirements.txt" ] || [ -f "pyproject.toml" ]; then 
-    LANG="python";
+    echo "python"
   elif [ -f "Cargo.toml" ]; then
-    LANG="rust";
+    echo "rust"
   elif [ -f "pom.xml" ]; then
-    LANG="java-maven";
+    echo "java-maven"
   elif [ -f "build.gradle" ]; then
-    LANG="java-gradle";
-  else 
-    print_status "yellow" "Could not auto-detect language. Please specify with --language"
+    echo "java-gradle"
+  fi
+}
+
+# Test every service (scripts/test-scheduler.js services) with this script from its own directory,
+# then merge the service reports and record one result for the whole run
+function run_services() {
+  local name lang status overall=0 started
+  local languages=() logs=() reports=() summary=()
+  started=$(date -u +%Y-%m-%dT%H:%M:%SZ)
+  START=$(date +%s)
+  
+  while read -r name lang; do
+    [ -z "$name" ] && continue
+    print_status "blue" "=== Service $name ($lang) ==="
+    
+    set +e
+    (cd "$ROOT_DIR" && bash scripts/test-affected.sh --service "$name" --language "$lang" --since "$SINCE" "${PASS_ARGS[@]}" < /dev/null)
+    status=$?
+    set -e
+    
+    languages+=("$lang")
+    reports+=("test-affected-$name")
+    [ -f "$ROOT_DIR/$CACHE/last-test-run-$name.log" ] && logs+=("$ROOT_DIR/$CACHE/last-test-run-$name.log")
+    if [ "$status" -eq 0 ]; then
+      summary+=("green|$name ($lang): passed")
+    else
+      summary+=("red|$name ($lang): failed")
+      overall=1
+    fi
+  done < <(node "$ROOT_DIR/scripts/test-scheduler.js" services)
+  
+  if [ ${#summary[@]} -eq 0 ]; then
+    print_status "yellow" "No project at the implementation root and no services with a supported toolchain. Please specify with --language"
     exit 1
   fi
+  
+  node "$ROOT_DIR/scripts/test-report.js" merge test-affected "${reports[@]}" --after "$started" >/dev/null || print_status "yellow" "Could not merge the service test reports"
+  if [ ${#logs[@]} -gt 0 ]; then
+    cat "${logs[@]}" > "$TEST_LOG"
+  fi
+  node "$ROOT_DIR/scripts/metrics-exporter.js" record-test --exit-code "$overall" --language "$(IFS=,; echo "${languages[*]}")" \
+    --scope "$([ "$ALL" = true ] && echo all || echo affected)" --duration "$(( $(date +%s) - START ))" \
+    ${logs[0]:+--log "$TEST_LOG"} >/dev/null || print_status "yellow" "Could not record test result"
+  node "$ROOT_DIR/scripts/test-trends.js" record test-affected --duration "$(( $(date +%s) - START ))" >/dev/null || print_status "yellow" "Could not record the test history"
+  
+  print_status "blue" "=== Services ==="
+  local entry
+  for entry in "${summary[@]}"; do
+    print_status "${entry%%|*}" "${entry#*|}"
+  done
+  exit $overall
+}
+
+# Auto-detect language if not provided
+if [ -z "$LANG" ]; then
+  LANG=$(detect_language)
+fi
+
+if [ -z "$LANG" ] && [ -z "$SERVICE" ]; then
+  run_services
+elif [ -z "$LANG" ]; then
+  print_status "yellow" "Could not auto-detect language. Please specify with --language"
+  exit 1
 fi
 
-print_status "blue" "Detected language: $LANG"
+print_status "blue" "Detected language: $LANG${SERVICE:+ (service: $SERVICE)}"
 
-# Create cache directory
-mkdir -p "../$CACHE"
+# A shard only runs part of the selection, so its passes say nothing about the cache keys
+if [ -n "$SHARD" ]; then
+  FORCE=true
+fi
+
+# Drop components whose last passing run used the same sources, dependencies, lockfiles and
+# toolchain (scripts/test-cache.js); `.all` stands for the full suite. Leaves the rest in RUN and
+# saves the keys to KEYS_FILE, so passes are recorded for the files the tests saw.
+KEYS_FILE="$ROOT_DIR/.cache/test-keys${SERVICE:+-$SERVICE}.json"
+function filter_cached() {
+  RUN=()
+  rm -f "$KEYS_FILE"
+  if [ -n "$SHARD" ]; then
+    RUN=("$@")
+    return
+  fi
+  
+  local state comp
+  while read -r state comp; do
+    case "$state" in
+      cached)
+        if [ "$FORCE" = true ]; then
+          RUN+=("$comp")
+        else
+          print_status "green" "cached: $comp (unchanged since its last passing run, use --force to rerun)"
+        fi
+        ;;
+      run) RUN+=("$comp") ;;
+    esac
+  done < <(node "$ROOT_DIR/scripts/test-cache.js" check --language "$LANG" "${SVC_ARGS[@]}" --keys "$KEYS_FILE" "$@" 2>/dev/null || printf 'run %s\n' "$@")
+}
+
+# Remember passing components for filter_cached, with the keys computed before the run
+function record_passes() {
+  node "$ROOT_DIR/scripts/test-cache.js" record --language "$LANG" "${SVC_ARGS[@]}" --keys "$KEYS_FILE" "$@" >/dev/null || print_status "yellow" "Could not update the test result cache"
+}
+
+# Run tests for affected components or all tests through scripts/test-scheduler.js, which runs
+# components in parallel with per-component timeouts and applies --shard
+function run_tests() {
+  if [ "$ALL" = true ] || [ ${#CMP[@]} -eq 0 ]; then
+    print_status "blue" "Running all tests"
+    node "$ROOT_DIR/scripts/test-scheduler.js" run --language "$LANG" "${SVC_ARGS[@]}" --report "$REPORT" "${SCHED_ARGS[@]}"
+  elif [ -s "$ROOT_DIR/$OUT" ]; then
+    print_status "blue" "Running tests for affected components: ${CMP[*]}"
+    node "$ROOT_DIR/scripts/test-scheduler.js" run --language "$LANG" "${SVC_ARGS[@]}" --report "$REPORT" "${SCHED_ARGS[@]}" "${CMP[@]}"
+  else
+    print_status "green" "No testable components affected"
+  fi
+}
+
+# Run the selected tests, rerun failures in isolation (scripts/flaky-tests.js) and record the result
+function run_and_gate() {
+  if [ "$ALL" = true ] || [ ${#CMP[@]} -eq 0 ]; then
+    SCOPE="all"
+  elif [ -s "$ROOT_DIR/$OUT" ]; then
+    SCOPE="affected"
+  else
+    SCOPE="none"
+  fi
+  
+  START=$(date +%s)
+  set +e
+  run_tests 2>&1 | tee "$TEST_LOG"
+  STATUS=${PIPESTATUS[0]}
+  set -e
+  FIRST_STATUS=$STATUS
+  
+  # Failures that pass when rerun alone are flaky and get quarantined; quarantined tests are
+  # still run and reported, but do not fail the gate
+  if [ "$STATUS" -ne 0 ] && [ "$RETRIES" != "0" ]; then
+    print_status "yellow" "Rerunning failed tests in isolation..."
+    if node "$ROOT_DIR/scripts/flaky-tests.js" retry --language "$LANG" "${SVC_ARGS[@]}" --report "$REPORT" --log "$TEST_LOG" ${RETRIES:+--retries "$RETRIES"}; then
+      print_status "yellow" "Only flaky or quarantined tests failed (see: node scripts/flaky-tests.js list)"
+      STATUS=0
+    fi
+  fi
+  
+  # Record the result for the metrics exporter (scripts/metrics-exporter.js) and the test history
+  # (scripts/test-trends.js); service runs are recorded once for the whole run by run_services
+  if [ -z "$SERVICE" ]; then
+    node "$ROOT_DIR/scripts/metrics-exporter.js" record-test --exit-code "$STATUS" --language "$LANG" --scope "$SCOPE" \
+      --duration "$(( $(date +%s) - START ))" --log "$TEST_LOG" >/dev/null || print_status "yellow" "Could not record test result"
+    node "$ROOT_DIR/scripts/test-trends.js" record "$REPORT" --duration "$(( $(date +%s) - START ))" >/dev/null || print_status "yellow" "Could not record the test history"
+  fi
+  
+  # Only clean runs are cached, so quarantined failures keep being retried and reported
+  if [ -n "$SHARD" ]; then
+    :
+  elif [ "$FIRST_STATUS" -eq 0 ] && [ "$SCOPE" = "all" ]; then
+    record_passes .all
+  elif [ "$FIRST_STATUS" -eq 0 ] && [ "$SCOPE" = "affected" ]; then
+    record_passes "${CMP[@]}"
+  fi
+  
+  exit $STATUS
+}
 
 # If --all flag is set, run all tests
 if [ "$ALL" = true ]; then
-  print_status "blue" "Running all tests for $LANG"
-  
-  case $LANG in
-    js) 
-      npm test
-      ;;
-    go) 
-      go test ./...
-      ;;
-    python) 
-      if [ -f "pytest.ini" ] || [ -d "tests" ]; then
-        python -m pytest
-      else
-        print_status "yellow" "No pytest configuration found"
-      fi
-      ;;
-    rust)
-      cargo test
-      ;;
-    java-maven)
-      mvn test
-      ;;
-    java-gradle)
-      ./gradlew test
-      ;;
-  esac
+  filter_cached .all
+  if [ ${#RUN[@]} -eq 0 ]; then
+    exit 0
+  fi
   
-  exit $?
+  run_and_gate
 fi
 
 # Get affected files relative to implementation directory 
 # Improved to handle nested service directories by preserving path structure after the implementation dir
-FILES=$(git -C .. diff --name-only --diff-filter=ACMRTUXB "$SINCE"..HEAD | grep "^$IMPL_DIR/" | sed "s|^$IMPL_DIR/||")
-
-# Detect if we're in a service subdirectory
-CURRENT_DIR=$(pwd)
-RELATIVE_TO_IMPL=${CURRENT_DIR#*/$IMPL_DIR/}
+FILES=$(git -C "$ROOT_DIR" diff --name-only --diff-filter=ACMRTUXB "$SINCE"..HEAD | grep "^$IMPL_DIR/" | sed "s|^$IMPL_DIR/||")
 
-# If we're in a service subdirectory (not the implementation root)
-if [ "$RELATIVE_TO_IMPL" != "$CURRENT_DIR" ] && [ -n "$RELATIVE_TO_IMPL" ]; then
-  SERVICE_NAME=$(echo "$RELATIVE_TO_IMPL" | cut -d'/' -f1)
-  
-  # Filter files to only those in this service
-  if [ -n "$SERVICE_NAME" ]; then
-    print_status "blue" "Running in service: $SERVICE_NAME"
-    FILES=$(echo "$FILES" | grep "^$SERVICE_NAME/")
-    # Strip service name prefix to get path relative to current directory
-    FILES=$(echo "$FILES" | sed "s|^$SERVICE_NAME/||")
-  fi
+# In a service run, keep the service's files, relative to the service directory
+if [ -n "$SERVICE" ]; then
+  FILES=$(echo "$FILES" | grep "^$SERVICE/" | sed "s|^$SERVICE/||" || true)
 fi
 
 if [ -z "$FILES" ]; then
@@ -202,10 +342,36 @@ if [ "$VERBOSE" = true ]; then
   echo "$FILES"
 fi
 
+# Prefer the reverse-dependency graph (scripts/affected-graph.js), which also finds components
+# that import changed shared packages; path patterns are the fallback when no graph can be built
+GRAPH=false
+GRAPH_STATUS=0
+node "$ROOT_DIR/scripts/affected-graph.js" --since "$SINCE" --language "$LANG" "${SVC_ARGS[@]}" --out "$OUT" || GRAPH_STATUS=$?
+if [ $GRAPH_STATUS -eq 0 ]; then
+  GRAPH=true
+  CMP=()
+  while read -r comp; do
+    [ -n "$comp" ] && CMP+=("$comp")
+  done < <(grep -v '^#' "$ROOT_DIR/$OUT")
+  
+  if [ ${#CMP[@]} -eq 0 ]; then
+    print_status "green" "No test components depend on the changed files"
+    exit 0
+  fi
+elif [ $GRAPH_STATUS -eq 4 ]; then
+  GRAPH=true
+  ALL=true
+  print_status "yellow" "Changed files outside the dependency graph have no tests near them, running all tests"
+else
+  print_status "yellow" "Dependency graph unavailable, matching components by path"
+fi
+
 # Handle large changes
-if [ "$CNT" -gt "$MAX" ]; then
+if [ "$GRAPH" = true ]; then
+  :
+elif [ "$CNT" -gt "$MAX" ]; then
   print_status "yellow" "Too many files changed ($CNT > $MAX), running all tests"
-  echo "" > "../$OUT"
+  echo "" > "$ROOT_DIR/$OUT"
   ALL=true
 else
   # Load test patterns from config if available
@@ -279,7 +445,7 @@ else
         ;;
     esac
   }
-
+  
   # Identify affected components based on language
   CMP=()
   while read -r f; do
@@ -329,52 +495,35 @@ else
     fi
   done <<< "$FILES"
   
+  # Without the graph a Go component is a top-level directory rather than a package, so test every
+  # package below it (a file at the root selects the whole module)
+  if [ "$LANG" = "go" ]; then
+    GO_CMP=()
+    for comp in "${CMP[@]}"; do
+      if [ "$comp" != "." ] && [ -d "$comp" ]; then
+        GO_CMP+=("$comp/...")
+      else
+        GO_CMP+=("...")
+      fi
+    done
+    CMP=($(printf '%s\n' "${GO_CMP[@]}" | sort -u))
+  fi
+  
   # Write affected components to file
-  printf "%s\n" "${CMP[@]}" > "../$OUT"
+  printf "%s\n" "${CMP[@]}" > "$ROOT_DIR/$OUT"
 fi
 
-# Run tests for affected components or all tests
+# Skip what already passed with identical inputs
 if [ "$ALL" = true ] || [ ${#CMP[@]} -eq 0 ]; then
-  print_status "blue" "Running all tests"
-  case $LANG in
-    js) npm test ;;
-    go) go test ./... ;;
-    python) python -m pytest ;;
-    rust) cargo test ;;
-    java-maven) mvn test ;;
-    java-gradle) ./gradlew test ;;
-  esac
-elif [ -s "../$OUT" ]; then
-  print_status "blue" "Running tests for affected components: ${CMP[*]}"
-  
-  case $LANG in
-    js) 
-      if [ -f "package.json" ] && grep -q "\"jest\":" "package.json"; then
-        npx jest -- "${CMP[@]}"
-      else
-        npm test
-      fi
-      ;;
-    go) 
-      for comp in "${CMP[@]}"; do
-        go test "./$comp/..."
-      done
-      ;;
-    python) 
-      python -m pytest "${CMP[@]}"
-      ;;
-    rust)
-      for comp in "${CMP[@]}"; do
-        cargo test --package "$comp"
-      done
-      ;;
-    java-maven)
-      mvn test -pl "$(IFS=,; echo "${CMP[*]}")"
-      ;;
-    java-gradle)
-      ./gradlew "${CMP[@]}:test"
-      ;;
-  esac
+  filter_cached .all
 else
-  print_status "green" "No testable components affected"
+  filter_cached "${CMP[@]}"
+  CMP=("${RUN[@]}")
 fi
+
+if [ ${#RUN[@]} -eq 0 ]; then
+  print_status "green" "All affected tests are cached"
+  exit 0
+fi
+
+run_and_gate
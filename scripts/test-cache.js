@@ -0,0 +1,381 @@
+#!/usr/bin/env node
+
+/**
+ * DStudio Test Result Cache
+ * Remembers green test runs by a content hash of what the tests depend on
+ *
+ * Usage:
+ *   node scripts/test-cache.js check --language <lang> [--service <name>] [--keys file] <component...>    Print "cached <c>" or "run <c>" per component
+ *   node scripts/test-cache.js record --language <lang> [--service <name>] [--keys file] <component...>   Record passes for the components
+ *   node scripts/test-cache.js key --language <lang> [--service <name>] <component>         Print a component's cache key
+ *   node scripts/test-cache.js list [--json]                             List cached passes
+ *   node scripts/test-cache.js clear [--language <lang>]                 Forget cached passes
+ *
+ * A component's key hashes its own sources, the sources of everything it transitively depends on
+ * (from scripts/affected-graph.js), the files outside the graph next to its tests, the language's
+ * lockfiles and manifests, and the toolchain version. Languages without a dependency graph (Java) and components the graph does not know
+ * hash the whole implementation directory. The component `.all` stands for the full suite.
+ * With --service, components are those of the service directory and are cached per service.
+ * check --keys saves the keys it computed, and record --keys records passes with those keys, so files
+ * edited while the tests run are not recorded as passing. Used by test-affected.sh; its --force
+ * flag skips the cache.
+ */
+
+const fs = require('fs');
+const path = require('path');
+const crypto = require('crypto');
+const { spawnSync } = require('child_process');
+const utils = require('../utils');
+const affectedGraph = require('./affected-graph');
+const logger = utils.logger.createScopedLogger('TestCache');
+
+// Lockfiles and manifests at the implementation root, in addition to affected-graph's global files
+const LOCKFILES = {
+  ...affectedGraph.GLOBAL_FILES,
+  python: [...affectedGraph.GLOBAL_FILES.python, /^(poetry\.lock|Pipfile(\.lock)?|conftest\.py)$/],
+  'java-maven': [/^pom\.xml$/],
+  'java-gradle': [/^(build|settings)\.gradle(\.kts)?$/, /^gradle\.(properties|lockfile)$/]
+};
+
+// Commands whose first line identifies the toolchain
+const TOOLCHAINS = {
+  js: [['node', '--version'], ['npm', '--version']],
+  go: [['go', 'version']],
+  python: [['python', '--version']],
+  rust: [['rustc', '--version'], ['cargo', '--version']],
+  'java-maven': [['java', '-version'], ['mvn', '-v']],
+  'java-gradle': [['java', '-version']]
+};
+
+/**
+ * Get the result cache file
+ * @returns {string} Absolute path
+ */
+function getCacheFile() {
+  return utils.path.resolveProjectPath(utils.config.get('development.testing.resultCacheFile', '.cache/test-results.json'));
+}
+
+/**
+ * Load the cached results
+ * @returns {Object} Results by "<language>:<component>"
+ */
+function loadResults() {
+  return utils.error.trySync(() => JSON.parse(fs.readFileSync(getCacheFile(), 'utf8')).results || {}, {}).value;
+}
+
+/**
+ * Save the cached results
+ * @param {Object} results - Results by "<language>:<component>"
+ */
+function saveResults(results) {
+  const file = getCacheFile();
+  utils.path.ensureDir(path.dirname(file));
+  fs.writeFileSync(`${file}.tmp`, JSON.stringify({ version: 1, results }, null, 2));
+  fs.renameSync(`${file}.tmp`, file);
+}
+
+/**
+ * Describe the installed toolchain for a language
+ * @param {string} language - Language as used by test-affected.sh
+ * @returns {string} Version lines, or "unknown" entries for missing tools
+ */
+function getToolchainVersion(language) {
+  return (TOOLCHAINS[language] || []).map(([command, ...args]) => {
+    const result = spawnSync(command, args, { encoding: 'utf8' });
+    const output = `${result.stdout || ''}${result.stderr || ''}`.trim().split('\n')[0];
+    return result.error ? `${command}: unknown` : output;
+  }).join('; ');
+}
+
+/**
+ * Hashes inputs of cache keys, reusing the graph, file hashes and toolchain within one run
+ */
+class KeyContext {
+  /**
+   * Create a context for one language
+   * @param {string} language - Language as used by test-affected.sh
+   * @param {string} implDir - Implementation directory
+   */
+  constructor(language, implDir = utils.config.getImplementationDir()) {
+    this.language = language;
+    this.implDir = implDir;
+    this.fileHashes = new Map();
+    this.graph = affectedGraph.buildGraph(language, implDir).value;
+    this.toolchain = getToolchainVersion(language);
+    
+    const rootFiles = utils.error.trySync(() => fs.readdirSync(implDir), []).value;
+    this.lockfiles = rootFiles.filter(file => (LOCKFILES[language] || []).some(pattern => pattern.test(file)));
+  }
+  
+  /**
+   * Hash a file relative to the implementation directory
+   * @param {string} rel - Relative path
+   * @returns {string} SHA-256, or "missing"
+   */
+  hashFile(rel) {
+    if (!this.fileHashes.has(rel)) {
+      this.fileHashes.set(rel, utils.file.calculateChecksumSync(path.join(this.implDir, rel)).value || 'missing');
+    }
+    return this.fileHashes.get(rel);
+  }
+  
+  /**
+   * List the files of a graph node
+   * Directory-based nodes (Go packages, Rust crates) own every file below their directory
+   * that does not belong to a nested node, as graph.locate() assigns changed files.
+   * @param {Object} node - Graph node
+   * @returns {Array<string>} Relative paths
+   */
+  nodeFiles(node) {
+    if (node.dir === undefined) return node.files;
+    
+    const nested = [...this.graph.nodes.values()]
+      .filter(other => other !== node && other.dir && other.dir !== node.dir && (node.dir === '' || other.dir.startsWith(`${node.dir}/`)))
+      .map(other => `${other.dir}/`);
+    const prefix = node.dir ? `${node.dir}/` : '';
+    
+    return affectedGraph.listFiles(path.join(this.implDir, node.dir), () => true)
+      .map(rel => `${prefix}${rel}`)
+      .filter(rel => !nested.some(dir => rel.startsWith(dir)));
+  }
+  
+  /**
+   * List the files outside the graph (fixtures, snapshots, data files) that select a component by
+   * directory, as affected-graph's findAffected() does; files with no tests near them count for every component
+   * @param {string} component - Component name
+   * @returns {Array<string>} Relative paths
+   */
+  nearbyFiles(component) {
+    if (!this.nearby) {
+      const importers = this.graph.reverse();
+      const globals = affectedGraph.GLOBAL_FILES[this.language] || [];
+      const outside = affectedGraph.listFiles(this.implDir, rel => !globals.some(pattern => pattern.test(rel)) && affectedGraph.locateChanged(this.graph, rel, importers).length === 0);
+      
+      this.nearby = { everywhere: [], byComponent: new Map() };
+      for (const rel of outside) {
+        const tests = affectedGraph.testsNear(this.graph, rel);
+        if (!tests) this.nearby.everywhere.push(rel);
+        for (const node of tests ? tests.nodes : []) {
+          this.nearby.byComponent.set(node.component, [...(this.nearby.byComponent.get(node.component) || []), rel]);
+        }
+      }
+    }
+    
+    return [...this.nearby.everywhere, ...(this.nearby.byComponent.get(component) || [])];
+  }
+  
+  /**
+   * Collect the files a component's tests depend on
+   * @param {string} component - Component name as printed by test-affected.sh
+   * @returns {Object} { files, scope } where scope is "graph" or "implementation"
+   */
+  componentFiles(component) {
+    const nodes = this.graph && component !== '.all' ? [...this.graph.nodes.values()].filter(node => node.component === component) : [];
+    
+    if (nodes.length === 0) {
+      return { files: affectedGraph.listFiles(this.implDir, () => true), scope: 'implementation' };
+    }
+    
+    const files = new Set();
+    for (const node of nodes) {
+      for (const id of this.graph.dependencies(node.id)) {
+        this.nodeFiles(this.graph.nodes.get(id)).forEach(file => files.add(file));
+      }
+    }
+    this.nearbyFiles(component).forEach(file => files.add(file));
+    
+    return { files: [...files].sort(), scope: 'graph' };
+  }
+  
+  /**
+   * Compute a component's cache key
+   * @param {string} component - Component name
+   * @returns {Object} { key, files, scope }
+   */
+  key(component) {
+    const { files, scope } = this.componentFiles(component);
+    const inputs = [...new Set([...files, ...this.lockfiles])].sort();
+    const hash = crypto.createHash('sha256');
+    
+    hash.update(`${this.language}\n${component}\n${this.toolchain}\n`);
+    for (const file of inputs) {
+      hash.update(`${file}\0${this.hashFile(file)}\n`);
+    }
+    
+    return { key: hash.digest('hex'), files: inputs.length, scope };
+  }
+}
+
+/**
+ * Get the result cache entry name of a component
+ * @param {string} language - Language as used by test-affected.sh
+ * @param {string} component - Component name
+ * @param {string} service - Service name, or null for the implementation root
+ * @returns {string} "<language>:[<service>/]<component>"
+ */
+function resultKey(language, component, service = null) {
+  return `${language}:${service ? `${service}/` : ''}${component}`;
+}
+
+/**
+ * Split components into cached passes and components that need to run
+ * @param {string} language - Language as used by test-affected.sh
+ * @param {Array<string>} components - Components to test
+ * @param {string} service - Service name, or null for the implementation root
+ * @returns {Object} { cached: [{ component, passedAt }], run: [component], keys } with keys as from computeKeys()
+ */
+function checkComponents(language, components, service = null) {
+  const context = new KeyContext(language, utils.project.getServiceDir(service));
+  const results = loadResults();
+  const keys = new Map();
+  const cached = [];
+  const run = [];
+  
+  for (const component of components) {
+    const entry = results[resultKey(language, component, service)];
+    keys.set(component, { ...context.key(component), toolchain: context.toolchain });
+    if (entry && entry.key === keys.get(component).key) {
+      cached.push({ component, passedAt: entry.passedAt });
+    } else {
+      run.push(component);
+    }
+  }
+  
+  return { cached, run, keys };
+}
+
+/**
+ * Compute the current keys of components
+ * @param {string} language - Language as used by test-affected.sh
+ * @param {Array<string>} components - Component names
+ * @param {string} service - Service name, or null for the implementation root
+ * @returns {Map<string, Object>} { key, files, scope, toolchain } by component
+ */
+function computeKeys(language, components, service = null) {
+  const context = new KeyContext(language, utils.project.getServiceDir(service));
+  return new Map(components.map(component => [component, { ...context.key(component), toolchain: context.toolchain }]));
+}
+
+/**
+ * Record passing components with their keys
+ * Callers that run tests while files may change pass the keys computed before the run, so a pass
+ * is never recorded for files the tests did not see.
+ * @param {string} language - Language as used by test-affected.sh
+ * @param {Array<string>} components - Components whose tests passed
+ * @param {string} service - Service name, or null for the implementation root
+ * @param {Map<string, Object>} keys - Keys from computeKeys(); the current keys by default
+ * @returns {Array<Object>} Recorded entries
+ */
+function recordPasses(language, components, service = null, keys = computeKeys(language, components, service)) {
+  const results = loadResults();
+  const passedAt = new Date().toISOString();
+  
+  const entries = components.map(component => {
+    const { key, files, scope, toolchain } = keys.get(component);
+    const entry = { language, component, key, files, scope, toolchain, passedAt };
+    if (service) entry.service = service;
+    results[resultKey(language, component, service)] = entry;
+    return entry;
+  });
+  
+  saveResults(results);
+  return entries;
+}
+
+/**
+ * Get the value following a command line flag
+ * @param {string} flag - Flag name
+ * @returns {string|undefined} Flag value
+ */
+function getArg(flag) {
+  const index = process.argv.indexOf(flag);
+  return index !== -1 ? process.argv[index + 1] : undefined;
+}
+
+/**
+ * Get the positional arguments after the command
+ * @returns {Array<string>} Arguments that are neither flags nor flag values
+ */
+function getPositionals() {
+  return process.argv.slice(3).filter((arg, i, args) => !arg.startsWith('--') && !['--language', '--service', '--keys'].includes(args[i - 1]));
+}
+
+/**
+ * Main function
+ */
+function main() {
+  const command = process.argv[2];
+  const service = getArg('--service') || null;
+  const language = getArg('--language') || require('./bisect-tests').detectLanguage(utils.project.getServiceDir(service));
+  
+  switch (command) {
+    case 'check': {
+      const { cached, run, keys } = checkComponents(language, getPositionals(), service);
+      if (getArg('--keys')) {
+        utils.path.ensureDir(path.dirname(path.resolve(getArg('--keys'))));
+        fs.writeFileSync(getArg('--keys'), JSON.stringify(Object.fromEntries(keys), null, 2));
+      }
+      for (const entry of cached) console.log(`cached ${entry.component}`);
+      for (const component of run) console.log(`run ${component}`);
+      break;
+    }
+    
+    case 'record': {
+      const keys = getArg('--keys') ? new Map(Object.entries(JSON.parse(fs.readFileSync(getArg('--keys'), 'utf8')))) : undefined;
+      const entries = recordPasses(language, getPositionals(), service, keys);
+      logger.info(`Recorded ${entries.length} passing component(s) for ${language}`);
+      break;
+    }
+    
+    case 'key': {
+      const component = getPositionals()[0];
+      if (!component) throw utils.error.ValidationError('key requires a component');
+      const result = new KeyContext(language, utils.project.getServiceDir(service)).key(component);
+      console.log(`${result.key} (${result.files} files, ${result.scope})`);
+      break;
+    }
+    
+    case 'list': {
+      const results = Object.values(loadResults());
+      if (process.argv.includes('--json')) {
+        console.log(JSON.stringify(results, null, 2));
+      } else if (results.length === 0) {
+        logger.info('No cached test results');
+      } else {
+        for (const entry of results.sort((a, b) => b.passedAt.localeCompare(a.passedAt))) {
+          const component = entry.service ? `${entry.service}/${entry.component}` : entry.component;
+          logger.info(`${entry.language.padEnd(12)} ${component.padEnd(40)} passed ${entry.passedAt} (${entry.files} files, ${entry.scope})`);
+        }
+      }
+      break;
+    }
+    
+    case 'clear': {
+      const only = getArg('--language');
+      const results = loadResults();
+      const kept = Object.fromEntries(Object.entries(results).filter(([, entry]) => only && entry.language !== only));
+      saveResults(kept);
+      logger.info(`Cleared ${Object.keys(results).length - Object.keys(kept).length} cached result(s)`);
+      break;
+    }
+    
+    default:
+      throw utils.error.ValidationError(`Unknown command: ${command || '(none)'} (expected check, record, key, list or clear)`);
+  }
+}
+
+if (require.main === module) {
+  try {
+    main();
+  } catch (err) {
+    utils.error.createErrorHandler('test-cache')(err);
+  }
+}
+
+module.exports = {
+  KeyContext,
+  checkComponents,
+  computeKeys,
+  recordPasses,
+  loadResults
+};
@@ -0,0 +1,203 @@
+#!/usr/bin/env node
+
+/**
+ * DStudio Test Reports
+ * Shows the normalized test reports written by the test runners
+ *
+ * Usage:
+ *   node scripts/test-report.js show [source] [--failed] [--json]
+ *   node scripts/test-report.js summary [source] [--markdown]
+ *   node scripts/test-report.js check [source]
+ *   node scripts/test-report.js merge <source> <input...> [--after <iso-date>]
+ *
+ * The source is the producer of the report (test-affected, test-summary) and defaults to the
+ * latest report. Reports live in .cache/test-reports/ (development.testing.reports.dir) as
+ * <source>.json and as JUnit XML in <source>.xml, for CI test annotations.
+ * `check` exits 1 when the report has failed tests that are not quarantined. `merge` combines
+ * reports, e.g. the per-service reports of a polyglot test-affected run, into one; --after skips
+ * reports generated before the given time, such as those of services that did not run.
+ */
+
+const path = require('path');
+const utils = require('../utils');
+const logger = utils.logger.createScopedLogger('TestReport');
+
+const STATUS_ICONS = { passed: '✓', failed: '✗', error: '✗', skipped: '-' };
+
+/**
+ * Load a report or fail with a hint on how to create one
+ * @param {string} source - Report source, or "latest"
+ * @returns {Object} Report
+ */
+function requireReport(source) {
+  const report = utils.testReport.loadReport(source);
+  if (!report.success) {
+    const file = path.relative(process.cwd(), path.join(utils.testReport.getReportDir(), `${source}.json`));
+    throw utils.error.ValidationError(`No test report at ${file}; run npm run test:affected first`);
+  }
+  return report.value;
+}
+
+/**
+ * Describe a report's totals in one line
+ * @param {Object} totals - Report totals
+ * @returns {string} Description
+ */
+function describeTotals(totals) {
+  const quarantined = totals.quarantined ? `, ${totals.quarantined} quarantined` : '';
+  return `${totals.tests} test(s): ${totals.passed} passed, ${totals.failed} failed, ${totals.errors} error(s), ${totals.skipped} skipped${quarantined} in ${totals.durationSeconds}s`;
+}
+
+/**
+ * Get the failed tests of a report
+ * @param {Object} report - Report
+ * @returns {Array<Object>} { suite, test } pairs
+ */
+function failedTests(report) {
+  return report.suites.flatMap(suite => suite.tests
+    .filter(test => test.status === 'failed' || test.status === 'error')
+    .map(test => ({ suite, test })));
+}
+
+/**
+ * Render a report as Markdown
+ * @param {Object} report - Report
+ * @returns {string} Markdown
+ */
+function toMarkdown(report) {
+  const { totals } = report;
+  const lines = [
+    `## Tests ${totals.success ? 'passed' : 'failed'} (${report.source}${report.language ? `, ${report.language}` : ''})`,
+    '',
+    '| Tests | Passed | Failed | Errors | Skipped | Quarantined | Duration |',
+    '|---|---|---|---|---|---|---|',
+    `| ${totals.tests} | ${totals.passed} | ${totals.failed} | ${totals.errors} | ${totals.skipped} | ${totals.quarantined} | ${totals.durationSeconds}s |`
+  ];
+  
+  const failed = failedTests(report);
+  if (failed.length > 0) {
+    lines.push('', '### Failed tests', '');
+    for (const { suite, test } of failed) {
+      const location = test.file ? ` (${test.file}${test.line ? `:${test.line}` : ''})` : '';
+      const tags = [test.flaky && 'flaky', test.quarantined && 'quarantined'].filter(Boolean);
+      const message = (test.message || '').split('\n')[0].replace(/\|/g, '\\|');
+      lines.push(`- \`${suite.name}\` **${test.name}**${location}${tags.length ? ` [${tags.join(', ')}]` : ''}${message ? `: ${message}` : ''}`);
+    }
+  }
+  
+  lines.push('', `Generated ${report.generated}${report.commit ? ` at ${report.commit.slice(0, 8)}` : ''}.`);
+  return `${lines.join('\n')}\n`;
+}
+
+/**
+ * Get the value following a command line flag
+ * @param {string} flag - Flag name
+ * @returns {string|undefined} Flag value
+ */
+function getArg(flag) {
+  const index = process.argv.indexOf(flag);
+  return index !== -1 ? process.argv[index + 1] : undefined;
+}
+
+/**
+ * Main function
+ */
+function main() {
+  const args = process.argv.slice(2);
+  const [command, source = 'latest', ...inputs] = args.filter((arg, index) => !arg.startsWith('--') && args[index - 1] !== '--after');
+  
+  switch (command) {
+    case 'show': {
+      const report = requireReport(source);
+      const onlyFailed = process.argv.includes('--failed');
+      
+      if (process.argv.includes('--json')) {
+        const suites = onlyFailed
+          ? report.suites.map(suite => ({ ...suite, tests: suite.tests.filter(test => test.status === 'failed' || test.status === 'error') })).filter(suite => suite.tests.length > 0)
+          : report.suites;
+        console.log(JSON.stringify({ ...report, suites }, null, 2));
+        break;
+      }
+      
+      logger.info(`${report.source} report from ${report.generated}${report.commit ? ` (${report.commit.slice(0, 8)})` : ''}`);
+      for (const suite of report.suites) {
+        const tests = onlyFailed ? suite.tests.filter(test => test.status === 'failed' || test.status === 'error') : suite.tests;
+        if (tests.length === 0) continue;
+        
+        logger.info(`${suite.name}${suite.service ? ` [${suite.service}]` : ''}`);
+        for (const test of tests) {
+          const tags = [test.flaky && 'flaky', test.quarantined && 'quarantined'].filter(Boolean);
+          const location = test.file ? ` ${test.file}${test.line ? `:${test.line}` : ''}` : '';
+          logger.info(`  ${STATUS_ICONS[test.status]} ${test.name}${location}${tags.length ? ` [${tags.join(', ')}]` : ''}`);
+        }
+      }
+      logger[report.totals.success ? 'info' : 'error'](describeTotals(report.totals));
+      break;
+    }
+    
+    case 'summary': {
+      const report = requireReport(source);
+      if (process.argv.includes('--markdown')) {
+        process.stdout.write(toMarkdown(report));
+      } else {
+        logger[report.totals.success ? 'info' : 'error'](`${report.source}: ${describeTotals(report.totals)}`);
+      }
+      break;
+    }
+    
+    case 'check': {
+      const report = requireReport(source);
+      if (report.totals.success) {
+        logger.info(`${report.source}: ${describeTotals(report.totals)}`);
+      } else {
+        logger.error(`${report.source}: ${describeTotals(report.totals)}`);
+        for (const { suite, test } of failedTests(report).filter(({ test }) => !test.quarantined)) {
+          logger.error(`  ${suite.name} ${test.name}: ${(test.message || '').split('\n')[0]}`);
+        }
+        process.exitCode = 1;
+      }
+      break;
+    }
+    
+    case 'merge': {
+      if (source === 'latest' || inputs.length === 0) throw utils.error.ValidationError('merge requires a source name and the reports to merge');
+      
+      const after = getArg('--after') ? Date.parse(getArg('--after')) : null;
+      const reports = inputs.map(input => utils.testReport.loadReport(input))
+        .filter(report => report.success && (!after || Date.parse(report.value.generated) >= after))
+        .map(report => report.value);
+      if (reports.length === 0) {
+        logger.warn(`None of the reports to merge exist${after ? ' or are recent enough' : ''}: ${inputs.join(', ')}`);
+        break;
+      }
+      
+      const languages = [...new Set(reports.map(report => report.language))];
+      const report = utils.testReport.createReport({
+        source,
+        language: languages.length === 1 ? languages[0] : null,
+        commit: reports[0].commit || null,
+        merged: reports.map(part => part.source),
+        suites: reports.flatMap(part => part.suites)
+      });
+      const written = utils.testReport.writeReport(report);
+      if (!written.success) throw written.error;
+      logger.info(`Merged ${reports.length} report(s) into ${source}: ${describeTotals(report.totals)}`);
+      break;
+    }
+    
+    default:
+      throw utils.error.ValidationError(`Unknown command: ${command || '(none)'} (expected show, summary, check or merge)`);
+  }
+}
+
+if (require.main === module) {
+  try {
+    main();
+  } catch (err) {
+    utils.error.createErrorHandler('test-report')(err);
+  }
+}
+
+module.exports = {
+  toMarkdown
+};
@@ -0,0 +1,561 @@
+#!/usr/bin/env node
+
+/**
+ * DStudio Test Scheduler
+ * Runs component test suites in parallel, with per-component timeouts and CI sharding
+ *
+ * Usage:
+ *   node scripts/test-scheduler.js run [--language <lang>] [--service <name>] [--workers <n>] [--timeout <sec>] [--shard <i>/<n>] [--report <name>] [--json] [component...]
+ *   node scripts/test-scheduler.js plan [--language <lang>] [--service <name>] [--shard <i>/<n>] [component...]
+ *   node scripts/test-scheduler.js services
+ *
+ * Components use the names test-affected.sh prints. Without components the full suite runs as
+ * one unit; with --shard the full suite is split into test components from scripts/affected-graph.js
+ * (Go packages, JS and Python test files, Rust crates) so every CI job gets a stable share.
+ * Units are sorted by name and dealt round-robin, so the same inputs always give the same shards.
+ *
+ * Output is streamed as "[component] line" and kept per component in .cache/test-runs/, together
+ * with last-run.json. Each unit also writes machine-readable results (go test -json, Jest --json,
+ * pytest --junitxml, libtest output, Surefire/Gradle XML), which are merged into one normalized
+ * report in .cache/test-reports/<--report name, default test-affected>.json and .xml.
+ * Exits 1 if any unit failed or timed out.
+ *
+ * With --service the units run from that service's directory, and its suites are tagged with the
+ * service. `services` lists the services of a polyglot implementation with their test language.
+ */
+
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const { spawn, execFileSync } = require('child_process');
+const utils = require('../utils');
+const affectedGraph = require('./affected-graph');
+const { detectLanguage } = require('./bisect-tests');
+const logger = utils.logger.createScopedLogger('TestScheduler');
+
+// Process groups of the units that are running, stopped together on SIGINT/SIGTERM
+const runningGroups = new Set();
+
+/**
+ * Get the scheduler settings
+ * @returns {Object} { workers, timeoutSeconds, logDir }
+ */
+function getSettings() {
+  const settings = utils.config.get('development.testing.scheduler', {});
+  return {
+    workers: settings.workers || os.cpus().length,
+    timeoutSeconds: settings.timeoutSeconds || 900,
+    logDir: utils.path.resolveProjectPath(settings.logDir || '.cache/test-runs')
+  };
+}
+
+/**
+ * Check whether a JS implementation runs its tests with Jest
+ * @param {string} implDir - Implementation directory
+ * @returns {boolean} True if package.json mentions jest
+ */
+function usesJest(implDir) {
+  return utils.error.trySync(() => fs.readFileSync(path.join(implDir, 'package.json'), 'utf8').includes('"jest":'), false).value;
+}
+
+/**
+ * Get the command for the full test suite
+ * @param {string} language - Language as used by test-affected.sh
+ * @returns {Array} [command, args]
+ */
+function suiteCommand(language) {
+  const commands = {
+    js: ['npm', ['test']],
+    go: ['go', ['test', './...']],
+    python: ['python', ['-m', 'pytest']],
+    rust: ['cargo', ['test']],
+    'java-maven': ['mvn', ['test']],
+    'java-gradle': ['./gradlew', ['test']]
+  };
+  return commands[language];
+}
+
+/**
+ * Get the command testing one affected component
+ * Go components from the dependency graph are single packages, so a package nested under another
+ * selected one runs once; the path fallback of test-affected.sh passes patterns such as "pkg/...".
+ * @param {string} language - Language as used by test-affected.sh
+ * @param {string} component - Component name
+ * @returns {Array} [command, args]
+ */
+function componentCommand(language, component) {
+  switch (language) {
+    case 'js': return ['npx', ['jest', component]];
+    case 'go': return ['go', ['test', component === '.' ? '.' : `./${component}`]];
+    case 'python': return ['python', ['-m', 'pytest', component]];
+    case 'rust': return ['cargo', ['test', '--package', component]];
+    case 'java-maven': return ['mvn', ['test', '-pl', component]];
+    case 'java-gradle': return ['./gradlew', [`${component}:test`]];
+    default: return null;
+  }
+}
+
+/**
+ * Split the full suite into test components from the dependency graph
+ * @param {string} language - Language as used by test-affected.sh
+ * @param {string} implDir - Implementation directory
+ * @returns {Array<Object>|null} Units, or null if the suite cannot be split
+ */
+function suiteUnits(language, implDir) {
+  if (language === 'js' && !usesJest(implDir)) return null;
+  
+  const graph = affectedGraph.buildGraph(language, implDir);
+  if (!graph.success) return null;
+  
+  const units = new Map();
+  for (const node of graph.value.nodes.values()) {
+    if (!node.component || units.has(node.component)) continue;
+    
+    const [command, args] = componentCommand(language, node.component);
+    units.set(node.component, { name: node.component, command, args });
+  }
+  return [...units.values()];
+}
+
+/**
+ * Plan the units to run
+ * @param {Object} options - Plan options
+ * @param {string} options.language - Language as used by test-affected.sh
+ * @param {Array<string>} options.components - Affected components (full suite if empty)
+ * @param {Object} options.shard - { index, total } (1-based index), or null
+ * @param {string} options.implDir - Implementation directory
+ * @returns {Array<Object>} Units: { name, command, args }
+ */
+function planUnits({ language, components = [], shard = null, implDir = utils.config.getImplementationDir() }) {
+  if (!suiteCommand(language)) throw utils.error.ValidationError(`Unsupported language: ${language}`);
+  
+  const [command, args] = suiteCommand(language);
+  const fullSuite = [{ name: language, command, args }];
+  let units;
+  
+  if (components.length === 0) {
+    units = shard ? suiteUnits(language, implDir) || fullSuite : fullSuite;
+  } else if (language === 'js' && !usesJest(implDir)) {
+    // Without Jest there is no way to select tests, as before
+    units = fullSuite;
+  } else {
+    units = [...new Set(components)].map(component => {
+      const [unitCommand, unitArgs] = componentCommand(language, component);
+      return { name: component, command: unitCommand, args: unitArgs };
+    });
+  }
+  
+  units.sort((a, b) => a.name.localeCompare(b.name));
+  return shard ? units.filter((unit, i) => i % shard.total === shard.index - 1) : units;
+}
+
+/**
+ * Parse a --shard value
+ * @param {string} value - "<index>/<total>", 1-based
+ * @returns {Object|null} { index, total }
+ */
+function parseShard(value) {
+  if (!value) return null;
+  
+  const match = /^(\d+)\/(\d+)$/.exec(value);
+  const shard = match && { index: parseInt(match[1], 10), total: parseInt(match[2], 10) };
+  if (!shard || shard.total < 1 || shard.index < 1 || shard.index > shard.total) {
+    throw utils.error.ValidationError(`Invalid shard: ${value} (expected <index>/<total>, e.g. 2/4)`);
+  }
+  return shard;
+}
+
+/**
+ * Turn a unit name into a file name
+ * @param {string} name - Unit name
+ * @returns {string} Safe file name
+ */
+function safeName(name) {
+  return name.replace(/[^\w.-]+/g, '_');
+}
+
+/**
+ * Make a unit write machine-readable results for the test report
+ * @param {Object} unit - Unit from planUnits()
+ * @param {string} language - Language as used by test-affected.sh
+ * @param {string} logDir - Directory for result files
+ * @returns {Object} Unit with its result format (and result file) set
+ */
+function withResultOutput(unit, language, logDir) {
+  const resultFile = path.join(logDir, `${safeName(unit.name)}.results`);
+  
+  switch (language) {
+    case 'go':
+      return { ...unit, args: [unit.args[0], '-json', ...unit.args.slice(1)], format: 'go-json' };
+    case 'js':
+      // Plain `npm test` has no machine-readable output; the unit is reported as a whole
+      return unit.command === 'npx'
+        ? { ...unit, args: [...unit.args, '--json', '--testLocationInResults', `--outputFile=${resultFile}.json`], format: 'jest', resultFile: `${resultFile}.json` }
+        : { ...unit, format: null };
+    case 'python':
+      return { ...unit, args: [...unit.args, `--junitxml=${resultFile}.xml`], format: 'junit', resultFile: `${resultFile}.xml` };
+    case 'rust':
+      return { ...unit, format: 'cargo' };
+    case 'java-maven':
+      return { ...unit, format: 'surefire' };
+    case 'java-gradle':
+      return { ...unit, format: 'gradle' };
+    default:
+      return { ...unit, format: null };
+  }
+}
+
+/**
+ * Pipe a stream to stdout line by line with a prefix
+ * @param {Stream} stream - Child output stream
+ * @param {string} prefix - Line prefix
+ * @param {WriteStream} log - Per-unit log file
+ * @param {Function} transform - Maps a raw line to the text to show, or null to drop it
+ * @param {Array<string>} output - Collects the shown lines
+ */
+function streamWithPrefix(stream, prefix, log, transform, output) {
+  let pending = '';
+  const emit = line => {
+    const text = transform(line);
+    if (text === null) return;
+    
+    log.write(`${text}\n`);
+    output.push(text);
+    for (const shown of text.split('\n')) process.stdout.write(`${prefix}${shown}\n`);
+  };
+  
+  stream.setEncoding('utf8');
+  stream.on('data', chunk => {
+    const lines = (pending + chunk).split('\n');
+    pending = lines.pop();
+    lines.forEach(emit);
+  });
+  stream.on('end', () => {
+    if (pending) emit(pending);
+  });
+}
+
+/**
+ * Read the module path from go.mod
+ * @param {string} implDir - Implementation directory
+ * @returns {string|null} Module path
+ */
+function goModulePath(implDir) {
+  const goMod = utils.error.trySync(() => fs.readFileSync(path.join(implDir, 'go.mod'), 'utf8'), '').value;
+  const match = /^module\s+(\S+)/m.exec(goMod);
+  return match ? match[1] : null;
+}
+
+/**
+ * Find the JUnit XML files Maven Surefire or Gradle wrote during a unit
+ * @param {Object} unit - Unit with format surefire or gradle
+ * @param {string} implDir - Implementation directory
+ * @param {number} since - Unit start time (ms)
+ * @returns {Array<string>} XML files
+ */
+function findJUnitFiles(unit, implDir, since) {
+  const reportDir = unit.format === 'surefire' ? path.join('target', 'surefire-reports') : path.join('build', 'test-results', 'test');
+  const modules = unit.args.includes('test') && unit.args.length === 1
+    ? ['', ...utils.error.trySync(() => fs.readdirSync(implDir, { withFileTypes: true }).filter(entry => entry.isDirectory()).map(entry => entry.name), []).value]
+    : [unit.name];
+  
+  return modules.flatMap(module => {
+    const dir = path.join(implDir, module, reportDir);
+    return utils.error.trySync(() => fs.readdirSync(dir), []).value
+      .filter(file => /\.xml$/.test(file) && (unit.format === 'gradle' || file.startsWith('TEST-')))
+      .map(file => path.join(dir, file))
+      .filter(file => fs.statSync(file).mtimeMs >= since - 1000);
+  });
+}
+
+/**
+ * Build the report suites of a finished unit
+ * A unit without parsable results (build failure, plain npm test) becomes a single test.
+ * @param {Object} unit - Unit from withResultOutput()
+ * @param {Object} run - { events, output, exitCode, timedOut, started }
+ * @param {Object} options - { implDir, timeoutSeconds }
+ * @returns {Array<Object>} Suites tagged with the unit name
+ */
+function collectSuites(unit, run, { implDir, timeoutSeconds }) {
+  const report = utils.testReport;
+  const readResult = () => fs.readFileSync(unit.resultFile, 'utf8');
+  const parsers = {
+    'go-json': () => report.fromGoTestEvents(run.events, { modulePath: goModulePath(implDir), rootDir: path.resolve(implDir) }),
+    jest: () => report.fromJestJson(JSON.parse(readResult()), implDir),
+    junit: () => report.fromJUnitXml(readResult(), { rootDir: implDir, python: true }),
+    cargo: () => report.fromCargoOutput(run.output.join('\n')),
+    surefire: () => findJUnitFiles(unit, implDir, run.started).flatMap(file => report.fromJUnitXml(fs.readFileSync(file, 'utf8'))),
+    gradle: () => findJUnitFiles(unit, implDir, run.started).flatMap(file => report.fromJUnitXml(fs.readFileSync(file, 'utf8')))
+  };
+  
+  const parser = parsers[unit.format];
+  const suites = (parser ? utils.error.trySync(parser, []).value : []).filter(suite => suite.tests.length > 0);
+  
+  if (suites.length === 0) {
+    const failed = run.exitCode !== 0 && !run.timedOut;
+    suites.push({
+      name: unit.name,
+      tests: [report.createTest({
+        name: unit.name,
+        status: run.exitCode === 0 ? 'passed' : 'error',
+        durationSeconds: (Date.now() - run.started) / 1000,
+        message: failed ? run.output.slice(-20).join('\n') || `Exited with ${run.exitCode}` : null
+      })]
+    });
+  }
+  
+  if (run.timedOut) {
+    suites[suites.length - 1].tests.push(report.createTest({ name: `${unit.name} (timeout)`, status: 'error', message: `Timed out after ${timeoutSeconds}s` }));
+  } else if (run.exitCode !== 0 && !suites.some(suite => suite.tests.some(test => test.status === 'failed' || test.status === 'error'))) {
+    // The unit failed although every test it reported passed (a crash, a failing TestMain, a threshold)
+    suites[suites.length - 1].tests.push(report.createTest({
+      name: `${unit.name} (exit code ${run.exitCode})`,
+      status: 'error',
+      message: run.output.slice(-20).join('\n') || `Exited with ${run.exitCode}`
+    }));
+  }
+  
+  return suites.map(suite => ({ ...suite, unit: unit.name }));
+}
+
+/**
+ * Run one unit
+ * @param {Object} unit - Unit from planUnits()
+ * @param {Object} options - { implDir, timeoutSeconds, logDir }
+ * @returns {Promise<Object>} { name, command, status, exitCode, durationSeconds, log }
+ */
+function runUnit(unit, { implDir, timeoutSeconds, logDir }) {
+  return new Promise(resolve => {
+    const logFile = path.join(logDir, `${safeName(unit.name)}.log`);
+    const log = fs.createWriteStream(logFile);
+    const started = Date.now();
+    const events = [];
+    const output = [];
+    let timedOut = false;
+    
+    if (unit.resultFile) utils.error.trySync(() => fs.unlinkSync(unit.resultFile));
+    
+    // go test -json events carry the text `go test -v` would print; show that and keep the events
+    const transform = unit.format !== 'go-json' ? line => line : line => {
+      const event = line.startsWith('{') ? utils.error.trySync(() => JSON.parse(line), null).value : null;
+      if (!event) return line;
+      
+      events.push(event);
+      return (event.Action === 'output' || event.Action === 'build-output') && event.Output ? event.Output.replace(/\n$/, '') : null;
+    };
+    
+    // Own process group, so a timeout also stops the test binaries the tool started
+    const child = spawn(unit.command, unit.args, { cwd: implDir, detached: true, stdio: ['ignore', 'pipe', 'pipe'] });
+    if (child.pid) runningGroups.add(child.pid);
+    streamWithPrefix(child.stdout, `[${unit.name}] `, log, transform, output);
+    streamWithPrefix(child.stderr, `[${unit.name}] `, log, line => line, output);
+    
+    const timer = setTimeout(() => {
+      timedOut = true;
+      process.stdout.write(`[${unit.name}] Timed out after ${timeoutSeconds}s\n`);
+      utils.error.trySync(() => process.kill(-child.pid, 'SIGTERM'));
+      setTimeout(() => utils.error.trySync(() => process.kill(-child.pid, 'SIGKILL')), 5000).unref();
+    }, timeoutSeconds * 1000);
+    
+    const finish = (exitCode, error) => {
+      clearTimeout(timer);
+      runningGroups.delete(child.pid);
+      if (error) {
+        log.write(`${error.message}\n`);
+        output.push(error.message);
+      }
+      log.end();
+      resolve({
+        name: unit.name,
+        command: [unit.command, ...unit.args].join(' '),
+        status: timedOut ? 'timeout' : exitCode === 0 ? 'passed' : 'failed',
+        exitCode,
+        durationSeconds: Math.round((Date.now() - started) / 100) / 10,
+        log: path.relative(utils.path.resolveProjectPath(), logFile),
+        suites: collectSuites(unit, { events, output, exitCode, timedOut, started }, { implDir, timeoutSeconds })
+      });
+    };
+    
+    child.on('error', error => {
+      process.stdout.write(`[${unit.name}] ${error.message}\n`);
+      finish(127, error);
+    });
+    child.on('close', code => finish(code === null ? 1 : code));
+  });
+}
+
+/**
+ * Stop the process groups of all running units
+ * Units run detached, so a Ctrl-C in the terminal does not reach them.
+ * @param {string} signal - Signal to send
+ * @returns {number} Number of process groups signalled
+ */
+function stopRunningUnits(signal = 'SIGTERM') {
+  for (const pid of runningGroups) {
+    utils.error.trySync(() => process.kill(-pid, signal));
+  }
+  return runningGroups.size;
+}
+
+/**
+ * Run units with a bounded number of workers
+ * @param {Array<Object>} units - Units from planUnits()
+ * @param {Object} options - { language, workers, timeoutSeconds, implDir }
+ * @returns {Promise<Array<Object>>} Unit results in plan order, with their report suites
+ */
+async function runUnits(units, options = {}) {
+  const settings = { ...getSettings(), implDir: utils.config.getImplementationDir(), ...options };
+  utils.path.ensureDir(settings.logDir);
+  
+  const results = new Array(units.length);
+  let next = 0;
+  const worker = async () => {
+    while (next < units.length) {
+      const index = next++;
+      results[index] = await runUnit(withResultOutput(units[index], settings.language, settings.logDir), settings);
+    }
+  };
+  
+  await Promise.all(Array.from({ length: Math.min(settings.workers, units.length) }, worker));
+  
+  fs.writeFileSync(path.join(settings.logDir, 'last-run.json'), JSON.stringify({
+    timestamp: new Date().toISOString(),
+    workers: settings.workers,
+    timeoutSeconds: settings.timeoutSeconds,
+    shard: options.shard || null,
+    units: results.map(({ suites, ...result }) => ({ ...result, totals: utils.testReport.summarize(suites) }))
+  }, null, 2));
+  return results;
+}
+
+/**
+ * List the services of the implementation with the language their tests run with
+ * @returns {Array<Object>} { name, language } for services with a supported test toolchain
+ */
+function listServices() {
+  const services = utils.project.getServices();
+  const languages = { javascript: 'js', typescript: 'js', go: 'go', python: 'python', rust: 'rust' };
+  
+  return (services.success ? services.value : []).map(service => {
+    const detected = utils.project.detectServiceLanguage(service.path);
+    // Maven and Gradle need different commands, so Java services use the marker file
+    const language = detected === 'java' ? detectLanguage(service.path) : languages[detected] || null;
+    if (!language) logger.warn(`${service.name}: no test toolchain for ${detected}, skipping`);
+    return { name: service.name, language };
+  }).filter(service => service.language);
+}
+
+/**
+ * Get the current commit of the project
+ * @returns {string|null} Commit SHA
+ */
+function currentCommit() {
+  return utils.error.trySync(() => execFileSync('git', ['rev-parse', 'HEAD'], {
+    cwd: utils.path.resolveProjectPath(),
+    encoding: 'utf8',
+    stdio: ['ignore', 'pipe', 'ignore']
+  }).trim(), null).value;
+}
+
+/**
+ * Get the value following a command line flag
+ * @param {string} flag - Flag name
+ * @returns {string|undefined} Flag value
+ */
+function getArg(flag) {
+  const index = process.argv.indexOf(flag);
+  return index !== -1 ? process.argv[index + 1] : undefined;
+}
+
+/**
+ * Get the components: arguments that are neither flags nor flag values
+ * @returns {Array<string>} Components
+ */
+function getComponents() {
+  const valueFlags = ['--language', '--service', '--workers', '--timeout', '--shard', '--report'];
+  return process.argv.slice(3).filter((arg, i, args) => !arg.startsWith('--') && !valueFlags.includes(args[i - 1]));
+}
+
+/**
+ * Main function
+ */
+async function main() {
+  const command = process.argv[2];
+  if (command === 'services') {
+    for (const service of listServices()) console.log(`${service.name} ${service.language}`);
+    return;
+  }
+  
+  const service = getArg('--service') || null;
+  const implDir = utils.project.getServiceDir(service);
+  const language = getArg('--language') || detectLanguage(implDir);
+  const shard = parseShard(getArg('--shard'));
+  const units = planUnits({ language, components: getComponents(), shard, implDir });
+  
+  switch (command) {
+    case 'plan':
+      for (const unit of units) console.log(`${unit.name}\t${unit.command} ${unit.args.join(' ')}`);
+      break;
+    
+    case 'run': {
+      if (units.length === 0) {
+        logger.info(`No test units in shard ${getArg('--shard')}`);
+        return;
+      }
+      
+      const options = { implDir, language, shard: getArg('--shard') || null };
+      if (service) options.logDir = path.join(getSettings().logDir, service);
+      if (getArg('--workers')) options.workers = parseInt(getArg('--workers'), 10);
+      if (getArg('--timeout')) options.timeoutSeconds = parseInt(getArg('--timeout'), 10);
+      
+      const shardNote = shard ? ` (shard ${shard.index}/${shard.total})` : '';
+      logger.info(`Running ${units.length} test unit(s)${shardNote} with ${Math.min(options.workers || getSettings().workers, units.length)} worker(s)`);
+      for (const [signal, code] of [['SIGINT', 130], ['SIGTERM', 143]]) {
+        process.on(signal, () => {
+          stopRunningUnits();
+          process.exit(code);
+        });
+      }
+      
+      const results = await runUnits(units, options);
+      const report = utils.testReport.createReport({
+        source: getArg('--report') || 'test-affected',
+        language,
+        commit: currentCommit(),
+        shard: options.shard,
+        suites: results.flatMap(result => result.suites).map(suite => (service ? { ...suite, service } : suite))
+      });
+      const written = utils.testReport.writeReport(report);
+      if (!written.success) logger.warn(`Could not write the test report: ${written.error.message}`);
+      
+      if (process.argv.includes('--json')) {
+        console.log(JSON.stringify(results, null, 2));
+      } else {
+        for (const result of results) {
+          const log = result.status === 'passed' ? 'info' : 'error';
+          logger[log](`${result.name}: ${result.status} in ${result.durationSeconds}s (${result.log})`);
+        }
+        const { totals } = report;
+        logger.info(`${totals.tests} test(s): ${totals.passed} passed, ${totals.failed} failed, ${totals.errors} error(s), ${totals.skipped} skipped (report: ${path.relative(utils.path.resolveProjectPath(), utils.testReport.getReportDir())}/${report.source}.json)`);
+      }
+      
+      if (results.some(result => result.status !== 'passed')) process.exitCode = 1;
+      break;
+    }
+    
+    default:
+      throw utils.error.ValidationError(`Unknown command: ${command || '(none)'} (expected run, plan or services)`);
+  }
+}
+
+if (require.main === module) {
+  main().catch(err => utils.error.createErrorHandler('test-scheduler')(err));
+}
+
+module.exports = {
+  planUnits,
+  parseShard,
+  runUnits,
+  stopRunningUnits,
+  listServices
+};
@@ -0,0 +1,233 @@
+#!/usr/bin/env node
+
+/**
+ * DStudio Test Trends
+ * Keeps the history of test runs and reports newly failing tests, duration regressions and pass rates
+ *
+ * Usage:
+ *   node scripts/test-trends.js record [source] [--agent <id>] [--duration <sec>]
+ *   node scripts/test-trends.js report [--service <name>] [--runs <n>] [--json | --markdown]
+ *   node scripts/test-trends.js list [--runs <n>]
+ *
+ * `record` appends the normalized report of a run (test-affected, test-summary; default the latest)
+ * to .cache/test-history/runs.jsonl with its commit, agent (--agent, else $AGENT_ID) and duration,
+ * and refreshes the trends. test-affected.sh and the test summary generator record every run.
+ *
+ * `report` looks at the last --runs runs (development.testing.history.windowRuns) and writes the
+ * trends as Markdown to claude/test-summaries/trends.md and as JSON, for dashboards, to
+ * .cache/test-history/trends.json. --json and --markdown print them instead.
+ */
+
+const fs = require('fs');
+const path = require('path');
+const { execFileSync } = require('child_process');
+const utils = require('../utils');
+const logger = utils.logger.createScopedLogger('TestTrends');
+
+const DIRECTION_ICONS = { improving: '↑', declining: '↓', stable: '→' };
+
+/**
+ * Get the files the trends are written to
+ * @returns {Object} { json, markdown } absolute paths
+ */
+function getTrendsFiles() {
+  return {
+    json: utils.path.resolveProjectPath(utils.config.get('development.testing.history.trendsFile', '.cache/test-history/trends.json')),
+    markdown: utils.path.resolveProjectPath(utils.config.get('development.testing.history.markdownFile', 'claude/test-summaries/trends.md'))
+  };
+}
+
+/**
+ * Get the commit the tests ran on
+ * @returns {string|null} Commit SHA
+ */
+function getHeadCommit() {
+  return utils.error.trySync(() => execFileSync('git', ['rev-parse', 'HEAD'], {
+    cwd: utils.path.resolveProjectPath(),
+    encoding: 'utf8',
+    stdio: ['ignore', 'pipe', 'ignore']
+  }).trim(), null).value;
+}
+
+/**
+ * Describe a run by its commit, agent and time
+ * @param {Object} run - Run reference from analyzeTrends()
+ * @returns {string} Description
+ */
+function describeRun(run) {
+  const details = [run.agent && `agent ${run.agent}`, run.time.replace(/\.\d+Z$/, 'Z')].filter(Boolean);
+  return `${run.commit ? `\`${run.commit.slice(0, 8)}\`` : run.source} (${details.join(', ')})`;
+}
+
+/**
+ * Render trends as Markdown
+ * @param {Object} trends - Result of analyzeTrends()
+ * @returns {string} Markdown
+ */
+function toMarkdown(trends) {
+  const lines = [
+    '# Test Trends',
+    '',
+    trends.runs > 0
+      ? `Test history of the last ${trends.runs} run(s), ${trends.from} to ${trends.to}.`
+      : 'No test runs recorded yet.',
+    ''
+  ];
+  const label = name => name === '.' ? 'implementation' : name;
+  
+  lines.push('## Pass rate by service', '');
+  if (Object.keys(trends.services).length === 0) {
+    lines.push('No services.', '');
+  } else {
+    lines.push('| Service | Runs | Latest | Average | Trend | Duration (latest / median) |', '|---|---|---|---|---|---|');
+    for (const [name, service] of Object.entries(trends.services).sort(([a], [b]) => a.localeCompare(b))) {
+      const rates = service.runs.slice(-10).map(run => run.passRate === null ? '-' : `${run.passRate}`).join(' ');
+      const rate = value => value === null ? '-' : `${value}%`;
+      lines.push(`| ${label(name)} | ${service.runs.length} | ${rate(service.latestPassRate)} | ${rate(service.averagePassRate)} | ${DIRECTION_ICONS[service.direction]} ${rates} | ${service.latestDurationSeconds}s / ${service.medianDurationSeconds}s |`);
+    }
+    lines.push('');
+  }
+  
+  lines.push('## Newly failing tests', '');
+  if (trends.newlyFailing.length === 0) {
+    lines.push('None.');
+  } else {
+    for (const test of trends.newlyFailing) {
+      const message = test.message ? `: ${test.message.replace(/\|/g, '\\|')}` : '';
+      lines.push(`- \`${label(test.service)}\` **${test.test}** failing for ${test.failingRuns} run(s) since ${describeRun(test.since)}, last passed ${describeRun(test.lastPassed)}${message}`);
+    }
+  }
+  lines.push('');
+  
+  lines.push('## Duration regressions', '');
+  if (trends.durationRegressions.length === 0) {
+    lines.push('None.');
+  } else {
+    for (const test of trends.durationRegressions) {
+      const increase = test.increasePercent !== null ? ` (+${test.increasePercent}%)` : '';
+      lines.push(`- \`${label(test.service)}\` **${test.test}**: ${test.baselineSeconds}s → ${test.latestSeconds}s${increase} at ${describeRun(test.run)}`);
+    }
+  }
+  lines.push('', `Generated ${trends.generated}.`);
+  
+  return `${lines.join('\n')}\n`;
+}
+
+/**
+ * Analyze the history and write the trends as JSON and Markdown
+ * @param {Object} options - analyzeTrends() options
+ * @returns {Object} Trends
+ */
+function writeTrends(options = {}) {
+  const trends = utils.testHistory.analyzeTrends(utils.testHistory.loadRuns(), options);
+  const files = getTrendsFiles();
+  
+  for (const [file, content] of [[files.json, JSON.stringify(trends, null, 2)], [files.markdown, toMarkdown(trends)]]) {
+    utils.path.ensureDir(path.dirname(file));
+    fs.writeFileSync(`${file}.tmp`, content);
+    fs.renameSync(`${file}.tmp`, file);
+  }
+  
+  return trends;
+}
+
+/**
+ * Record a report as a run and refresh the trends
+ * @param {Object} report - Normalized test report
+ * @param {Object} options - { agent, durationSeconds }
+ * @returns {Object} Result object with { run, replaced, runs }
+ */
+function recordReport(report, { agent = process.env.AGENT_ID || null, durationSeconds = null } = {}) {
+  const run = utils.testHistory.createRun(report, { commit: report.commit || getHeadCommit(), agent, durationSeconds });
+  const recorded = utils.testHistory.recordRun(run);
+  if (recorded.success) {
+    const written = utils.error.trySync(() => writeTrends());
+    if (!written.success) logger.warn(`Could not write the test trends: ${written.error.message}`);
+  }
+  return recorded;
+}
+
+/**
+ * Get the value following a command line flag
+ * @param {string} flag - Flag name
+ * @returns {string|undefined} Flag value
+ */
+function getArg(flag) {
+  const index = process.argv.indexOf(flag);
+  return index !== -1 ? process.argv[index + 1] : undefined;
+}
+
+/**
+ * Main function
+ */
+function main() {
+  const args = process.argv.slice(2);
+  const [command, source = 'latest'] = args.filter((arg, index) => !arg.startsWith('--') && !['--agent', '--duration', '--service', '--runs'].includes(args[index - 1]));
+  const window = getArg('--runs') ? parseInt(getArg('--runs'), 10) : undefined;
+  
+  switch (command) {
+    case 'record': {
+      const report = utils.testReport.loadReport(source);
+      if (!report.success) throw utils.error.ValidationError(`No test report for ${source}; run npm run test:affected first`);
+      
+      const recorded = recordReport(report.value, {
+        agent: getArg('--agent'),
+        durationSeconds: getArg('--duration') !== undefined ? parseFloat(getArg('--duration')) : null
+      });
+      if (!recorded.success) throw recorded.error;
+      logger.info(`${recorded.value.replaced ? 'Updated' : 'Recorded'} ${report.value.source} run from ${report.value.generated} (${recorded.value.runs} run(s) in the history)`);
+      break;
+    }
+    
+    case 'report': {
+      const options = { window, service: getArg('--service') || null };
+      if (process.argv.includes('--json')) {
+        console.log(JSON.stringify(utils.testHistory.analyzeTrends(utils.testHistory.loadRuns(), options), null, 2));
+        break;
+      }
+      if (process.argv.includes('--markdown')) {
+        process.stdout.write(toMarkdown(utils.testHistory.analyzeTrends(utils.testHistory.loadRuns(), options)));
+        break;
+      }
+      
+      const trends = writeTrends(options);
+      const files = getTrendsFiles();
+      for (const [name, service] of Object.entries(trends.services)) {
+        logger.info(`${name === '.' ? 'implementation' : name}: ${service.latestPassRate === null ? '-' : `${service.latestPassRate}%`} passed in the latest run, ${service.direction} over ${service.runs.length} run(s)`);
+      }
+      logger[trends.newlyFailing.length ? 'warn' : 'info'](`${trends.newlyFailing.length} newly failing test(s), ${trends.durationRegressions.length} duration regression(s)`);
+      logger.info(`Trends written to ${path.relative(process.cwd(), files.markdown)} and ${path.relative(process.cwd(), files.json)}`);
+      break;
+    }
+    
+    case 'list': {
+      const runs = utils.testHistory.loadRuns().slice(-(window || 20));
+      if (runs.length === 0) {
+        logger.info('No test runs recorded yet');
+        break;
+      }
+      for (const run of runs) {
+        const { totals } = run;
+        logger[totals.success ? 'info' : 'error'](`${run.time} ${run.source.padEnd(14)} ${(run.commit || '').slice(0, 8).padEnd(8)} ${(run.agent || '-').padEnd(16)} ${totals.passed}/${totals.tests} passed, ${totals.failed + totals.errors} failed in ${run.durationSeconds}s`);
+      }
+      break;
+    }
+    
+    default:
+      throw utils.error.ValidationError(`Unknown command: ${command || '(none)'} (expected record, report or list)`);
+  }
+}
+
+if (require.main === module) {
+  try {
+    main();
+  } catch (err) {
+    utils.error.createErrorHandler('test-trends')(err);
+  }
+}
+
+module.exports = {
+  toMarkdown,
+  writeTrends,
+  recordReport
+};
@@ -0,0 +1,377 @@
+#!/usr/bin/env node
+
+/**
+ * DStudio Test Watcher
+ * Reruns the tests affected by implementation changes while an agent works
+ *
+ * Usage:
+ *   node scripts/test-watch.js [watch] [--service <name>] [--debounce <ms>] [--all]
+ *   node scripts/test-watch.js status [--json]
+ *
+ * `watch` follows the implementation directory and waits until a burst of writes has been quiet
+ * for development.testing.watch.debounceMs. The files changed since the last run are mapped to
+ * their service (polyglot implementations) and to the affected test components with
+ * scripts/affected-graph.js, and only those run, through scripts/test-scheduler.js. Languages
+ * without a dependency graph rerun their full suite. Changes made while tests run are queued for
+ * the next run. --all runs every suite once on start.
+ *
+ * The pass/fail summary per component is kept up to date in .cache/test-watch.json
+ * (development.testing.watch.statusFile) for the Navigation Hub (@tests) and `status`; each run
+ * also writes the test-watch report (scripts/test-report.js). Passing components are recorded in
+ * the result cache, so test-affected.sh can skip them afterwards.
+ */
+
+const path = require('path');
+const utils = require('../utils');
+const affectedGraph = require('./affected-graph');
+const scheduler = require('./test-scheduler');
+const testCache = require('./test-cache');
+const flakyTests = require('./flaky-tests');
+const { detectLanguage } = require('./bisect-tests');
+const logger = utils.logger.createScopedLogger('TestWatch');
+
+// Caches test tools write while they run; changes there must not trigger another run
+const TOOL_OUTPUT_DIRS = new Set(['.pytest_cache', '.mypy_cache', '.nyc_output', '.gradle']);
+
+const STATUS_ICONS = { passed: '✓', failed: '✗', timeout: '✗' };
+
+/**
+ * Get the directories tests run in: the implementation, or each service of a polyglot implementation
+ * @param {string} service - Only this service, or null for all
+ * @returns {Array<Object>} { service, dir, prefix, language }
+ */
+function getWatchRoots(service = null) {
+  const implDir = utils.config.getImplementationDir();
+  const language = service ? null : detectLanguage(implDir);
+  if (language) return [{ service: null, dir: implDir, prefix: '', language }];
+  
+  return scheduler.listServices()
+    .filter(entry => !service || entry.name === service)
+    .map(entry => ({ service: entry.name, dir: utils.project.getServiceDir(entry.name), prefix: `${entry.name}/`, language: entry.language }));
+}
+
+/**
+ * Check whether a changed path is ignored
+ * @param {string} relativePath - Path relative to the implementation directory
+ * @returns {boolean} True for excluded directories, build output and tool caches
+ */
+function isIgnored(relativePath) {
+  return utils.watch.isExcludedPath(relativePath) ||
+    relativePath.split(/[\\/]/).some(segment => affectedGraph.SKIP_DIRS.has(segment) || TOOL_OUTPUT_DIRS.has(segment));
+}
+
+/**
+ * Get the status key of a component
+ * @param {Object} root - Root from getWatchRoots()
+ * @param {string} component - Component (unit) name
+ * @returns {string} "[<service>/]<component>"
+ */
+function componentKey(root, component) {
+  return `${root.service ? `${root.service}/` : ''}${component}`;
+}
+
+/**
+ * Select the units of a root affected by changed files
+ * @param {Object} root - Root from getWatchRoots()
+ * @param {Array<string>} files - Changed files relative to the root, or null for the full suite
+ * @returns {Object} { units, changed: Map of unit name to the changed files that selected it }
+ */
+function planRoot(root, files) {
+  const fullSuite = () => ({ units: scheduler.planUnits({ language: root.language, implDir: root.dir }), changed: new Map([[root.language, files || []]]) });
+  if (!files) return fullSuite();
+  
+  const graph = affectedGraph.buildGraph(root.language, root.dir);
+  if (!graph.success) {
+    logger.debug(`${root.service || 'implementation'}: ${graph.error.message}; running the full suite`);
+    return fullSuite();
+  }
+  // Tests the graph cannot see (e.g. a plain npm test script) can only run as a whole
+  if (![...graph.value.nodes.values()].some(node => node.isTest)) return fullSuite();
+  
+  const { components, unmapped } = affectedGraph.findAffected(graph.value, files);
+  // Changed files with no tests near them could affect anything
+  if (unmapped.length > 0) return fullSuite();
+  if (components.length === 0) return { units: [], changed: new Map() };
+  
+  const units = scheduler.planUnits({ language: root.language, components: components.map(entry => entry.component), implDir: root.dir });
+  // Plain npm test cannot select tests, so it runs as one unit for all of them
+  const changed = new Map(units.map(unit => [unit.name, [...new Set(components.filter(entry => entry.component === unit.name || unit.name === root.language).flatMap(entry => entry.changed))]]));
+  return { units, changed };
+}
+
+/**
+ * Test watcher running affected tests as the implementation changes
+ */
+class TestWatcher {
+  /**
+   * Create a new test watcher
+   * @param {Object} options - Watcher options
+   * @param {string} options.service - Only watch this service
+   * @param {number} options.debounceMs - Quiet time before a burst of writes is tested
+   */
+  constructor(options = {}) {
+    this.service = options.service || null;
+    this.debounceMs = options.debounceMs ?? utils.config.get('development.testing.watch.debounceMs', 1000);
+    this.implDir = utils.config.getImplementationDir();
+    this.watcher = null;
+    this.pending = new Set();
+    this.fullRun = false;
+    this.running = false;
+    
+    // Keep the last known result of every component until it runs again
+    const previous = utils.testReport.loadWatchStatus();
+    this.status = {
+      updated: null,
+      state: 'idle',
+      pid: process.pid,
+      running: [],
+      pendingFiles: 0,
+      totals: {},
+      components: previous.success ? previous.value.components || {} : {}
+    };
+  }
+  
+  /**
+   * Start watching
+   * @param {Object} options - { all } to run every suite once first
+   */
+  start({ all = false } = {}) {
+    this.watcher = new utils.watch.DirectoryWatcher(this.implDir, {
+      debounceMs: this.debounceMs,
+      rescanIntervalSeconds: utils.config.get('navigation.watch.rescanIntervalSeconds', 30),
+      isExcluded: isIgnored
+    });
+    
+    this.watcher.on('batch', batch => {
+      for (const change of batch.filter(entry => !entry.isDirectory)) {
+        this.pending.add(change.relativePath.split(path.sep).join('/'));
+      }
+      this.drain();
+    });
+    this.watcher.on('mode', mode => logger.info(`Watching ${path.relative(process.cwd(), this.implDir) || '.'} (${mode === 'watch' ? 'native events' : 'polling'}, ${this.debounceMs}ms debounce)`));
+    this.watcher.on('error', err => logger.warn(`Watcher error, falling back to polling: ${err.message}`));
+    this.watcher.start();
+    
+    this.saveStatus('idle');
+    if (all) {
+      this.fullRun = true;
+      this.drain();
+    }
+  }
+  
+  /**
+   * Stop watching
+   */
+  stop() {
+    if (this.watcher) {
+      this.watcher.stop();
+      this.watcher = null;
+    }
+    this.saveStatus('stopped');
+  }
+  
+  /**
+   * Run the queued changes, one run at a time, until none are left
+   * @returns {Promise<void>}
+   */
+  async drain() {
+    if (this.running) {
+      this.saveStatus('running');
+      return;
+    }
+    
+    this.running = true;
+    try {
+      while (this.fullRun || this.pending.size > 0) {
+        const files = this.fullRun ? null : [...this.pending].sort();
+        this.fullRun = false;
+        this.pending.clear();
+        
+        try {
+          await this.run(files);
+        } catch (err) {
+          logger.error(`Test run failed: ${err.message}`);
+        }
+      }
+    } finally {
+      this.running = false;
+      this.status.running = [];
+      if (this.watcher) this.saveStatus('idle');
+    }
+  }
+  
+  /**
+   * Run the tests affected by changed files
+   * @param {Array<string>} files - Changed files relative to the implementation, or null for every suite
+   * @returns {Promise<void>}
+   */
+  async run(files) {
+    const plans = [];
+    for (const root of getWatchRoots(this.service)) {
+      const rootFiles = files && files.filter(file => file.startsWith(root.prefix)).map(file => file.slice(root.prefix.length));
+      if (rootFiles && rootFiles.length === 0) continue;
+      
+      const plan = planRoot(root, rootFiles);
+      if (plan.units.length === 0) {
+        logger.info(`${root.service || 'implementation'}: no tests affected by ${rootFiles.join(', ')}`);
+        continue;
+      }
+      plans.push({ root, ...plan });
+    }
+    if (plans.length === 0) return;
+    
+    this.status.running = plans.flatMap(plan => plan.units.map(unit => componentKey(plan.root, unit.name)));
+    this.saveStatus('running');
+    logger.info(`Running ${this.status.running.join(', ')}`);
+    
+    const suites = [];
+    for (const { root, units, changed } of plans) {
+      const options = { implDir: root.dir, language: root.language };
+      if (root.service) options.logDir = path.join(utils.path.resolveProjectPath(utils.config.get('development.testing.scheduler.logDir', '.cache/test-runs')), root.service);
+      
+      // Keys of the files as the tests see them; edits made during the run must not count as tested
+      const cacheName = name => (name === root.language ? '.all' : name);
+      const keys = utils.error.trySync(() => testCache.computeKeys(root.language, units.map(unit => cacheName(unit.name)), root.service));
+      
+      const results = await scheduler.runUnits(units, options);
+      const report = flakyTests.annotateReport(utils.testReport.createReport({ source: 'test-watch', suites: results.flatMap(result => result.suites) }), root.language);
+      suites.push(...report.suites.map(suite => (root.service ? { ...suite, service: root.service } : suite)));
+      
+      for (const result of results) {
+        const totals = utils.testReport.summarize(result.suites);
+        this.status.components[componentKey(root, result.name)] = {
+          service: root.service,
+          language: root.language,
+          component: result.name,
+          status: result.status === 'timeout' ? 'timeout' : totals.success ? 'passed' : 'failed',
+          tests: totals.tests,
+          passed: totals.passed,
+          failed: totals.failed + totals.errors,
+          quarantined: totals.quarantined,
+          durationSeconds: result.durationSeconds,
+          lastRun: new Date().toISOString(),
+          log: result.log,
+          changed: (changed.get(result.name) || []).slice(0, 10)
+        };
+      }
+      
+      // Only clean runs are cached, as in test-affected.sh
+      const clean = results.filter(result => result.status === 'passed').map(result => cacheName(result.name));
+      if (clean.length > 0 && keys.success) utils.error.trySync(() => testCache.recordPasses(root.language, clean, root.service, keys.value));
+    }
+    
+    const languages = [...new Set(plans.map(plan => plan.root.language))];
+    const written = utils.testReport.writeReport(utils.testReport.createReport({
+      source: 'test-watch',
+      language: languages.length === 1 ? languages[0] : null,
+      suites
+    }));
+    if (!written.success) logger.warn(`Could not write the test report: ${written.error.message}`);
+    
+    this.status.running = [];
+    const { totals } = this.saveStatus('running');
+    const failing = Object.entries(this.status.components).filter(([, entry]) => entry.status !== 'passed').map(([key]) => key);
+    logger[failing.length ? 'error' : 'info'](`${totals.passed}/${totals.components} component(s) passing${failing.length ? `; failing: ${failing.join(', ')}` : ''}`);
+  }
+  
+  /**
+   * Write the live status
+   * @param {string} state - idle, running or stopped
+   * @returns {Object} The status
+   */
+  saveStatus(state) {
+    const components = Object.values(this.status.components);
+    Object.assign(this.status, {
+      updated: new Date().toISOString(),
+      state,
+      pendingFiles: this.pending.size,
+      totals: {
+        components: components.length,
+        passed: components.filter(entry => entry.status === 'passed').length,
+        failed: components.filter(entry => entry.status !== 'passed').length
+      }
+    });
+    
+    const saved = utils.testReport.saveWatchStatus(this.status);
+    if (!saved.success) logger.warn(`Could not write the watch status: ${saved.error.message}`);
+    return this.status;
+  }
+}
+
+/**
+ * Print the live status
+ * @param {boolean} json - Print the raw status
+ */
+function showStatus(json) {
+  const status = utils.testReport.loadWatchStatus();
+  if (!status.success) throw utils.error.ValidationError('No test watch status yet; run npm run test:watch');
+  
+  if (json) {
+    console.log(JSON.stringify(status.value, null, 2));
+    return;
+  }
+  
+  const { state, updated, totals, components, running } = status.value;
+  logger.info(`Watcher ${state}, updated ${updated}: ${totals.passed}/${totals.components} component(s) passing`);
+  for (const [key, entry] of Object.entries(components).sort(([a], [b]) => a.localeCompare(b))) {
+    const tests = entry.tests ? ` ${entry.passed}/${entry.tests} tests` : '';
+    const note = running.includes(key) ? ' (running)' : '';
+    logger[entry.status === 'passed' ? 'info' : 'error'](`  ${STATUS_ICONS[entry.status] || '?'} ${key}${tests} in ${entry.durationSeconds}s at ${entry.lastRun}${note}`);
+  }
+}
+
+/**
+ * Get the value following a command line flag
+ * @param {string} flag - Flag name
+ * @returns {string|undefined} Flag value
+ */
+function getArg(flag) {
+  const index = process.argv.indexOf(flag);
+  return index !== -1 ? process.argv[index + 1] : undefined;
+}
+
+/**
+ * Main function
+ */
+function main() {
+  const command = process.argv[2] && !process.argv[2].startsWith('--') ? process.argv[2] : 'watch';
+  
+  switch (command) {
+    case 'watch': {
+      const service = getArg('--service') || null;
+      if (service && getWatchRoots(service).length === 0) throw utils.error.ValidationError(`Unknown service or no test toolchain: ${service}`);
+      
+      const watcher = new TestWatcher({ service, debounceMs: getArg('--debounce') ? parseInt(getArg('--debounce'), 10) : undefined });
+      watcher.start({ all: process.argv.includes('--all') });
+      
+      const shutdown = () => {
+        watcher.stop();
+        scheduler.stopRunningUnits();
+        process.exit(0);
+      };
+      process.on('SIGINT', shutdown);
+      process.on('SIGTERM', shutdown);
+      break;
+    }
+    
+    case 'status':
+      showStatus(process.argv.includes('--json'));
+      break;
+    
+    default:
+      throw utils.error.ValidationError(`Unknown command: ${command} (expected watch or status)`);
+  }
+}
+
+if (require.main === module) {
+  try {
+    main();
+  } catch (err) {
+    utils.error.createErrorHandler('test-watch')(err);
+  }
+}
+
+module.exports = {
+  TestWatcher,
+  getWatchRoots
+};
@@ -0,0 +1,50 @@
+/**
+ * Watchdog Check: Disk Usage
+ * Watches free space on the project volume and the size of the .cache directory
+ */
+
+const fs = require('fs');
+const utils = require('../../utils');
+
+module.exports = {
+  name: 'disk-usage',
+  description: 'Warn when free disk space runs low or .cache grows too large',
+  intervalSeconds: 300,
+  
+  /**
+   * Run the check
+   * @param {Object} context - Check context (rootDir, options)
+   * @returns {Array<Object>} Events
+   */
+  run({ rootDir, options }) {
+    const events = [];
+    const warnFreePercent = options.warnFreePercent ?? 10;
+    const alertFreePercent = options.alertFreePercent ?? 5;
+    const maxCacheSizeMb = options.maxCacheSizeMb ?? 500;
+    
+    // fs.statfsSync is available from Node 18.15
+    if (typeof fs.statfsSync === 'function') {
+      const stats = fs.statfsSync(rootDir);
+      const freePercent = Math.round((stats.bavail / stats.blocks) * 1000) / 10;
+      const data = { freePercent, freeBytes: stats.bavail * stats.bsize, totalBytes: stats.blocks * stats.bsize };
+      
+      if (freePercent < alertFreePercent) {
+        events.push({ level: 'alert', event: 'disk-low', message: `Only ${freePercent}% disk space free on the project volume`, data });
+      } else if (freePercent < warnFreePercent) {
+        events.push({ level: 'warn', event: 'disk-low', message: `Disk space running low: ${freePercent}% free`, data });
+      }
+    }
+    
+    const cacheSize = utils.cache.getCacheSize();
+    if (cacheSize > maxCacheSizeMb * 1024 * 1024) {
+      events.push({
+        level: 'warn',
+        event: 'cache-large',
+        message: `.cache is ${utils.cache.formatCacheSize(cacheSize)} (limit ${maxCacheSizeMb} MB), run npm run cache:clean`,
+        data: { cacheBytes: cacheSize, maxCacheSizeMb }
+      });
+    }
+    
+    return events;
+  }
+};
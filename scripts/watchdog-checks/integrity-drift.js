@@ -0,0 +1,76 @@
+/**
+ * Watchdog Check: Integrity Drift
+ * Verifies the meta/implementation layout and flags uncommitted changes to meta infrastructure
+ */
+
+const fs = require('fs');
+const path = require('path');
+const { execFileSync } = require('child_process');
+const utils = require('../../utils');
+
+// Tech stack files that belong in the implementation directory (package.json is the meta package)
+const TECH_STACK_FILES = ['go.mod', 'requirements.txt', 'pyproject.toml', 'Cargo.toml', 'pom.xml', 'build.gradle'];
+
+module.exports = {
+  name: 'integrity-drift',
+  description: 'Check meta/implementation separation and uncommitted meta infrastructure changes',
+  intervalSeconds: 600,
+  
+  /**
+   * Run the check
+   * @param {Object} context - Check context (rootDir, options, memory)
+   * @returns {Array<Object>} Events
+   */
+  run({ rootDir, options, memory }) {
+    const events = [];
+    const implDir = utils.config.getImplementationDir();
+    const implName = utils.path.getRelativeToProjectRoot(implDir);
+    
+    if (!fs.existsSync(implDir)) {
+      events.push({ level: 'warn', event: 'implementation-missing', message: `Implementation directory not found: ${implName}` });
+    } else if (!fs.existsSync(path.join(implDir, 'README.md'))) {
+      events.push({ level: 'warn', event: 'implementation-readme-missing', message: 'Implementation directory missing README.md' });
+    }
+    
+    for (const stackFile of TECH_STACK_FILES) {
+      if (fs.existsSync(path.join(rootDir, stackFile))) {
+        events.push({
+          level: 'warn',
+          event: 'misplaced-stack-file',
+          message: `Tech stack file '${stackFile}' found in root directory - should be in ${implName}`,
+          data: { file: stackFile }
+        });
+      }
+    }
+    
+    if (fs.existsSync(path.join(rootDir, 'node_modules')) && fs.existsSync(path.join(implDir, 'package.json'))) {
+      events.push({ level: 'warn', event: 'misplaced-node-modules', message: 'node_modules found in root but package.json is in implementation directory' });
+    }
+    
+    // Uncommitted edits to meta infrastructure (reported when the set of files changes)
+    const protectedPaths = options.protectedPaths || utils.config.get('integrity.protectedPaths', utils.integrity.DEFAULT_PROTECTED_PATHS);
+    const status = utils.error.trySync(() => execFileSync('git', ['status', '--porcelain', '--', ...protectedPaths], {
+      cwd: rootDir,
+      encoding: 'utf8',
+      stdio: ['ignore', 'pipe', 'ignore']
+    }));
+    
+    if (status.success) {
+      const changed = status.value.split('\n').filter(Boolean).map(line => line.slice(3));
+      const signature = changed.join('\n');
+      
+      if (changed.length > 0 && signature !== memory.lastDrift) {
+        events.push({
+          level: 'warn',
+          event: 'meta-drift',
+          message: `${changed.length} uncommitted change(s) to meta infrastructure: ${changed.slice(0, 5).join(', ')}${changed.length > 5 ? ', ...' : ''}`,
+          data: { files: changed }
+        });
+      }
+      
+      memory.lastDrift = signature;
+    }
+    
+    return events;
+  }
+};
@@ -0,0 +1,56 @@
+/**
+ * Watchdog Check: PID Liveness
+ * Detects heartbeats whose owning process has exited without releasing its lease
+ */
+
+const os = require('os');
+const utils = require('../../utils');
+
+module.exports = {
+  name: 'pid-liveness',
+  description: 'Alert when an active lease belongs to a process that no longer exists',
+  intervalSeconds: 30,
+  
+  /**
+   * Run the check
+   * @param {Object} context - Check context (rootDir, memory)
+   * @returns {Array<Object>} Events
+   */
+  run({ rootDir, memory }) {
+    const events = [];
+    const reported = memory.reported || {};
+    const current = {};
+    
+    for (const heartbeat of utils.heartbeat.listHeartbeats(rootDir)) {
+      const data = heartbeat.data;
+      if (!data || data.status === 'released' || !data.pid) continue;
+      
+      // Processes on other hosts cannot be probed
+      if (data.hostname && data.hostname !== os.hostname()) continue;
+      if (heartbeat.ownerAlive) continue;
+      
+      const key = `${heartbeat.file}:${data.leaseId || data.sessionId}`;
+      current[key] = true;
+      
+      // Report each dead owner once rather than on every run
+      if (reported[key]) continue;
+      
+      events.push({
+        level: 'alert',
+        event: 'owner-process-gone',
+        message: `Process ${data.pid} owning ${heartbeat.file} (session ${data.sessionId}, task ${data.taskId || data.currentTask || 'unknown'}) is no longer running`,
+        data: {
+          file: heartbeat.file,
+          pid: data.pid,
+          sessionId: data.sessionId,
+          taskId: data.taskId || data.currentTask || null,
+          leaseExpiresAt: data.leaseExpiresAt || null,
+          touchedFiles: data.touchedFiles || []
+        }
+      });
+    }
+    
+    memory.reported = current;
+    return events;
+  }
+};
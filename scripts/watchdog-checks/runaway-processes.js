@@ -0,0 +1,142 @@
+/**
+ * Watchdog Check: Runaway Processes
+ * Flags agent child processes and project processes that burn CPU, memory or wall time
+ * Project daemons (options.daemonPatterns) may run indefinitely but are still held to the CPU and memory limits.
+ */
+
+const os = require('os');
+const { execFileSync } = require('child_process');
+const utils = require('../../utils');
+
+// Project daemons that are meant to run indefinitely; options.daemonPatterns replaces the list
+const DAEMON_PATTERNS = ['metrics-exporter(\\.js)? serve', 'integrity-monitor(\\.js)? watch', 'test-watch(\\.js)?', 'watchdog(\\.js|\\.sh)?'];
+
+/**
+ * Parse a ps duration ([DD-][HH:]MM:SS, used by both etime and time) into seconds
+ * @param {string} value - ps duration
+ * @returns {number} Seconds
+ */
+function parseDuration(value) {
+  const [days, rest] = value.includes('-') ? value.split('-') : ['0', value];
+  const parts = rest.split(':').map(Number);
+  const seconds = parts.reduce((total, part) => total * 60 + part, 0);
+  return Number(days) * 86400 + seconds;
+}
+
+/**
+ * List processes with ps
+ * @returns {Array<Object>} Processes with pid, ppid, elapsed, cpuSeconds, rssKb and command
+ */
+function listProcesses() {
+  const output = execFileSync('ps', ['-eo', 'pid=,ppid=,etime=,time=,rss=,args='], {
+    encoding: 'utf8',
+    stdio: ['ignore', 'pipe', 'ignore']
+  });
+  
+  return output.split('\n').filter(Boolean).map(line => {
+    const [pid, ppid, etime, time, rss, ...args] = line.trim().split(/\s+/);
+    return {
+      pid: Number(pid),
+      ppid: Number(ppid),
+      elapsedSeconds: parseDuration(etime),
+      cpuSeconds: parseDuration(time),
+      rssKb: Number(rss),
+      command: args.join(' ')
+    };
+  });
+}
+
+module.exports = {
+  name: 'runaway-processes',
+  description: 'Alert on agent or project processes with sustained CPU, excessive memory or runtime',
+  intervalSeconds: 60,
+  
+  /**
+   * Run the check
+   * @param {Object} context - Check context (rootDir, options, memory)
+   * @returns {Array<Object>} Events
+   */
+  run({ rootDir, options, memory }) {
+    if (process.platform === 'win32') return [];
+    
+    const maxCpuPercent = options.maxCpuPercent ?? 90;
+    const sustainedSamples = options.sustainedSamples ?? 5;
+    const maxRuntimeSeconds = options.maxRuntimeSeconds ?? 3600;
+    const maxRssMb = options.maxRssMb ?? 2048;
+    const daemons = (options.daemonPatterns || DAEMON_PATTERNS).map(pattern => new RegExp(pattern));
+    
+    const processes = listProcesses();
+    const children = new Map();
+    for (const proc of processes) {
+      if (!children.has(proc.ppid)) children.set(proc.ppid, []);
+      children.get(proc.ppid).push(proc);
+    }
+    
+    // Descendants of live local agents, plus anything running from the project directory
+    const watched = new Map();
+    const agentPids = utils.heartbeat.listHeartbeats(rootDir)
+      .filter(heartbeat => heartbeat.data && heartbeat.data.pid && heartbeat.ownerAlive &&
+        (!heartbeat.data.hostname || heartbeat.data.hostname === os.hostname()))
+      .map(heartbeat => heartbeat.data.pid);
+    
+    const queue = agentPids.flatMap(pid => children.get(pid) || []);
+    while (queue.length > 0) {
+      const proc = queue.shift();
+      if (watched.has(proc.pid)) continue;
+      watched.set(proc.pid, proc);
+      queue.push(...(children.get(proc.pid) || []));
+    }
+    
+    for (const proc of processes) {
+      if (proc.command.includes(rootDir) && !agentPids.includes(proc.pid)) {
+        watched.set(proc.pid, proc);
+      }
+    }
+    // Never report the watchdog itself, whether this is the daemon or a --once run beside it
+    const { getPaths, readRunningPid } = require('../watchdog');
+    watched.delete(process.pid);
+    watched.delete(readRunningPid(getPaths().pidFile));
+    
+    const previous = memory.samples || {};
+    const reported = memory.reported || {};
+    const samples = {};
+    const stillReported = {};
+    const events = [];
+    
+    for (const proc of watched.values()) {
+      // CPU usage between samples; ps %cpu is a lifetime average on Linux
+      const last = previous[proc.pid];
+      let cpuPercent = null;
+      let highCount = 0;
+      
+      if (last && proc.elapsedSeconds > last.elapsedSeconds) {
+        cpuPercent = Math.round(((proc.cpuSeconds - last.cpuSeconds) / (proc.elapsedSeconds - last.elapsedSeconds)) * 100);
+        highCount = cpuPercent >= maxCpuPercent ? last.highCount + 1 : 0;
+      }
+      
+      samples[proc.pid] = { cpuSeconds: proc.cpuSeconds, elapsedSeconds: proc.elapsedSeconds, highCount };
+      
+      const reasons = [];
+      if (highCount >= sustainedSamples) reasons.push(`CPU ${cpuPercent}% for ${highCount} samples`);
+      if (proc.rssKb > maxRssMb * 1024) reasons.push(`RSS ${Math.round(proc.rssKb / 1024)} MB`);
+      if (proc.elapsedSeconds > maxRuntimeSeconds && !daemons.some(pattern => pattern.test(proc.command))) reasons.push(`running ${proc.elapsedSeconds}s`);
+      
+      if (reasons.length === 0) continue;
+      
+      // Report each runaway once until it recovers or exits
+      stillReported[proc.pid] = true;
+      if (reported[proc.pid]) continue;
+      
+      events.push({
+        level: 'alert',
+        event: 'runaway-process',
+        message: `Runaway process ${proc.pid} (${reasons.join(', ')}): ${proc.command.slice(0, 120)}`,
+        data: { pid: proc.pid, ppid: proc.ppid, cpuPercent, rssKb: proc.rssKb, elapsedSeconds: proc.elapsedSeconds, command: proc.command, reasons }
+      });
+    }
+    
+    memory.samples = samples;
+    memory.reported = stillReported;
+    return events;
+  }
+};
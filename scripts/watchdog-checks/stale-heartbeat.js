@@ -0,0 +1,63 @@
+/**
+ * Watchdog Check: Stale Heartbeat
+ * Warns about ageing heartbeat files and moves stale ones to the stale-locks directory
+ */
+
+const utils = require('../../utils');
+
+module.exports = {
+  name: 'stale-heartbeat',
+  description: 'Back up and remove heartbeat files that stopped being renewed',
+  intervalSeconds: () => utils.config.get('recovery.heartbeatIntervalSeconds', 30),
+  
+  /**
+   * Run the check
+   * @param {Object} context - Check context (rootDir, options)
+   * @returns {Array<Object>} Events
+   */
+  run({ rootDir, options }) {
+    const staleSeconds = options.staleSeconds || utils.config.get('recovery.heartbeatStaleSeconds', 300);
+    const staleLocksDir = utils.config.getStaleLocksDir();
+    const events = [];
+    
+    for (const heartbeat of utils.heartbeat.listHeartbeats(rootDir)) {
+      // Released leases carry a handoff for the next agent and are not stale
+      if (heartbeat.data && heartbeat.data.status === 'released') continue;
+      
+      const lastBeat = Date.parse(heartbeat.data?.timestamp || '') || (heartbeat.modified ? heartbeat.modified.getTime() : Date.now());
+      const age = Math.round((Date.now() - lastBeat) / 1000);
+      const data = {
+        file: heartbeat.file,
+        agent: heartbeat.data?.agent || null,
+        sessionId: heartbeat.data?.sessionId || null,
+        taskId: heartbeat.data?.taskId || heartbeat.data?.currentTask || null,
+        ageSeconds: age,
+        staleSeconds
+      };
+      
+      if (age <= staleSeconds) {
+        if (age > staleSeconds / 2) {
+          events.push({ level: 'warn', event: 'heartbeat-ageing', message: `Lock file ${heartbeat.file} is getting old (${age}s)`, data });
+        }
+        continue;
+      }
+      
+      const archived = utils.heartbeat.archiveHeartbeat(heartbeat.path, staleLocksDir);
+      
+      if (!archived.success) {
+        events.push({ level: 'error', event: 'heartbeat-backup-failed', message: `Failed to backup stale lock file ${heartbeat.file}: ${archived.error.message}`, data });
+        continue;
+      }
+      
+      const { backupFile, removed } = archived.value;
+      events.push({
+        level: 'alert',
+        event: 'stale-heartbeat',
+        message: `Stale heartbeat detected (${age}s > ${staleSeconds}s) for ${heartbeat.file}, backed up to ${utils.path.getRelativeToProjectRoot(backupFile)}${removed ? '' : ' (lock file could not be removed)'}`,
+        data: { ...data, backupFile, removed }
+      });
+    }
+    
+    return events;
+  }
+};
@@ -0,0 +1,415 @@
+#!/usr/bin/env node
+
+/**
+ * DStudio Watchdog
+ * Runs pluggable health checks on their own schedules and records structured events
+ *
+ * Usage:
+ *   node scripts/watchdog.js start      Start the daemon in the background
+ *   node scripts/watchdog.js stop       Stop the background daemon
+ *   node scripts/watchdog.js status     Show daemon state and the latest result of each check
+ *   node scripts/watchdog.js run        Run in the foreground (--once runs every check once)
+ *   node scripts/watchdog.js checks     List available checks and their schedules
+ */
+
+const fs = require('fs');
+const path = require('path');
+const { spawn } = require('child_process');
+const EventEmitter = require('events');
+const utils = require('../utils');
+const logger = utils.logger.createScopedLogger('Watchdog');
+
+// Check plugins live next to this script
+const CHECKS_DIR = path.join(__dirname, 'watchdog-checks');
+
+// Event levels in increasing severity; warn and above are mirrored to issues.log
+const LEVELS = ['info', 'warn', 'alert', 'error'];
+
+/**
+ * Resolve watchdog file locations from configuration
+ * @returns {Object} Absolute paths for pidfile, events log, state file and issues log
+ */
+function getPaths() {
+  return {
+    pidFile: utils.path.resolveProjectPath(utils.config.get('watchdog.pidFile', '.cache/watchdog.pid')),
+    eventsFile: utils.path.resolveProjectPath(utils.config.get('watchdog.eventsFile', '.cache/watchdog/events.jsonl')),
+    stateFile: utils.path.resolveProjectPath(utils.config.get('watchdog.stateFile', '.cache/watchdog/state.json')),
+    outputFile: utils.path.resolveProjectPath(utils.config.get('watchdog.outputFile', '.cache/watchdog/watchdog.out')),
+    issuesLog: utils.path.resolveProjectPath(utils.config.get('watchdog.issuesLog', 'issues.log'))
+  };
+}
+
+/**
+ * Load check plugins
+ * A check module exports { name, description, intervalSeconds, run(context) }, where
+ * run returns (or resolves to) an array of { level, event, message, data } objects.
+ * @returns {Array<Object>} Enabled checks with their resolved options
+ */
+function loadChecks() {
+  const checkConfig = utils.config.get('watchdog.checks', {});
+  const files = utils.error.trySync(() => fs.readdirSync(CHECKS_DIR), []).value;
+  
+  return files
+    .filter(file => file.endsWith('.js'))
+    .sort()
+    .map(file => require(path.join(CHECKS_DIR, file)))
+    .filter(check => check && check.name && typeof check.run === 'function')
+    .map(check => {
+      const options = checkConfig[check.name] || {};
+      const intervalSeconds = options.intervalSeconds ||
+        (typeof check.intervalSeconds === 'function' ? check.intervalSeconds() : check.intervalSeconds) || 60;
+      
+      return { ...check, options, intervalSeconds, enabled: options.enabled !== false };
+    })
+    .filter(check => check.enabled);
+}
+
+/**
+ * Read the pid recorded in the pidfile if that process is alive
+ * @param {string} pidFile - Pidfile path
+ * @returns {number|null} Running daemon pid or null
+ */
+function readRunningPid(pidFile) {
+  const result = utils.file.readFileSync(pidFile);
+  if (!result.success) return null;
+  
+  const pid = parseInt(result.value.trim(), 10);
+  return utils.heartbeat.isOwnerAlive({ pid }) ? pid : null;
+}
+
+/**
+ * Watchdog daemon
+ *
+ * Events:
+ * - `event` ({ timestamp, check, level, event, message, data }) for every check result
+ */
+class Watchdog extends EventEmitter {
+  /**
+   * Create a new watchdog
+   * @param {Object} options - Watchdog options
+   * @param {Array<Object>} options.checks - Checks to run (defaults to loadChecks())
+   * @param {Object} options.paths - File locations (defaults to getPaths())
+   */
+  constructor(options = {}) {
+    super();
+    this.checks = options.checks || loadChecks();
+    this.paths = options.paths || getPaths();
+    this.timers = new Map();
+    this.running = new Set();
+    this.state = utils.error.trySync(() => JSON.parse(fs.readFileSync(this.paths.stateFile, 'utf8')), {}).value || {};
+    this.state.checks = this.state.checks || {};
+  }
+  
+  /**
+   * Schedule every check
+   */
+  start() {
+    this.state.pid = process.pid;
+    this.state.started = new Date().toISOString();
+    this.saveState();
+    
+    for (const check of this.checks) {
+      this.schedule(check, 0);
+    }
+    
+    this.record({
+      check: 'watchdog',
+      level: 'info',
+      event: 'started',
+      message: `Watchdog started with checks: ${this.checks.map(check => `${check.name} (${check.intervalSeconds}s)`).join(', ')}`
+    });
+  }
+  
+  /**
+   * Cancel all scheduled checks
+   */
+  stop() {
+    for (const timer of this.timers.values()) {
+      clearTimeout(timer);
+    }
+    this.timers.clear();
+    
+    this.record({ check: 'watchdog', level: 'info', event: 'stopped', message: 'Watchdog stopping' });
+    this.state.pid = null;
+    this.saveState();
+  }
+  
+  /**
+   * Schedule the next run of a check
+   * @param {Object} check - Check plugin
+   * @param {number} delayMs - Delay before the run
+   */
+  schedule(check, delayMs) {
+    this.timers.set(check.name, setTimeout(async () => {
+      await this.runCheck(check);
+      if (this.timers.has(check.name)) {
+        this.schedule(check, check.intervalSeconds * 1000);
+      }
+    }, delayMs));
+  }
+  
+  /**
+   * Run a single check and record its events
+   * @param {Object} check - Check plugin
+   * @returns {Promise<Array<Object>>} Recorded events
+   */
+  async runCheck(check) {
+    // Never overlap runs of the same check
+    if (this.running.has(check.name)) return [];
+    this.running.add(check.name);
+    
+    const checkState = this.state.checks[check.name] = this.state.checks[check.name] || {};
+    checkState.memory = checkState.memory || {};
+    const started = Date.now();
+    let results;
+    
+    const outcome = await utils.error.tryAsync(async () => check.run({
+      rootDir: utils.path.resolveProjectPath(),
+      config: utils.config.config,
+      options: check.options,
+      memory: checkState.memory
+    }));
+    
+    if (outcome.success) {
+      results = outcome.value || [];
+    } else {
+      results = [{ level: 'error', event: 'check-failed', message: `Check ${check.name} failed: ${outcome.error.message}` }];
+    }
+    
+    const events = results.map(result => this.record({ check: check.name, ...result }));
+    
+    checkState.lastRun = new Date(started).toISOString();
+    checkState.durationMs = Date.now() - started;
+    checkState.lastLevel = events.reduce((worst, event) =>
+      LEVELS.indexOf(event.level) > LEVELS.indexOf(worst) ? event.level : worst, 'ok');
+    checkState.lastEvents = events.slice(-5);
+    this.saveState();
+    
+    this.running.delete(check.name);
+    return events;
+  }
+  
+  /**
+   * Run every check once
+   * @returns {Promise<Array<Object>>} All recorded events
+   */
+  async runOnce() {
+    const events = [];
+    
+    for (const check of this.checks) {
+      events.push(...await this.runCheck(check));
+    }
+    
+    return events;
+  }
+  
+  /**
+   * Record an event in the JSONL log and mirror warnings to issues.log
+   * @param {Object} event - Event without timestamp
+   * @returns {Object} Recorded event
+   */
+  record(event) {
+    const entry = {
+      timestamp: new Date().toISOString(),
+      check: event.check,
+      level: LEVELS.includes(event.level) ? event.level : 'info',
+      event: event.event || event.check,
+      message: event.message,
+      data: event.data || null
+    };
+    
+    utils.path.ensureDir(path.dirname(this.paths.eventsFile));
+    fs.appendFileSync(this.paths.eventsFile, JSON.stringify(entry) + '\n');
+    
+    if (entry.level !== 'info') {
+      fs.appendFileSync(this.paths.issuesLog, `[${entry.timestamp}] [${entry.level.toUpperCase()}] ${entry.message}\n`);
+    }
+    
+    const log = { info: logger.info, warn: logger.warn }[entry.level] || logger.error;
+    log(`[${entry.check}] ${entry.message}`);
+    
+    this.emit('event', entry);
+    return entry;
+  }
+  
+  /**
+   * Persist daemon and check state
+   */
+  saveState() {
+    utils.path.ensureDir(path.dirname(this.paths.stateFile));
+    utils.file.writeFileSync(this.paths.stateFile, JSON.stringify(this.state, null, 2));
+  }
+}
+
+/**
+ * Run the daemon in the foreground
+ * @param {boolean} once - Run each check once and exit
+ */
+async function runForeground(once) {
+  const paths = getPaths();
+  const watchdog = new Watchdog({ paths });
+  
+  // Apply stale-agent recovery policies to heartbeat events
+  const recovery = utils.config.get('recovery.autoRecover', true) ? require('./recovery').attach(watchdog) : null;
+  
+  if (once) {
+    const events = await watchdog.runOnce();
+    if (recovery) await recovery.idle();
+    const worst = events.reduce((max, event) => Math.max(max, LEVELS.indexOf(event.level)), 0);
+    
+    // Exit non-zero on alerts so CI and cron can react
+    process.exitCode = worst >= LEVELS.indexOf('alert') ? 1 : 0;
+    return;
+  }
+  
+  const runningPid = readRunningPid(paths.pidFile);
+  if (runningPid && runningPid !== process.pid) {
+    throw utils.error.ExecutionError(`Watchdog already running (pid ${runningPid})`);
+  }
+  
+  utils.path.ensureDir(path.dirname(paths.pidFile));
+  fs.writeFileSync(paths.pidFile, String(process.pid));
+  
+  const shutdown = () => {
+    watchdog.stop();
+    
+    // Only remove the pidfile if it is still ours
+    if (readRunningPid(paths.pidFile) === process.pid) {
+      fs.unlinkSync(paths.pidFile);
+    }
+    process.exit(0);
+  };
+  
+  process.on('SIGINT', shutdown);
+  process.on('SIGTERM', shutdown);
+  
+  watchdog.start();
+}
+
+/**
+ * Start the daemon in the background
+ */
+function startDaemon() {
+  const paths = getPaths();
+  const runningPid = readRunningPid(paths.pidFile);
+  
+  if (runningPid) {
+    logger.warn(`Watchdog already running (pid ${runningPid})`);
+    return;
+  }
+  
+  utils.path.ensureDir(path.dirname(paths.outputFile));
+  const output = fs.openSync(paths.outputFile, 'a');
+  
+  const child = spawn(process.execPath, [__filename, 'run'], {
+    cwd: utils.path.resolveProjectPath(),
+    detached: true,
+    stdio: ['ignore', output, output]
+  });
+  
+  // Write the pidfile immediately so a second start cannot race the child
+  fs.writeFileSync(paths.pidFile, String(child.pid));
+  child.unref();
+  
+  logger.info(`Watchdog started (pid ${child.pid}), output in ${utils.path.getRelativeToProjectRoot(paths.outputFile)}`);
+}
+
+/**
+ * Stop the background daemon
+ * @returns {Promise<void>}
+ */
+async function stopDaemon() {
+  const paths = getPaths();
+  const pid = readRunningPid(paths.pidFile);
+  
+  if (!pid) {
+    logger.info('Watchdog is not running');
+    utils.error.trySync(() => fs.unlinkSync(paths.pidFile));
+    return;
+  }
+  
+  process.kill(pid, 'SIGTERM');
+  
+  // Wait up to five seconds for a clean shutdown
+  for (let i = 0; i < 50 && utils.heartbeat.isOwnerAlive({ pid }); i++) {
+    await new Promise(resolve => setTimeout(resolve, 100));
+  }
+  
+  if (utils.heartbeat.isOwnerAlive({ pid })) {
+    throw utils.error.TimeoutError(`Watchdog (pid ${pid}) did not stop within 5 seconds`);
+  }
+  
+  utils.error.trySync(() => fs.unlinkSync(paths.pidFile));
+  logger.info(`Watchdog stopped (pid ${pid})`);
+}
+
+/**
+ * Print daemon status and the latest result of each check
+ */
+function showStatus() {
+  const paths = getPaths();
+  const pid = readRunningPid(paths.pidFile);
+  const state = utils.error.trySync(() => JSON.parse(fs.readFileSync(paths.stateFile, 'utf8')), {}).value || {};
+  
+  if (process.argv.includes('--json')) {
+    console.log(JSON.stringify({ running: Boolean(pid), pid, started: state.started || null, checks: state.checks || {} }, null, 2));
+    return;
+  }
+  
+  logger.info(pid ? `Watchdog running (pid ${pid}, started ${state.started})` : 'Watchdog is not running');
+  
+  for (const check of loadChecks()) {
+    const checkState = (state.checks || {})[check.name];
+    
+    if (!checkState || !checkState.lastRun) {
+      logger.info(`  ${check.name.padEnd(18)} every ${check.intervalSeconds}s, not run yet`);
+      continue;
+    }
+    
+    const last = checkState.lastEvents && checkState.lastEvents[checkState.lastEvents.length - 1];
+    logger.info(`  ${check.name.padEnd(18)} every ${check.intervalSeconds}s, last ${checkState.lastRun} [${checkState.lastLevel}]${last ? ` ${last.message}` : ''}`);
+  }
+  
+  if (!pid) process.exitCode = 3;
+}
+
+/**
+ * Main function
+ */
+async function main() {
+  const command = process.argv[2] || 'run';
+  
+  switch (command) {
+    case 'start':
+      startDaemon();
+      break;
+    case 'stop':
+      await stopDaemon();
+      break;
+    case 'status':
+      showStatus();
+      break;
+    case 'run':
+      await runForeground(process.argv.includes('--once'));
+      break;
+    case 'checks':
+      for (const check of loadChecks()) {
+        logger.info(`${check.name.padEnd(18)} every ${check.intervalSeconds}s - ${check.description}`);
+      }
+      break;
+    default:
+      throw utils.error.ValidationError(`Unknown command: ${command} (expected start, stop, status, run or checks)`);
+  }
+}
+
+if (require.main === module) {
+  main().catch(err => utils.error.createErrorHandler('watchdog')(err));
+}
+
+module.exports = {
+  Watchdog,
+  loadChecks,
+  getPaths,
+  readRunningPid,
+  LEVELS
+};
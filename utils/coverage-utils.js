@@ -0,0 +1,497 @@
+/**
+ * Coverage Utilities
+ * One line-coverage model merged from each language's coverage tool output
+ *
+ * Model: { version, generated, commit, files: { "<path>": File } }
+ * File:  { service, language, lines: { "<line>": hits }, functions: { "<name>": { line, hits } } }
+ * Paths are relative to the implementation directory. Go blocks are mapped to the lines they
+ * span; a line shared by several blocks counts as covered only if all of them ran.
+ * Functions come from the tools that report them (lcov); describeFile() finds the functions of
+ * every language in the source and covers them by their lines.
+ */
+
+const fs = require('fs');
+const path = require('path');
+const { trySync } = require('./error-utils');
+const configUtils = require('./config-utils');
+const { parseAttributes } = require('./test-report-utils');
+
+const PROJECT_ROOT = path.resolve(path.join(__dirname, '..'));
+const MODEL_VERSION = 1;
+
+/**
+ * Get the coverage directory (raw tool output and the merged model)
+ * @returns {string} Absolute path
+ */
+function getCoverageDir() {
+  return path.resolve(PROJECT_ROOT, configUtils.get('development.testing.coverage.dir', '.cache/coverage'));
+}
+
+/**
+ * Get the coverage threshold of a service
+ * @param {string} service - Service name, or null for the whole implementation
+ * @returns {number} Minimum line coverage in percent
+ */
+function getThreshold(service = null) {
+  const overrides = configUtils.get('development.testing.coverage.serviceThresholds', {});
+  if (service !== null && typeof overrides[service] === 'number') return overrides[service];
+  return configUtils.get('development.testing.coverageThresholdPercent', 90);
+}
+
+/**
+ * Create an empty file entry
+ * @returns {Object} File entry
+ */
+function createFile() {
+  return { lines: {}, functions: {} };
+}
+
+/**
+ * Read coverage from a Go coverprofile
+ * Counts of blocks repeated by several test binaries (-coverpkg) are added up.
+ * @param {string} text - Profile text
+ * @param {Object} options - { modulePath } to turn import paths into module-relative paths
+ * @returns {Object} Files by path
+ */
+function fromGoCoverprofile(text, { modulePath = null } = {}) {
+  const blocks = new Map();
+  
+  for (const [, file, position, startLine, endLine, endColumn, count] of String(text).matchAll(/^(.+\.go):((\d+)\.\d+,(\d+)\.(\d+)) \d+ (\d+)$/gm)) {
+    const key = `${file}:${position}`;
+    // A block ending at column 1 stops before the last line's code
+    const lastLine = Number(endColumn) <= 1 && Number(endLine) > Number(startLine) ? Number(endLine) - 1 : Number(endLine);
+    const block = blocks.get(key) || { file, startLine: Number(startLine), endLine: lastLine, count: 0 };
+    block.count += Number(count);
+    blocks.set(key, block);
+  }
+  
+  const files = {};
+  for (const block of blocks.values()) {
+    const relative = modulePath && block.file.startsWith(`${modulePath}/`) ? block.file.slice(modulePath.length + 1) : block.file;
+    const entry = files[relative] || (files[relative] = createFile());
+    
+    for (let line = block.startLine; line <= block.endLine; line++) {
+      entry.lines[line] = line in entry.lines ? Math.min(entry.lines[line], block.count) : block.count;
+    }
+  }
+  
+  return files;
+}
+
+/**
+ * Compute the statement coverage of a Go coverprofile, per package and in total
+ * This is what `go test -cover` reports: covered statements over all statements, so packages
+ * weigh by their size. Blocks repeated by several test binaries count once.
+ * @param {string} text - Profile text
+ * @returns {Object} { covered, statements, percent, packages: { "<import path>": { covered, statements, percent } } }
+ */
+function goStatementCoverage(text) {
+  const blocks = new Map();
+  for (const [, file, position, statements, count] of String(text).matchAll(/^(.+\.go):(\d+\.\d+,\d+\.\d+) (\d+) (\d+)$/gm)) {
+    const key = `${file}:${position}`;
+    const block = blocks.get(key) || { pkg: path.posix.dirname(file), statements: Number(statements), covered: false };
+    block.covered = block.covered || Number(count) > 0;
+    blocks.set(key, block);
+  }
+  
+  const percentOf = ({ covered, statements }) => (statements ? Math.round((covered / statements) * 1000) / 10 : 100);
+  const packages = {};
+  const total = { covered: 0, statements: 0 };
+  for (const block of blocks.values()) {
+    const pkg = packages[block.pkg] || (packages[block.pkg] = { covered: 0, statements: 0 });
+    for (const counts of [pkg, total]) {
+      counts.statements += block.statements;
+      if (block.covered) counts.covered += block.statements;
+    }
+  }
+  
+  for (const pkg of Object.values(packages)) pkg.percent = percentOf(pkg);
+  return { ...total, percent: percentOf(total), packages };
+}
+
+/**
+ * Read coverage from an lcov tracefile (Istanbul/Jest, c8, cargo-llvm-cov)
+ * @param {string} text - lcov text
+ * @param {string} rootDir - Directory source paths are made relative to
+ * @returns {Object} Files by path
+ */
+function fromLcov(text, rootDir) {
+  const files = {};
+  let entry = null;
+  
+  for (const line of String(text).split('\n')) {
+    const [tag, value = ''] = line.trim().split(/:(.*)/s);
+    
+    if (tag === 'SF') {
+      const file = path.relative(rootDir, path.resolve(rootDir, value)).split(path.sep).join('/');
+      entry = files[file] || (files[file] = createFile());
+    } else if (tag === 'DA' && entry) {
+      const [number, hits] = value.split(',');
+      entry.lines[number] = (entry.lines[number] || 0) + Number(hits);
+    } else if (tag === 'FN' && entry) {
+      const [number, name] = value.split(/,(.*)/s);
+      entry.functions[name] = { line: Number(number), hits: entry.functions[name]?.hits || 0 };
+    } else if (tag === 'FNDA' && entry) {
+      const [hits, name] = value.split(/,(.*)/s);
+      entry.functions[name] = { line: entry.functions[name]?.line || null, hits: (entry.functions[name]?.hits || 0) + Number(hits) };
+    } else if (tag === 'end_of_record') {
+      entry = null;
+    }
+  }
+  
+  return files;
+}
+
+/**
+ * Read coverage from Cobertura XML (coverage.py `coverage xml`)
+ * @param {string} xml - Cobertura XML
+ * @param {string} rootDir - Directory source paths are made relative to
+ * @returns {Object} Files by path
+ */
+function fromCobertura(xml, rootDir) {
+  const files = {};
+  const sources = [...String(xml).matchAll(/<source>([\s\S]*?)<\/source>/g)].map(match => match[1].trim());
+  const resolveFile = filename => {
+    const base = sources.find(source => fs.existsSync(path.resolve(rootDir, source, filename))) || sources[0] || '.';
+    return path.relative(rootDir, path.resolve(rootDir, base, filename)).split(path.sep).join('/');
+  };
+  
+  for (const [, classAttrs, body] of String(xml).matchAll(/<class\b([^>]*)>([\s\S]*?)<\/class>/g)) {
+    const file = resolveFile(parseAttributes(classAttrs).filename);
+    const entry = files[file] || (files[file] = createFile());
+    
+    for (const [, methodAttrs, methodBody] of body.matchAll(/<method\b([^>]*)>([\s\S]*?)<\/method>/g)) {
+      const first = /<line\b([^>]*)\/>/.exec(methodBody);
+      const line = first ? parseAttributes(first[1]) : {};
+      entry.functions[parseAttributes(methodAttrs).name] = { line: Number(line.number) || null, hits: Number(line.hits) || 0 };
+    }
+    
+    // Method lines repeat the class lines; only the class <lines> are counted
+    const classLines = body.replace(/<methods>[\s\S]*?<\/methods>/g, '');
+    for (const [, lineAttrs] of classLines.matchAll(/<line\b([^>]*)\/>/g)) {
+      const { number, hits } = parseAttributes(lineAttrs);
+      entry.lines[number] = Math.max(entry.lines[number] || 0, Number(hits));
+    }
+  }
+  
+  return files;
+}
+
+/**
+ * Count the covered lines of a file entry
+ * @param {Object} entry - File entry
+ * @returns {Object} { covered, total, percent }
+ */
+function countLines(entry) {
+  const hits = Object.values(entry.lines);
+  const covered = hits.filter(count => count > 0).length;
+  return { covered, total: hits.length, percent: hits.length ? Math.round((covered / hits.length) * 1000) / 10 : 100 };
+}
+
+/**
+ * Get the uncovered line ranges of a file entry
+ * Lines without code (blank lines, comments) do not split a range; a covered line does.
+ * @param {Object} entry - File entry
+ * @returns {Array<Array<number>>} [start, end] pairs in line order
+ */
+function uncoveredRanges(entry) {
+  const ranges = [];
+  let range = null;
+  
+  for (const line of Object.keys(entry.lines).map(Number).sort((a, b) => a - b)) {
+    if (entry.lines[line] > 0) {
+      range = null;
+    } else if (range) {
+      range[1] = line;
+    } else {
+      ranges.push(range = [line, line]);
+    }
+  }
+  
+  return ranges;
+}
+
+/**
+ * Format line ranges as "12-18, 30"
+ * @param {Array<Array<number>>} ranges - [start, end] pairs
+ * @returns {string} Ranges
+ */
+function formatRanges(ranges) {
+  return ranges.map(([start, end]) => (start === end ? `${start}` : `${start}-${end}`)).join(', ');
+}
+
+// Function declarations per source file extension; the name is the last capture group
+const FUNCTION_PATTERNS = {
+  '.go': [/^func\s+(?:\(\s*\w*\s*\*?(\w+)(?:\[[^\]]*\])?\s*\)\s*)?(\w+)/],
+  '.rs': [/^\s*(?:pub(?:\([^)]*\))?\s+)?(?:const\s+)?(?:async\s+)?(?:unsafe\s+)?(?:extern\s+"[^"]*"\s+)?fn\s+(\w+)/],
+  '.js': [
+    /^\s*(?:export\s+(?:default\s+)?)?(?:async\s+)?function\s*\*?\s*(\w+)/,
+    /^\s*(?:export\s+)?(?:const|let|var)\s+(\w+)\s*=\s*(?:async\s+)?(?:function\b|(?:\([^)]*\)|\w+)\s*=>)/,
+    /^\s+(?:static\s+)?(?:async\s+)?(?:get\s+|set\s+)?(?!(?:if|for|while|switch|catch|function|return)\b)(\w+)\s*\([^)]*\)\s*\{\s*$/
+  ],
+  '.java': [/^\s*(?:(?:public|private|protected|static|final|abstract|synchronized|native|default)\s+)*(?:<[^>]+>\s+)?(?!(?:return|new|else|throw)\b)[\w<>[\],.?]+(?:\s*<[^>]*>)?\s+(\w+)\s*\((?![^)]*\)\s*;)/],
+  '.kt': [/^\s*(?:(?:public|private|protected|internal|override|open|suspend|inline|operator|infix)\s+)*fun\s+(?:<[^>]+>\s*)?(?:[\w.]+\.)?(\w+)\s*\(/]
+};
+for (const ext of ['.jsx', '.ts', '.tsx', '.mjs', '.cjs']) FUNCTION_PATTERNS[ext] = FUNCTION_PATTERNS['.js'];
+
+/**
+ * Find the last line of a function whose body is enclosed in braces
+ * Braces in string literals and line comments are ignored.
+ * @param {Array<string>} lines - Source lines
+ * @param {number} start - Index of the declaration line
+ * @returns {number} Index of the last line, or start for declarations without a body
+ */
+function findBraceEnd(lines, start) {
+  let depth = 0;
+  let opened = false;
+  
+  for (let i = start; i < lines.length && i < start + 5000; i++) {
+    const code = lines[i]
+      .replace(/"(?:\\.|[^"\\])*"|'(?:\\.|[^'\\])'|'\\[^']*'|`(?:\\.|[^`\\])*`/g, '')
+      .replace(/\/\/.*$/, '');
+    
+    for (const char of code) {
+      if (char === '{') {
+        depth++;
+        opened = true;
+      } else if (char === '}') {
+        depth--;
+      }
+      if (opened && depth === 0) return i;
+    }
+    
+    // An interface or abstract method ends where its signature does
+    if (!opened && /;\s*$/.test(code)) return start;
+  }
+  
+  return start;
+}
+
+/**
+ * Find the functions of a source file and the lines they span
+ * Go methods are named Type.Method and Python methods Class.method. Python functions end before the
+ * next line indented no deeper than their def; the others end at their closing brace.
+ * @param {string} source - Source text
+ * @param {string} file - File path, for the language
+ * @returns {Array<Object>} { name, line, endLine } with 1-based lines
+ */
+function findFunctions(source, file) {
+  const ext = path.extname(file).toLowerCase();
+  const lines = String(source).split('\n');
+  const functions = [];
+  
+  if (ext === '.py') {
+    const indentOf = line => line.match(/^\s*/)[0].length;
+    const classes = [];
+    
+    lines.forEach((text, i) => {
+      const match = /^(\s*)(?:async\s+)?(def|class)\s+(\w+)/.exec(text);
+      if (!match) return;
+      
+      const indent = match[1].length;
+      while (classes.length > 0 && classes[classes.length - 1].indent >= indent) classes.pop();
+      if (match[2] === 'class') {
+        classes.push({ name: match[3], indent });
+        return;
+      }
+      
+      let end = i;
+      for (let j = i + 1; j < lines.length; j++) {
+        if (!lines[j].trim() || lines[j].trim().startsWith('#')) continue;
+        if (indentOf(lines[j]) <= indent) break;
+        end = j;
+      }
+      
+      const owner = classes.length > 0 && classes[classes.length - 1].indent < indent ? `${classes[classes.length - 1].name}.` : '';
+      functions.push({ name: `${owner}${match[3]}`, line: i + 1, endLine: end + 1 });
+    });
+    
+    return functions;
+  }
+  
+  const patterns = FUNCTION_PATTERNS[ext];
+  if (!patterns) return functions;
+  
+  lines.forEach((text, i) => {
+    for (const pattern of patterns) {
+      const match = pattern.exec(text);
+      if (!match) continue;
+      
+      const groups = match.slice(1).filter(Boolean);
+      const name = ext === '.go' && groups.length === 2 ? `${groups[0]}.${groups[1]}` : groups[groups.length - 1];
+      functions.push({ name, line: i + 1, endLine: findBraceEnd(lines, i) + 1 });
+      break;
+    }
+  });
+  
+  return functions;
+}
+
+/**
+ * Compute the coverage of each function of a file
+ * A function counts its body lines; the declaration line runs when the module loads in most languages.
+ * Call counts from the coverage tool (lcov FNDA) take precedence over the lines.
+ * @param {Object} entry - File entry
+ * @param {string} source - Source text of the file
+ * @param {string} file - File path, for the language
+ * @returns {Array<Object>} { name, line, endLine, covered, total, percent, tested } for functions with code
+ */
+function functionCoverage(entry, source, file) {
+  const calls = new Map(Object.values(entry.functions).filter(fn => fn.line).map(fn => [fn.line, fn.hits]));
+  
+  return findFunctions(source, file)
+    .map(fn => {
+      const first = fn.endLine > fn.line ? fn.line + 1 : fn.line;
+      let covered = 0;
+      let total = 0;
+      for (let line = first; line <= fn.endLine; line++) {
+        if (!(line in entry.lines)) continue;
+        total++;
+        if (entry.lines[line] > 0) covered++;
+      }
+      
+      const percent = total ? Math.round((covered / total) * 1000) / 10 : null;
+      const tested = calls.has(fn.line) ? calls.get(fn.line) > 0 : covered > 0;
+      return { ...fn, covered, total, percent, tested };
+    })
+    .filter(fn => fn.total > 0 || calls.has(fn.line));
+}
+
+/**
+ * Describe the coverage of one file: totals, uncovered line ranges and per-function coverage
+ * @param {Object} entry - File entry
+ * @param {string} source - Source text of the file, or null to skip the functions
+ * @param {string} file - File path, for the language
+ * @returns {Object} { covered, total, percent, uncovered: [[start, end]], functions: [...] }
+ */
+function describeFile(entry, source = null, file = '') {
+  return {
+    ...countLines(entry),
+    uncovered: uncoveredRanges(entry),
+    functions: source === null ? [] : functionCoverage(entry, source, file)
+  };
+}
+
+/**
+ * Get the heatmap marker of a coverage percentage
+ * @param {number} percent - Line coverage in percent
+ * @param {number} threshold - Threshold of the service
+ * @returns {string} 🟩 at or above the threshold, 🟨 from half of it, 🟥 below
+ */
+function heatMarker(percent, threshold) {
+  if (percent >= threshold) return '🟩';
+  return percent >= threshold / 2 ? '🟨' : '🟥';
+}
+
+/**
+ * Add files from a parser to a model
+ * @param {Object} model - Coverage model, updated in place
+ * @param {Object} files - Files by path from a parser
+ * @param {Object} options - { prefix, service, language } where prefix makes paths implementation-relative
+ * @returns {Object} The model
+ */
+function addFiles(model, files, { prefix = '', service = null, language = null } = {}) {
+  for (const [file, entry] of Object.entries(files)) {
+    const key = path.posix.join(prefix || '.', file);
+    const target = model.files[key] || (model.files[key] = { service, language, ...createFile() });
+    
+    for (const [line, hits] of Object.entries(entry.lines)) target.lines[line] = (target.lines[line] || 0) + hits;
+    for (const [name, fn] of Object.entries(entry.functions)) {
+      target.functions[name] = { line: fn.line ?? target.functions[name]?.line ?? null, hits: (target.functions[name]?.hits || 0) + fn.hits };
+    }
+  }
+  return model;
+}
+
+/**
+ * Create an empty coverage model
+ * @param {Object} meta - Extra fields, e.g. commit
+ * @returns {Object} Coverage model
+ */
+function createModel(meta = {}) {
+  return { version: MODEL_VERSION, generated: new Date().toISOString(), ...meta, files: {} };
+}
+
+/**
+ * Summarize a model per file and per service and compare it with the thresholds
+ * @param {Object} model - Coverage model
+ * @returns {Object} { totals, services: { name: { covered, total, percent, threshold, passed, files } }, files: [...], passed }
+ */
+function summarizeModel(model) {
+  const files = Object.entries(model.files)
+    .map(([file, entry]) => ({ file, service: entry.service, language: entry.language, ...countLines(entry) }))
+    .filter(file => file.total > 0);
+  
+  const services = {};
+  for (const file of files) {
+    const name = file.service || '.';
+    const service = services[name] || (services[name] = { covered: 0, total: 0, files: 0 });
+    service.covered += file.covered;
+    service.total += file.total;
+    service.files++;
+  }
+  
+  const percentOf = ({ covered, total }) => total ? Math.round((covered / total) * 1000) / 10 : 100;
+  for (const [name, service] of Object.entries(services)) {
+    service.percent = percentOf(service);
+    service.threshold = getThreshold(name === '.' ? null : name);
+    service.passed = service.percent >= service.threshold;
+  }
+  
+  const covered = files.reduce((sum, file) => sum + file.covered, 0);
+  const total = files.reduce((sum, file) => sum + file.total, 0);
+  const totals = { covered, total, percent: percentOf({ covered, total }), files: files.length };
+  
+  return {
+    totals,
+    services,
+    files: files.sort((a, b) => a.percent - b.percent || b.total - a.total),
+    passed: Object.values(services).every(service => service.passed)
+  };
+}
+
+/**
+ * Save the merged model as coverage.json in the coverage directory
+ * @param {Object} model - Coverage model
+ * @param {string} dir - Coverage directory
+ * @returns {Object} Result object with the written path
+ */
+function saveModel(model, dir = getCoverageDir()) {
+  return trySync(() => {
+    fs.mkdirSync(dir, { recursive: true });
+    const file = path.join(dir, 'coverage.json');
+    fs.writeFileSync(`${file}.tmp`, JSON.stringify(model));
+    fs.renameSync(`${file}.tmp`, file);
+    return file;
+  });
+}
+
+/**
+ * Load the merged model
+ * @param {string} dir - Coverage directory
+ * @returns {Object} Result object with the model
+ */
+function loadModel(dir = getCoverageDir()) {
+  return trySync(() => JSON.parse(fs.readFileSync(path.join(dir, 'coverage.json'), 'utf8')));
+}
+
+module.exports = {
+  getCoverageDir,
+  getThreshold,
+  fromGoCoverprofile,
+  goStatementCoverage,
+  fromLcov,
+  fromCobertura,
+  countLines,
+  uncoveredRanges,
+  formatRanges,
+  findFunctions,
+  functionCoverage,
+  describeFile,
+  heatMarker,
+  addFiles,
+  createModel,
+  summarizeModel,
+  saveModel,
+  loadModel
+};
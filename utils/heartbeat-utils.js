@@ -0,0 +1,498 @@
+/**
+ * Heartbeat Utilities
+ * Per-agent heartbeat files with leases, task ownership and explicit handoff
+ */
+
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const crypto = require('crypto');
+const { ValidationError, ExecutionError, trySync } = require('./error-utils');
+const configUtils = require('./config-utils');
+
+// Project root (heartbeat files live next to .agent-config.json)
+const PROJECT_ROOT = path.resolve(path.join(__dirname, '..'));
+
+// Keep the touched-file list bounded; the most recent paths win
+const MAX_TOUCHED_FILES = 200;
+
+// An acquisition lock older than this was left by a process that died while acquiring
+const ACQUIRE_LOCK_STALE_MS = 10000;
+
+/**
+ * Normalize an agent identifier for use in a file name
+ * @param {string} agentId - Agent identifier
+ * @returns {string} Normalized identifier
+ */
+function normalizeAgentId(agentId) {
+  return String(agentId || '').trim().toLowerCase().replace(/[^a-z0-9_-]+/g, '-').replace(/^-+|-+$/g, '');
+}
+
+/**
+ * Get the heartbeat file path for an agent
+ * @param {string} agentId - Agent identifier
+ * @param {string} rootDir - Directory holding heartbeat files
+ * @returns {string} Path to .agent-lock-<agentId>
+ */
+function getHeartbeatPath(agentId, rootDir = PROJECT_ROOT) {
+  const baseName = configUtils.get('recovery.heartbeatFile', '.agent-lock');
+  return path.join(rootDir, `${baseName}-${normalizeAgentId(agentId)}`);
+}
+
+/**
+ * Get the lease duration from configuration
+ * @returns {number} Lease duration in seconds
+ */
+function getLeaseSeconds() {
+  return configUtils.get('recovery.heartbeatLeaseSeconds', configUtils.get('recovery.heartbeatStaleSeconds', 300));
+}
+
+/**
+ * Read a heartbeat file
+ * @param {string} heartbeatPath - Path to the heartbeat file
+ * @returns {Object} Result object with success flag and heartbeat data
+ */
+function readHeartbeat(heartbeatPath) {
+  return trySync(() => JSON.parse(fs.readFileSync(heartbeatPath, 'utf8')));
+}
+
+/**
+ * Write a heartbeat file atomically (temporary file + rename)
+ * @param {string} heartbeatPath - Path to the heartbeat file
+ * @param {Object} heartbeat - Heartbeat data
+ * @returns {Object} Result object with success flag
+ */
+function writeHeartbeat(heartbeatPath, heartbeat) {
+  return trySync(() => {
+    const tmpPath = `${heartbeatPath}.${process.pid}.tmp`;
+    fs.writeFileSync(tmpPath, JSON.stringify(heartbeat, null, 2));
+    fs.renameSync(tmpPath, heartbeatPath);
+    return heartbeatPath;
+  });
+}
+
+/**
+ * Check whether the process that wrote a heartbeat is still alive
+ * Processes on other hosts cannot be probed and are assumed alive.
+ * @param {Object} heartbeat - Heartbeat data
+ * @returns {boolean} True if the owner may still be running
+ */
+function isOwnerAlive(heartbeat) {
+  if (!heartbeat || !heartbeat.pid) return false;
+  if (heartbeat.hostname && heartbeat.hostname !== os.hostname()) return true;
+  
+  try {
+    process.kill(heartbeat.pid, 0);
+    return true;
+  } catch (err) {
+    // EPERM means the process exists but belongs to another user
+    return err.code === 'EPERM';
+  }
+}
+
+/**
+ * Check whether a heartbeat holds an unexpired lease
+ * @param {Object} heartbeat - Heartbeat data
+ * @param {number} now - Reference time in milliseconds
+ * @returns {boolean} True if the lease is held
+ */
+function isLeaseActive(heartbeat, now = Date.now()) {
+  if (!heartbeat || heartbeat.status === 'released') return false;
+  
+  const expiresAt = Date.parse(heartbeat.leaseExpiresAt || '');
+  return Number.isFinite(expiresAt) && expiresAt > now;
+}
+
+/**
+ * List all heartbeat files in a directory
+ * @param {string} rootDir - Directory holding heartbeat files
+ * @returns {Array<Object>} Heartbeats with file, path, data, leaseActive and ownerAlive
+ */
+function listHeartbeats(rootDir = PROJECT_ROOT) {
+  const baseName = configUtils.get('recovery.heartbeatFile', '.agent-lock');
+  const entries = trySync(() => fs.readdirSync(rootDir), []).value;
+  const now = Date.now();
+  
+  return entries
+    .filter(file => (file === baseName || file.startsWith(`${baseName}-`)) && !file.endsWith('.tmp') && !file.endsWith('.lock'))
+    .map(file => {
+      const heartbeatPath = path.join(rootDir, file);
+      const data = readHeartbeat(heartbeatPath).value;
+      const stats = trySync(() => fs.statSync(heartbeatPath)).value;
+      
+      return {
+        file,
+        path: heartbeatPath,
+        data,
+        modified: stats ? stats.mtime : null,
+        leaseActive: isLeaseActive(data, now),
+        ownerAlive: isOwnerAlive(data)
+      };
+    });
+}
+
+/**
+ * Find the agent holding a live lease on a task
+ * @param {string} taskId - Task identifier
+ * @param {Object} options - Lookup options
+ * @param {string} options.rootDir - Directory holding heartbeat files
+ * @param {string} options.excludeLeaseId - Lease to ignore (usually the caller's own)
+ * @returns {Object|null} Heartbeat entry of the owner, or null if the task is free
+ */
+function findTaskOwner(taskId, options = {}) {
+  if (!taskId) return null;
+  
+  return listHeartbeats(options.rootDir).find(entry =>
+    entry.data &&
+    entry.data.taskId === taskId &&
+    entry.data.leaseId !== options.excludeLeaseId &&
+    entry.leaseActive &&
+    entry.ownerAlive
+  ) || null;
+}
+
+/**
+ * Move a heartbeat file into the stale-locks directory
+ * Backups are named <file>.<timestamp>[.<agent>].stale, matching earlier watchdog backups.
+ * @param {string} heartbeatPath - Path to the heartbeat file
+ * @param {string} staleLocksDir - Backup directory (defaults to configuration)
+ * @returns {Object} Result object with success flag and { backupFile, removed }
+ */
+function archiveHeartbeat(heartbeatPath, staleLocksDir = configUtils.getStaleLocksDir()) {
+  return trySync(() => {
+    const data = readHeartbeat(heartbeatPath).value;
+    const ts = new Date().toISOString().replace(/[-:T]/g, '').slice(0, 14);
+    const agentSuffix = data && data.agent ? `.${String(data.agent).replace(/[^A-Za-z0-9_-]+/g, '-')}` : '';
+    const backupFile = path.join(staleLocksDir, `${path.basename(heartbeatPath)}.${ts}${agentSuffix}.stale`);
+    
+    fs.mkdirSync(staleLocksDir, { recursive: true });
+    fs.copyFileSync(heartbeatPath, backupFile);
+    
+    const removed = trySync(() => fs.unlinkSync(heartbeatPath)).success;
+    return { backupFile, removed };
+  });
+}
+
+/**
+ * Run a function while holding the acquisition lock of a heartbeat file
+ * The lock is created exclusively, so only one process at a time can check and take the lease.
+ * @param {string} heartbeatPath - Path to the heartbeat file
+ * @param {Function} fn - Function returning a result object
+ * @returns {Object} Result of fn, or a failed result while another process holds the lock
+ */
+function withAcquireLock(heartbeatPath, fn) {
+  const lockPath = `${heartbeatPath}.lock`;
+  let fd = null;
+  
+  for (let attempt = 0; attempt < 2 && fd === null; attempt++) {
+    try {
+      fd = fs.openSync(lockPath, 'wx');
+    } catch (err) {
+      if (err.code !== 'EEXIST') return { success: false, value: null, error: ExecutionError(`Cannot lock ${path.basename(heartbeatPath)}: ${err.message}`) };
+      
+      const stats = trySync(() => fs.statSync(lockPath)).value;
+      const holder = parseInt(trySync(() => fs.readFileSync(lockPath, 'utf8'), '').value, 10);
+      if (stats && Date.now() - stats.mtimeMs < ACQUIRE_LOCK_STALE_MS && (!holder || isOwnerAlive({ pid: holder }))) break;
+      
+      // Move the abandoned lock aside first, so only one process removes it
+      const abandoned = `${lockPath}.${process.pid}.tmp`;
+      if (trySync(() => fs.renameSync(lockPath, abandoned)).success) trySync(() => fs.unlinkSync(abandoned));
+    }
+  }
+  
+  if (fd === null) {
+    return { success: false, value: null, error: ExecutionError(`Lease on ${path.basename(heartbeatPath)} is being acquired by another process`) };
+  }
+  
+  try {
+    fs.writeSync(fd, String(process.pid));
+    return fn();
+  } finally {
+    fs.closeSync(fd);
+    trySync(() => fs.unlinkSync(lockPath));
+  }
+}
+
+/**
+ * Heartbeat lease held by one agent process
+ *
+ * The heartbeat file is owned by whoever holds its leaseId. A lease can be
+ * taken over once it has expired, was released, or its owner process is gone;
+ * otherwise acquisition is refused.
+ */
+class HeartbeatLease {
+  /**
+   * Create a new heartbeat lease
+   * @param {string} agentId - Agent identifier (used in the file name)
+   * @param {Object} options - Lease options
+   * @param {string} options.agent - Display name of the agent
+   * @param {string} options.sessionId - Session identifier
+   * @param {string} options.taskId - Initial task identifier
+   * @param {number} options.leaseSeconds - Lease duration (defaults to configuration)
+   * @param {number} options.intervalSeconds - Renewal interval (defaults to configuration)
+   * @param {string} options.rootDir - Directory holding heartbeat files
+   */
+  constructor(agentId, options = {}) {
+    if (!normalizeAgentId(agentId)) {
+      throw ValidationError(`Invalid agent ID: ${agentId}`);
+    }
+    
+    this.agentId = normalizeAgentId(agentId);
+    this.agent = options.agent || agentId;
+    this.sessionId = options.sessionId || `session-${Date.now()}`;
+    this.taskId = options.taskId || null;
+    this.progress = 0;
+    this.touchedFiles = [];
+    this.leaseSeconds = options.leaseSeconds || getLeaseSeconds();
+    this.intervalSeconds = options.intervalSeconds || configUtils.get('recovery.heartbeatIntervalSeconds', 30);
+    this.heartbeatPath = getHeartbeatPath(this.agentId, options.rootDir);
+    this.rootDir = options.rootDir || PROJECT_ROOT;
+    this.leaseId = null;
+    this.acquiredAt = null;
+    this.timer = null;
+  }
+  
+  /**
+   * Acquire the lease, refusing to take over a live one
+   * @returns {Object} Result object with success flag and heartbeat data
+   */
+  acquire() {
+    return withAcquireLock(this.heartbeatPath, () => this.takeLease());
+  }
+  
+  /**
+   * Check the current holder and write this process's lease; called with the acquisition lock held
+   * @returns {Object} Result object with success flag and heartbeat data
+   */
+  takeLease() {
+    const existing = readHeartbeat(this.heartbeatPath).value;
+    
+    if (existing && existing.leaseId !== this.leaseId && isLeaseActive(existing) && isOwnerAlive(existing)) {
+      return {
+        success: false,
+        value: existing,
+        error: ExecutionError(`Lease on ${path.basename(this.heartbeatPath)} is held by session ${existing.sessionId} (pid ${existing.pid}@${existing.hostname}) until ${existing.leaseExpiresAt}`)
+      };
+    }
+    
+    const taskCheck = this.checkTaskOwnership(this.taskId);
+    if (!taskCheck.success) return taskCheck;
+    
+    this.leaseId = crypto.randomBytes(8).toString('hex');
+    this.acquiredAt = new Date().toISOString();
+    
+    // Carry over what the previous owner handed off (or was doing when it died)
+    this.previousOwner = existing ? {
+      sessionId: existing.sessionId,
+      pid: existing.pid,
+      hostname: existing.hostname,
+      status: existing.status,
+      taskId: existing.taskId,
+      progress: existing.progress,
+      handoff: existing.handoff || null
+    } : null;
+    
+    return this.write('active');
+  }
+  
+  /**
+   * Renew the lease, verifying it is still owned by this process
+   * @param {Object} updates - Fields to update (sessionId, taskId, progress, touchedFiles)
+   * @returns {Object} Result object with success flag and heartbeat data
+   */
+  renew(updates = {}) {
+    if (!this.leaseId) {
+      return { success: false, value: null, error: ExecutionError('Lease has not been acquired') };
+    }
+    
+    const current = readHeartbeat(this.heartbeatPath).value;
+    if (current && current.leaseId !== this.leaseId) {
+      this.stop();
+      this.leaseId = null;
+      return { success: false, value: current, error: ExecutionError(`Lease lost to session ${current.sessionId}`) };
+    }
+    
+    if (updates.taskId !== undefined && updates.taskId !== this.taskId) {
+      const taskCheck = this.setTask(updates.taskId);
+      if (!taskCheck.success) return taskCheck;
+    }
+    
+    if (updates.sessionId) this.sessionId = updates.sessionId;
+    if (updates.progress !== undefined) this.setProgress(updates.progress);
+    if (updates.touchedFiles) this.touch(updates.touchedFiles);
+    
+    return this.write('active');
+  }
+  
+  /**
+   * Start periodic renewal
+   * @param {Function} getUpdates - Optional callback returning updates for each renewal
+   * @returns {Object} Result object from the initial acquisition
+   */
+  start(getUpdates = () => ({})) {
+    const result = this.leaseId ? this.renew(getUpdates()) : this.acquire();
+    if (!result.success) return result;
+    
+    clearInterval(this.timer);
+    this.timer = setInterval(() => this.renew(getUpdates()), this.intervalSeconds * 1000);
+    
+    // Do not keep the process alive just for heartbeats
+    if (this.timer.unref) this.timer.unref();
+    
+    return result;
+  }
+  
+  /**
+   * Stop periodic renewal without releasing the lease
+   */
+  stop() {
+    clearInterval(this.timer);
+    this.timer = null;
+  }
+  
+  /**
+   * Release the lease and record a handoff for the next owner
+   * @param {Object} handoff - Handoff details
+   * @param {string} handoff.to - Agent or session expected to continue
+   * @param {string} handoff.note - Free-form note for the next owner
+   * @param {string} handoff.status - Final status (defaults to completed)
+   * @param {boolean} handoff.resume - Ask the next owner to continue this session
+   * @param {Object} handoff.recovery - Recovery details (checkpoint branch, stash) for resumed sessions
+   * @returns {Object} Result object with success flag and heartbeat data
+   */
+  release(handoff = {}) {
+    this.stop();
+    
+    if (!this.leaseId) {
+      return { success: false, value: null, error: ExecutionError('Lease has not been acquired') };
+    }
+    
+    const current = readHeartbeat(this.heartbeatPath).value;
+    if (current && current.leaseId !== this.leaseId) {
+      this.leaseId = null;
+      return { success: false, value: current, error: ExecutionError(`Lease already taken over by session ${current.sessionId}`) };
+    }
+    
+    const result = this.write('released', {
+      releasedAt: new Date().toISOString(),
+      finalStatus: handoff.status || 'completed',
+      to: handoff.to || null,
+      note: handoff.note || null,
+      sessionId: this.sessionId,
+      taskId: this.taskId,
+      progress: this.progress,
+      touchedFiles: this.touchedFiles,
+      resume: handoff.resume === true,
+      recovery: handoff.recovery || null
+    });
+    
+    this.leaseId = null;
+    return result;
+  }
+  
+  /**
+   * Switch to a task, refusing tasks leased by another live agent
+   * @param {string} taskId - Task identifier
+   * @returns {Object} Result object with success flag
+   */
+  setTask(taskId) {
+    const taskCheck = this.checkTaskOwnership(taskId);
+    if (!taskCheck.success) return taskCheck;
+    
+    if (taskId !== this.taskId) {
+      this.taskId = taskId;
+      this.progress = 0;
+    }
+    
+    return { success: true, value: taskId, error: null };
+  }
+  
+  /**
+   * Check that no other live lease owns a task
+   * @param {string} taskId - Task identifier
+   * @returns {Object} Result object with success flag
+   */
+  checkTaskOwnership(taskId) {
+    const owner = findTaskOwner(taskId, { rootDir: this.rootDir, excludeLeaseId: this.leaseId });
+    
+    if (owner && owner.path !== this.heartbeatPath) {
+      return {
+        success: false,
+        value: owner.data,
+        error: ExecutionError(`Task ${taskId} is owned by agent ${owner.data.agentId} (session ${owner.data.sessionId}) until ${owner.data.leaseExpiresAt}`)
+      };
+    }
+    
+    return { success: true, value: taskId, error: null };
+  }
+  
+  /**
+   * Set the progress percentage of the current task
+   * @param {number} percent - Progress between 0 and 100
+   */
+  setProgress(percent) {
+    const value = Number(percent);
+    this.progress = Number.isFinite(value) ? Math.min(100, Math.max(0, Math.round(value))) : this.progress;
+  }
+  
+  /**
+   * Record files touched by the agent
+   * @param {string|Array<string>} files - Project-relative file paths
+   */
+  touch(files) {
+    for (const file of [].concat(files)) {
+      const index = this.touchedFiles.indexOf(file);
+      if (index !== -1) this.touchedFiles.splice(index, 1);
+      this.touchedFiles.push(file);
+    }
+    
+    if (this.touchedFiles.length > MAX_TOUCHED_FILES) {
+      this.touchedFiles = this.touchedFiles.slice(-MAX_TOUCHED_FILES);
+    }
+  }
+  
+  /**
+   * Write the heartbeat file
+   * @param {string} status - Heartbeat status (active or released)
+   * @param {Object} handoff - Handoff details for released leases
+   * @returns {Object} Result object with success flag and heartbeat data
+   */
+  write(status, handoff = null) {
+    const now = new Date();
+    const heartbeat = {
+      agent: this.agent,
+      agentId: this.agentId,
+      pid: process.pid,
+      hostname: os.hostname(),
+      sessionId: this.sessionId,
+      taskId: this.taskId,
+      currentTask: this.taskId || 'unknown',
+      progress: this.progress,
+      touchedFiles: this.touchedFiles,
+      status,
+      timestamp: now.toISOString(),
+      leaseId: this.leaseId,
+      acquiredAt: this.acquiredAt,
+      leaseExpiresAt: status === 'released' ? now.toISOString() : new Date(now.getTime() + this.leaseSeconds * 1000).toISOString(),
+      previousOwner: this.previousOwner || null,
+      handoff
+    };
+    
+    const result = writeHeartbeat(this.heartbeatPath, heartbeat);
+    return result.success ? { success: true, value: heartbeat, error: null } : result;
+  }
+}
+
+module.exports = {
+  HeartbeatLease,
+  normalizeAgentId,
+  getHeartbeatPath,
+  getLeaseSeconds,
+  readHeartbeat,
+  writeHeartbeat,
+  isOwnerAlive,
+  isLeaseActive,
+  listHeartbeats,
+  findTaskOwner,
+  archiveHeartbeat
+};
@@ -14,5 +14,11 @@ module.exports = {
   
   // Domain-specific utilities
   cache: require('./cache-utils'),
-  project: require('./project-utils')
+  project: require('./project-utils'),
+  watch: require('./watch-utils'),
+  heartbeat: require('./heartbeat-utils'),
+  integrity: require('./integrity-utils'),
+  testReport: require('./test-report-utils'),
+  testHistory: require('./test-history-utils'),
+  coverage: require('./coverage-utils')
 };
@@ -0,0 +1,350 @@
+/**
+ * Integrity Utilities
+ * Per-layer file baselines signed with an HMAC key held outside the repository
+ */
+
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const crypto = require('crypto');
+const { ValidationError, trySync } = require('./error-utils');
+const configUtils = require('./config-utils');
+const fileUtils = require('./file-utils');
+const watchUtils = require('./watch-utils');
+const heartbeatUtils = require('./heartbeat-utils');
+
+// Project root (baselines cover paths relative to it)
+const PROJECT_ROOT = path.resolve(path.join(__dirname, '..'));
+
+// Layers with separate baselines
+const LAYERS = ['meta', 'implementation'];
+
+// Meta infrastructure that agents must not change during a session
+const DEFAULT_PROTECTED_PATHS = ['.agent-config.json', 'scripts', 'utils', 'claude', 'docs/protocol'];
+
+// Files that change during normal operation and are left out of baselines, including the
+// maps, summaries, views and protocol references the claude/ tools regenerate
+const DEFAULT_IGNORE = [
+  '.agent-lock*', '*.log', '*.tmp', 'claude/memory/**',
+  'claude/project-map.md', 'claude/code-maps/**', 'claude/test-summaries/**', 'claude/views/**', 'claude/protocol-refs.*'
+];
+
+// Environment variable that overrides the key file
+const KEY_ENV = 'DSTUDIO_INTEGRITY_KEY';
+
+/**
+ * Convert a relative path to forward slashes
+ * @param {string} relativePath - Path relative to the project root
+ * @returns {string} Normalized path
+ */
+function normalizePath(relativePath) {
+  return relativePath.split(path.sep).join('/');
+}
+
+/**
+ * Get the implementation directory relative to the project root
+ * @returns {string} Relative implementation directory
+ */
+function getImplementationPrefix() {
+  return normalizePath(path.relative(PROJECT_ROOT, configUtils.getImplementationDir()));
+}
+
+/**
+ * Get the layer a project-relative path belongs to
+ * @param {string} relativePath - Path relative to the project root
+ * @returns {string} 'implementation' or 'meta'
+ */
+function getLayer(relativePath) {
+  const normalized = normalizePath(relativePath);
+  const implPrefix = getImplementationPrefix();
+  return normalized === implPrefix || normalized.startsWith(`${implPrefix}/`) ? 'implementation' : 'meta';
+}
+
+/**
+ * Check whether a path is protected meta infrastructure
+ * @param {string} relativePath - Path relative to the project root
+ * @returns {boolean} True if the path is under integrity.protectedPaths
+ */
+function isProtectedPath(relativePath) {
+  const normalized = normalizePath(relativePath);
+  return configUtils.get('integrity.protectedPaths', DEFAULT_PROTECTED_PATHS)
+    .some(protectedPath => normalized === protectedPath || normalized.startsWith(`${protectedPath}/`));
+}
+
+/**
+ * Check whether a path is left out of baselines
+ * @param {string} relativePath - Path relative to the project root
+ * @returns {boolean} True if the path is excluded or matches integrity.ignore
+ */
+function isIgnoredPath(relativePath) {
+  return watchUtils.isExcludedPath(relativePath) ||
+    fileUtils.matchesPattern(normalizePath(relativePath), configUtils.get('integrity.ignore', DEFAULT_IGNORE));
+}
+
+/**
+ * Hash the files of a layer
+ * @param {string} layer - 'meta' or 'implementation'
+ * @param {string} rootDir - Project root
+ * @returns {Object} Map of relative path to { sha256, size }
+ */
+function scanLayer(layer, rootDir = PROJECT_ROOT) {
+  const implPrefix = getImplementationPrefix();
+  const scanDir = layer === 'implementation' ? path.join(rootDir, implPrefix) : rootDir;
+  const base = layer === 'implementation' ? implPrefix : '';
+  const files = {};
+  
+  const snapshot = watchUtils.scanSnapshot(scanDir, relativePath =>
+    isIgnoredPath(relativePath) || (layer === 'meta' && getLayer(relativePath) === 'implementation'), base);
+  
+  for (const [relativePath, entry] of snapshot) {
+    if (entry.isDirectory) continue;
+    
+    const checksum = fileUtils.calculateChecksumSync(path.join(rootDir, relativePath));
+    if (checksum.success) {
+      files[normalizePath(relativePath)] = { sha256: checksum.value, size: entry.size };
+    }
+  }
+  
+  return files;
+}
+
+/**
+ * Get the file holding the signing key
+ * @returns {string} Absolute key file path
+ */
+function getKeyFile() {
+  const keyFile = configUtils.get('integrity.keyFile', '~/.dstudio/integrity.key');
+  return path.resolve(keyFile.replace(/^~(?=$|[\\/])/, os.homedir()));
+}
+
+/**
+ * Get the HMAC signing key
+ * The key comes from DSTUDIO_INTEGRITY_KEY or integrity.keyFile, which must be outside the project
+ * so that an agent working in the repository cannot re-sign a baseline.
+ * @param {Object} options - Key options
+ * @param {boolean} options.create - Create a random key file if none exists
+ * @returns {Object} Result object with success flag and { key, keyId, source }
+ */
+function getSigningKey(options = {}) {
+  return trySync(() => {
+    let key = process.env[KEY_ENV];
+    let source = KEY_ENV;
+    
+    if (!key) {
+      const keyFile = getKeyFile();
+      if (keyFile === PROJECT_ROOT || keyFile.startsWith(PROJECT_ROOT + path.sep)) {
+        throw ValidationError(`Integrity key file must be outside the project: ${keyFile}`);
+      }
+      
+      if (!fs.existsSync(keyFile)) {
+        if (!options.create) {
+          throw ValidationError(`No integrity key found; set ${KEY_ENV} or create a baseline to generate ${keyFile}`);
+        }
+        fs.mkdirSync(path.dirname(keyFile), { recursive: true, mode: 0o700 });
+        fs.writeFileSync(keyFile, crypto.randomBytes(32).toString('hex') + '\n', { mode: 0o600 });
+      }
+      
+      key = fs.readFileSync(keyFile, 'utf8').trim();
+      source = keyFile;
+    }
+    
+    if (!key) {
+      throw ValidationError(`Integrity key from ${source} is empty`);
+    }
+    
+    // The key ID identifies which key signed a baseline without revealing it
+    const keyId = crypto.createHash('sha256').update(key).digest('hex').slice(0, 16);
+    return { key, keyId, source };
+  });
+}
+
+/**
+ * Serialize a value with sorted object keys so signatures do not depend on key order
+ * @param {*} value - Value to serialize
+ * @returns {string} Canonical JSON
+ */
+function canonicalJson(value) {
+  if (Array.isArray(value)) {
+    return `[${value.map(canonicalJson).join(',')}]`;
+  }
+  if (value && typeof value === 'object') {
+    return `{${Object.keys(value).sort().map(key => `${JSON.stringify(key)}:${canonicalJson(value[key])}`).join(',')}}`;
+  }
+  return JSON.stringify(value === undefined ? null : value);
+}
+
+/**
+ * Sign a document with HMAC-SHA256
+ * Everything except the signature field is signed.
+ * @param {Object} document - Document to sign
+ * @param {Object} signingKey - Key from getSigningKey()
+ * @returns {Object} Document with a signature field
+ */
+function signDocument(document, signingKey) {
+  const { signature, ...payload } = document;
+  
+  return {
+    ...payload,
+    signature: {
+      algorithm: 'hmac-sha256',
+      keyId: signingKey.keyId,
+      value: crypto.createHmac('sha256', signingKey.key).update(canonicalJson(payload)).digest('hex')
+    }
+  };
+}
+
+/**
+ * Verify the signature of a document
+ * @param {Object} document - Signed document
+ * @param {Object} signingKey - Key from getSigningKey()
+ * @returns {Object} Result object with success flag and the document or a ValidationError
+ */
+function verifyDocument(document, signingKey) {
+  return trySync(() => {
+    if (!document || !document.signature || !document.signature.value) {
+      throw ValidationError('Document is not signed');
+    }
+    if (document.signature.keyId !== signingKey.keyId) {
+      throw ValidationError(`Document was signed with key ${document.signature.keyId}, not ${signingKey.keyId}`);
+    }
+    
+    const expected = Buffer.from(signDocument(document, signingKey).signature.value, 'hex');
+    const actual = Buffer.from(String(document.signature.value), 'hex');
+    
+    if (actual.length !== expected.length || !crypto.timingSafeEqual(actual, expected)) {
+      throw ValidationError('Signature mismatch: the document was modified after signing');
+    }
+    
+    return document;
+  });
+}
+
+/**
+ * Get the baseline file for a layer
+ * @param {string} layer - 'meta' or 'implementation'
+ * @returns {string} Absolute baseline path
+ */
+function getBaselinePath(layer) {
+  return path.join(PROJECT_ROOT, configUtils.get('integrity.baselineDir', '.cache/integrity'), `${layer}.baseline.json`);
+}
+
+/**
+ * Create and save a signed baseline for a layer
+ * @param {string} layer - 'meta' or 'implementation'
+ * @param {Object} signingKey - Key from getSigningKey()
+ * @param {Object} options - Baseline options
+ * @param {Object} options.files - Files to record (defaults to a fresh scan)
+ * @param {string} options.createdBy - Who created the baseline
+ * @returns {Object} Result object with success flag and the signed baseline
+ */
+function saveBaseline(layer, signingKey, options = {}) {
+  return trySync(() => {
+    if (!LAYERS.includes(layer)) {
+      throw ValidationError(`Unknown layer: ${layer} (expected ${LAYERS.join(' or ')})`);
+    }
+    
+    const baseline = signDocument({
+      version: 1,
+      layer,
+      createdAt: new Date().toISOString(),
+      createdBy: options.createdBy || os.userInfo().username,
+      files: options.files || scanLayer(layer)
+    }, signingKey);
+    
+    const baselinePath = getBaselinePath(layer);
+    const tmpPath = `${baselinePath}.${process.pid}.tmp`;
+    fs.mkdirSync(path.dirname(baselinePath), { recursive: true });
+    fs.writeFileSync(tmpPath, JSON.stringify(baseline, null, 2));
+    fs.renameSync(tmpPath, baselinePath);
+    
+    return baseline;
+  });
+}
+
+/**
+ * Load and verify the baseline of a layer
+ * @param {string} layer - 'meta' or 'implementation'
+ * @param {Object} signingKey - Key from getSigningKey()
+ * @returns {Object} Result object with success flag and the verified baseline
+ */
+function loadBaseline(layer, signingKey) {
+  const baselinePath = getBaselinePath(layer);
+  
+  if (!fs.existsSync(baselinePath)) {
+    return { success: false, value: null, error: ValidationError(`No ${layer} baseline at ${path.relative(PROJECT_ROOT, baselinePath)}`) };
+  }
+  
+  const parsed = trySync(() => JSON.parse(fs.readFileSync(baselinePath, 'utf8')));
+  return parsed.success ? verifyDocument(parsed.value, signingKey) : parsed;
+}
+
+/**
+ * Compare two file maps
+ * @param {Object} baselineFiles - Recorded files
+ * @param {Object} currentFiles - Current files
+ * @returns {Object} Sorted { added, removed, modified } path lists
+ */
+function diffFiles(baselineFiles, currentFiles) {
+  const added = Object.keys(currentFiles).filter(file => !baselineFiles[file]);
+  const removed = Object.keys(baselineFiles).filter(file => !currentFiles[file]);
+  const modified = Object.keys(currentFiles)
+    .filter(file => baselineFiles[file] && baselineFiles[file].sha256 !== currentFiles[file].sha256);
+  
+  return { added: added.sort(), removed: removed.sort(), modified: modified.sort() };
+}
+
+/**
+ * Attribute a file change to the agent whose heartbeat was active
+ * An agent that listed the file in touchedFiles wins; otherwise a single live lease is assumed.
+ * @param {string} relativePath - Changed path relative to the project root
+ * @param {string} rootDir - Directory holding heartbeat files
+ * @returns {Object} { agentId, sessionId, taskId, basis, candidates }
+ */
+function attributeChange(relativePath, rootDir = PROJECT_ROOT) {
+  const normalized = normalizePath(relativePath);
+  const active = heartbeatUtils.listHeartbeats(rootDir)
+    .filter(entry => entry.data && entry.leaseActive && entry.ownerAlive);
+  const touched = active.filter(entry =>
+    (entry.data.touchedFiles || []).some(file => normalizePath(file) === normalized));
+  
+  let owner = null;
+  let basis = 'none';
+  
+  if (touched.length > 0) {
+    owner = touched[touched.length - 1];
+    basis = touched.length === 1 ? 'touched-files' : 'ambiguous';
+  } else if (active.length === 1) {
+    owner = active[0];
+    basis = 'active-lease';
+  } else if (active.length > 1) {
+    basis = 'ambiguous';
+  }
+  
+  return {
+    agentId: owner ? owner.data.agentId || owner.file : null,
+    sessionId: owner ? owner.data.sessionId || null : null,
+    taskId: owner ? owner.data.taskId || owner.data.currentTask || null : null,
+    basis,
+    candidates: active.map(entry => entry.data.agentId || entry.file)
+  };
+}
+
+module.exports = {
+  LAYERS,
+  DEFAULT_PROTECTED_PATHS,
+  normalizePath,
+  getLayer,
+  isProtectedPath,
+  isIgnoredPath,
+  scanLayer,
+  getKeyFile,
+  getSigningKey,
+  canonicalJson,
+  signDocument,
+  verifyDocument,
+  getBaselinePath,
+  saveBaseline,
+  loadBaseline,
+  diffFiles,
+  attributeChange
+};
@@ -77,6 +77,16 @@ function getServices() {
   }, []);
 }
 
+/**
+ * Get the directory a service's tests run in
+ * @param {string} service - Service name, or null for the implementation root
+ * @returns {string} Absolute path
+ */
+function getServiceDir(service = null) {
+  const implDir = configUtils.getImplementationDir();
+  return service ? path.join(implDir, service) : implDir;
+}
+
 /**
  * Detect the programming language of a service
  * @param {string} servicePath - Path to service directory
@@ -344,6 +354,7 @@ function getServiceSpecs() {
 module.exports = {
   isServiceDirectory,
   getServices,
+  getServiceDir,
   detectServiceLanguage,
   readAgentStatusFiles,
   generateProjectStatus,
@@ -0,0 +1,248 @@
+/**
+ * Test History Utilities
+ * Time series of test runs, appended from the normalized test reports, and the trends derived from it
+ *
+ * Store: one Run per line in .cache/test-history/runs.jsonl (development.testing.history.file)
+ * Run:     { id, time, source, commit, agent, language, durationSeconds, totals, services: { "<service>": Service } }
+ * Service: { tests, passed, failed, errors, skipped, quarantined, durationSeconds, results: { "<suite>::<test>": [status, durationSeconds, quarantined?] }, messages: { "<suite>::<test>": message } }
+ * The service of a single-project implementation is ".". A run is identified by the report it came
+ * from, so recording an updated report (e.g. after flaky retries) replaces the run instead of adding one.
+ */
+
+const fs = require('fs');
+const path = require('path');
+const { trySync } = require('./error-utils');
+const configUtils = require('./config-utils');
+
+const PROJECT_ROOT = path.resolve(path.join(__dirname, '..'));
+
+/**
+ * Get the history store
+ * @returns {string} Absolute path
+ */
+function getHistoryFile() {
+  return path.resolve(PROJECT_ROOT, configUtils.get('development.testing.history.file', '.cache/test-history/runs.jsonl'));
+}
+
+/**
+ * Load the recorded runs, oldest first
+ * @param {string} file - History store
+ * @returns {Array<Object>} Runs; unreadable lines are skipped
+ */
+function loadRuns(file = getHistoryFile()) {
+  const text = trySync(() => fs.readFileSync(file, 'utf8'), '').value;
+  return text.split('\n')
+    .filter(line => line.startsWith('{'))
+    .map(line => trySync(() => JSON.parse(line), null).value)
+    .filter(Boolean);
+}
+
+/**
+ * Create a run from a report
+ * @param {Object} report - Normalized test report
+ * @param {Object} options - { commit, agent, durationSeconds } overriding what the report has
+ * @returns {Object} Run; durationSeconds is null without a measured duration
+ */
+function createRun(report, { commit = null, agent = null, durationSeconds = null } = {}) {
+  const services = {};
+  
+  for (const suite of report.suites) {
+    const name = suite.service || '.';
+    const service = services[name] || (services[name] = { tests: 0, passed: 0, failed: 0, errors: 0, skipped: 0, quarantined: 0, durationSeconds: 0, results: {}, messages: {} });
+    
+    for (const test of suite.tests) {
+      const key = `${suite.name}::${test.name}`;
+      const failed = test.status === 'failed' || test.status === 'error';
+      service.tests++;
+      service[{ passed: 'passed', failed: 'failed', skipped: 'skipped', error: 'errors' }[test.status]]++;
+      if (failed && test.quarantined) service.quarantined++;
+      service.durationSeconds += test.durationSeconds || 0;
+      service.results[key] = failed && test.quarantined ? [test.status, test.durationSeconds, true] : [test.status, test.durationSeconds];
+      if (failed && test.message) service.messages[key] = test.message.split('\n')[0].slice(0, 200);
+    }
+  }
+  
+  for (const service of Object.values(services)) {
+    service.durationSeconds = Math.round(service.durationSeconds * 1000) / 1000;
+  }
+  
+  return {
+    id: `${report.source}@${report.generated}`,
+    time: report.generated,
+    source: report.source,
+    commit: commit || report.commit || null,
+    agent,
+    language: report.language || null,
+    durationSeconds,
+    totals: report.totals,
+    services
+  };
+}
+
+/**
+ * Append a run to the history, or replace the run recorded from the same report
+ * The oldest runs are dropped beyond development.testing.history.maxRuns. Without a measured duration,
+ * the run keeps the duration recorded for the report before, or the sum of its test durations.
+ * @param {Object} run - Run from createRun()
+ * @param {string} file - History store
+ * @returns {Object} Result object with { run, replaced, runs } where runs is the number kept
+ */
+function recordRun(run, file = getHistoryFile()) {
+  return trySync(() => {
+    fs.mkdirSync(path.dirname(file), { recursive: true });
+    const runs = loadRuns(file);
+    const maxRuns = configUtils.get('development.testing.history.maxRuns', 200);
+    const previous = runs.find(entry => entry.id === run.id);
+    const replaced = Boolean(previous);
+    if (run.durationSeconds === null) run = { ...run, durationSeconds: previous ? previous.durationSeconds : run.totals.durationSeconds };
+    
+    if (!replaced && runs.length < maxRuns) {
+      fs.appendFileSync(file, `${JSON.stringify(run)}\n`);
+      return { run, replaced, runs: runs.length + 1 };
+    }
+    
+    const kept = [...runs.filter(entry => entry.id !== run.id), run].slice(-maxRuns);
+    fs.writeFileSync(`${file}.tmp`, kept.map(entry => JSON.stringify(entry)).join('\n') + '\n');
+    fs.renameSync(`${file}.tmp`, file);
+    return { run, replaced, runs: kept.length };
+  });
+}
+
+/**
+ * Get the median of a list of numbers
+ * @param {Array<number>} values - Values
+ * @returns {number|null} Median, or null for an empty list
+ */
+function median(values) {
+  if (values.length === 0) return null;
+  const sorted = [...values].sort((a, b) => a - b);
+  const middle = Math.floor(sorted.length / 2);
+  return sorted.length % 2 ? sorted[middle] : (sorted[middle - 1] + sorted[middle]) / 2;
+}
+
+/**
+ * Get the pass rate of a service in one run
+ * @param {Object} service - Service entry of a run
+ * @returns {number|null} Passed tests in percent of the tests that ran, or null if none ran
+ */
+function passRate(service) {
+  const ran = service.tests - service.skipped;
+  return ran > 0 ? Math.round((service.passed / ran) * 1000) / 10 : null;
+}
+
+/**
+ * Derive trends from the recorded runs
+ * A test is newly failing when its latest outcome failed and it passed earlier in the window; its
+ * duration regressed when its latest passing run took longer than the median of its earlier passing
+ * runs by more than durationRegressionPercent and minDurationSeconds. Quarantined failures count as
+ * failures for pass rates, but are not reported as newly failing.
+ * @param {Array<Object>} runs - Runs, oldest first
+ * @param {Object} options - Analysis options
+ * @param {number} options.window - Number of most recent runs to look at
+ * @param {string} options.service - Only this service
+ * @param {number} options.durationRegressionPercent - Slowdown that counts as a regression
+ * @param {number} options.minDurationSeconds - Smallest slowdown, in seconds, that counts as a regression
+ * @param {number} options.minSamples - Earlier passing runs a test needs for a duration baseline
+ * @returns {Object} { generated, window, runs, from, to, services, newlyFailing, durationRegressions }
+ */
+function analyzeTrends(runs, {
+  window = configUtils.get('development.testing.history.windowRuns', 20),
+  service = null,
+  durationRegressionPercent = configUtils.get('development.testing.history.durationRegressionPercent', 50),
+  minDurationSeconds = configUtils.get('development.testing.history.minDurationSeconds', 0.5),
+  minSamples = 3
+} = {}) {
+  const recent = runs.filter(run => !service || run.services[service]).slice(-window);
+  const describeRun = run => ({ id: run.id, time: run.time, commit: run.commit, agent: run.agent, source: run.source });
+  const services = {};
+  const histories = new Map();
+  
+  for (const run of recent) {
+    for (const [name, entry] of Object.entries(run.services)) {
+      if (service && name !== service) continue;
+      
+      const trend = services[name] || (services[name] = { runs: [] });
+      trend.runs.push({ ...describeRun(run), passRate: passRate(entry), tests: entry.tests, failed: entry.failed + entry.errors, durationSeconds: entry.durationSeconds });
+      
+      for (const [key, [status, durationSeconds, quarantined]] of Object.entries(entry.results)) {
+        const id = `${name}\n${key}`;
+        if (!histories.has(id)) histories.set(id, { service: name, test: key, outcomes: [] });
+        histories.get(id).outcomes.push({ run, status, durationSeconds, quarantined: Boolean(quarantined), message: entry.messages?.[key] || null });
+      }
+    }
+  }
+  
+  for (const trend of Object.values(services)) {
+    const rates = trend.runs.map(run => run.passRate).filter(rate => rate !== null);
+    const latest = trend.runs[trend.runs.length - 1];
+    trend.latestPassRate = latest.passRate;
+    trend.averagePassRate = rates.length ? Math.round((rates.reduce((sum, rate) => sum + rate, 0) / rates.length) * 10) / 10 : null;
+    trend.change = rates.length > 1 ? Math.round((rates[rates.length - 1] - rates[0]) * 10) / 10 : 0;
+    trend.direction = trend.change >= 1 ? 'improving' : trend.change <= -1 ? 'declining' : 'stable';
+    trend.latestDurationSeconds = latest.durationSeconds;
+    trend.medianDurationSeconds = Math.round(median(trend.runs.map(run => run.durationSeconds)) * 1000) / 1000;
+  }
+  
+  const newlyFailing = [];
+  const durationRegressions = [];
+  const isFailure = outcome => outcome.status === 'failed' || outcome.status === 'error';
+  
+  for (const { service: name, test, outcomes } of histories.values()) {
+    const latest = outcomes[outcomes.length - 1];
+    
+    if (isFailure(latest) && !latest.quarantined) {
+      let start = outcomes.length - 1;
+      while (start > 0 && isFailure(outcomes[start - 1])) start--;
+      const lastPassed = outcomes.slice(0, start).reverse().find(outcome => outcome.status === 'passed');
+      
+      if (lastPassed) {
+        newlyFailing.push({
+          service: name,
+          test,
+          message: latest.message,
+          failingRuns: outcomes.length - start,
+          since: describeRun(outcomes[start].run),
+          lastPassed: describeRun(lastPassed.run)
+        });
+      }
+    }
+    
+    if (latest.status === 'passed' && typeof latest.durationSeconds === 'number') {
+      const earlier = outcomes.slice(0, -1)
+        .filter(outcome => outcome.status === 'passed' && typeof outcome.durationSeconds === 'number')
+        .map(outcome => outcome.durationSeconds);
+      const baseline = median(earlier);
+      
+      if (earlier.length >= minSamples && latest.durationSeconds - baseline >= minDurationSeconds &&
+          latest.durationSeconds >= baseline * (1 + durationRegressionPercent / 100)) {
+        durationRegressions.push({
+          service: name,
+          test,
+          baselineSeconds: Math.round(baseline * 1000) / 1000,
+          latestSeconds: latest.durationSeconds,
+          increasePercent: baseline > 0 ? Math.round(((latest.durationSeconds - baseline) / baseline) * 100) : null,
+          run: describeRun(latest.run)
+        });
+      }
+    }
+  }
+  
+  return {
+    generated: new Date().toISOString(),
+    window,
+    runs: recent.length,
+    from: recent.length ? recent[0].time : null,
+    to: recent.length ? recent[recent.length - 1].time : null,
+    services,
+    newlyFailing: newlyFailing.sort((a, b) => a.failingRuns - b.failingRuns || a.service.localeCompare(b.service) || a.test.localeCompare(b.test)),
+    durationRegressions: durationRegressions.sort((a, b) => (b.latestSeconds - b.baselineSeconds) - (a.latestSeconds - a.baselineSeconds))
+  };
+}
+
+module.exports = {
+  getHistoryFile,
+  loadRuns,
+  createRun,
+  recordRun,
+  analyzeTrends
+};
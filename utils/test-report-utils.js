@@ -0,0 +1,654 @@
+/**
+ * Test Report Utilities
+ * Normalized test reports (JSON and JUnit XML) built from each language's test tool output
+ *
+ * Report: { version, source, language, generated, commit, totals, suites: [Suite] }
+ * Suite:  { name, path?, service?, tests: [Test] }
+ * Test:   { name, status, durationSeconds, message, file, line, flaky?, quarantined? }
+ * Status is one of passed, failed, skipped or error (the suite could not run).
+ *
+ * The test watcher (scripts/test-watch.js) also keeps a live status per component:
+ * { updated, state, running: [key], pendingFiles, totals, components: { "<[service/]component>": Component } }
+ * Component: { service, language, component, status, tests, passed, failed, durationSeconds, lastRun, log, changed }
+ */
+
+const fs = require('fs');
+const path = require('path');
+const { trySync } = require('./error-utils');
+const configUtils = require('./config-utils');
+
+const PROJECT_ROOT = path.resolve(path.join(__dirname, '..'));
+const REPORT_VERSION = 1;
+
+/**
+ * Get the report directory
+ * @returns {string} Absolute path
+ */
+function getReportDir() {
+  return path.resolve(PROJECT_ROOT, configUtils.get('development.testing.reports.dir', '.cache/test-reports'));
+}
+
+/**
+ * Create a normalized test
+ * @param {Object} test - Test fields; name and status are required
+ * @returns {Object} Test with every field present
+ */
+function createTest({ name, status, durationSeconds = null, message = null, file = null, line = null, ...extra }) {
+  return { name, status, durationSeconds, message, file, line: line === null ? null : Number(line), ...extra };
+}
+
+/**
+ * Count the tests of a set of suites
+ * Failed tests that are quarantined (flaky) are counted but do not make the run fail.
+ * @param {Array<Object>} suites - Suites
+ * @returns {Object} { tests, passed, failed, skipped, errors, quarantined, durationSeconds, success }
+ */
+function summarize(suites) {
+  const totals = { tests: 0, passed: 0, failed: 0, skipped: 0, errors: 0, quarantined: 0, durationSeconds: 0 };
+  
+  for (const test of suites.flatMap(suite => suite.tests)) {
+    totals.tests++;
+    totals[{ passed: 'passed', failed: 'failed', skipped: 'skipped', error: 'errors' }[test.status]]++;
+    if (test.quarantined && (test.status === 'failed' || test.status === 'error')) totals.quarantined++;
+    totals.durationSeconds += test.durationSeconds || 0;
+  }
+  
+  totals.durationSeconds = Math.round(totals.durationSeconds * 1000) / 1000;
+  totals.success = totals.failed + totals.errors - totals.quarantined === 0;
+  return totals;
+}
+
+/**
+ * Create a report
+ * @param {Object} options - Report fields
+ * @param {string} options.source - Producer, e.g. test-affected or test-summary
+ * @param {string} options.language - Language, or null for mixed reports
+ * @param {Array<Object>} options.suites - Suites
+ * @returns {Object} Report with totals
+ */
+function createReport({ source, language = null, suites = [], ...meta }) {
+  return finalizeReport({
+    version: REPORT_VERSION,
+    source,
+    language,
+    generated: new Date().toISOString(),
+    ...meta,
+    suites
+  });
+}
+
+/**
+ * Recompute the totals of a report after its tests changed
+ * @param {Object} report - Report, updated in place
+ * @returns {Object} The report
+ */
+function finalizeReport(report) {
+  report.totals = summarize(report.suites);
+  return report;
+}
+
+/**
+ * Find the first file:line reference in test output
+ * @param {string} text - Output
+ * @param {RegExp} pattern - Pattern with file and line groups
+ * @returns {Object} { file, line } (null fields if not found)
+ */
+function findLocation(text, pattern) {
+  const match = pattern.exec(text || '');
+  return match ? { file: match[1], line: Number(match[2]) } : { file: null, line: null };
+}
+
+// Failure kinds of Go tests, in order of precedence, recognized from their output
+const GO_FAILURE_KINDS = [
+  ['race', /WARNING: DATA RACE|race detected during execution of test/],
+  ['timeout', /panic: test timed out after/],
+  ['panic', /^panic: /m]
+];
+
+/**
+ * Find the first stack frame in a directory
+ * @param {string} output - Output with Go stack traces
+ * @param {string} rootDir - Directory frames must be in, or null for the first frame outside GOROOT
+ * @returns {Object} { file, line } relative to rootDir (null fields if not found)
+ */
+function findGoFrame(output, rootDir) {
+  for (const [, file, line] of String(output).matchAll(/^[ \t]+(\/\S+\.go):(\d+)/gm)) {
+    if (rootDir ? file.startsWith(`${rootDir}${path.sep}`) : !/\/src\/(runtime|testing|sync|internal)\//.test(file)) {
+      return { file: rootDir ? path.relative(rootDir, file).split(path.sep).join('/') : file, line: Number(line) };
+    }
+  }
+  return { file: null, line: null };
+}
+
+/**
+ * Describe the first data race in Go race detector output
+ * @param {string} output - Test output
+ * @param {string} rootDir - Module directory, to locate the racing accesses
+ * @returns {Object} { message, file, line } where file:line is the first racing access
+ */
+function describeGoRace(output, rootDir) {
+  const report = output.slice(output.indexOf('WARNING: DATA RACE')).split(/^={10,}$/m)[0];
+  const accesses = [...report.matchAll(/^((?:Previous )?(?:write|read)) at \S+ by [^:\n]+:\n((?:[ \t]+.*\n)*)/gim)]
+    .map(([, access, frames]) => ({ access: access.toLowerCase(), ...findGoFrame(frames, rootDir) }))
+    .filter(access => access.file);
+  
+  return {
+    message: `DATA RACE${accesses.length ? `: ${accesses.map(access => `${access.access} at ${access.file}:${access.line}`).join(', ')}` : ''}`,
+    file: accesses.length ? accesses[0].file : null,
+    line: accesses.length ? accesses[0].line : null
+  };
+}
+
+/**
+ * Split compiler output that go test wrote to stderr (before Go 1.24) by package
+ * @param {string} text - stderr of go test
+ * @returns {Map<string, Array<string>>} Output lines by import path
+ */
+function splitGoBuildOutput(text) {
+  const packages = new Map();
+  let current = null;
+  
+  for (const line of String(text || '').split('\n')) {
+    const header = /^# (\S+)/.exec(line);
+    if (header) {
+      current = header[1];
+      if (!packages.has(current)) packages.set(current, []);
+    } else if (current && line.trim()) {
+      packages.get(current).push(`${line}\n`);
+    }
+  }
+  return packages;
+}
+
+/**
+ * Build suites from `go test -json` events
+ * Tests and subtests are separate tests; subtests name their parent. Failed tests are classified
+ * (kind: assertion, race, panic, timeout, or subtest when only subtests failed), and a package that did not build becomes one error
+ * test of kind build with the compiler diagnostics.
+ * @param {Array<Object>} events - Parsed JSON events
+ * @param {Object} options - Parser options
+ * @param {string} options.modulePath - Module path, to turn import paths into directories
+ * @param {string} options.rootDir - Module directory, to locate race and panic stack frames
+ * @param {string} options.buildOutput - stderr of go test, for compiler errors of older Go versions
+ * @returns {Array<Object>} One suite per package, with its elapsed time
+ */
+function fromGoTestEvents(events, { modulePath = null, rootDir = null, buildOutput = null } = {}) {
+  const packages = new Map();
+  const getPackage = name => {
+    if (!packages.has(name)) packages.set(name, { tests: new Map(), output: [], action: null, elapsed: null, failedBuild: false });
+    return packages.get(name);
+  };
+  
+  for (const [name, lines] of splitGoBuildOutput(buildOutput)) {
+    getPackage(name).output.push(...lines);
+  }
+  
+  for (const event of events) {
+    // Build failures (Go 1.24+) are reported against "pkg [pkg.test]"
+    if (event.Action === 'build-output') {
+      getPackage(String(event.ImportPath || '').split(' ')[0]).output.push(event.Output || '');
+      continue;
+    }
+    if (!event.Package) continue;
+    
+    const pkg = getPackage(event.Package);
+    if (!event.Test) {
+      if (event.Action === 'output') pkg.output.push(event.Output);
+      if (['pass', 'fail', 'skip'].includes(event.Action)) {
+        pkg.action = event.Action;
+        pkg.elapsed = event.Elapsed ?? null;
+        pkg.failedBuild = Boolean(event.FailedBuild);
+      }
+      continue;
+    }
+    
+    if (!pkg.tests.has(event.Test)) pkg.tests.set(event.Test, { output: [], action: null, elapsed: null });
+    const test = pkg.tests.get(event.Test);
+    if (event.Action === 'output') test.output.push(event.Output);
+    if (['pass', 'fail', 'skip'].includes(event.Action)) {
+      test.action = event.Action;
+      test.elapsed = event.Elapsed ?? null;
+    }
+  }
+  
+  return [...packages.entries()].filter(([, pkg]) => pkg.action || pkg.tests.size > 0).map(([name, pkg]) => {
+    const dir = modulePath && (name === modulePath || name.startsWith(`${modulePath}/`)) ? name.slice(modulePath.length + 1) || '.' : null;
+    const inDir = file => (file && dir && dir !== '.' && !file.startsWith(`${dir}/`) ? path.posix.join(dir, file) : file);
+    const packageOutput = pkg.output.join('');
+    
+    const tests = [...pkg.tests.entries()].map(([testName, test]) => {
+      const output = test.output.join('');
+      const failed = test.action === 'fail' || test.action === null;
+      // Before Go 1.27 the timeout panic is part of the package output
+      const kind = failed ? (GO_FAILURE_KINDS.find(([, pattern]) => pattern.test(output) || (test.action === null && pattern.test(packageOutput))) || ['assertion'])[0] : undefined;
+      
+      let location = findLocation(output, /^\s+([\w.-]+\.go):(\d+):/m);
+      let message = null;
+      if (kind === 'race') {
+        ({ message, ...location } = describeGoRace(output, rootDir));
+      } else if (kind === 'timeout') {
+        const running = [...`${output}${packageOutput}`.matchAll(/^\t\t(\S+) \(/gm)].map(match => match[1]);
+        message = `${(/panic: (test timed out after \S+)/.exec(`${output}${packageOutput}`) || [])[1]}${running.length ? ` (running: ${[...new Set(running)].join(', ')})` : ''}`;
+      } else if (kind === 'panic') {
+        message = (/^panic: .*$/m.exec(output) || [])[0];
+        location = findGoFrame(output, rootDir);
+      } else if (failed) {
+        const failure = output.split('\n').find(line => /^\s+[\w.-]+\.go:\d+:/.test(line));
+        message = (failure || output).trim().split('\n')[0] || 'Test failed';
+      }
+      
+      return createTest({
+        name: testName,
+        status: { pass: 'passed', fail: 'failed', skip: 'skipped' }[test.action] || 'error',
+        durationSeconds: test.elapsed,
+        message,
+        file: kind === 'race' || kind === 'panic' ? location.file : inDir(location.file),
+        line: location.line,
+        kind,
+        parent: testName.includes('/') ? testName.slice(0, testName.lastIndexOf('/')) : undefined
+      });
+    });
+    
+    // A parent without failures of its own failed because of its subtests
+    for (const test of tests.filter(entry => entry.kind === 'assertion' && !entry.line)) {
+      const failedSubtests = tests.filter(entry => entry.parent === test.name && (entry.status === 'failed' || entry.status === 'error'));
+      if (failedSubtests.length === 0) continue;
+      
+      test.kind = 'subtest';
+      test.message = `Subtest(s) failed: ${failedSubtests.map(entry => entry.name).join(', ')}`;
+    }
+    
+    // A package that failed without a failing test did not build or crashed outside a test
+    const failedBuild = pkg.failedBuild || /\[(build|setup) failed\]/.test(packageOutput);
+    if (pkg.action === 'fail' && !tests.some(test => test.status === 'failed' || test.status === 'error')) {
+      const diagnostics = [...packageOutput.matchAll(/^\.?\/?([\w./-]+\.go):(\d+)(?::(\d+))?: (.*)$/gm)]
+        .map(([, file, line, column, text]) => ({ file: inDir(file), line: Number(line), column: column ? Number(column) : null, message: text }));
+      const kind = failedBuild ? 'build' : (GO_FAILURE_KINDS.find(([, pattern]) => pattern.test(packageOutput)) || ['panic'])[0];
+      
+      tests.push(createTest({
+        name: name,
+        status: 'error',
+        message: (diagnostics.length
+          ? diagnostics.slice(0, 5).map(entry => `${entry.file}:${entry.line}${entry.column ? `:${entry.column}` : ''}: ${entry.message}`)
+          : packageOutput.trim().split('\n').filter(line => !/^(FAIL|ok)\b/.test(line)).slice(0, 5)).join('\n') || 'Package failed',
+        file: diagnostics.length ? diagnostics[0].file : null,
+        line: diagnostics.length ? diagnostics[0].line : null,
+        kind,
+        diagnostics: diagnostics.length ? diagnostics : undefined
+      }));
+    }
+    
+    return { name, path: dir, durationSeconds: pkg.elapsed, buildFailed: failedBuild || undefined, tests };
+  });
+}
+
+/**
+ * Build suites from Jest's --json output
+ * @param {Object} json - Parsed Jest results
+ * @param {string} rootDir - Directory test file paths are made relative to
+ * @returns {Array<Object>} One suite per test file
+ */
+function fromJestJson(json, rootDir) {
+  return (json.testResults || []).map(result => {
+    const file = path.relative(rootDir, result.testFilePath || result.name).split(path.sep).join('/');
+    const tests = (result.assertionResults || []).map(assertion => {
+      const message = (assertion.failureMessages || []).join('\n');
+      const stackLine = new RegExp(`${file.replace(/[.*+?^${}()|[\]\\]/g, '\\$&')}:(\\d+):\\d+`).exec(message);
+      return createTest({
+        name: assertion.fullName || assertion.title,
+        status: { passed: 'passed', failed: 'failed' }[assertion.status] || 'skipped',
+        durationSeconds: assertion.duration === null || assertion.duration === undefined ? null : assertion.duration / 1000,
+        message: message ? message.split('\n')[0] : null,
+        file,
+        line: assertion.location ? assertion.location.line : stackLine ? stackLine[1] : null
+      });
+    });
+    
+    // The file itself failed (syntax error, missing module) before any test ran
+    if (result.status === 'failed' && !tests.some(test => test.status === 'failed')) {
+      tests.push(createTest({ name: file, status: 'error', message: (result.message || 'Test suite failed to run').trim().split('\n').slice(0, 5).join('\n'), file }));
+    }
+    
+    return { name: file, path: file, tests };
+  });
+}
+
+/**
+ * Decode XML entities
+ * @param {string} text - XML text
+ * @returns {string} Decoded text
+ */
+function decodeXml(text) {
+  const entities = { lt: '<', gt: '>', quot: '"', apos: "'", amp: '&' };
+  
+  // One pass, so CDATA sections stay raw and decoded text is never decoded again
+  return String(text || '').replace(/<!\[CDATA\[([\s\S]*?)\]\]>|&(#x[0-9a-fA-F]+|#\d+|\w+);/g, (match, cdata, entity) => {
+    if (cdata !== undefined) return cdata;
+    if (!entity.startsWith('#')) return entities[entity] ?? match;
+    
+    const code = entity[1] === 'x' ? parseInt(entity.slice(2), 16) : parseInt(entity.slice(1), 10);
+    return code <= 0x10ffff ? String.fromCodePoint(code) : match;
+  });
+}
+
+/**
+ * Encode text for XML attributes and content
+ * @param {*} value - Value
+ * @returns {string} Encoded text
+ */
+function encodeXml(value) {
+  return String(value ?? '')
+    .replace(/&/g, '&amp;').replace(/</g, '&lt;').replace(/>/g, '&gt;').replace(/"/g, '&quot;')
+    // eslint-disable-next-line no-control-regex
+    .replace(/[\u0000-\u0008\u000b\u000c\u000e-\u001f]/g, '');
+}
+
+/**
+ * Parse XML attributes
+ * @param {string} text - Attribute text of a tag
+ * @returns {Object} Attributes
+ */
+function parseAttributes(text) {
+  return Object.fromEntries([...String(text).matchAll(/([\w:.-]+)="([^"]*)"/g)].map(([, name, value]) => [name, decodeXml(value)]));
+}
+
+/**
+ * Find the Python file a JUnit class name refers to (tests.unit.test_x.TestY -> tests/unit/test_x.py)
+ * @param {string} classname - Dotted class name
+ * @param {string} rootDir - Directory the tests ran in
+ * @returns {Object|null} { file, rest } where rest are the class parts after the module
+ */
+function resolvePythonClass(classname, rootDir) {
+  const parts = classname.split('.');
+  for (let i = parts.length; i > 0; i--) {
+    const file = `${parts.slice(0, i).join('/')}.py`;
+    if (fs.existsSync(path.join(rootDir, file))) return { file, rest: parts.slice(i) };
+  }
+  return null;
+}
+
+/**
+ * Build suites from JUnit XML (Surefire, Gradle, pytest --junitxml)
+ * @param {string} xml - JUnit XML
+ * @param {Object} options - { rootDir, python } where python names tests by pytest node ID
+ * @returns {Array<Object>} One suite per <testsuite>
+ */
+function fromJUnitXml(xml, { rootDir = null, python = false } = {}) {
+  const suites = [];
+  
+  // Suites without test cases may be written as <testsuite .../>
+  for (const [, suiteAttrs, , body = ''] of String(xml).matchAll(/<testsuite\b([^>]*?)(\/>|>([\s\S]*?)<\/testsuite>)/g)) {
+    const suite = parseAttributes(suiteAttrs);
+    const tests = [];
+    
+    for (const [, caseAttrs, , content = ''] of body.matchAll(/<testcase\b([^>]*?)(\/>|>([\s\S]*?)<\/testcase>)/g)) {
+      const testCase = parseAttributes(caseAttrs);
+      const problem = /<(failure|error)\b([^>]*?)(?:\/>|>([\s\S]*?)<\/\1>)/.exec(content);
+      const problemAttrs = problem ? parseAttributes(problem[2]) : {};
+      const detail = problem ? decodeXml(problem[3]) : '';
+      let name = testCase.name;
+      let file = testCase.file || null;
+      
+      if (python && rootDir && testCase.classname) {
+        const resolved = resolvePythonClass(testCase.classname, rootDir);
+        if (resolved) {
+          file = resolved.file;
+          name = [resolved.file, ...resolved.rest, testCase.name].join('::');
+        }
+      }
+      
+      const location = findLocation(detail, /([\w./-]+\.(?:py|java|kt|js|ts)):(\d+)/);
+      tests.push(createTest({
+        name,
+        status: problem ? (problem[1] === 'error' ? 'error' : 'failed') : /<skipped\b/.test(content) ? 'skipped' : 'passed',
+        durationSeconds: testCase.time !== undefined ? parseFloat(testCase.time) : null,
+        message: problem ? (problemAttrs.message || detail.trim().split('\n')[0] || 'Test failed') : null,
+        file: file || location.file,
+        line: testCase.line !== undefined ? testCase.line : location.line
+      }));
+    }
+    
+    suites.push({ name: suite.name || 'tests', tests });
+  }
+  
+  return suites;
+}
+
+/**
+ * Name the suite of a cargo test binary from its "Running" or "Doc-tests" header
+ * @param {string} line - Output line
+ * @returns {string|null} Suite name, or null if the line is no header
+ */
+function cargoSuiteName(line) {
+  const running = /^\s*Running ((?:unittests )?\S+)(?: \((.+)\))?/.exec(line) || /^\s*Doc-tests (\S+)/.exec(line);
+  if (!running) return null;
+  
+  const binary = running[2] ? path.basename(running[2]).replace(/-[0-9a-f]+(\.exe)?$/, '') : null;
+  return line.includes('Doc-tests') ? `${running[1]} (doc)` : binary ? `${binary} ${running[1]}` : running[1];
+}
+
+/**
+ * Describe a Rust test panic from the output the test printed
+ * @param {string} output - Captured stdout of the test
+ * @returns {Object} { file, line, message }
+ */
+function describeRustPanic(output) {
+  const location = findLocation(output, /panicked at (?:'[\s\S]*?', )?([\w./-]+\.rs):(\d+):\d+/);
+  const lines = String(output || '').split('\n');
+  const message = lines.find(line => line.trim() && !/^thread '.*'(?: \(\d+\))? panicked at|^note:/.test(line)) || lines[0];
+  return { ...location, message: message.trim() };
+}
+
+/**
+ * Build suites from `cargo test` output (libtest's text format)
+ * Without stderr, suites are named from the "Running" headers found in the output itself.
+ * @param {string} output - cargo test output
+ * @param {string} stderr - cargo's stderr, with the headers of the test binaries in run order
+ * @returns {Array<Object>} One suite per test binary (unit tests, integration tests, doc tests)
+ */
+function fromCargoOutput(output, stderr = null) {
+  const suites = [];
+  const panics = new Map();
+  const names = stderr ? String(stderr).split('\n').map(cargoSuiteName).filter(Boolean) : null;
+  let suite = null;
+  
+  // Panic messages follow the results as "---- name stdout ----" blocks
+  for (const [, name, block] of String(output).matchAll(/^---- (\S+) stdout ----\n([\s\S]*?)(?=^---- |^failures:|^test result:)/gm)) {
+    panics.set(name, describeRustPanic(block));
+  }
+  
+  for (const line of String(output).split('\n')) {
+    // Each binary starts with "running N tests" on stdout, in the order of the stderr headers
+    const name = names ? (/^running \d+ tests?$/.test(line) ? names[suites.length] || 'tests' : null) : cargoSuiteName(line);
+    if (name) {
+      suites.push(suite = { name, tests: [] });
+      continue;
+    }
+    
+    const result = /^test (.+?) \.\.\. (ok|FAILED|ignored)/.exec(line);
+    if (result) {
+      // "Running" headers go to stderr and may be missing or out of order
+      if (!suite) suites.push(suite = { name: 'tests', tests: [] });
+      const panic = panics.get(result[1]) || {};
+      suite.tests.push(createTest({
+        name: result[1],
+        status: { ok: 'passed', FAILED: 'failed', ignored: 'skipped' }[result[2]],
+        message: result[2] === 'FAILED' ? panic.message || 'Test failed' : null,
+        file: panic.file || null,
+        line: panic.line || null
+      }));
+    }
+  }
+  
+  return suites;
+}
+
+/**
+ * Build suites from libtest JSON events (`cargo test -- -Z unstable-options --format json`, nightly)
+ * @param {string} output - stdout with one JSON event per line
+ * @param {string} stderr - cargo's stderr, with the headers of the test binaries in run order
+ * @returns {Array<Object>} One suite per test binary
+ */
+function fromLibtestJson(output, stderr = null) {
+  const names = String(stderr || '').split('\n').map(cargoSuiteName).filter(Boolean);
+  const suites = [];
+  let suite = null;
+  
+  for (const line of String(output).split('\n')) {
+    if (!line.startsWith('{')) continue;
+    const event = trySync(() => JSON.parse(line), null).value;
+    if (!event) continue;
+    
+    if (event.type === 'suite' && event.event === 'started') {
+      suites.push(suite = { name: names[suites.length] || 'tests', tests: [] });
+      continue;
+    }
+    
+    // "started" and "timeout" (still running after 60s) are followed by the outcome
+    if (event.type !== 'test' || !['ok', 'failed', 'ignored'].includes(event.event)) continue;
+    if (!suite) suites.push(suite = { name: 'tests', tests: [] });
+    
+    const panic = event.event === 'failed' ? describeRustPanic(event.stdout || event.message) : {};
+    suite.tests.push(createTest({
+      name: event.name,
+      status: { ok: 'passed', failed: 'failed', ignored: 'skipped' }[event.event],
+      durationSeconds: event.exec_time !== undefined ? Number(event.exec_time) : null,
+      message: event.event === 'failed' ? panic.message || event.message || 'Test failed' : null,
+      file: panic.file || null,
+      line: panic.line || null
+    }));
+  }
+  
+  return suites;
+}
+
+/**
+ * Render a report as JUnit XML
+ * @param {Object} report - Report
+ * @returns {string} XML document
+ */
+function toJUnitXml(report) {
+  const time = seconds => (seconds || 0).toFixed(3);
+  const lines = ['<?xml version="1.0" encoding="UTF-8"?>'];
+  lines.push(`<testsuites name="${encodeXml(report.source)}" tests="${report.totals.tests}" failures="${report.totals.failed}" errors="${report.totals.errors}" skipped="${report.totals.skipped}" time="${time(report.totals.durationSeconds)}" timestamp="${report.generated}">`);
+  
+  for (const suite of report.suites) {
+    const totals = summarize([suite]);
+    lines.push(`  <testsuite name="${encodeXml(suite.name)}" tests="${totals.tests}" failures="${totals.failed}" errors="${totals.errors}" skipped="${totals.skipped}" time="${time(totals.durationSeconds)}">`);
+    
+    for (const test of suite.tests) {
+      const location = `${test.file ? ` file="${encodeXml(test.file)}"` : ''}${test.line ? ` line="${test.line}"` : ''}`;
+      const open = `    <testcase classname="${encodeXml(suite.name)}" name="${encodeXml(test.name)}" time="${time(test.durationSeconds)}"${location}`;
+      
+      if (test.status === 'passed') {
+        lines.push(`${open}/>`);
+      } else if (test.status === 'skipped') {
+        lines.push(`${open}><skipped/></testcase>`);
+      } else {
+        const tag = test.status === 'error' ? 'error' : 'failure';
+        const type = test.quarantined ? ' type="quarantined"' : '';
+        lines.push(`${open}><${tag} message="${encodeXml((test.message || '').split('\n')[0])}"${type}>${encodeXml(test.message)}</${tag}></testcase>`);
+      }
+    }
+    
+    lines.push('  </testsuite>');
+  }
+  
+  lines.push('</testsuites>');
+  return `${lines.join('\n')}\n`;
+}
+
+/**
+ * Write a report as <source>.json and <source>.xml, and as latest.json and latest.xml
+ * @param {Object} report - Report
+ * @param {string} dir - Report directory
+ * @returns {Object} Result object with the written paths
+ */
+function writeReport(report, dir = getReportDir()) {
+  return trySync(() => {
+    fs.mkdirSync(dir, { recursive: true });
+    finalizeReport(report);
+    
+    const json = `${JSON.stringify(report, null, 2)}\n`;
+    const xml = toJUnitXml(report);
+    const written = {};
+    for (const name of [report.source, 'latest']) {
+      for (const [ext, content] of [['json', json], ['xml', xml]]) {
+        const file = path.join(dir, `${name}.${ext}`);
+        fs.writeFileSync(`${file}.tmp`, content);
+        fs.renameSync(`${file}.tmp`, file);
+        written[`${name}.${ext}`] = file;
+      }
+    }
+    return written;
+  });
+}
+
+/**
+ * Load a report
+ * @param {string} name - Report source, or "latest"
+ * @param {string} dir - Report directory
+ * @returns {Object} Result object with the report
+ */
+function loadReport(name = 'latest', dir = getReportDir()) {
+  return trySync(() => JSON.parse(fs.readFileSync(path.join(dir, `${name}.json`), 'utf8')));
+}
+
+/**
+ * Get the test watcher status file
+ * @returns {string} Absolute path
+ */
+function getWatchStatusFile() {
+  return path.resolve(PROJECT_ROOT, configUtils.get('development.testing.watch.statusFile', '.cache/test-watch.json'));
+}
+
+/**
+ * Save the test watcher status
+ * @param {Object} status - Watcher status
+ * @returns {Object} Result object with the written path
+ */
+function saveWatchStatus(status) {
+  return trySync(() => {
+    const file = getWatchStatusFile();
+    fs.mkdirSync(path.dirname(file), { recursive: true });
+    fs.writeFileSync(`${file}.tmp`, `${JSON.stringify(status, null, 2)}\n`);
+    fs.renameSync(`${file}.tmp`, file);
+    return file;
+  });
+}
+
+/**
+ * Load the test watcher status
+ * A watcher that exited without saying so is reported as stopped.
+ * @returns {Object} Result object with the status
+ */
+function loadWatchStatus() {
+  return trySync(() => {
+    const status = JSON.parse(fs.readFileSync(getWatchStatusFile(), 'utf8'));
+    if (status.state !== 'stopped' && !trySync(() => process.kill(status.pid, 0)).success) {
+      status.state = 'stopped';
+      status.running = [];
+    }
+    return status;
+  });
+}
+
+module.exports = {
+  getReportDir,
+  createTest,
+  createReport,
+  finalizeReport,
+  summarize,
+  fromGoTestEvents,
+  fromJestJson,
+  fromJUnitXml,
+  fromCargoOutput,
+  fromLibtestJson,
+  toJUnitXml,
+  parseAttributes,
+  writeReport,
+  loadReport,
+  getWatchStatusFile,
+  saveWatchStatus,
+  loadWatchStatus
+};
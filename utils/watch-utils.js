@@ -0,0 +1,360 @@
+/**
+ * Watch Utilities
+ * Debounced filesystem watching that honours excludeDirs and falls back to polling
+ */
+
+const fs = require('fs');
+const path = require('path');
+const EventEmitter = require('events');
+const { trySync } = require('./error-utils');
+const configUtils = require('./config-utils');
+
+// Defaults used when neither options nor configuration provide values
+const DEFAULT_DEBOUNCE_MS = 250;
+const DEFAULT_RESCAN_INTERVAL_SECONDS = 30;
+
+/**
+ * Directory watcher emitting normalized change events
+ *
+ * Events:
+ * - `change` ({ type, path, relativePath, isDirectory, size, modified }) for each change
+ * - `batch` (Array of changes) once per debounced flush
+ * - `mode` ('watch' | 'poll') when the watcher starts or falls back to polling
+ * - `error` (Error) when the native watcher fails
+ */
+class DirectoryWatcher extends EventEmitter {
+  /**
+   * Create a new directory watcher
+   * @param {string} rootDir - Directory to watch
+   * @param {Object} options - Watcher options
+   * @param {number} options.debounceMs - Delay used to coalesce bursts of events
+   * @param {number} options.rescanIntervalSeconds - Interval for polling rescans
+   * @param {boolean} options.forcePolling - Skip native watching and poll instead
+   * @param {Function} options.isExcluded - Predicate on a relative path (defaults to excludeDirs)
+   */
+  constructor(rootDir, options = {}) {
+    super();
+    this.rootDir = path.resolve(rootDir);
+    this.debounceMs = options.debounceMs ?? DEFAULT_DEBOUNCE_MS;
+    this.rescanIntervalSeconds = options.rescanIntervalSeconds ?? DEFAULT_RESCAN_INTERVAL_SECONDS;
+    this.forcePolling = options.forcePolling === true;
+    this.isExcluded = options.isExcluded || isExcludedPath;
+    
+    this.mode = null;
+    this.snapshot = new Map();
+    this.pending = new Set();
+    this.fsWatcher = null;
+    this.debounceTimer = null;
+    this.rescanTimer = null;
+  }
+  
+  /**
+   * Start watching
+   * @returns {string} Active mode ('watch' or 'poll')
+   */
+  start() {
+    if (this.mode) return this.mode;
+    
+    this.snapshot = scanSnapshot(this.rootDir, this.isExcluded);
+    
+    if (!this.forcePolling && this.startNativeWatcher()) {
+      this.mode = 'watch';
+    } else {
+      this.startPolling();
+    }
+    
+    this.emit('mode', this.mode);
+    return this.mode;
+  }
+  
+  /**
+   * Stop watching and release all timers and handles
+   */
+  stop() {
+    if (this.fsWatcher) {
+      this.fsWatcher.close();
+      this.fsWatcher = null;
+    }
+    
+    clearTimeout(this.debounceTimer);
+    clearInterval(this.rescanTimer);
+    this.debounceTimer = null;
+    this.rescanTimer = null;
+    this.pending.clear();
+    this.mode = null;
+  }
+  
+  /**
+   * Start the native recursive watcher
+   * @returns {boolean} True if native watching is available
+   */
+  startNativeWatcher() {
+    const result = trySync(() => fs.watch(this.rootDir, { recursive: true }, (eventType, filename) => {
+      if (!filename) {
+        // Some platforms omit the filename; fall back to a full rescan
+        this.scheduleRescan();
+        return;
+      }
+      
+      const relativePath = filename.toString();
+      if (this.isExcluded(relativePath)) return;
+      
+      this.pending.add(relativePath);
+      this.scheduleFlush();
+    }));
+    
+    if (!result.success) return false;
+    
+    this.fsWatcher = result.value;
+    this.fsWatcher.on('error', (err) => {
+      this.emit('error', err);
+      this.fsWatcher.close();
+      this.fsWatcher = null;
+      this.startPolling();
+      this.emit('mode', this.mode);
+    });
+    
+    return true;
+  }
+  
+  /**
+   * Start periodic rescans
+   */
+  startPolling() {
+    this.mode = 'poll';
+    clearInterval(this.rescanTimer);
+    this.rescanTimer = setInterval(() => this.rescan(), this.rescanIntervalSeconds * 1000);
+    
+    // Do not keep the process alive just for polling
+    if (this.rescanTimer.unref) this.rescanTimer.unref();
+  }
+  
+  /**
+   * Schedule a debounced flush of pending paths
+   */
+  scheduleFlush() {
+    clearTimeout(this.debounceTimer);
+    this.debounceTimer = setTimeout(() => this.flush(), this.debounceMs);
+  }
+  
+  /**
+   * Schedule a debounced full rescan
+   */
+  scheduleRescan() {
+    clearTimeout(this.debounceTimer);
+    this.debounceTimer = setTimeout(() => this.rescan(), this.debounceMs);
+  }
+  
+  /**
+   * Resolve pending paths against the snapshot and emit changes
+   */
+  flush() {
+    const changes = [];
+    const paths = Array.from(this.pending).sort();
+    this.pending.clear();
+    
+    for (const relativePath of paths) {
+      const absPath = path.join(this.rootDir, relativePath);
+      const stats = trySync(() => fs.statSync(absPath));
+      const previous = this.snapshot.get(relativePath);
+      
+      if (!stats.success) {
+        if (previous) {
+          changes.push(...this.removeEntry(relativePath));
+        }
+        continue;
+      }
+      
+      const entry = toEntry(stats.value);
+      
+      if (!previous) {
+        changes.push(...this.addEntry(relativePath, entry));
+      } else if (!entry.isDirectory && (previous.size !== entry.size || previous.mtimeMs !== entry.mtimeMs)) {
+        this.snapshot.set(relativePath, entry);
+        changes.push(this.toChange('modify', relativePath, entry));
+      }
+    }
+    
+    this.emitChanges(changes);
+  }
+  
+  /**
+   * Rescan the whole tree and emit the differences
+   */
+  rescan() {
+    const current = scanSnapshot(this.rootDir, this.isExcluded);
+    const changes = [];
+    
+    for (const [relativePath, entry] of current) {
+      const previous = this.snapshot.get(relativePath);
+      
+      if (!previous) {
+        changes.push(this.toChange('add', relativePath, entry));
+      } else if (!entry.isDirectory && (previous.size !== entry.size || previous.mtimeMs !== entry.mtimeMs)) {
+        changes.push(this.toChange('modify', relativePath, entry));
+      }
+    }
+    
+    for (const [relativePath, entry] of this.snapshot) {
+      if (!current.has(relativePath)) {
+        changes.push(this.toChange('remove', relativePath, entry));
+      }
+    }
+    
+    this.snapshot = current;
+    this.emitChanges(changes);
+  }
+  
+  /**
+   * Record an added path, including the contents of added directories
+   * @param {string} relativePath - Path relative to the root
+   * @param {Object} entry - Snapshot entry
+   * @returns {Array} Changes
+   */
+  addEntry(relativePath, entry) {
+    this.snapshot.set(relativePath, entry);
+    const changes = [this.toChange('add', relativePath, entry)];
+    
+    if (entry.isDirectory) {
+      const nested = scanSnapshot(path.join(this.rootDir, relativePath), this.isExcluded, relativePath);
+      for (const [nestedPath, nestedEntry] of nested) {
+        if (this.snapshot.has(nestedPath)) continue;
+        this.snapshot.set(nestedPath, nestedEntry);
+        changes.push(this.toChange('add', nestedPath, nestedEntry));
+      }
+    }
+    
+    return changes;
+  }
+  
+  /**
+   * Forget a removed path and everything below it
+   * @param {string} relativePath - Path relative to the root
+   * @returns {Array} Changes
+   */
+  removeEntry(relativePath) {
+    const changes = [];
+    const prefix = relativePath + path.sep;
+    
+    for (const [knownPath, entry] of this.snapshot) {
+      if (knownPath.startsWith(prefix)) {
+        this.snapshot.delete(knownPath);
+        changes.push(this.toChange('remove', knownPath, entry));
+      }
+    }
+    
+    const entry = this.snapshot.get(relativePath);
+    this.snapshot.delete(relativePath);
+    changes.push(this.toChange('remove', relativePath, entry));
+    
+    return changes;
+  }
+  
+  /**
+   * Build a change event
+   * @param {string} type - add, modify or remove
+   * @param {string} relativePath - Path relative to the root
+   * @param {Object} entry - Snapshot entry
+   * @returns {Object} Change event
+   */
+  toChange(type, relativePath, entry) {
+    return {
+      type,
+      path: path.join(this.rootDir, relativePath),
+      relativePath,
+      isDirectory: entry ? entry.isDirectory : false,
+      size: entry ? entry.size : 0,
+      modified: entry ? new Date(entry.mtimeMs) : null
+    };
+  }
+  
+  /**
+   * Emit individual and batched change events
+   * @param {Array} changes - Changes to emit
+   */
+  emitChanges(changes) {
+    if (changes.length === 0) return;
+    
+    for (const change of changes) {
+      this.emit('change', change);
+    }
+    
+    this.emit('batch', changes);
+  }
+}
+
+/**
+ * Check whether any segment of a relative path is an excluded directory
+ * @param {string} relativePath - Path relative to the watched root
+ * @returns {boolean} True if the path should be ignored
+ */
+function isExcludedPath(relativePath) {
+  return relativePath.split(/[\\/]/).some(segment => configUtils.isExcludedDir(segment));
+}
+
+/**
+ * Convert fs.Stats into a snapshot entry
+ * @param {fs.Stats} stats - File stats
+ * @returns {Object} Snapshot entry
+ */
+function toEntry(stats) {
+  return {
+    isDirectory: stats.isDirectory(),
+    size: stats.isDirectory() ? 0 : stats.size,
+    mtimeMs: stats.mtimeMs
+  };
+}
+
+/**
+ * Build a snapshot of a directory tree
+ * @param {string} dir - Directory to scan
+ * @param {Function} isExcluded - Predicate on relative paths
+ * @param {string} base - Relative path prefix for entries
+ * @returns {Map<string, Object>} Relative path to snapshot entry
+ */
+function scanSnapshot(dir, isExcluded = isExcludedPath, base = '') {
+  const snapshot = new Map();
+  
+  function scan(currentDir, currentBase) {
+    const entries = trySync(() => fs.readdirSync(currentDir, { withFileTypes: true }), []).value;
+    
+    for (const entry of entries) {
+      const relativePath = currentBase ? path.join(currentBase, entry.name) : entry.name;
+      if (isExcluded(relativePath)) continue;
+      
+      const absPath = path.join(currentDir, entry.name);
+      const stats = trySync(() => fs.statSync(absPath));
+      if (!stats.success) continue;
+      
+      snapshot.set(relativePath, toEntry(stats.value));
+      
+      if (stats.value.isDirectory()) {
+        scan(absPath, relativePath);
+      }
+    }
+  }
+  
+  scan(dir, base);
+  return snapshot;
+}
+
+/**
+ * Create and start a directory watcher
+ * @param {string} rootDir - Directory to watch
+ * @param {Object} options - Watcher options (see DirectoryWatcher)
+ * @returns {DirectoryWatcher} Started watcher
+ */
+function watchDirectory(rootDir, options = {}) {
+  const watcher = new DirectoryWatcher(rootDir, options);
+  watcher.start();
+  return watcher;
+}
+
+module.exports = {
+  DirectoryWatcher,
+  watchDirectory,
+  scanSnapshot,
+  isExcludedPath,
+  DEFAULT_DEBOUNCE_MS,
+  DEFAULT_RESCAN_INTERVAL_SECONDS
+};